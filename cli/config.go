@@ -1,9 +1,19 @@
 package cli
 
 import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
 	"github.com/netresearch/ofelia/core"
 	"github.com/netresearch/ofelia/middlewares"
 
+	docker "github.com/fsouza/go-dockerclient"
 	defaults "github.com/mcuadros/go-defaults"
 	gcfg "gopkg.in/gcfg.v1"
 )
@@ -19,18 +29,96 @@ const (
 // Config contains the configuration
 type Config struct {
 	Global struct {
-		middlewares.SlackConfig `mapstructure:",squash"`
-		middlewares.SaveConfig  `mapstructure:",squash"`
-		middlewares.MailConfig  `mapstructure:",squash"`
+		middlewares.SlackConfig     `mapstructure:",squash"`
+		middlewares.DiscordConfig   `mapstructure:",squash"`
+		middlewares.TeamsConfig     `mapstructure:",squash"`
+		middlewares.GotifyConfig    `mapstructure:",squash"`
+		middlewares.PagerDutyConfig `mapstructure:",squash"`
+		middlewares.WebhookConfig   `mapstructure:",squash"`
+		middlewares.SaveConfig      `mapstructure:",squash"`
+		middlewares.MailConfig      `mapstructure:",squash"`
+		middlewares.StatsDConfig    `mapstructure:",squash"`
+		middlewares.RedactConfig    `mapstructure:",squash"`
+		DefaultJitter               string `gcfg:"default-jitter" mapstructure:"default-jitter"`
+		// NotificationBatchWindow groups the failures notified by the global
+		// Slack, mail and webhook notifiers within the window
+		NotificationBatchWindow string `gcfg:"notification-batch-window" mapstructure:"notification-batch-window"`
+		// DockerTLSCert, DockerTLSKey and DockerTLSCA secure the connection to
+		// the global Docker daemon, its certificate is verified unless
+		// DockerTLSVerify is false
+		DockerTLSCert   string `gcfg:"docker-tls-cert" mapstructure:"docker-tls-cert"`
+		DockerTLSKey    string `gcfg:"docker-tls-key" mapstructure:"docker-tls-key"`
+		DockerTLSCA     string `gcfg:"docker-tls-ca" mapstructure:"docker-tls-ca"`
+		DockerTLSVerify string `gcfg:"docker-tls-verify" mapstructure:"docker-tls-verify"`
+		// DockerRetryAttempts is the number of attempts of the Docker calls
+		// failing with a transient error, only the ones reading the state of
+		// the daemon are retried
+		DockerRetryAttempts int `gcfg:"docker-retry-attempts" mapstructure:"docker-retry-attempts"`
+		// DockerMaxOpsPerSecond limits the rate of the containers, execs and
+		// services created and started by the jobs, per Docker daemon,
+		// unlimited if zero
+		DockerMaxOpsPerSecond float64 `gcfg:"docker-max-ops-per-second" mapstructure:"docker-max-ops-per-second"`
+		// DockerPullTimeout and DockerInspectTimeout bound each pull of an
+		// image and each inspect of a container, unlimited if empty
+		DockerPullTimeout    string `gcfg:"docker-pull-timeout" mapstructure:"docker-pull-timeout"`
+		DockerInspectTimeout string `gcfg:"docker-inspect-timeout" mapstructure:"docker-inspect-timeout"`
+		// MaxOutput is the size of the output kept of each stream of the
+		// jobs without their own max-output
+		MaxOutput string `gcfg:"max-output" mapstructure:"max-output"`
+		// LogFormat is the format of the logs of the daemon, text or json
+		LogFormat string `gcfg:"log-format" mapstructure:"log-format"`
+		// RunPastAt runs the jobs scheduled @at a past time at startup
+		// instead of rejecting them
+		RunPastAt bool `gcfg:"run-past-at" mapstructure:"run-past-at"`
+		// SweepContainers is the age above which the stopped containers of
+		// the run jobs are removed at startup, disabled if empty
+		SweepContainers string `gcfg:"sweep-containers" mapstructure:"sweep-containers"`
+		// DockerWaitTimeout is how long the global Docker daemon is waited
+		// for at startup, it is checked once if empty
+		DockerWaitTimeout string `gcfg:"docker-wait-timeout" mapstructure:"docker-wait-timeout"`
+		// StartWithoutDocker starts the scheduler even if the global Docker
+		// daemon isn't ready, its jobs fail until it is
+		StartWithoutDocker bool `gcfg:"start-without-docker" mapstructure:"start-without-docker"`
+		// ReloadWebhook receives the changes of the jobs applied by the
+		// reloads of the config file and the updates of the Docker labels
+		ReloadWebhook string `gcfg:"reload-webhook" mapstructure:"reload-webhook"`
+		// ShutdownTimeout is how long the running jobs are waited for on
+		// shutdown before being force-stopped, without limit if empty
+		ShutdownTimeout string `gcfg:"shutdown-timeout" mapstructure:"shutdown-timeout"`
+		// TriggerSocket is the path of a Unix socket running the jobs named
+		// on the lines written to it, disabled if empty
+		TriggerSocket string `gcfg:"trigger-socket" mapstructure:"trigger-socket"`
+		// LabelNamespace limits the Docker labels read to the ones under
+		// `ofelia.<namespace>.`, for several instances sharing a host
+		LabelNamespace string `gcfg:"label-namespace" mapstructure:"label-namespace"`
+		// MaintenanceWindows are the periods, a schedule followed by a
+		// duration, during which the scheduled executions are skipped or
+		// deferred according to MaintenancePolicy
+		MaintenanceWindows []string `gcfg:"maintenance-window" mapstructure:"maintenance-window"`
+		MaintenancePolicy  string   `gcfg:"maintenance-policy" mapstructure:"maintenance-policy"`
+		// MissingEnv is what the references to unset environment variables
+		// expand to: empty, the default, or error
+		MissingEnv string `gcfg:"missing-env" mapstructure:"missing-env"`
 	}
-	ExecJobs      map[string]*ExecJobConfig    `gcfg:"job-exec" mapstructure:"job-exec,squash"`
-	RunJobs       map[string]*RunJobConfig     `gcfg:"job-run" mapstructure:"job-run,squash"`
-	ServiceJobs   map[string]*RunServiceConfig `gcfg:"job-service-run" mapstructure:"job-service-run,squash"`
-	LocalJobs     map[string]*LocalJobConfig   `gcfg:"job-local" mapstructure:"job-local,squash"`
-	Docker        DockerConfig
-	sh            *core.Scheduler
-	dockerHandler *DockerHandler
-	logger        core.Logger
+	ExecJobs      map[string]*ExecJobConfig      `gcfg:"job-exec" mapstructure:"job-exec,squash"`
+	RunJobs       map[string]*RunJobConfig       `gcfg:"job-run" mapstructure:"job-run,squash"`
+	ServiceJobs   map[string]*RunServiceConfig   `gcfg:"job-service-run" mapstructure:"job-service-run,squash"`
+	LocalJobs     map[string]*LocalJobConfig     `gcfg:"job-local" mapstructure:"job-local,squash"`
+	RegistryAuths map[string]*RegistryAuthConfig `gcfg:"registry-auth" mapstructure:"-"`
+	// DockerEndpoints are the Docker daemons the jobs can select by name
+	// with docker-endpoint
+	DockerEndpoints map[string]*DockerEndpointConfig `gcfg:"docker-endpoint" mapstructure:"-"`
+	Docker          DockerConfig
+	sh              *core.Scheduler
+	dockerHandler   *DockerHandler
+	logger          core.Logger
+	batchers        []*middlewares.NotificationBatcher
+	dockerClients   map[string]*docker.Client
+	// dockerOptions are the options of the calls to each client
+	dockerOptions map[*docker.Client]*core.DockerOptions
+	// fileJobs are the jobs defined in the config file, the ones changed
+	// when the file is reloaded
+	fileJobs map[jobKey]bool
 }
 
 func NewConfig(logger core.Logger) *Config {
@@ -46,11 +134,148 @@ func NewConfig(logger core.Logger) *Config {
 	return c
 }
 
-// BuildFromFile builds a scheduler using the config from a file
+// BuildFromFile builds a scheduler using the config from a file, in the
+// format matching its extension
 func BuildFromFile(filename string, logger core.Logger) (*Config, error) {
+	return BuildFromFileFormat(filename, "", logger)
+}
+
+// BuildFromFileFormat builds a scheduler using the config from a file in the
+// given format, `ini` or `yaml`, or detected from the extension if empty. A
+// directory is read with BuildFromDir.
+func BuildFromFileFormat(filename, format string, logger core.Logger) (*Config, error) {
+	if fi, err := os.Stat(filename); err == nil && fi.IsDir() {
+		return BuildFromDir(filename, logger)
+	}
+
 	c := NewConfig(logger)
-	err := gcfg.ReadFileInto(c, filename)
-	return c, err
+	format, err := configFormat(filename, format)
+	if err != nil {
+		return c, err
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return c, err
+	}
+
+	if format == configFormatYAML {
+		err = c.readYAML(data)
+	} else {
+		err = gcfg.ReadStringInto(c, string(data))
+	}
+
+	if err != nil {
+		return c, err
+	}
+
+	if err := c.expandConfigEnv(); err != nil {
+		return c, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	return c, nil
+}
+
+// BuildFromDir builds a scheduler using the `*.ini` files of a directory,
+// read in sorted order into the same config: the global options of a file,
+// the lists included, override the ones of the previous files, and a job
+// defined in several files is merged, with a warning, its options overridden
+// and its lists appended
+func BuildFromDir(dir string, logger core.Logger) (*Config, error) {
+	c := NewConfig(logger)
+	files, err := filepath.Glob(filepath.Join(dir, "*.ini"))
+	if err != nil {
+		return c, err
+	}
+
+	if len(files) == 0 {
+		return c, fmt.Errorf("no *.ini file in %q", dir)
+	}
+
+	// the file defining each job first
+	defined := make(map[jobKey]string)
+	for _, filename := range files {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return c, err
+		}
+
+		config := string(data)
+		own := NewConfig(logger)
+		if err := gcfg.ReadStringInto(own, config); err != nil {
+			return c, fmt.Errorf("%s: %w", filename, err)
+		}
+
+		for _, key := range sortedJobKeys(own.fileJobKeys()) {
+			if first, ok := defined[key]; ok {
+				logger.Warningf("%s %q is defined in %q and %q, merging them", key.Type, key.Name, first, filename)
+				continue
+			}
+
+			defined[key] = filename
+		}
+
+		// gcfg appends the values of the multi-valued options, the global
+		// ones read from the file are merged afterwards to replace them
+		global, dockerConfig := c.Global, c.Docker
+		if err := gcfg.ReadStringInto(c, config); err != nil {
+			return c, fmt.Errorf("%s: %w", filename, err)
+		}
+
+		c.Global, c.Docker = global, dockerConfig
+		overrideOptions(reflect.ValueOf(&c.Global).Elem(), reflect.ValueOf(&own.Global).Elem())
+		overrideOptions(reflect.ValueOf(&c.Docker).Elem(), reflect.ValueOf(&own.Docker).Elem())
+	}
+
+	// the variables are expanded once the files are merged
+	if err := c.expandConfigEnv(); err != nil {
+		return c, fmt.Errorf("%s: %w", dir, err)
+	}
+
+	return c, nil
+}
+
+// overrideOptions sets the fields of dst to the ones of src set in a file,
+// the lists included. The options set to their zero value, e.g. false, are
+// indistinguishable from the unset ones and don't override dst.
+func overrideOptions(dst, src reflect.Value) {
+	for i := 0; i < dst.NumField(); i++ {
+		d, v := dst.Field(i), src.Field(i)
+		switch {
+		case !d.CanSet():
+		case d.Kind() == reflect.Struct:
+			overrideOptions(d, v)
+		case !v.IsZero():
+			d.Set(v)
+		}
+	}
+}
+
+// sortedJobKeys returns the keys sorted by type and name
+func sortedJobKeys(keys map[jobKey]bool) []jobKey {
+	sorted := make([]jobKey, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Type != sorted[j].Type {
+			return sorted[i].Type < sorted[j].Type
+		}
+
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	return sorted
+}
+
+// configPath returns the config directory if set, the config file otherwise
+func configPath(file, dir string) string {
+	if dir != "" {
+		return dir
+	}
+
+	return file
 }
 
 // BuildFromString builds a scheduler using the config from a string
@@ -59,27 +284,81 @@ func BuildFromString(config string, logger core.Logger) (*Config, error) {
 	if err := gcfg.ReadStringInto(c, config); err != nil {
 		return nil, err
 	}
+
+	if err := c.expandConfigEnv(); err != nil {
+		return nil, err
+	}
 	return c, nil
 }
 
 // Call this only once at app init
 func (c *Config) InitializeApp() error {
 	c.sh = core.NewScheduler(c.logger)
-	c.buildSchedulerMiddlewares(c.sh)
+	if err := c.buildSchedulerMiddlewares(c.sh); err != nil {
+		return err
+	}
 
 	var err error
-	c.dockerHandler, err = NewDockerHandler(c, c.logger, c.Docker.Filters)
+	if c.sh.DefaultJitter, err = c.defaultJitter(); err != nil {
+		return err
+	}
+
+	c.sh.DefaultMaxOutput, err = core.ParseMaxOutput(c.Global.MaxOutput, 0)
+	if err != nil {
+		return err
+	}
+
+	c.sh.RegistryAuths = c.buildRegistryAuths()
+	c.sh.RunPastAt = c.Global.RunPastAt
+
+	if c.sh.MaintenanceWindows, err = c.maintenanceWindows(); err != nil {
+		return err
+	}
+	c.sh.MaintenancePolicy = c.Global.MaintenancePolicy
+
+	if _, err := c.shutdownTimeout(); err != nil {
+		return err
+	}
+
+	if _, _, err := c.dockerTimeouts(); err != nil {
+		return err
+	}
+
+	dockerTLS, err := c.dockerTLS()
 	if err != nil {
 		return err
 	}
 
+	ready, err := c.dockerReadiness()
+	if err != nil {
+		return err
+	}
+
+	prefix, err := c.labelPrefix()
+	if err != nil {
+		return err
+	}
+
+	c.dockerHandler, err = NewDockerHandler(c, c.logger, c.Docker.Host, dockerTLS, c.Docker.Filters, prefix, ready, c.newDockerOptions())
+	if err != nil {
+		return err
+	}
+
+	if err := c.sweepContainers(); err != nil {
+		return err
+	}
+
 	// In order to support non dynamic job types such as Local or Run using labels
 	// lets parse the labels and merge the job lists
+	c.fileJobs = c.fileJobKeys()
 	dockerLabels, err := c.dockerHandler.GetDockerLabels()
-	if err == nil {
-		parsedLabelConfig := Config{}
+	parsedLabelConfig := Config{}
+	parsedLabelConfig.Global.MissingEnv = c.Global.MissingEnv
+	if err == nil && parsedLabelConfig.readDockerLabels(dockerLabels, c.logger) {
+		for key := range parsedLabelConfig.fileJobKeys() {
+			delete(c.fileJobs, key)
+		}
 
-		parsedLabelConfig.buildFromDockerLabels(dockerLabels)
 		for name, j := range parsedLabelConfig.RunJobs {
 			c.RunJobs[name] = j
 		}
@@ -93,50 +372,671 @@ func (c *Config) InitializeApp() error {
 		}
 	}
 
+	if err := c.validateNotifications(); err != nil {
+		return err
+	}
+
+	if err := c.validateDockerEndpoints(); err != nil {
+		return err
+	}
+
 	for name, j := range c.ExecJobs {
 		defaults.SetDefaults(j)
-		j.Client = c.dockerHandler.GetInternalDockerClient()
+		j.Client, j.Docker = c.dockerTarget(j.DockerEndpoint, j.DockerHost)
 		j.Name = name
 		j.buildMiddlewares()
-		c.sh.AddJob(j)
+		if !c.addJob(jobExec, name, j) {
+			delete(c.ExecJobs, name)
+		}
 	}
 
 	for name, j := range c.RunJobs {
 		defaults.SetDefaults(j)
-		j.Client = c.dockerHandler.GetInternalDockerClient()
+		j.Client, j.Docker = c.dockerTarget(j.DockerEndpoint, j.DockerHost)
 		j.Name = name
 		j.buildMiddlewares()
-		c.sh.AddJob(j)
+		if !c.addJob(jobRun, name, j) {
+			delete(c.RunJobs, name)
+		}
 	}
 
 	for name, j := range c.LocalJobs {
 		defaults.SetDefaults(j)
 		j.Name = name
 		j.buildMiddlewares()
-		c.sh.AddJob(j)
+		if !c.addJob(jobLocal, name, j) {
+			delete(c.LocalJobs, name)
+		}
 	}
 
 	for name, j := range c.ServiceJobs {
 		defaults.SetDefaults(j)
 		j.Name = name
-		j.Client = c.dockerHandler.GetInternalDockerClient()
+		j.Client, j.Docker = c.dockerTarget(j.DockerEndpoint, j.DockerHost)
 		j.buildMiddlewares()
-		c.sh.AddJob(j)
+		if !c.addJob(jobServiceRun, name, j) {
+			delete(c.ServiceJobs, name)
+		}
+	}
+
+	for _, w := range c.disabledMiddlewareWarnings() {
+		c.logger.Warningf("%s", w)
+	}
+
+	return nil
+}
+
+// addJob adds a job of the config to the scheduler, logging why it is
+// rejected, e.g. an invalid option, in which case it returns false and the
+// job must be left out of the config. The secrets and configs of the service
+// jobs are looked up in the swarm.
+func (c *Config) addJob(typ, name string, j core.Job) bool {
+	if err := c.sh.AddJob(j); err != nil {
+		c.logger.Errorf("Can't add %s %q: %s", typ, name, err)
+		delete(c.fileJobs, jobKey{typ, name})
+		return false
+	}
+
+	// the swarm secrets and configs are only needed by the executions, the
+	// missing ones are warned about so they can be created in the meantime
+	if s, ok := j.(*RunServiceConfig); ok {
+		if err := s.CheckSwarmRefs(); err != nil {
+			c.logger.Warningf("%s %q: %s", typ, name, err)
+		}
+	}
+
+	return true
+}
+
+// sharedScheduleThreshold is the number of jobs sharing the same schedule
+// without jitter above which they are reported by the validation
+const sharedScheduleThreshold = 5
+
+// schedulesWithoutJitter returns the names of the jobs without jitter indexed
+// by schedule, for the schedules shared by at least sharedScheduleThreshold
+// of them. Since these jobs fire at the exact same instant they may overload
+// the Docker daemon.
+func (c *Config) schedulesWithoutJitter() map[string][]string {
+	if c.Global.DefaultJitter != "" {
+		return nil
+	}
+
+	bySchedule := make(map[string][]string)
+	c.eachJob(func(name string, j core.Job) {
+		if j.GetSchedulingOptions().Jitter == "" && j.GetSchedule() != "" {
+			bySchedule[j.GetSchedule()] = append(bySchedule[j.GetSchedule()], name)
+		}
+	})
+
+	for schedule, names := range bySchedule {
+		if len(names) < sharedScheduleThreshold {
+			delete(bySchedule, schedule)
+			continue
+		}
+
+		sort.Strings(names)
+	}
+
+	return bySchedule
+}
+
+// notificationConfig is implemented by the notification configs which can
+// be checked when loading the config
+type notificationConfig interface {
+	Validate() error
+}
+
+// validateNotifications checks the notification configs of the global
+// section and of the jobs, such as the webhook payload templates, so a
+// mistake is reported when loading the config instead of when sending a
+// notification
+func (c *Config) validateNotifications() error {
+	global := []notificationConfig{
+		&c.Global.WebhookConfig, &c.Global.GotifyConfig, &c.Global.PagerDutyConfig, &c.Global.MailConfig, &c.Global.RedactConfig,
+	}
+	for _, nc := range global {
+		if err := nc.Validate(); err != nil {
+			return fmt.Errorf("global: %w", err)
+		}
+	}
+
+	configs := make(map[string][]notificationConfig)
+	for name, j := range c.ExecJobs {
+		configs[name] = []notificationConfig{&j.WebhookConfig, &j.GotifyConfig, &j.PagerDutyConfig, &j.MailConfig}
+	}
+
+	for name, j := range c.RunJobs {
+		configs[name] = []notificationConfig{&j.WebhookConfig, &j.GotifyConfig, &j.PagerDutyConfig, &j.MailConfig}
+	}
+
+	for name, j := range c.LocalJobs {
+		configs[name] = []notificationConfig{&j.WebhookConfig, &j.GotifyConfig, &j.PagerDutyConfig, &j.MailConfig}
+	}
+
+	for name, j := range c.ServiceJobs {
+		configs[name] = []notificationConfig{&j.WebhookConfig, &j.GotifyConfig, &j.PagerDutyConfig, &j.MailConfig}
+	}
+
+	for name, ncs := range configs {
+		for _, nc := range ncs {
+			if err := nc.Validate(); err != nil {
+				return fmt.Errorf("job %q: %w", name, err)
+			}
+		}
 	}
 
 	return nil
 }
 
-func (c *Config) buildSchedulerMiddlewares(sh *core.Scheduler) {
-	sh.Use(middlewares.NewSlack(&c.Global.SlackConfig))
-	sh.Use(middlewares.NewSave(&c.Global.SaveConfig))
-	sh.Use(middlewares.NewMail(&c.Global.MailConfig))
+// mailTLSWarnings returns the likely mistakes in the SMTP TLS settings, by
+// section
+func (c *Config) mailTLSWarnings() map[string]string {
+	configs := map[string]*middlewares.MailConfig{"global": &c.Global.MailConfig}
+	for name, j := range c.ExecJobs {
+		configs[fmt.Sprintf("job %q", name)] = &j.MailConfig
+	}
+
+	for name, j := range c.RunJobs {
+		configs[fmt.Sprintf("job %q", name)] = &j.MailConfig
+	}
+
+	for name, j := range c.LocalJobs {
+		configs[fmt.Sprintf("job %q", name)] = &j.MailConfig
+	}
+
+	for name, j := range c.ServiceJobs {
+		configs[fmt.Sprintf("job %q", name)] = &j.MailConfig
+	}
+
+	warnings := make(map[string]string)
+	for section, mc := range configs {
+		if w := mc.TLSWarning(); w != "" {
+			warnings[section] = w
+		}
+	}
+
+	return warnings
+}
+
+// eachJob calls f for every configured job, regardless of its type
+func (c *Config) eachJob(f func(name string, j core.Job)) {
+	for name, j := range c.ExecJobs {
+		f(name, j)
+	}
+
+	for name, j := range c.RunJobs {
+		f(name, j)
+	}
+
+	for name, j := range c.LocalJobs {
+		f(name, j)
+	}
+
+	for name, j := range c.ServiceJobs {
+		f(name, j)
+	}
+}
+
+// buildRegistryAuths returns the credentials of the registry-auth sections
+// indexed by registry host
+func (c *Config) buildRegistryAuths() map[string]docker.AuthConfiguration {
+	auths := make(map[string]docker.AuthConfiguration, len(c.RegistryAuths))
+	for registry, a := range c.RegistryAuths {
+		auths[registry] = docker.AuthConfiguration{
+			Username:      a.Username,
+			Password:      a.Password,
+			ServerAddress: registry,
+		}
+	}
+
+	return auths
+}
+
+// readOnlyWithoutMounts returns the names of the run jobs with a read-only
+// root filesystem but neither tmpfs nor volume where the command could write
+func (c *Config) readOnlyWithoutMounts() []string {
+	var names []string
+	for name, j := range c.RunJobs {
+		if j.ReadOnly && j.Image != "" && len(j.Tmpfs) == 0 && len(j.Volume) == 0 {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// rootJobs returns the names of the Docker jobs running as root, the default
+// user, without allow-root. The run jobs starting an existing container keep
+// its user and are left out.
+func (c *Config) rootJobs() []string {
+	var names []string
+	check := func(name, user string, allowed bool) {
+		if !allowed && (user == "" || core.IsRootUser(user)) {
+			names = append(names, name)
+		}
+	}
+
+	for name, j := range c.ExecJobs {
+		check(name, j.User, j.AllowRoot)
+	}
+
+	for name, j := range c.RunJobs {
+		if j.Image != "" {
+			check(name, j.User, j.AllowRoot)
+		}
+	}
+
+	for name, j := range c.ServiceJobs {
+		check(name, j.User, j.AllowRoot)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// shells run the commands of the shell wrappers, such as `sh -c "a & b"`
+var shells = map[string]bool{"sh": true, "bash": true, "ash": true, "dash": true, "zsh": true}
+
+// shellWrappersWithoutInit returns the names of the run jobs without init
+// whose command is a shell wrapper, or is run with shell, such commands often
+// start children that are left as zombies without an init process reaping
+// them
+func (c *Config) shellWrappersWithoutInit() []string {
+	var names []string
+	for name, j := range c.RunJobs {
+		if j.Init || j.Image == "" {
+			continue
+		}
+
+		fields := strings.Fields(j.Command)
+		if j.Shell || len(fields) > 1 && shells[path.Base(fields[0])] && fields[1] == "-c" {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// dockerReadiness parses the docker-wait-timeout and start-without-docker
+// options
+func (c *Config) dockerReadiness() (dockerReadiness, error) {
+	ready := dockerReadiness{optional: c.Global.StartWithoutDocker}
+	if c.Global.DockerWaitTimeout == "" {
+		return ready, nil
+	}
+
+	timeout, err := time.ParseDuration(c.Global.DockerWaitTimeout)
+	if err != nil {
+		return ready, fmt.Errorf("invalid docker-wait-timeout %q: %w", c.Global.DockerWaitTimeout, err)
+	}
+
+	if timeout < 0 {
+		return ready, fmt.Errorf("invalid docker-wait-timeout %q, expected a positive duration", c.Global.DockerWaitTimeout)
+	}
+
+	ready.timeout = timeout
+	return ready, nil
+}
+
+// sweepAge parses the sweep-containers age, zero if the sweep is disabled
+func (c *Config) sweepAge() (time.Duration, error) {
+	if c.Global.SweepContainers == "" {
+		return 0, nil
+	}
+
+	age, err := time.ParseDuration(c.Global.SweepContainers)
+	if err != nil {
+		return 0, fmt.Errorf("invalid sweep-containers %q: %w", c.Global.SweepContainers, err)
+	}
+
+	if age <= 0 {
+		return 0, fmt.Errorf("invalid sweep-containers %q, expected a positive duration", c.Global.SweepContainers)
+	}
+
+	return age, nil
+}
+
+// shutdownTimeout parses the shutdown-timeout, zero if the running jobs are
+// waited for without limit
+func (c *Config) shutdownTimeout() (time.Duration, error) {
+	if c.Global.ShutdownTimeout == "" {
+		return 0, nil
+	}
+
+	timeout, err := time.ParseDuration(c.Global.ShutdownTimeout)
+	if err != nil {
+		return 0, fmt.Errorf("invalid shutdown-timeout %q: %w", c.Global.ShutdownTimeout, err)
+	}
+
+	if timeout <= 0 {
+		return 0, fmt.Errorf("invalid shutdown-timeout %q, expected a positive duration", c.Global.ShutdownTimeout)
+	}
+
+	return timeout, nil
+}
+
+// defaultJitter parses the default-jitter, zero if empty
+func (c *Config) defaultJitter() (time.Duration, error) {
+	if c.Global.DefaultJitter == "" {
+		return 0, nil
+	}
+
+	jitter, err := time.ParseDuration(c.Global.DefaultJitter)
+	if err != nil {
+		return 0, fmt.Errorf("invalid default-jitter %q: %w", c.Global.DefaultJitter, err)
+	}
+
+	if jitter < 0 {
+		return 0, fmt.Errorf("invalid default-jitter %q, can't be negative", c.Global.DefaultJitter)
+	}
+
+	return jitter, nil
+}
+
+// dockerTimeouts parses the docker-pull-timeout and docker-inspect-timeout,
+// zero if unlimited
+func (c *Config) dockerTimeouts() (pull, inspect time.Duration, err error) {
+	if pull, err = parseDockerTimeout("docker-pull-timeout", c.Global.DockerPullTimeout); err != nil {
+		return 0, 0, err
+	}
+
+	if inspect, err = parseDockerTimeout("docker-inspect-timeout", c.Global.DockerInspectTimeout); err != nil {
+		return 0, 0, err
+	}
+
+	return pull, inspect, nil
+}
+
+func parseDockerTimeout(option, value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", option, value, err)
+	}
+
+	if timeout <= 0 {
+		return 0, fmt.Errorf("invalid %s %q, expected a positive duration", option, value)
+	}
+
+	return timeout, nil
+}
+
+// maintenanceWindows parses the maintenance-window options, checking the
+// maintenance-policy applied to them
+func (c *Config) maintenanceWindows() ([]core.MaintenanceWindow, error) {
+	if err := core.ValidateMaintenancePolicy(c.Global.MaintenancePolicy); err != nil {
+		return nil, err
+	}
+
+	var windows []core.MaintenanceWindow
+	for _, spec := range c.Global.MaintenanceWindows {
+		w, err := core.ParseMaintenanceWindow(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		windows = append(windows, w)
+	}
+
+	return windows, nil
+}
+
+// labelPrefix returns the prefix of the Docker labels read, `ofelia` or
+// `ofelia.<namespace>` with label-namespace
+func (c *Config) labelPrefix() (string, error) {
+	ns := c.Global.LabelNamespace
+	if ns == "" {
+		return labelPrefix, nil
+	}
+
+	if !labelNamespacePattern.MatchString(ns) {
+		return "", fmt.Errorf("invalid label-namespace %q, expected letters, digits, - and _", ns)
+	}
+
+	switch ns {
+	case "enabled", "service", jobExec, jobRun, jobServiceRun, jobLocal:
+		return "", fmt.Errorf("invalid label-namespace %q, it's a reserved label name", ns)
+	}
+
+	return labelPrefix + "." + ns, nil
+}
+
+// sweepContainers removes the stopped containers of the run jobs older than
+// the sweep-containers age from the global Docker daemon. It runs before any
+// job is scheduled, so none of them belongs to a running execution.
+func (c *Config) sweepContainers() error {
+	age, err := c.sweepAge()
+	if err != nil || age == 0 {
+		return err
+	}
+
+	client, options := c.dockerTarget("", "")
+	removed, err := core.SweepContainers(client, options, age, time.Now())
+	if len(removed) > 0 {
+		c.logger.Noticef("Removed %d stopped containers of run jobs older than %s", len(removed), age)
+	}
+
+	if err != nil {
+		c.logger.Warningf("Can't sweep the containers of the run jobs: %s", err)
+	}
+
+	return nil
+}
+
+// secretFileWarnings returns the problems of the host files of the
+// secret-files of the run jobs: missing files and files readable by
+// everyone, which defeat the purpose of keeping the secrets out of the
+// environment
+func (c *Config) secretFileWarnings() []string {
+	var warnings []string
+	for name, j := range c.RunJobs {
+		for _, e := range j.SecretFiles {
+			host, _, _ := strings.Cut(e, ":")
+			info, err := os.Stat(host)
+			switch {
+			case os.IsNotExist(err):
+				warnings = append(warnings, fmt.Sprintf("job %q: secret file %q doesn't exist", name, host))
+			case err != nil:
+				warnings = append(warnings, fmt.Sprintf("job %q: secret file %q: %s", name, host, err))
+			case info.Mode().Perm()&0o004 != 0:
+				warnings = append(warnings, fmt.Sprintf("job %q: secret file %q is readable by everyone", name, host))
+			}
+		}
+	}
+
+	sort.Strings(warnings)
+	return warnings
+}
+
+// onFailureWarnings returns the on-failure jobs which aren't defined in the
+// configuration, they may still be defined with Docker labels, and the jobs
+// being their own on-failure job, rejected when scheduled
+func (c *Config) onFailureWarnings() []string {
+	names := make(map[string]int)
+	c.eachJob(func(name string, j core.Job) {
+		names[name]++
+	})
+
+	var warnings []string
+	c.eachJob(func(name string, j core.Job) {
+		switch f := j.GetSchedulingOptions().OnFailure; {
+		case f == name:
+			warnings = append(warnings, fmt.Sprintf("job %q: %s", name, core.ErrOnFailureLoop))
+		case f != "" && names[f] == 0:
+			warnings = append(warnings, fmt.Sprintf("job %q: on-failure job %q isn't defined", name, f))
+		case names[f] > 1:
+			warnings = append(warnings, fmt.Sprintf("job %q: on-failure job %q won't run, %s", name, f, core.ErrAmbiguousJob))
+		}
+	})
+
+	sort.Strings(warnings)
+	return warnings
+}
+
+// registriesWithoutAuth returns the names of the jobs indexed by registry,
+// for the images hosted outside of Docker Hub without any credentials
+// configured, neither in the job, in a registry-auth section nor in the
+// Docker config file.
+func (c *Config) registriesWithoutAuth() map[string][]string {
+	byRegistry := make(map[string][]string)
+	check := func(name, image string, auth core.RegistryAuth) {
+		registry := core.ImageRegistry(image)
+		if image == "" || registry == "" || auth.RegistryUser != "" {
+			return
+		}
+
+		if _, ok := c.RegistryAuths[registry]; ok || core.HasDockerConfigAuth(registry) {
+			return
+		}
+
+		byRegistry[registry] = append(byRegistry[registry], name)
+	}
+
+	for name, j := range c.RunJobs {
+		if j.Container == "" {
+			check(name, j.Image, j.RegistryAuth)
+		}
+	}
+
+	for name, j := range c.ServiceJobs {
+		check(name, j.Image, j.RegistryAuth)
+	}
+
+	for _, names := range byRegistry {
+		sort.Strings(names)
+	}
+
+	return byRegistry
+}
+
+func (c *Config) buildSchedulerMiddlewares(sh *core.Scheduler) error {
+	var window time.Duration
+	if c.Global.NotificationBatchWindow != "" {
+		var err error
+		window, err = time.ParseDuration(c.Global.NotificationBatchWindow)
+		if err != nil || window <= 0 {
+			return fmt.Errorf("invalid notification-batch-window %q, expected a positive duration", c.Global.NotificationBatchWindow)
+		}
+	}
+
+	ms := []core.Middleware{
+		middlewares.NewSlack(&c.Global.SlackConfig),
+		middlewares.NewDiscord(&c.Global.DiscordConfig),
+		middlewares.NewTeams(&c.Global.TeamsConfig),
+		middlewares.NewGotify(&c.Global.GotifyConfig),
+		middlewares.NewPagerDuty(&c.Global.PagerDutyConfig),
+		middlewares.NewWebhook(&c.Global.WebhookConfig),
+		middlewares.NewSave(&c.Global.SaveConfig),
+		middlewares.NewMail(&c.Global.MailConfig),
+		middlewares.NewStatsD(&c.Global.StatsDConfig),
+		// last, so the output is redacted before the others use it
+		middlewares.NewRedactFunc(&c.Global.RedactConfig, c.liveSecrets),
+	}
+
+	for _, m := range ms {
+		if b, ok := m.(middlewares.Batchable); ok && window > 0 {
+			c.batchers = append(c.batchers, b.EnableBatching(window))
+		}
+
+		sh.Use(m)
+	}
+
+	return nil
+}
+
+// middlewareNames are the names accepted by disable-middlewares
+var middlewareNames = map[string]bool{}
+
+func init() {
+	for _, m := range []core.Middleware{
+		&middlewares.Overlap{}, &middlewares.Slack{}, &middlewares.Discord{},
+		&middlewares.Teams{}, &middlewares.Gotify{}, &middlewares.PagerDuty{},
+		&middlewares.Webhook{}, &middlewares.Save{}, &middlewares.Mail{},
+		&middlewares.StatsD{}, &middlewares.Redact{},
+	} {
+		middlewareNames[core.MiddlewareName(m)] = true
+	}
+}
+
+// disabledMiddlewareWarnings returns a warning per unknown middleware name
+// of disable-middlewares, such a name disables nothing
+func (c *Config) disabledMiddlewareWarnings() []string {
+	var warnings []string
+	c.eachJob(func(name string, j core.Job) {
+		for _, m := range j.GetSchedulingOptions().DisableMiddlewares {
+			if !middlewareNames[strings.ToLower(strings.TrimSpace(m))] {
+				warnings = append(warnings, fmt.Sprintf("job %q: unknown middleware %q in disable-middlewares", name, m))
+			}
+		}
+	})
+
+	sort.Strings(warnings)
+	return warnings
+}
+
+// secrets returns the passwords and tokens of the configuration, they are
+// redacted from the output of the jobs
+func (c *Config) secrets() []string {
+	secrets := []string{c.Global.SMTPPassword, c.Global.GotifyToken, c.Global.PagerDutyRoutingKey}
+	for _, a := range c.RegistryAuths {
+		secrets = append(secrets, a.Password)
+	}
+
+	for _, j := range c.ExecJobs {
+		secrets = append(secrets, j.SMTPPassword, j.GotifyToken, j.PagerDutyRoutingKey)
+	}
+
+	for _, j := range c.RunJobs {
+		secrets = append(secrets, j.SMTPPassword, j.GotifyToken, j.PagerDutyRoutingKey, j.RegistryPassword)
+	}
+
+	for _, j := range c.LocalJobs {
+		secrets = append(secrets, j.SMTPPassword, j.GotifyToken, j.PagerDutyRoutingKey)
+	}
+
+	for _, j := range c.ServiceJobs {
+		secrets = append(secrets, j.SMTPPassword, j.GotifyToken, j.PagerDutyRoutingKey, j.RegistryPassword)
+	}
+
+	return secrets
+}
+
+// liveSecrets returns the secrets of the jobs currently in the config, the
+// ones of the labels and of the reloads included
+func (c *Config) liveSecrets() []string {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+
+	return c.secrets()
+}
+
+// flushNotifications sends the pending batches of notifications
+func (c *Config) flushNotifications() {
+	for _, b := range c.batchers {
+		b.Flush()
+	}
 }
 
 func (c *Config) dockerLabelsUpdate(labels map[string]map[string]string) {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+
 	// Get the current labels
 	var parsedLabelConfig Config
-	parsedLabelConfig.buildFromDockerLabels(labels)
+	parsedLabelConfig.Global.MissingEnv = c.Global.MissingEnv
+	if !parsedLabelConfig.readDockerLabels(labels, c.logger) {
+		// the label jobs are kept as they are
+		return
+	}
+
+	c.dropInvalidDockerTargets(&parsedLabelConfig)
+
+	var changes []jobChange
 
 	// Calculate the delta execJobs
 	for name, j := range c.ExecJobs {
@@ -147,16 +1047,23 @@ func (c *Config) dockerLabelsUpdate(labels map[string]map[string]string) {
 				// so, lets take care of it by simply restarting
 				// For the hash to work properly, we must fill the fields before calling it
 				defaults.SetDefaults(newJob)
-				newJob.Client = c.dockerHandler.GetInternalDockerClient()
+				newJob.Client, newJob.Docker = c.dockerTarget(newJob.DockerEndpoint, newJob.DockerHost)
 				newJob.Name = newJobsName
 				if newJob.Hash() != j.Hash() {
 					// Remove from the scheduler
 					c.sh.RemoveJob(j)
 					// Add the job back to the scheduler
 					newJob.buildMiddlewares()
-					c.sh.AddJob(newJob)
+					if !c.addJob(jobExec, name, newJob) {
+						// not added back as a new job below
+						delete(c.ExecJobs, name)
+						delete(parsedLabelConfig.ExecJobs, name)
+						changes = append(changes, jobChange{jobExec, name, jobRemoved, sourceLabels})
+						break
+					}
 					// Update the job config
 					c.ExecJobs[name] = newJob
+					changes = append(changes, jobChange{jobExec, name, jobUpdated, sourceLabels})
 				}
 				break
 			}
@@ -174,11 +1081,14 @@ func (c *Config) dockerLabelsUpdate(labels map[string]map[string]string) {
 		}
 		if !found {
 			defaults.SetDefaults(newJob)
-			newJob.Client = c.dockerHandler.GetInternalDockerClient()
+			newJob.Client, newJob.Docker = c.dockerTarget(newJob.DockerEndpoint, newJob.DockerHost)
 			newJob.Name = newJobsName
 			newJob.buildMiddlewares()
-			c.sh.AddJob(newJob)
+			if !c.addJob(jobExec, newJobsName, newJob) {
+				continue
+			}
 			c.ExecJobs[newJobsName] = newJob
+			changes = append(changes, jobChange{jobExec, newJobsName, jobAdded, sourceLabels})
 		}
 	}
 
@@ -190,16 +1100,23 @@ func (c *Config) dockerLabelsUpdate(labels map[string]map[string]string) {
 				// so, lets take care of it by simply restarting
 				// For the hash to work properly, we must fill the fields before calling it
 				defaults.SetDefaults(newJob)
-				newJob.Client = c.dockerHandler.GetInternalDockerClient()
+				newJob.Client, newJob.Docker = c.dockerTarget(newJob.DockerEndpoint, newJob.DockerHost)
 				newJob.Name = newJobsName
 				if newJob.Hash() != j.Hash() {
 					// Remove from the scheduler
 					c.sh.RemoveJob(j)
 					// Add the job back to the scheduler
 					newJob.buildMiddlewares()
-					c.sh.AddJob(newJob)
+					if !c.addJob(jobRun, name, newJob) {
+						// not added back as a new job below
+						delete(c.RunJobs, name)
+						delete(parsedLabelConfig.RunJobs, name)
+						changes = append(changes, jobChange{jobRun, name, jobRemoved, sourceLabels})
+						break
+					}
 					// Update the job config
 					c.RunJobs[name] = newJob
+					changes = append(changes, jobChange{jobRun, name, jobUpdated, sourceLabels})
 				}
 				break
 			}
@@ -217,67 +1134,107 @@ func (c *Config) dockerLabelsUpdate(labels map[string]map[string]string) {
 		}
 		if !found {
 			defaults.SetDefaults(newJob)
-			newJob.Client = c.dockerHandler.GetInternalDockerClient()
+			newJob.Client, newJob.Docker = c.dockerTarget(newJob.DockerEndpoint, newJob.DockerHost)
 			newJob.Name = newJobsName
 			newJob.buildMiddlewares()
-			c.sh.AddJob(newJob)
+			if !c.addJob(jobRun, newJobsName, newJob) {
+				continue
+			}
 			c.RunJobs[newJobsName] = newJob
+			changes = append(changes, jobChange{jobRun, newJobsName, jobAdded, sourceLabels})
 		}
 	}
+
+	c.reportJobChanges(changes)
 }
 
 // ExecJobConfig contains all configuration params needed to build a ExecJob
 type ExecJobConfig struct {
-	core.ExecJob              `mapstructure:",squash"`
-	middlewares.OverlapConfig `mapstructure:",squash"`
-	middlewares.SlackConfig   `mapstructure:",squash"`
-	middlewares.SaveConfig    `mapstructure:",squash"`
-	middlewares.MailConfig    `mapstructure:",squash"`
+	core.ExecJob                `mapstructure:",squash"`
+	middlewares.OverlapConfig   `mapstructure:",squash"`
+	middlewares.SlackConfig     `mapstructure:",squash"`
+	middlewares.DiscordConfig   `mapstructure:",squash"`
+	middlewares.TeamsConfig     `mapstructure:",squash"`
+	middlewares.GotifyConfig    `mapstructure:",squash"`
+	middlewares.PagerDutyConfig `mapstructure:",squash"`
+	middlewares.WebhookConfig   `mapstructure:",squash"`
+	middlewares.SaveConfig      `mapstructure:",squash"`
+	middlewares.MailConfig      `mapstructure:",squash"`
 }
 
 func (c *ExecJobConfig) buildMiddlewares() {
 	c.ExecJob.Use(middlewares.NewOverlap(&c.OverlapConfig))
 	c.ExecJob.Use(middlewares.NewSlack(&c.SlackConfig))
+	c.ExecJob.Use(middlewares.NewDiscord(&c.DiscordConfig))
+	c.ExecJob.Use(middlewares.NewTeams(&c.TeamsConfig))
+	c.ExecJob.Use(middlewares.NewGotify(&c.GotifyConfig))
+	c.ExecJob.Use(middlewares.NewPagerDuty(&c.PagerDutyConfig))
+	c.ExecJob.Use(middlewares.NewWebhook(&c.WebhookConfig))
 	c.ExecJob.Use(middlewares.NewSave(&c.SaveConfig))
 	c.ExecJob.Use(middlewares.NewMail(&c.MailConfig))
 }
 
 // RunServiceConfig contains all configuration params needed to build a RunJob
 type RunServiceConfig struct {
-	core.RunServiceJob        `mapstructure:",squash"`
-	middlewares.OverlapConfig `mapstructure:",squash"`
-	middlewares.SlackConfig   `mapstructure:",squash"`
-	middlewares.SaveConfig    `mapstructure:",squash"`
-	middlewares.MailConfig    `mapstructure:",squash"`
+	core.RunServiceJob          `mapstructure:",squash"`
+	middlewares.OverlapConfig   `mapstructure:",squash"`
+	middlewares.SlackConfig     `mapstructure:",squash"`
+	middlewares.DiscordConfig   `mapstructure:",squash"`
+	middlewares.TeamsConfig     `mapstructure:",squash"`
+	middlewares.GotifyConfig    `mapstructure:",squash"`
+	middlewares.PagerDutyConfig `mapstructure:",squash"`
+	middlewares.WebhookConfig   `mapstructure:",squash"`
+	middlewares.SaveConfig      `mapstructure:",squash"`
+	middlewares.MailConfig      `mapstructure:",squash"`
 }
 
 type RunJobConfig struct {
-	core.RunJob               `mapstructure:",squash"`
-	middlewares.OverlapConfig `mapstructure:",squash"`
-	middlewares.SlackConfig   `mapstructure:",squash"`
-	middlewares.SaveConfig    `mapstructure:",squash"`
-	middlewares.MailConfig    `mapstructure:",squash"`
+	core.RunJob                 `mapstructure:",squash"`
+	middlewares.OverlapConfig   `mapstructure:",squash"`
+	middlewares.SlackConfig     `mapstructure:",squash"`
+	middlewares.DiscordConfig   `mapstructure:",squash"`
+	middlewares.TeamsConfig     `mapstructure:",squash"`
+	middlewares.GotifyConfig    `mapstructure:",squash"`
+	middlewares.PagerDutyConfig `mapstructure:",squash"`
+	middlewares.WebhookConfig   `mapstructure:",squash"`
+	middlewares.SaveConfig      `mapstructure:",squash"`
+	middlewares.MailConfig      `mapstructure:",squash"`
 }
 
 func (c *RunJobConfig) buildMiddlewares() {
 	c.RunJob.Use(middlewares.NewOverlap(&c.OverlapConfig))
 	c.RunJob.Use(middlewares.NewSlack(&c.SlackConfig))
+	c.RunJob.Use(middlewares.NewDiscord(&c.DiscordConfig))
+	c.RunJob.Use(middlewares.NewTeams(&c.TeamsConfig))
+	c.RunJob.Use(middlewares.NewGotify(&c.GotifyConfig))
+	c.RunJob.Use(middlewares.NewPagerDuty(&c.PagerDutyConfig))
+	c.RunJob.Use(middlewares.NewWebhook(&c.WebhookConfig))
 	c.RunJob.Use(middlewares.NewSave(&c.SaveConfig))
 	c.RunJob.Use(middlewares.NewMail(&c.MailConfig))
 }
 
 // LocalJobConfig contains all configuration params needed to build a RunJob
 type LocalJobConfig struct {
-	core.LocalJob             `mapstructure:",squash"`
-	middlewares.OverlapConfig `mapstructure:",squash"`
-	middlewares.SlackConfig   `mapstructure:",squash"`
-	middlewares.SaveConfig    `mapstructure:",squash"`
-	middlewares.MailConfig    `mapstructure:",squash"`
+	core.LocalJob               `mapstructure:",squash"`
+	middlewares.OverlapConfig   `mapstructure:",squash"`
+	middlewares.SlackConfig     `mapstructure:",squash"`
+	middlewares.DiscordConfig   `mapstructure:",squash"`
+	middlewares.TeamsConfig     `mapstructure:",squash"`
+	middlewares.GotifyConfig    `mapstructure:",squash"`
+	middlewares.PagerDutyConfig `mapstructure:",squash"`
+	middlewares.WebhookConfig   `mapstructure:",squash"`
+	middlewares.SaveConfig      `mapstructure:",squash"`
+	middlewares.MailConfig      `mapstructure:",squash"`
 }
 
 func (c *LocalJobConfig) buildMiddlewares() {
 	c.LocalJob.Use(middlewares.NewOverlap(&c.OverlapConfig))
 	c.LocalJob.Use(middlewares.NewSlack(&c.SlackConfig))
+	c.LocalJob.Use(middlewares.NewDiscord(&c.DiscordConfig))
+	c.LocalJob.Use(middlewares.NewTeams(&c.TeamsConfig))
+	c.LocalJob.Use(middlewares.NewGotify(&c.GotifyConfig))
+	c.LocalJob.Use(middlewares.NewPagerDuty(&c.PagerDutyConfig))
+	c.LocalJob.Use(middlewares.NewWebhook(&c.WebhookConfig))
 	c.LocalJob.Use(middlewares.NewSave(&c.SaveConfig))
 	c.LocalJob.Use(middlewares.NewMail(&c.MailConfig))
 }
@@ -285,10 +1242,25 @@ func (c *LocalJobConfig) buildMiddlewares() {
 func (c *RunServiceConfig) buildMiddlewares() {
 	c.RunServiceJob.Use(middlewares.NewOverlap(&c.OverlapConfig))
 	c.RunServiceJob.Use(middlewares.NewSlack(&c.SlackConfig))
+	c.RunServiceJob.Use(middlewares.NewDiscord(&c.DiscordConfig))
+	c.RunServiceJob.Use(middlewares.NewTeams(&c.TeamsConfig))
+	c.RunServiceJob.Use(middlewares.NewGotify(&c.GotifyConfig))
+	c.RunServiceJob.Use(middlewares.NewPagerDuty(&c.PagerDutyConfig))
+	c.RunServiceJob.Use(middlewares.NewWebhook(&c.WebhookConfig))
 	c.RunServiceJob.Use(middlewares.NewSave(&c.SaveConfig))
 	c.RunServiceJob.Use(middlewares.NewMail(&c.MailConfig))
 }
 
+// RegistryAuthConfig contains the credentials of a registry, the registry
+// host being the name of the section
+type RegistryAuthConfig struct {
+	Username string
+	Password string
+}
+
 type DockerConfig struct {
+	// Host is the daemon of the jobs without docker-host, e.g.
+	// `ssh://user@host`, DOCKER_HOST by default
+	Host    string   `mapstructure:"host"`
 	Filters []string `mapstructure:"filters"`
 }
@@ -1,8 +1,14 @@
 package cli
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	docker "github.com/fsouza/go-dockerclient"
 	defaults "github.com/mcuadros/go-defaults"
 	"github.com/netresearch/ofelia/core"
 	"github.com/netresearch/ofelia/middlewares"
@@ -59,7 +65,7 @@ func (s *SuiteConfig) TestJobDefaultsNotSet(c *C) {
 
 	defaults.SetDefaults(j)
 
-	c.Assert(j.Pull, Equals, "true")
+	c.Assert(j.Pull, Equals, "missing")
 }
 
 func (s *SuiteConfig) TestExecJobBuildEmpty(c *C) {
@@ -297,6 +303,142 @@ func (s *SuiteConfig) TestLabelsConfig(c *C) {
 			},
 			Comment: "Test run job with environment variables",
 		},
+		{
+			Labels: map[string]map[string]string{
+				"some": {
+					requiredLabel: "true",
+					serviceLabel:  "true",
+					labelPrefix + "." + jobRun + ".job1.schedule":    "schedule1",
+					labelPrefix + "." + jobRun + ".job1.extra-hosts": `["db:10.0.0.2", "cache:10.0.0.3"]`,
+				},
+			},
+			ExpectedConfig: Config{
+				RunJobs: map[string]*RunJobConfig{
+					"job1": {RunJob: core.RunJob{BareJob: core.BareJob{
+						Schedule: "schedule1",
+					},
+						ExtraHosts: []string{"db:10.0.0.2", "cache:10.0.0.3"},
+					},
+					},
+				},
+			},
+			Comment: "Test run job with extra hosts",
+		},
+		{
+			Labels: map[string]map[string]string{
+				"some": {
+					requiredLabel: "true",
+					serviceLabel:  "true",
+					labelPrefix + "." + jobRun + ".job1.schedule": "schedule1",
+					labelPrefix + "." + jobRun + ".job1.cap-add":  `["net_admin", "CAP_SYS_TIME"]`,
+					labelPrefix + "." + jobRun + ".job1.cap-drop": "ALL",
+				},
+			},
+			ExpectedConfig: Config{
+				RunJobs: map[string]*RunJobConfig{
+					"job1": {RunJob: core.RunJob{BareJob: core.BareJob{
+						Schedule: "schedule1",
+					},
+						CapAdd:  []string{"net_admin", "CAP_SYS_TIME"},
+						CapDrop: []string{"ALL"},
+					},
+					},
+				},
+			},
+			Comment: "Test run job with capabilities",
+		},
+		{
+			Labels: map[string]map[string]string{
+				"some": {
+					requiredLabel: "true",
+					serviceLabel:  "true",
+					labelPrefix + "." + jobRun + ".job1.schedule":        "schedule1",
+					labelPrefix + "." + jobRun + ".job1.devices":         `["/dev/fuse", "/dev/snd:r"]`,
+					labelPrefix + "." + jobRun + ".job1.ulimits":         `["nofile=1024:2048", "nproc=512"]`,
+					labelPrefix + "." + jobRun + ".job1.sysctls":         "net.core.somaxconn=1024",
+					labelPrefix + "." + jobRun + ".job1.network-aliases": `["worker", "cron"]`,
+				},
+			},
+			ExpectedConfig: Config{
+				RunJobs: map[string]*RunJobConfig{
+					"job1": {RunJob: core.RunJob{BareJob: core.BareJob{
+						Schedule: "schedule1",
+					},
+						Devices:        []string{"/dev/fuse", "/dev/snd:r"},
+						Ulimits:        []string{"nofile=1024:2048", "nproc=512"},
+						Sysctls:        []string{"net.core.somaxconn=1024"},
+						NetworkAliases: []string{"worker", "cron"},
+					},
+					},
+				},
+			},
+			Comment: "Test run job with devices, ulimits, sysctls and network aliases",
+		},
+		{
+			Labels: map[string]map[string]string{
+				"some": {
+					requiredLabel: "true",
+					serviceLabel:  "true",
+					labelPrefix + "." + jobRun + ".job1.schedule":   "schedule1",
+					labelPrefix + "." + jobRun + ".job1.log-driver": "json-file",
+					labelPrefix + "." + jobRun + ".job1.log-opts":   `["max-size=10m", "max-file=3"]`,
+				},
+			},
+			ExpectedConfig: Config{
+				RunJobs: map[string]*RunJobConfig{
+					"job1": {RunJob: core.RunJob{BareJob: core.BareJob{
+						Schedule: "schedule1",
+					},
+						LogDriver: "json-file",
+						LogOpts:   []string{"max-size=10m", "max-file=3"},
+					},
+					},
+				},
+			},
+			Comment: "Test run job with log options",
+		},
+		{
+			Labels: map[string]map[string]string{
+				"some": {
+					requiredLabel: "true",
+					serviceLabel:  "true",
+					labelPrefix + "." + jobLocal + ".job1.schedule":            "schedule1",
+					labelPrefix + "." + jobLocal + ".job1.disable-middlewares": `["save", "statsd"]`,
+				},
+			},
+			ExpectedConfig: Config{
+				LocalJobs: map[string]*LocalJobConfig{
+					"job1": {LocalJob: core.LocalJob{BareJob: core.BareJob{
+						Schedule:           "schedule1",
+						DisableMiddlewares: []string{"save", "statsd"},
+					}}},
+				},
+			},
+			Comment: "Test local job with disabled middlewares",
+		},
+		{
+			Labels: map[string]map[string]string{
+				"some": {
+					requiredLabel: "true",
+					serviceLabel:  "true",
+					labelPrefix + "." + jobServiceRun + ".job1.schedule": "schedule1",
+					labelPrefix + "." + jobServiceRun + ".job1.secrets":  `["db", "api"]`,
+					labelPrefix + "." + jobServiceRun + ".job1.configs":  `["backup.conf"]`,
+				},
+			},
+			ExpectedConfig: Config{
+				ServiceJobs: map[string]*RunServiceConfig{
+					"job1": {RunServiceJob: core.RunServiceJob{BareJob: core.BareJob{
+						Schedule: "schedule1",
+					},
+						Secrets: []string{"db", "api"},
+						Configs: []string{"backup.conf"},
+					},
+					},
+				},
+			},
+			Comment: "Test service job with secrets and configs",
+		},
 	}
 
 	for _, t := range testcases {
@@ -306,3 +448,678 @@ func (s *SuiteConfig) TestLabelsConfig(c *C) {
 		c.Assert(conf, DeepEquals, t.ExpectedConfig)
 	}
 }
+
+func (s *SuiteConfig) TestSchedulesWithoutJitter(c *C) {
+	conf, err := BuildFromString(`
+		[job-local "a"]
+		schedule = @every 1m
+		[job-local "b"]
+		schedule = @every 1m
+		[job-exec "c"]
+		schedule = @every 1m
+		[job-run "d"]
+		schedule = @every 1m
+		[job-service-run "e"]
+		schedule = @every 1m
+		[job-local "f"]
+		schedule = @every 1m
+		jitter = 30s
+		[job-local "g"]
+		schedule = @hourly
+	`, &TestLogger{})
+	c.Assert(err, IsNil)
+
+	c.Assert(conf.schedulesWithoutJitter(), DeepEquals, map[string][]string{
+		"@every 1m": {"a", "b", "c", "d", "e"},
+	})
+
+	conf.Global.DefaultJitter = "10s"
+	c.Assert(conf.schedulesWithoutJitter(), HasLen, 0)
+}
+
+func (s *SuiteConfig) TestRegistriesWithoutAuth(c *C) {
+	conf, err := BuildFromString(`
+		[registry-auth "registry.example.com"]
+		username = user
+		password = secret
+		[job-run "a"]
+		schedule = @every 1m
+		image = registry.example.com/foo
+		[job-run "b"]
+		schedule = @every 1m
+		image = other.example.com/foo
+		[job-run "c"]
+		schedule = @every 1m
+		image = other.example.com/bar
+		registry-user = user
+		registry-password = secret
+		[job-service-run "d"]
+		schedule = @every 1m
+		image = other.example.com/baz
+		[job-run "e"]
+		schedule = @every 1m
+		image = busybox
+	`, &TestLogger{})
+	c.Assert(err, IsNil)
+
+	c.Assert(conf.RunJobs["c"].RegistryUser, Equals, "user")
+	c.Assert(conf.buildRegistryAuths(), DeepEquals, map[string]docker.AuthConfiguration{
+		"registry.example.com": {Username: "user", Password: "secret", ServerAddress: "registry.example.com"},
+	})
+	c.Assert(conf.registriesWithoutAuth(), DeepEquals, map[string][]string{
+		"other.example.com": {"b", "d"},
+	})
+}
+
+func (s *SuiteConfig) TestValidateWebhooks(c *C) {
+	conf, err := BuildFromString(`
+		[job-local "a"]
+		schedule = @hourly
+		command = echo a
+		webhook-url = http://localhost
+		webhook-payload-template = {{.JobName}}
+	`, &TestLogger{})
+	c.Assert(err, IsNil)
+	c.Assert(conf.validateNotifications(), IsNil)
+
+	conf.LocalJobs["a"].WebhookPayloadTemplate = "{{.JobName"
+	c.Assert(conf.validateNotifications(), ErrorMatches, `job "a": invalid webhook-payload-template.*`)
+
+	conf.Global.WebhookPayloadTemplate = "{{.Foo}}"
+	c.Assert(conf.validateNotifications(), ErrorMatches, `global: invalid webhook-payload-template.*`)
+}
+
+func (s *SuiteConfig) TestValidateGotify(c *C) {
+	conf, err := BuildFromString(`
+		[global]
+		gotify-url = https://gotify.example.com
+		gotify-token = token
+		gotify-priority = 5
+
+		[job-local "a"]
+		schedule = @hourly
+		command = echo a
+		gotify-url = https://gotify.example.com
+	`, &TestLogger{})
+	c.Assert(err, IsNil)
+	c.Assert(conf.Global.GotifyPriority, Equals, 5)
+	c.Assert(conf.validateNotifications(), ErrorMatches, `job "a": gotify-token is required with gotify-url`)
+
+	conf.LocalJobs["a"].GotifyToken = "token"
+	c.Assert(conf.validateNotifications(), IsNil)
+
+	conf.Global.GotifyURL = "ftp://gotify.example.com"
+	c.Assert(conf.validateNotifications(), ErrorMatches, `global: invalid gotify-url .*`)
+}
+
+func (s *SuiteConfig) TestValidatePagerDuty(c *C) {
+	conf, err := BuildFromString(`
+		[global]
+		pagerduty-routing-key = key
+		pagerduty-severity = critical
+
+		[job-local "a"]
+		schedule = @hourly
+		command = echo a
+		pagerduty-severity = warning
+	`, &TestLogger{})
+	c.Assert(err, IsNil)
+	c.Assert(conf.Global.PagerDutySeverity, Equals, "critical")
+	c.Assert(conf.validateNotifications(), ErrorMatches, `job "a": pagerduty-routing-key is required.*`)
+
+	conf.LocalJobs["a"].PagerDutyRoutingKey = "key"
+	c.Assert(conf.validateNotifications(), IsNil)
+
+	conf.Global.PagerDutySeverity = "page"
+	c.Assert(conf.validateNotifications(), ErrorMatches, `global: invalid pagerduty-severity "page".*`)
+}
+
+func (s *SuiteConfig) TestMailTLSMode(c *C) {
+	conf, err := BuildFromString(`
+		[global]
+		smtp-host = mail.example.com
+		smtp-port = 465
+		smtp-tls-mode = starttls
+
+		[job-local "a"]
+		schedule = @hourly
+		command = echo a
+		smtp-port = 587
+		smtp-tls-mode = starttls
+	`, &TestLogger{})
+	c.Assert(err, IsNil)
+	c.Assert(conf.validateNotifications(), IsNil)
+	c.Assert(conf.mailTLSWarnings(), DeepEquals, map[string]string{
+		"global": "smtp-port 465 usually expects smtp-tls-mode tls, not starttls",
+	})
+
+	conf.LocalJobs["a"].SMTPTLSMode = "ssl"
+	c.Assert(conf.validateNotifications(), ErrorMatches, `job "a": unknown smtp-tls-mode.*`)
+}
+
+func (s *SuiteConfig) TestNotificationBatchWindow(c *C) {
+	conf, err := BuildFromString(`
+		[global]
+		slack-webhook = http://localhost/slack
+		webhook-url = http://localhost/webhook
+		discord-webhook = http://localhost/discord
+		notification-batch-window = 1m
+	`, &TestLogger{})
+	c.Assert(err, IsNil)
+
+	sh := core.NewScheduler(&TestLogger{})
+	c.Assert(conf.buildSchedulerMiddlewares(sh), IsNil)
+	// the three notifiers and redact, for the secrets of the jobs added later
+	c.Assert(sh.Middlewares(), HasLen, 4)
+	c.Assert(conf.batchers, HasLen, 2)
+
+	conf.batchers = nil
+	conf.Global.NotificationBatchWindow = "soon"
+	c.Assert(conf.buildSchedulerMiddlewares(core.NewScheduler(&TestLogger{})), ErrorMatches, `invalid notification-batch-window "soon".*`)
+	c.Assert(conf.batchers, HasLen, 0)
+}
+
+func (s *SuiteConfig) TestRedact(c *C) {
+	conf, err := BuildFromString(`
+		[global]
+		redact-patterns = "token=\\w+"
+		redact-patterns = "Bearer \\S+"
+		smtp-password = hunter2
+
+		[registry-auth "registry.example.com"]
+		username = ci
+		password = s3cr3t
+
+		[job-run "a"]
+		schedule = @hourly
+		image = busybox
+		registry-password = p4ss
+	`, &TestLogger{})
+	c.Assert(err, IsNil)
+	c.Assert(conf.Global.RedactPatterns, DeepEquals, []string{`token=\w+`, `Bearer \S+`})
+	c.Assert(conf.validateNotifications(), IsNil)
+
+	secrets := make(map[string]bool)
+	for _, secret := range conf.secrets() {
+		secrets[secret] = true
+	}
+
+	for _, secret := range []string{"hunter2", "s3cr3t", "p4ss"} {
+		c.Assert(secrets[secret], Equals, true, Commentf("secret %q", secret))
+	}
+
+	sh := core.NewScheduler(&TestLogger{})
+	c.Assert(conf.buildSchedulerMiddlewares(sh), IsNil)
+	ms := sh.Middlewares()
+	c.Assert(ms[len(ms)-1], FitsTypeOf, &middlewares.Redact{})
+
+	conf.Global.RedactPatterns = []string{"("}
+	c.Assert(conf.validateNotifications(), ErrorMatches, `global: invalid redact-patterns "\(".*`)
+}
+
+func (s *SuiteConfig) TestRunJobCapabilities(c *C) {
+	conf, err := BuildFromString(`
+		[job-run "a"]
+		schedule = @hourly
+		image = busybox
+		cap-drop = ALL
+		cap-add = net_bind_service
+		cap-add = CAP_CHOWN
+	`, &TestLogger{})
+	c.Assert(err, IsNil)
+	c.Assert(conf.RunJobs["a"].CapDrop, DeepEquals, []string{"ALL"})
+	c.Assert(conf.RunJobs["a"].CapAdd, DeepEquals, []string{"net_bind_service", "CAP_CHOWN"})
+	c.Assert(core.ValidateJob(conf.RunJobs["a"]), IsNil)
+
+	conf.RunJobs["a"].CapAdd = []string{"CAP_FOO"}
+	c.Assert(core.ValidateJob(conf.RunJobs["a"]), ErrorMatches, `unknown capability: "CAP_FOO"`)
+}
+
+func (s *SuiteConfig) TestLogDriver(c *C) {
+	conf, err := BuildFromString(`
+		[job-run "a"]
+		schedule = @hourly
+		image = busybox
+		log-driver = json-file
+		log-opts = max-size=10m
+		log-opts = max-file=3
+	`, &TestLogger{})
+	c.Assert(err, IsNil)
+	c.Assert(conf.RunJobs["a"].LogDriver, Equals, "json-file")
+	c.Assert(conf.RunJobs["a"].LogOpts, DeepEquals, []string{"max-size=10m", "max-file=3"})
+	c.Assert(core.ValidateJob(conf.RunJobs["a"]), IsNil)
+
+	conf.RunJobs["a"].LogDriver = "awslogs"
+	c.Assert(core.ValidateJob(conf.RunJobs["a"]), ErrorMatches, `unknown log driver: "awslogs"`)
+}
+
+// warningLogger keeps the warnings logged
+type warningLogger struct {
+	TestLogger
+	warnings []string
+}
+
+func (l *warningLogger) Warningf(format string, args ...interface{}) {
+	l.warnings = append(l.warnings, fmt.Sprintf(format, args...))
+}
+
+func (s *SuiteConfig) TestBuildFromDir(c *C) {
+	dir := c.MkDir()
+	write := func(name, content string) {
+		c.Assert(os.WriteFile(filepath.Join(dir, name), []byte(content), 0644), IsNil)
+	}
+
+	write("00-global.ini", `
+		[global]
+		log-format = text
+		max-output = 1m
+		maintenance-window = 0 2 * * * 1h
+		maintenance-window = 0 14 * * * 1h
+
+		[job-local "backup"]
+		schedule = @daily
+		command = backup.sh
+	`)
+	write("10-team.ini", `
+		[global]
+		max-output = 2m
+		maintenance-window = 0 3 * * * 1h
+
+		[job-local "backup"]
+		schedule = @hourly
+
+		[job-run "report"]
+		schedule = @weekly
+		image = busybox
+	`)
+	// only the INI files are read
+	write("notes.txt", "[invalid")
+
+	logger := &warningLogger{}
+	conf, err := BuildFromDir(dir, logger)
+	c.Assert(err, IsNil)
+
+	// the later files override the global options
+	c.Assert(conf.Global.LogFormat, Equals, "text")
+	c.Assert(conf.Global.MaxOutput, Equals, "2m")
+	c.Assert(conf.Global.MaintenanceWindows, DeepEquals, []string{"0 3 * * * 1h"})
+
+	c.Assert(conf.LocalJobs, HasLen, 1)
+	c.Assert(conf.LocalJobs["backup"].Schedule, Equals, "@hourly")
+	c.Assert(conf.LocalJobs["backup"].Command, Equals, "backup.sh")
+	c.Assert(conf.RunJobs, HasLen, 1)
+	c.Assert(conf.RunJobs["report"].Image, Equals, "busybox")
+
+	c.Assert(logger.warnings, DeepEquals, []string{fmt.Sprintf(
+		"job-local %q is defined in %q and %q, merging them",
+		"backup", filepath.Join(dir, "00-global.ini"), filepath.Join(dir, "10-team.ini"),
+	)})
+
+	// the directory given as config file
+	conf, err = BuildFromFileFormat(dir, "", &TestLogger{})
+	c.Assert(err, IsNil)
+	c.Assert(conf.Global.MaxOutput, Equals, "2m")
+
+	write("20-broken.ini", "[job-local \"x\"]\nunknown = 1\n")
+	_, err = BuildFromDir(dir, &TestLogger{})
+	c.Assert(err, ErrorMatches, `(?s).*20-broken.ini: .*`)
+
+	_, err = BuildFromDir(c.MkDir(), &TestLogger{})
+	c.Assert(err, ErrorMatches, `no \*.ini file in .*`)
+}
+
+func (s *SuiteConfig) TestReadOnlyWithoutMounts(c *C) {
+	conf, err := BuildFromString(`
+		[job-run "scratch"]
+		schedule = @hourly
+		image = busybox
+		read-only = true
+		tmpfs = /tmp:size=64m
+		[job-run "data"]
+		schedule = @hourly
+		image = busybox
+		read-only = true
+		volume = /data:/data
+		[job-run "bare"]
+		schedule = @hourly
+		image = busybox
+		read-only = true
+		[job-run "writable"]
+		schedule = @hourly
+		image = busybox
+	`, &TestLogger{})
+	c.Assert(err, IsNil)
+	c.Assert(conf.RunJobs["scratch"].Tmpfs, DeepEquals, []string{"/tmp:size=64m"})
+	c.Assert(conf.readOnlyWithoutMounts(), DeepEquals, []string{"bare"})
+}
+
+func (s *SuiteConfig) TestRootJobs(c *C) {
+	conf, err := BuildFromString(`
+		[job-exec "default"]
+		schedule = @hourly
+		container = app
+		command = backup
+		[job-exec "allowed"]
+		schedule = @hourly
+		container = app
+		command = backup
+		allow-root = true
+		[job-run "uid"]
+		schedule = @hourly
+		image = busybox
+		user = 0:0
+		[job-run "nobody"]
+		schedule = @hourly
+		image = busybox
+		user = 65534:65534
+		[job-run "existing"]
+		schedule = @hourly
+		container = app
+		[job-service-run "named"]
+		schedule = @hourly
+		image = busybox
+		user = root
+	`, &TestLogger{})
+	c.Assert(err, IsNil)
+	c.Assert(conf.ExecJobs["allowed"].AllowRoot, Equals, true)
+	c.Assert(conf.rootJobs(), DeepEquals, []string{"default", "named", "uid"})
+}
+
+func (s *SuiteConfig) TestSweepAge(c *C) {
+	conf := &Config{}
+	age, err := conf.sweepAge()
+	c.Assert(err, IsNil)
+	c.Assert(age, Equals, time.Duration(0))
+
+	conf.Global.SweepContainers = "24h"
+	age, err = conf.sweepAge()
+	c.Assert(err, IsNil)
+	c.Assert(age, Equals, 24*time.Hour)
+
+	conf.Global.SweepContainers = "-1h"
+	_, err = conf.sweepAge()
+	c.Assert(err, ErrorMatches, `invalid sweep-containers "-1h", expected a positive duration`)
+
+	conf.Global.SweepContainers = "daily"
+	_, err = conf.sweepAge()
+	c.Assert(err, ErrorMatches, `invalid sweep-containers "daily".*`)
+}
+
+func (s *SuiteConfig) TestCronAlias(c *C) {
+	conf, err := BuildFromString(`
+		[job-local "a"]
+		cron = */30 * * * * *
+		command = echo a
+		[job-local "b"]
+		schedule = @hourly
+		cron = @daily
+		command = echo b
+	`, &TestLogger{})
+	c.Assert(err, IsNil)
+
+	c.Assert(conf.LocalJobs["a"].GetSchedule(), Equals, "*/30 * * * * *")
+	c.Assert(core.ValidateJob(conf.LocalJobs["a"]), IsNil)
+	c.Assert(core.ValidateJob(conf.LocalJobs["b"]), ErrorMatches, `schedule and cron are set to different values: "@hourly" and "@daily"`)
+}
+
+func (s *SuiteConfig) TestOnFailureWarnings(c *C) {
+	conf, err := BuildFromString(`
+		[job-run "backup"]
+		schedule = @daily
+		image = backup
+		on-failure = cleanup
+		[job-local "cleanup"]
+		schedule = @weekly
+		command = rm -rf /tmp/backup
+		on-failure = alert
+		[job-local "retry"]
+		schedule = @weekly
+		command = retry.sh
+		on-failure = retry
+		[job-local "report"]
+		schedule = @weekly
+		command = report.sh
+		on-failure = notify
+		[job-local "notify"]
+		schedule = @weekly
+		command = notify.sh
+		[job-run "notify"]
+		schedule = @weekly
+		image = notify
+	`, &TestLogger{})
+	c.Assert(err, IsNil)
+	c.Assert(conf.RunJobs["backup"].OnFailure, Equals, "cleanup")
+	c.Assert(conf.onFailureWarnings(), DeepEquals, []string{
+		`job "cleanup": on-failure job "alert" isn't defined`,
+		`job "report": on-failure job "notify" won't run, several jobs have the name`,
+		`job "retry": a job can't be its own on-failure job`,
+	})
+}
+
+func (s *SuiteConfig) TestDockerReadiness(c *C) {
+	conf := &Config{}
+	ready, err := conf.dockerReadiness()
+	c.Assert(err, IsNil)
+	c.Assert(ready, Equals, dockerReadiness{})
+
+	conf.Global.DockerWaitTimeout = "1m"
+	conf.Global.StartWithoutDocker = true
+	ready, err = conf.dockerReadiness()
+	c.Assert(err, IsNil)
+	c.Assert(ready, Equals, dockerReadiness{timeout: time.Minute, optional: true})
+
+	conf.Global.DockerWaitTimeout = "-1s"
+	_, err = conf.dockerReadiness()
+	c.Assert(err, ErrorMatches, `invalid docker-wait-timeout "-1s", expected a positive duration`)
+
+	conf.Global.DockerWaitTimeout = "forever"
+	_, err = conf.dockerReadiness()
+	c.Assert(err, ErrorMatches, `invalid docker-wait-timeout "forever".*`)
+}
+
+func (s *SuiteConfig) TestStartWithoutDocker(c *C) {
+	// nothing listens on the port 1
+	host := "tcp://127.0.0.1:1"
+
+	_, err := NewDockerHandler(&Config{}, &TestLogger{}, host, nil, nil, labelPrefix, dockerReadiness{}, nil)
+	c.Assert(errors.Is(err, core.ErrDockerNotReady), Equals, true)
+
+	h, err := NewDockerHandler(&Config{}, &TestLogger{}, host, nil, nil, labelPrefix, dockerReadiness{optional: true}, nil)
+	c.Assert(err, IsNil)
+	h.Stop()
+}
+
+func (s *SuiteConfig) TestSecretFileWarnings(c *C) {
+	dir := c.MkDir()
+	private, shared := filepath.Join(dir, "private"), filepath.Join(dir, "shared")
+	c.Assert(os.WriteFile(private, []byte("s3cr3t"), 0600), IsNil)
+	c.Assert(os.WriteFile(shared, []byte("s3cr3t"), 0600), IsNil)
+	c.Assert(os.Chmod(shared, 0644), IsNil)
+
+	conf, err := BuildFromString(fmt.Sprintf(`
+		[job-run "backup"]
+		schedule = @hourly
+		image = busybox
+		secret-files = %[1]s/private:/run/secrets/private
+		secret-files = %[1]s/shared:/run/secrets/shared
+		secret-files = %[1]s/missing:/run/secrets/missing
+	`, dir), &TestLogger{})
+	c.Assert(err, IsNil)
+	c.Assert(conf.RunJobs["backup"].SecretFiles, HasLen, 3)
+	c.Assert(conf.secretFileWarnings(), DeepEquals, []string{
+		fmt.Sprintf(`job "backup": secret file %q doesn't exist`, filepath.Join(dir, "missing")),
+		fmt.Sprintf(`job "backup": secret file %q is readable by everyone`, shared),
+	})
+}
+
+func (s *SuiteConfig) TestShellWrappersWithoutInit(c *C) {
+	conf, err := BuildFromString(`
+		[job-run "wrapper"]
+		schedule = @hourly
+		image = busybox
+		command = /bin/sh -c "worker & worker; wait"
+		[job-run "reaped"]
+		schedule = @hourly
+		image = busybox
+		command = bash -c "worker & wait"
+		init = true
+		[job-run "direct"]
+		schedule = @hourly
+		image = busybox
+		command = worker --once
+		[job-run "started"]
+		schedule = @hourly
+		container = worker
+		[job-run "shell"]
+		schedule = @hourly
+		image = busybox
+		command = worker & wait
+		shell = true
+	`, &TestLogger{})
+	c.Assert(err, IsNil)
+	c.Assert(conf.RunJobs["reaped"].Init, Equals, true)
+	c.Assert(conf.shellWrappersWithoutInit(), DeepEquals, []string{"shell", "wrapper"})
+}
+
+func (s *SuiteConfig) TestShutdownTimeout(c *C) {
+	conf := &Config{}
+	timeout, err := conf.shutdownTimeout()
+	c.Assert(err, IsNil)
+	c.Assert(timeout, Equals, time.Duration(0))
+
+	conf.Global.ShutdownTimeout = "30s"
+	timeout, err = conf.shutdownTimeout()
+	c.Assert(err, IsNil)
+	c.Assert(timeout, Equals, 30*time.Second)
+
+	conf.Global.ShutdownTimeout = "0s"
+	_, err = conf.shutdownTimeout()
+	c.Assert(err, ErrorMatches, `invalid shutdown-timeout "0s", expected a positive duration`)
+
+	conf.Global.ShutdownTimeout = "soon"
+	_, err = conf.shutdownTimeout()
+	c.Assert(err, ErrorMatches, `invalid shutdown-timeout "soon".*`)
+}
+
+func (s *SuiteConfig) TestDockerTimeouts(c *C) {
+	conf, err := BuildFromString(`
+		[global]
+		docker-pull-timeout = 5m
+		docker-inspect-timeout = 30s
+	`, &TestLogger{})
+	c.Assert(err, IsNil)
+
+	pull, inspect, err := conf.dockerTimeouts()
+	c.Assert(err, IsNil)
+	c.Assert(pull, Equals, 5*time.Minute)
+	c.Assert(inspect, Equals, 30*time.Second)
+
+	conf.Global.DockerInspectTimeout = "-1s"
+	_, _, err = conf.dockerTimeouts()
+	c.Assert(err, ErrorMatches, `invalid docker-inspect-timeout "-1s", expected a positive duration`)
+
+	conf.Global.DockerPullTimeout = "later"
+	_, _, err = conf.dockerTimeouts()
+	c.Assert(err, ErrorMatches, `invalid docker-pull-timeout "later".*`)
+}
+
+func (s *SuiteConfig) TestMaintenanceWindows(c *C) {
+	conf, err := BuildFromString(`
+		[global]
+		maintenance-window = 0 2 * * * 2h
+		maintenance-window = @weekly 30m
+		maintenance-policy = defer
+
+		[job-local "critical"]
+		schedule = @hourly
+		command = echo critical
+		ignore-maintenance = true
+	`, &TestLogger{})
+	c.Assert(err, IsNil)
+	c.Assert(conf.LocalJobs["critical"].IgnoreMaintenance, Equals, true)
+
+	windows, err := conf.maintenanceWindows()
+	c.Assert(err, IsNil)
+	c.Assert(windows, HasLen, 2)
+	c.Assert(windows[0].Duration, Equals, 2*time.Hour)
+	c.Assert(windows[1].Spec, Equals, "@weekly 30m")
+
+	conf.Global.MaintenanceWindows = append(conf.Global.MaintenanceWindows, "nightly")
+	_, err = conf.maintenanceWindows()
+	c.Assert(err, ErrorMatches, `invalid maintenance window "nightly", expected a schedule and a duration`)
+
+	conf.Global.MaintenancePolicy = "postpone"
+	_, err = conf.maintenanceWindows()
+	c.Assert(err, ErrorMatches, `unknown maintenance policy: "postpone"`)
+}
+
+func (s *SuiteConfig) TestDockerMaxOpsPerSecond(c *C) {
+	conf, err := BuildFromString(`
+		[global]
+		docker-max-ops-per-second = 2.5
+	`, &TestLogger{})
+	c.Assert(err, IsNil)
+	c.Assert(conf.Global.DockerMaxOpsPerSecond, Equals, 2.5)
+}
+
+func (s *SuiteConfig) TestDisableMiddlewares(c *C) {
+	conf, err := BuildFromString(`
+		[global]
+		save-folder = /tmp
+		slack-webhook = http://localhost/slack
+
+		[job-local "binary"]
+		schedule = @hourly
+		command = cat image.png
+		disable-middlewares = save
+		disable-middlewares = overlap
+		no-overlap = true
+
+		[job-local "typo"]
+		schedule = @hourly
+		command = echo typo
+		disable-middlewares = saev
+	`, &TestLogger{})
+	c.Assert(err, IsNil)
+
+	sh := core.NewScheduler(&TestLogger{})
+	c.Assert(conf.buildSchedulerMiddlewares(sh), IsNil)
+
+	j := conf.LocalJobs["binary"]
+	j.Name = "binary"
+	j.buildMiddlewares()
+	c.Assert(sh.AddJob(j), IsNil)
+
+	var names []string
+	for _, m := range j.Middlewares() {
+		names = append(names, core.MiddlewareName(m))
+	}
+
+	// the global slack and redact are kept, the global save and the job
+	// overlap aren't
+	c.Assert(names, DeepEquals, []string{"slack", "redact"})
+
+	c.Assert(conf.disabledMiddlewareWarnings(), DeepEquals, []string{
+		`job "typo": unknown middleware "saev" in disable-middlewares`,
+	})
+}
+
+func (s *SuiteConfig) TestLabelPrefix(c *C) {
+	conf := NewConfig(&TestLogger{})
+	prefix, err := conf.labelPrefix()
+	c.Assert(err, IsNil)
+	c.Assert(prefix, Equals, "ofelia")
+
+	conf.Global.LabelNamespace = "team_a-1"
+	prefix, err = conf.labelPrefix()
+	c.Assert(err, IsNil)
+	c.Assert(prefix, Equals, "ofelia.team_a-1")
+
+	conf.Global.LabelNamespace = "team.a"
+	_, err = conf.labelPrefix()
+	c.Assert(err, ErrorMatches, `invalid label-namespace "team.a".*`)
+
+	conf.Global.LabelNamespace = "job-exec"
+	_, err = conf.labelPrefix()
+	c.Assert(err, ErrorMatches, `invalid label-namespace "job-exec", it's a reserved label name`)
+}
@@ -2,35 +2,66 @@ package cli
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 
 	"github.com/netresearch/ofelia/core"
 )
 
+var errInvalidConfig = errors.New("invalid configuration")
+
 // DaemonCommand daemon process
 type DaemonCommand struct {
 	ConfigFile    string   `long:"config" description:"configuration file" default:"/etc/ofelia.conf"`
+	ConfigFormat  string   `long:"config-format" description:"format of the configuration file, ini or yaml, detected from the extension by default"`
+	ConfigDir     string   `long:"config-dir" description:"directory of INI configuration files, merged in sorted order, instead of --config"`
 	DockerFilters []string `short:"f" long:"docker-filter" description:"Filter for docker containers"`
 	EnablePprof   bool     `long:"enable-pprof" description:"Enable the pprof HTTP server"`
 	PprofAddr     string   `long:"pprof-address" description:"Address for the pprof HTTP server to listen on" default:"127.0.0.1:8080"`
+	EnableHealth  bool     `long:"enable-health" description:"Enable the /healthz and /readyz HTTP probes"`
+	HealthAddr    string   `long:"health-address" description:"Address for the probes HTTP server to listen on" default:":8081"`
+	WatchConfig   bool     `long:"watch-config" description:"Reload the jobs of the configuration file when it changes"`
+	DryRun        bool     `long:"dry-run" description:"Print the jobs of the configuration file without scheduling them"`
+	JSON          bool     `long:"json" description:"Print the dry run report as JSON"`
+	RunOnce       bool     `long:"run-once" description:"Run every job once and exit, with an error if any failed"`
 
 	scheduler  *core.Scheduler
+	config     *Config
 	signals    chan os.Signal
 	httpServer *http.Server
-	done       chan struct{}
-	Logger     core.Logger
+	// healthServer serves the probes, nil unless enabled
+	healthServer *http.Server
+	// trigger listens on the trigger-socket, nil unless set
+	trigger net.Listener
+	// done is closed by stop, once, on a signal or a failed HTTP server
+	done     chan struct{}
+	doneOnce sync.Once
+	Logger   core.Logger
 }
 
 // Execute runs the daemon
 func (c *DaemonCommand) Execute(args []string) error {
+	if c.DryRun {
+		return c.dryRun(os.Stdout)
+	}
+
 	if err := c.boot(); err != nil {
 		return err
 	}
 
+	if c.RunOnce {
+		return c.runOnce()
+	}
+
 	if err := c.start(); err != nil {
 		return err
 	}
@@ -46,55 +77,159 @@ func (c *DaemonCommand) boot() (err error) {
 	c.httpServer = &http.Server{Addr: c.PprofAddr}
 
 	// Always try to read the config file, as there are options such as globals or some tasks that can be specified there and not in docker
-	config, err := BuildFromFile(c.ConfigFile, c.Logger)
-	if err != nil {
-		c.Logger.Debugf("Config file: %v not found", c.ConfigFile)
+	// A missing file is fine, the jobs can all be defined with Docker labels
+	config, err := BuildFromFileFormat(configPath(c.ConfigFile, c.ConfigDir), c.ConfigFormat, c.Logger)
+	if errors.Is(err, fs.ErrNotExist) {
+		c.Logger.Debugf("Config file: %v not found", configPath(c.ConfigFile, c.ConfigDir))
+	} else if err != nil {
+		c.Logger.Criticalf("Can't read the config: %v", err)
+		return err
 	}
 	config.Docker.Filters = c.DockerFilters
 
+	if err := setLogFormat(config.Global.LogFormat, os.Stdout); err != nil {
+		c.Logger.Criticalf("Can't start the app: %v", err)
+		return err
+	}
+
 	err = config.InitializeApp()
 	if err != nil {
 		c.Logger.Criticalf("Can't start the app: %v", err)
 	}
 	c.scheduler = config.sh
+	c.config = config
 
 	return err
 }
 
+// dryRun prints the jobs that would be registered, it never starts the
+// scheduler nor connects to Docker
+func (c *DaemonCommand) dryRun(w io.Writer) error {
+	config, err := BuildFromFileFormat(configPath(c.ConfigFile, c.ConfigDir), c.ConfigFormat, c.Logger)
+	if err != nil {
+		return err
+	}
+
+	r := config.dryRun()
+	if c.JSON {
+		err = r.WriteJSON(w)
+	} else {
+		err = r.WriteTable(w)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if !r.Valid {
+		return errInvalidConfig
+	}
+
+	return nil
+}
+
 func (c *DaemonCommand) start() error {
 	c.setSignals()
 	if err := c.scheduler.Start(); err != nil {
 		return err
 	}
 
+	if path := c.config.Global.TriggerSocket; path != "" {
+		l, err := listenTrigger(path, c.scheduler, c.Logger)
+		if err != nil {
+			return fmt.Errorf("can't listen on the trigger-socket: %w", err)
+		}
+
+		c.trigger = l
+	}
+
+	if c.WatchConfig {
+		path := configPath(c.ConfigFile, c.ConfigDir)
+		if err := c.config.watchConfig(path, c.ConfigFormat, c.done); err != nil {
+			c.Logger.Errorf("Can't watch %q, changes require a restart: %s", path, err)
+		}
+	}
+
 	if c.EnablePprof {
 		go func() {
 			if err := c.httpServer.ListenAndServe(); err != http.ErrServerClosed {
 				c.Logger.Errorf("Error starting HTTP server: %v", err)
-				close(c.done)
+				c.stop()
 			}
 		}()
 	}
 
+	if c.EnableHealth {
+		c.startHealthServer()
+	}
+
 	return nil
 }
 
+func (c *DaemonCommand) startHealthServer() {
+	var ping func() error
+	if h := c.config.dockerHandler; h != nil {
+		ping = h.GetInternalDockerClient().Ping
+	}
+
+	c.healthServer = &http.Server{Addr: c.HealthAddr, Handler: newHealthHandler(c.scheduler, ping)}
+	go func() {
+		if err := c.healthServer.ListenAndServe(); err != http.ErrServerClosed {
+			c.Logger.Errorf("Error starting the probes HTTP server: %v", err)
+			c.stop()
+		}
+	}()
+}
+
 func (c *DaemonCommand) setSignals() {
 	c.signals = make(chan os.Signal, 1)
 	c.done = make(chan struct{})
 
-	signal.Notify(c.signals, syscall.SIGINT, syscall.SIGTERM)
+	signals := []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+	if sigPause != nil {
+		signals = append(signals, sigPause, sigResume)
+	}
+
+	signal.Notify(c.signals, signals...)
 
 	go func() {
-		sig := <-c.signals
-		c.Logger.Warningf(
-			"Signal received: %s, shutting down the process\n", sig,
-		)
+		for sig := range c.signals {
+			if c.pauseSignal(sig) {
+				continue
+			}
 
-		close(c.done)
+			c.Logger.Warningf(
+				"Signal received: %s, shutting down the process\n", sig,
+			)
+
+			c.stop()
+			return
+		}
 	}()
 }
 
+// stop makes the daemon shut down, it can be called several times
+func (c *DaemonCommand) stop() {
+	c.doneOnce.Do(func() { close(c.done) })
+}
+
+// pauseSignal pauses the scheduled executions on SIGUSR1 and resumes them on
+// SIGUSR2, it reports whether sig was one of them
+func (c *DaemonCommand) pauseSignal(sig os.Signal) bool {
+	switch sig {
+	case sigPause:
+		c.scheduler.PauseAll()
+		c.Logger.Warningf("Signal received: %s, pausing the scheduled jobs", sig)
+	case sigResume:
+		c.scheduler.ResumeAll()
+		c.Logger.Noticef("Signal received: %s, resuming the scheduled jobs", sig)
+	default:
+		return false
+	}
+
+	return true
+}
+
 func (c *DaemonCommand) shutdown() error {
 	<-c.done
 
@@ -103,10 +238,34 @@ func (c *DaemonCommand) shutdown() error {
 		c.Logger.Warningf("Error stopping HTTP server: %v", err)
 	}
 
+	if c.trigger != nil {
+		c.trigger.Close()
+	}
+
+	if c.healthServer != nil {
+		if err := c.healthServer.Shutdown(context.Background()); err != nil {
+			c.Logger.Warningf("Error stopping the probes HTTP server: %v", err)
+		}
+	}
+
+	// the failures of the jobs still running are batched too
+	defer c.config.flushNotifications()
+
 	if !c.scheduler.IsRunning() {
 		return nil
 	}
 
-	c.Logger.Warningf("Waiting running jobs.")
-	return c.scheduler.Stop()
+	// validated at startup
+	timeout, _ := c.config.shutdownTimeout()
+	if timeout > 0 {
+		c.Logger.Warningf("Waiting running jobs, at most %s.", timeout)
+	} else {
+		c.Logger.Warningf("Waiting running jobs.")
+	}
+
+	if err := c.scheduler.StopWithTimeout(timeout); err != nil {
+		c.Logger.Warningf("%s", err)
+	}
+
+	return nil
 }
@@ -0,0 +1,95 @@
+package cli
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/netresearch/ofelia/core"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteDaemon struct{}
+
+var _ = Suite(&SuiteDaemon{})
+
+func (s *SuiteDaemon) TestPauseSignal(c *C) {
+	d := &DaemonCommand{Logger: &TestLogger{}, scheduler: core.NewScheduler(&TestLogger{})}
+
+	c.Assert(d.pauseSignal(sigPause), Equals, true)
+	c.Assert(d.scheduler.IsPaused(), Equals, true)
+
+	c.Assert(d.pauseSignal(sigResume), Equals, true)
+	c.Assert(d.scheduler.IsPaused(), Equals, false)
+
+	c.Assert(d.pauseSignal(syscall.SIGTERM), Equals, false)
+	c.Assert(d.scheduler.IsPaused(), Equals, false)
+}
+
+func (s *SuiteDaemon) TestStopTwice(c *C) {
+	d := &DaemonCommand{Logger: &TestLogger{}, done: make(chan struct{})}
+
+	// a signal and a failed HTTP server
+	d.stop()
+	d.stop()
+
+	select {
+	case <-d.done:
+	default:
+		c.Fatal("done isn't closed")
+	}
+}
+
+func (s *SuiteDaemon) TestBootInvalidConfig(c *C) {
+	file := filepath.Join(c.MkDir(), "ofelia.ini")
+	c.Assert(os.WriteFile(file, []byte(`
+		[job-local "backup"]
+		schedule = @daily
+		command = ${OFELIA_TEST_MISSING:?is required}
+	`), 0644), IsNil)
+
+	d := &DaemonCommand{Logger: &TestLogger{}, ConfigFile: file}
+	c.Assert(d.boot(), ErrorMatches, `.*variable OFELIA_TEST_MISSING: is required`)
+	c.Assert(d.config, IsNil)
+}
+
+func (s *SuiteDaemon) TestShutdownTimeout(c *C) {
+	job := &core.LocalJob{}
+	job.Name = "slow"
+	job.Schedule = "@hourly"
+	job.Command = "sleep 60"
+
+	sc := core.NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(job), IsNil)
+	c.Assert(sc.Start(), IsNil)
+
+	config := &Config{}
+	config.Global.ShutdownTimeout = "200ms"
+	d := &DaemonCommand{
+		Logger:     &TestLogger{},
+		scheduler:  sc,
+		config:     config,
+		httpServer: &http.Server{},
+		done:       make(chan struct{}),
+	}
+
+	executions := make(chan *core.Execution, 1)
+	go func() {
+		e, _ := sc.RunJob(job.Name)
+		executions <- e
+	}()
+	time.Sleep(200 * time.Millisecond)
+
+	close(d.done)
+	start := time.Now()
+	c.Assert(d.shutdown(), IsNil)
+	c.Assert(time.Since(start) < 5*time.Second, Equals, true)
+	c.Assert(sc.IsRunning(), Equals, false)
+
+	// the job was force-stopped
+	e := <-executions
+	c.Assert(e.Failed, Equals, true)
+}
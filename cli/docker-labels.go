@@ -2,19 +2,26 @@ package cli
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
 	"strings"
 
+	"github.com/netresearch/ofelia/core"
+
 	"github.com/mitchellh/mapstructure"
 )
 
 const (
 	labelPrefix = "ofelia"
 
-	requiredLabel       = labelPrefix + ".enabled"
-	requiredLabelFilter = requiredLabel + "=true"
-	serviceLabel        = labelPrefix + ".service"
+	requiredLabel = labelPrefix + ".enabled"
+	serviceLabel  = labelPrefix + ".service"
 )
 
+var labelNamespacePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
 func (c *Config) buildFromDockerLabels(labels map[string]map[string]string) error {
 	execJobs := make(map[string]map[string]interface{})
 	localJobs := make(map[string]map[string]interface{})
@@ -76,6 +83,34 @@ func (c *Config) buildFromDockerLabels(labels map[string]map[string]string) erro
 		}
 	}
 
+	// the values are expanded once parsed, so a variable can't change the
+	// JSON lists
+	strict, err := c.strictEnv()
+	if err != nil {
+		return err
+	}
+
+	// the values failing to expand drop their job, or the global options,
+	// the rest being read anyway
+	var invalid invalidLabels
+	if err := expandParams(globalConfigs, strict); err != nil {
+		invalid = append(invalid, fmt.Errorf("global %w", err))
+		globalConfigs = nil
+	}
+
+	for jobType, jobs := range map[string]map[string]map[string]interface{}{
+		jobExec: execJobs, jobLocal: localJobs, jobServiceRun: serviceJobs, jobRun: runJobs,
+	} {
+		for name, params := range jobs {
+			if err := expandParams(params, strict); err != nil {
+				invalid = append(invalid, fmt.Errorf("%s %q: %w", jobType, name, err))
+				delete(jobs, name)
+			}
+		}
+	}
+
+	sort.Slice(invalid, func(i, j int) bool { return invalid[i].Error() < invalid[j].Error() })
+
 	if len(globalConfigs) > 0 {
 		if err := mapstructure.WeakDecode(globalConfigs, &c.Global); err != nil {
 			return err
@@ -106,19 +141,53 @@ func (c *Config) buildFromDockerLabels(labels map[string]map[string]string) erro
 		}
 	}
 
+	if len(invalid) > 0 {
+		return invalid
+	}
+
 	return nil
 }
 
+// invalidLabels are the jobs, or the global options, of the Docker labels
+// dropped by buildFromDockerLabels, which reads the others anyway
+type invalidLabels []error
+
+func (e invalidLabels) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+
+	return strings.Join(msgs, ", ")
+}
+
+// readDockerLabels reads the Docker labels into c, logging the jobs dropped
+// since they can't be read. It returns false if none could be read.
+func (c *Config) readDockerLabels(labels map[string]map[string]string, logger core.Logger) bool {
+	err := c.buildFromDockerLabels(labels)
+	if err == nil {
+		return true
+	}
+
+	var invalid invalidLabels
+	if !errors.As(err, &invalid) {
+		logger.Errorf("Can't read the Docker labels: %s", err)
+		return false
+	}
+
+	for _, err := range invalid {
+		logger.Errorf("Can't read the Docker labels of %s", err)
+	}
+
+	return true
+}
+
 func setJobParam(params map[string]interface{}, paramName, paramVal string) {
 	switch paramName {
-	case "volume":
-		arr := []string{} // allow providing JSON arr of volume mounts
-		if err := json.Unmarshal([]byte(paramVal), &arr); err == nil {
-			params[paramName] = arr
-			return
-		}
-	case "environment":
-		arr := []string{} // allow providing JSON arr of env keyvalues
+	case "volume", "secret-files", "environment", "extra-hosts", "container-labels",
+		"tmpfs", "cap-add", "cap-drop", "devices", "ulimits", "sysctls", "network-aliases", "log-opts",
+		"disable-middlewares", "secrets", "configs":
+		arr := []string{} // allow providing JSON arr of values
 		if err := json.Unmarshal([]byte(paramVal), &arr); err == nil {
 			params[paramName] = arr
 			return
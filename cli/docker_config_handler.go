@@ -2,9 +2,12 @@ package cli
 
 import (
 	"errors"
+	"fmt"
+	"os"
 	"strings"
 	"time"
 
+	"github.com/docker/docker/api/types/swarm"
 	docker "github.com/fsouza/go-dockerclient"
 	"github.com/netresearch/ofelia/core"
 )
@@ -12,10 +15,25 @@ import (
 var ErrNoContainerWithOfeliaEnabled = errors.New("Couldn't find containers with label 'ofelia.enabled=true'")
 
 type DockerHandler struct {
+	host         string
+	tls          *core.DockerTLS
 	filters      []string
 	dockerClient *docker.Client
 	notifier     dockerLabelsUpdate
 	logger       core.Logger
+	stop         chan struct{}
+	// prefix is the one of the labels read, `ofelia` or `ofelia.<namespace>`
+	prefix string
+	// options are the ones of the calls listing the containers and services
+	options *core.DockerOptions
+}
+
+// dockerReadiness is how the daemon is waited for at startup
+type dockerReadiness struct {
+	// timeout is the maximum wait, the daemon is checked once if zero
+	timeout time.Duration
+	// optional starts without the daemon if it isn't ready in time
+	optional bool
 }
 
 type dockerLabelsUpdate interface {
@@ -27,7 +45,23 @@ func (c *DockerHandler) GetInternalDockerClient() *docker.Client {
 	return c.dockerClient
 }
 
+// buildDockerClient returns the client of the configured host and TLS
+// files, or of the DOCKER_HOST, DOCKER_TLS_VERIFY and DOCKER_CERT_PATH
+// environment variables
 func (c *DockerHandler) buildDockerClient() (*docker.Client, error) {
+	host := c.host
+	if env := os.Getenv("DOCKER_HOST"); host == "" && (c.tls != nil || strings.HasPrefix(env, "ssh://")) {
+		host = env
+	}
+
+	if c.tls != nil {
+		return core.NewDockerTLSClient(host, c.tls)
+	}
+
+	if host != "" {
+		return core.NewDockerClient(host)
+	}
+
 	d, err := docker.NewClientFromEnv()
 	if err != nil {
 		return nil, err
@@ -36,11 +70,19 @@ func (c *DockerHandler) buildDockerClient() (*docker.Client, error) {
 	return d, nil
 }
 
-func NewDockerHandler(notifier dockerLabelsUpdate, logger core.Logger, filters []string) (*DockerHandler, error) {
+func NewDockerHandler(
+	notifier dockerLabelsUpdate, logger core.Logger, host string, tls *core.DockerTLS, filters []string,
+	prefix string, ready dockerReadiness, options *core.DockerOptions,
+) (*DockerHandler, error) {
 	c := &DockerHandler{
+		host:     host,
+		tls:      tls,
 		filters:  filters,
+		prefix:   prefix,
+		options:  options,
 		notifier: notifier,
 		logger:   logger,
+		stop:     make(chan struct{}),
 	}
 
 	var err error
@@ -49,9 +91,21 @@ func NewDockerHandler(notifier dockerLabelsUpdate, logger core.Logger, filters [
 		return nil, err
 	}
 
-	// Do a sanity check on docker
-	if _, err = c.dockerClient.Info(); err != nil {
-		return nil, err
+	// Do a sanity check on docker, once it answers
+	if err = core.WaitForDocker(c.dockerClient, ready.timeout, logger); err == nil {
+		_, err = c.dockerClient.Info()
+	}
+
+	if err != nil {
+		if c.tls != nil {
+			err = fmt.Errorf("error connecting to the Docker daemon with TLS, check the docker-tls-* files: %w", err)
+		}
+
+		if !ready.optional {
+			return nil, err
+		}
+
+		logger.Warningf("Starting without the Docker daemon, its jobs fail until it is ready: %s", err)
 	}
 
 	go c.watch()
@@ -60,10 +114,13 @@ func NewDockerHandler(notifier dockerLabelsUpdate, logger core.Logger, filters [
 
 func (c *DockerHandler) watch() {
 	// Poll for changes
-	tick := time.Tick(10000 * time.Millisecond)
+	tick := time.NewTicker(10000 * time.Millisecond)
+	defer tick.Stop()
 	for {
 		select {
-		case <-tick:
+		case <-c.stop:
+			return
+		case <-tick.C:
 			labels, err := c.GetDockerLabels()
 			// Do not print or care if there is no container up right now
 			if err != nil && !errors.Is(err, ErrNoContainerWithOfeliaEnabled) {
@@ -74,9 +131,25 @@ func (c *DockerHandler) watch() {
 	}
 }
 
+// Stop stops polling the labels of the containers and closes the idle
+// connections of the client
+func (c *DockerHandler) Stop() {
+	select {
+	case <-c.stop:
+	default:
+		close(c.stop)
+	}
+
+	c.dockerClient.HTTPClient.CloseIdleConnections()
+}
+
+// GetDockerLabels returns the ofelia labels of the enabled containers and,
+// on a swarm manager, of the enabled services, indexed by container. With a
+// label namespace, only the labels under it are read, renamed as the ones
+// without namespace.
 func (c *DockerHandler) GetDockerLabels() (map[string]map[string]string, error) {
 	filters := map[string][]string{
-		"label": {requiredLabelFilter},
+		"label": {c.prefix + ".enabled=true"},
 	}
 	for _, f := range c.filters {
 		parts := strings.SplitN(f, "=", 2)
@@ -92,33 +165,128 @@ func (c *DockerHandler) GetDockerLabels() (map[string]map[string]string, error)
 		}
 	}
 
-	conts, err := c.dockerClient.ListContainers(docker.ListContainersOptions{
-		Filters: filters,
+	var conts []docker.APIContainers
+	err := c.options.Retry(func() (err error) {
+		conts, err = c.dockerClient.ListContainers(docker.ListContainersOptions{
+			Filters: filters,
+		})
+		return err
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	if len(conts) == 0 {
+	var labels = make(map[string]map[string]string)
+
+	for _, cont := range conts {
+		if len(cont.Names) > 0 && len(cont.Labels) > 0 {
+			name := strings.TrimPrefix(cont.Names[0], "/")
+			labels[name] = ofeliaLabels(cont.Labels, c.prefix)
+		}
+	}
+
+	if err := c.addServiceLabels(labels, filters["label"]); err != nil {
+		return nil, err
+	}
+
+	if len(labels) == 0 {
 		return nil, ErrNoContainerWithOfeliaEnabled
 	}
 
-	var labels = make(map[string]map[string]string)
+	return labels, nil
+}
+
+// addServiceLabels adds the ofelia labels of the enabled swarm services,
+// when the daemon is a swarm manager. A service is indexed by the container
+// of one of its tasks running on this node, where its exec jobs run, its
+// exec jobs are dropped if there is none.
+func (c *DockerHandler) addServiceLabels(labels map[string]map[string]string, labelFilters []string) error {
+	var info *docker.DockerInfo
+	err := c.options.Retry(func() (err error) {
+		info, err = c.dockerClient.Info()
+		return err
+	})
+	if err != nil || !info.Swarm.ControlAvailable {
+		return err
+	}
+
+	var services []swarm.Service
+	err = c.options.Retry(func() (err error) {
+		services, err = c.dockerClient.ListServices(docker.ListServicesOptions{
+			Filters: map[string][]string{"label": labelFilters},
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, svc := range services {
+		if svc.Spec.Labels[c.prefix+".enabled"] != "true" {
+			continue
+		}
 
-	for _, c := range conts {
-		if len(c.Names) > 0 && len(c.Labels) > 0 {
-			name := strings.TrimPrefix(c.Names[0], "/")
-			for k := range c.Labels {
-				// remove all not relevant labels
-				if !strings.HasPrefix(k, labelPrefix) {
-					delete(c.Labels, k)
-					continue
+		container, err := c.localTaskContainer(svc.ID, info.Swarm.NodeID)
+		if err != nil {
+			return err
+		}
+
+		l := ofeliaLabels(svc.Spec.Labels, c.prefix)
+		if container == "" {
+			container = svc.Spec.Name
+			for k := range l {
+				if strings.HasPrefix(k, labelPrefix+"."+jobExec+".") {
+					c.logger.Debugf("No task of the service %q running on this node, ignoring %q", svc.Spec.Name, k)
+					delete(l, k)
 				}
 			}
+		}
 
-			labels[name] = c.Labels
+		labels[container] = l
+	}
+
+	return nil
+}
+
+// localTaskContainer returns the container of a running task of the service
+// on the node, empty if there is none
+func (c *DockerHandler) localTaskContainer(service, node string) (string, error) {
+	var tasks []swarm.Task
+	err := c.options.Retry(func() (err error) {
+		tasks, err = c.dockerClient.ListTasks(docker.ListTasksOptions{
+			Filters: map[string][]string{
+				"service":       {service},
+				"node":          {node},
+				"desired-state": {string(swarm.TaskStateRunning)},
+			},
+		})
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	for _, t := range tasks {
+		if t.Status.State == swarm.TaskStateRunning && t.Status.ContainerStatus != nil && t.Status.ContainerStatus.ContainerID != "" {
+			return t.Status.ContainerStatus.ContainerID, nil
 		}
 	}
 
-	return labels, nil
+	return "", nil
+}
+
+// ofeliaLabels returns the labels relevant to ofelia, the ones under prefix.
+// With a namespace in prefix, they are renamed under labelPrefix.
+func ofeliaLabels(labels map[string]string, prefix string) map[string]string {
+	l := make(map[string]string)
+	for k, v := range labels {
+		switch {
+		case prefix == labelPrefix && strings.HasPrefix(k, labelPrefix):
+			l[k] = v
+		case prefix != labelPrefix && strings.HasPrefix(k, prefix+"."):
+			l[labelPrefix+strings.TrimPrefix(k, prefix)] = v
+		}
+	}
+
+	return l
 }
@@ -0,0 +1,185 @@
+package cli
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/docker/docker/api/types/swarm"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/fsouza/go-dockerclient/testing"
+	"github.com/netresearch/ofelia/core"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteDockerHandler struct {
+	server  *testing.DockerServer
+	client  *docker.Client
+	handler *DockerHandler
+	// tasks are the running tasks by service name, with their container
+	tasks map[string]string
+}
+
+var _ = Suite(&SuiteDockerHandler{})
+
+func (s *SuiteDockerHandler) SetUpTest(c *C) {
+	var err error
+	s.server, err = testing.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, IsNil)
+
+	s.client, err = docker.NewClient(s.server.URL())
+	c.Assert(err, IsNil)
+
+	_, err = s.client.InitSwarm(docker.InitSwarmOptions{})
+	c.Assert(err, IsNil)
+
+	// the test server reports neither the manager role nor running tasks
+	s.server.CustomHandler("/info", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(docker.DockerInfo{Swarm: swarm.Info{NodeID: "node", ControlAvailable: true}})
+	}))
+
+	s.tasks = make(map[string]string)
+	s.server.CustomHandler("/tasks", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var filters map[string][]string
+		json.Unmarshal([]byte(r.FormValue("filters")), &filters)
+
+		var tasks []swarm.Task
+		svc, err := s.client.InspectService(filters["service"][0])
+		c.Assert(err, IsNil)
+		if container, ok := s.tasks[svc.Spec.Name]; ok && filters["node"][0] == "node" {
+			tasks = append(tasks, swarm.Task{
+				ServiceID: svc.ID,
+				NodeID:    "node",
+				Status: swarm.TaskStatus{
+					State:           swarm.TaskStateRunning,
+					ContainerStatus: &swarm.ContainerStatus{ContainerID: container},
+				},
+			})
+		}
+
+		json.NewEncoder(w).Encode(tasks)
+	}))
+
+	s.handler, err = NewDockerHandler(&Config{}, &TestLogger{}, s.server.URL(), nil, nil, labelPrefix, dockerReadiness{}, nil)
+	c.Assert(err, IsNil)
+}
+
+func (s *SuiteDockerHandler) TearDownTest(c *C) {
+	s.handler.Stop()
+	s.server.Stop()
+}
+
+func (s *SuiteDockerHandler) createService(c *C, name string, labels map[string]string) {
+	_, err := s.client.CreateService(docker.CreateServiceOptions{ServiceSpec: swarm.ServiceSpec{
+		Annotations:  swarm.Annotations{Name: name, Labels: labels},
+		TaskTemplate: swarm.TaskSpec{ContainerSpec: &swarm.ContainerSpec{Image: "busybox"}},
+	}})
+	c.Assert(err, IsNil)
+}
+
+func (s *SuiteDockerHandler) TestServiceLabels(c *C) {
+	s.createService(c, "web", map[string]string{
+		requiredLabel:                            "true",
+		"com.example.team":                       "ops",
+		labelPrefix + ".job-exec.flush.schedule": "@hourly",
+		labelPrefix + ".job-exec.flush.command":  "nginx -s reopen",
+	})
+	s.createService(c, "batch", map[string]string{
+		requiredLabel:                            "true",
+		labelPrefix + ".job-exec.clean.schedule": "@daily",
+		labelPrefix + ".job-run.report.schedule": "@daily",
+		labelPrefix + ".job-run.report.image":    "busybox",
+	})
+	s.createService(c, "disabled", map[string]string{
+		labelPrefix + ".job-exec.other.schedule": "@daily",
+	})
+	s.tasks["web"] = "web-task"
+
+	labels, err := s.handler.GetDockerLabels()
+	c.Assert(err, IsNil)
+	c.Assert(labels, DeepEquals, map[string]map[string]string{
+		"web-task": {
+			requiredLabel:                            "true",
+			labelPrefix + ".job-exec.flush.schedule": "@hourly",
+			labelPrefix + ".job-exec.flush.command":  "nginx -s reopen",
+		},
+		// no task on this node to exec in
+		"batch": {
+			requiredLabel:                            "true",
+			labelPrefix + ".job-run.report.schedule": "@daily",
+			labelPrefix + ".job-run.report.image":    "busybox",
+		},
+	})
+}
+
+func (s *SuiteDockerHandler) TestServiceJobsSynced(c *C) {
+	s.createService(c, "web", map[string]string{
+		requiredLabel:                            "true",
+		labelPrefix + ".job-exec.flush.schedule": "@hourly",
+		labelPrefix + ".job-exec.flush.command":  "nginx -s reopen",
+	})
+	s.tasks["web"] = "web-task"
+
+	conf := NewConfig(&TestLogger{})
+	conf.sh = core.NewScheduler(&TestLogger{})
+	conf.dockerHandler = s.handler
+
+	labels, err := s.handler.GetDockerLabels()
+	c.Assert(err, IsNil)
+	conf.dockerLabelsUpdate(labels)
+	c.Assert(conf.ExecJobs["flush"].Container, Equals, "web-task")
+	c.Assert(conf.sh.Entries(), HasLen, 1)
+
+	// the task was replaced
+	s.tasks["web"] = "web-task-2"
+	labels, err = s.handler.GetDockerLabels()
+	c.Assert(err, IsNil)
+	conf.dockerLabelsUpdate(labels)
+	c.Assert(conf.ExecJobs["flush"].Container, Equals, "web-task-2")
+	c.Assert(conf.sh.Entries(), HasLen, 1)
+}
+
+func (s *SuiteDockerHandler) TestLabelNamespace(c *C) {
+	for _, name := range []string{"a", "b"} {
+		s.createService(c, "team-"+name, map[string]string{
+			"ofelia." + name + ".enabled":                    "true",
+			"ofelia." + name + ".job-exec.backup.schedule":   "@daily",
+			"ofelia." + name + ".job-exec.backup.command":    "backup " + name,
+			"ofelia." + name + ".job-run.report.image":       "busybox",
+			"ofelia.job-exec.unnamespaced.schedule":          "@hourly",
+			"ofelia.other.job-exec.other-namespace.schedule": "@hourly",
+		})
+		s.tasks["team-"+name] = "team-" + name + "-task"
+	}
+
+	for _, name := range []string{"a", "b"} {
+		conf := NewConfig(&TestLogger{})
+		conf.Global.LabelNamespace = name
+		prefix, err := conf.labelPrefix()
+		c.Assert(err, IsNil)
+
+		h, err := NewDockerHandler(conf, &TestLogger{}, s.server.URL(), nil, nil, prefix, dockerReadiness{}, nil)
+		c.Assert(err, IsNil)
+		defer h.Stop()
+
+		labels, err := h.GetDockerLabels()
+		c.Assert(err, IsNil)
+		c.Assert(labels, DeepEquals, map[string]map[string]string{
+			"team-" + name + "-task": {
+				requiredLabel: "true",
+				labelPrefix + ".job-exec.backup.schedule": "@daily",
+				labelPrefix + ".job-exec.backup.command":  "backup " + name,
+				labelPrefix + ".job-run.report.image":     "busybox",
+			},
+		})
+
+		c.Assert(conf.buildFromDockerLabels(labels), IsNil)
+		c.Assert(conf.ExecJobs, HasLen, 1)
+		c.Assert(conf.ExecJobs["backup"].Command, Equals, "backup "+name)
+		c.Assert(conf.ExecJobs["backup"].Container, Equals, "team-"+name+"-task")
+	}
+
+	// the default instance reads none of them
+	_, err := s.handler.GetDockerLabels()
+	c.Assert(err, Equals, ErrNoContainerWithOfeliaEnabled)
+}
@@ -0,0 +1,290 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/netresearch/ofelia/core"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+var (
+	errUnknownDockerEndpoint = errors.New("unknown docker-endpoint")
+	errDockerTargetConflict  = errors.New("docker-endpoint and docker-host can't be used together")
+)
+
+// DockerEndpointConfig is a named Docker daemon, the name being the one of
+// the section
+type DockerEndpointConfig struct {
+	Host string
+	// TLSCert, TLSKey and TLSCA are the paths of the client certificate,
+	// its key and the CA certificate of a TLS daemon
+	TLSCert string `gcfg:"tls-cert" mapstructure:"tls-cert"`
+	TLSKey  string `gcfg:"tls-key" mapstructure:"tls-key"`
+	TLSCA   string `gcfg:"tls-ca" mapstructure:"tls-ca"`
+}
+
+// validate checks the host and the TLS files of the endpoint
+func (e *DockerEndpointConfig) validate() error {
+	if e.Host == "" {
+		return errors.New("host is required")
+	}
+
+	if err := core.ValidateDockerHost(e.Host); err != nil {
+		return err
+	}
+
+	hasTLS := e.TLSCert != "" || e.TLSKey != "" || e.TLSCA != ""
+	if hasTLS && strings.HasPrefix(e.Host, "ssh://") {
+		return errors.New("the TLS files can't be used with an ssh:// host")
+	}
+
+	if hasTLS && (e.TLSCert == "" || e.TLSKey == "") {
+		return errors.New("tls-cert and tls-key are required with TLS")
+	}
+
+	return nil
+}
+
+// newEndpointClient returns a client of the endpoint, without connecting
+func newEndpointClient(e *DockerEndpointConfig) (*docker.Client, error) {
+	if e.TLSCert != "" {
+		return core.NewDockerTLSClient(e.Host, &core.DockerTLS{
+			Cert: e.TLSCert, Key: e.TLSKey, CA: e.TLSCA, Verify: true,
+		})
+	}
+
+	return core.NewDockerClient(e.Host)
+}
+
+// dockerClientFactory creates the clients of the endpoints and hosts of the
+// jobs, replaced in the tests
+var dockerClientFactory = newEndpointClient
+
+// dockerClientsMu protects the clients of the endpoints and hosts,
+// requested by the reloads of the config file and the updates of the Docker
+// labels
+var dockerClientsMu sync.Mutex
+
+// dockerClient returns the client of the named endpoint, or of the daemon
+// at host, or the global one if both are empty. A client is created the
+// first time an endpoint or host is used and then shared by all its jobs, a
+// failure to reach the daemon is only logged so the jobs of the other
+// daemons keep running.
+func (c *Config) dockerClient(endpoint, host string) *docker.Client {
+	var key string
+	var e *DockerEndpointConfig
+	switch {
+	case endpoint != "":
+		key, e = "endpoint "+endpoint, c.DockerEndpoints[endpoint]
+	case host != "":
+		key, e = host, &DockerEndpointConfig{Host: host}
+	case c.dockerHandler != nil:
+		return c.dockerHandler.GetInternalDockerClient()
+	}
+
+	if e == nil {
+		// reported by the validation
+		return nil
+	}
+
+	dockerClientsMu.Lock()
+	defer dockerClientsMu.Unlock()
+
+	if client, ok := c.dockerClients[key]; ok {
+		return client
+	}
+
+	client, err := dockerClientFactory(e)
+	if err != nil {
+		c.logger.Errorf("Can't create the Docker client of %s: %s", key, err)
+		return nil
+	}
+
+	if err := client.Ping(); err != nil {
+		c.logger.Errorf("Can't reach the Docker daemon of %s: %s", key, err)
+	}
+
+	if c.dockerClients == nil {
+		c.dockerClients = make(map[string]*docker.Client)
+	}
+
+	c.dockerClients[key] = client
+	return client
+}
+
+// dockerTarget returns the client of dockerClient and the options of its
+// calls, shared by all the jobs using the client
+func (c *Config) dockerTarget(endpoint, host string) (*docker.Client, *core.DockerOptions) {
+	client := c.dockerClient(endpoint, host)
+	if client == nil {
+		return nil, nil
+	}
+
+	dockerClientsMu.Lock()
+	defer dockerClientsMu.Unlock()
+
+	if o, ok := c.dockerOptions[client]; ok {
+		return client, o
+	}
+
+	if c.dockerOptions == nil {
+		c.dockerOptions = make(map[*docker.Client]*core.DockerOptions)
+	}
+
+	o := c.newDockerOptions()
+	c.dockerOptions[client] = o
+	return client, o
+}
+
+// newDockerOptions returns the options of the calls to a Docker client,
+// from the global options. Each client has its own limiter.
+func (c *Config) newDockerOptions() *core.DockerOptions {
+	// the timeouts are checked by InitializeApp and the validation
+	pull, inspect, _ := c.dockerTimeouts()
+
+	return &core.DockerOptions{
+		RetryAttempts:  c.Global.DockerRetryAttempts,
+		Limiter:        core.NewRateLimiter(c.Global.DockerMaxOpsPerSecond),
+		PullTimeout:    pull,
+		InspectTimeout: inspect,
+	}
+}
+
+// closeDockerClients stops polling the container labels and closes the idle
+// connections of the clients, ending the ssh processes of the SSH hosts
+func (c *Config) closeDockerClients() {
+	if c.dockerHandler != nil {
+		c.dockerHandler.Stop()
+	}
+
+	dockerClientsMu.Lock()
+	defer dockerClientsMu.Unlock()
+
+	for _, client := range c.dockerClients {
+		client.HTTPClient.CloseIdleConnections()
+	}
+}
+
+// checkDockerTarget checks the docker-endpoint of a job
+func (c *Config) checkDockerTarget(endpoint, host string) error {
+	if endpoint == "" {
+		return nil
+	}
+
+	if host != "" {
+		return errDockerTargetConflict
+	}
+
+	if _, ok := c.DockerEndpoints[endpoint]; !ok {
+		return fmt.Errorf("%w %q", errUnknownDockerEndpoint, endpoint)
+	}
+
+	return nil
+}
+
+// validateDockerEndpoints checks the docker-endpoint sections, that the jobs
+// only reference existing ones and the docker-retry-attempts
+func (c *Config) validateDockerEndpoints() error {
+	if c.Global.DockerRetryAttempts < 0 {
+		return fmt.Errorf("invalid docker-retry-attempts %d", c.Global.DockerRetryAttempts)
+	}
+
+	for name, e := range c.DockerEndpoints {
+		if err := e.validate(); err != nil {
+			return fmt.Errorf("docker-endpoint %q: %w", name, err)
+		}
+	}
+
+	for name, j := range c.ExecJobs {
+		if err := c.checkDockerTarget(j.DockerEndpoint, j.DockerHost); err != nil {
+			return fmt.Errorf("job %q: %w", name, err)
+		}
+	}
+
+	for name, j := range c.RunJobs {
+		if err := c.checkDockerTarget(j.DockerEndpoint, j.DockerHost); err != nil {
+			return fmt.Errorf("job %q: %w", name, err)
+		}
+	}
+
+	for name, j := range c.ServiceJobs {
+		if err := c.checkDockerTarget(j.DockerEndpoint, j.DockerHost); err != nil {
+			return fmt.Errorf("job %q: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// dockerTLS returns the TLS files of the global Docker daemon, nil if none
+// is set. The files must exist.
+func (c *Config) dockerTLS() (*core.DockerTLS, error) {
+	g := &c.Global
+	if g.DockerTLSCert == "" && g.DockerTLSKey == "" && g.DockerTLSCA == "" && g.DockerTLSVerify == "" {
+		return nil, nil
+	}
+
+	t := &core.DockerTLS{Verify: true}
+	if g.DockerTLSVerify != "" {
+		verify, err := strconv.ParseBool(g.DockerTLSVerify)
+		if err != nil {
+			return nil, fmt.Errorf("invalid docker-tls-verify %q, expected true or false", g.DockerTLSVerify)
+		}
+
+		t.Verify = verify
+	}
+
+	if (g.DockerTLSCert == "") != (g.DockerTLSKey == "") {
+		return nil, errors.New("docker-tls-cert and docker-tls-key must be set together")
+	}
+
+	files := []struct {
+		option string
+		path   *string
+		target *string
+	}{
+		{"docker-tls-cert", &g.DockerTLSCert, &t.Cert},
+		{"docker-tls-key", &g.DockerTLSKey, &t.Key},
+		{"docker-tls-ca", &g.DockerTLSCA, &t.CA},
+	}
+
+	for _, f := range files {
+		if *f.path == "" {
+			continue
+		}
+
+		path := filepath.Clean(*f.path)
+		if _, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("%s: %w", f.option, err)
+		}
+
+		*f.target = path
+	}
+
+	return t, nil
+}
+
+// dropInvalidDockerTargets removes the jobs defined with Docker labels
+// referencing an unknown docker-endpoint, since they couldn't run
+func (c *Config) dropInvalidDockerTargets(labels *Config) {
+	for name, j := range labels.ExecJobs {
+		if err := c.checkDockerTarget(j.DockerEndpoint, j.DockerHost); err != nil {
+			c.logger.Warningf("Ignoring job %q: %s", name, err)
+			delete(labels.ExecJobs, name)
+		}
+	}
+
+	for name, j := range labels.RunJobs {
+		if err := c.checkDockerTarget(j.DockerEndpoint, j.DockerHost); err != nil {
+			c.logger.Warningf("Ignoring job %q: %s", name, err)
+			delete(labels.RunJobs, name)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/netresearch/ofelia/core"
+
+	docker "github.com/fsouza/go-dockerclient"
+	. "gopkg.in/check.v1"
+)
+
+type SuiteDockerEndpoints struct {
+	created []string
+}
+
+var _ = Suite(&SuiteDockerEndpoints{})
+
+func (s *SuiteDockerEndpoints) SetUpTest(c *C) {
+	s.created = nil
+	dockerClientFactory = func(e *DockerEndpointConfig) (*docker.Client, error) {
+		if e.Host == "tcp://broken:2375" {
+			return nil, errors.New("broken")
+		}
+
+		s.created = append(s.created, e.Host)
+		return docker.NewClient("tcp://127.0.0.1:1")
+	}
+}
+
+func (s *SuiteDockerEndpoints) TearDownTest(c *C) {
+	dockerClientFactory = newEndpointClient
+}
+
+func (s *SuiteDockerEndpoints) buildConfig(c *C, ini string) *Config {
+	conf, err := BuildFromString(`
+		[docker-endpoint "build"]
+		host = ssh://builder@build.example.com
+
+		[docker-endpoint "prod"]
+		host = tcp://prod.example.com:2376
+		tls-cert = /certs/cert.pem
+		tls-key = /certs/key.pem
+		tls-ca = /certs/ca.pem
+	`+ini, &TestLogger{})
+	c.Assert(err, IsNil)
+
+	return conf
+}
+
+func (s *SuiteDockerEndpoints) TestSelection(c *C) {
+	conf := s.buildConfig(c, `
+		[job-run "a"]
+		schedule = @hourly
+		image = busybox
+		docker-endpoint = build
+
+		[job-exec "b"]
+		schedule = @hourly
+		container = foo
+		docker-endpoint = prod
+
+		[job-run "c"]
+		schedule = @hourly
+		image = busybox
+		docker-endpoint = build
+	`)
+	c.Assert(conf.validateDockerEndpoints(), IsNil)
+	c.Assert(conf.DockerEndpoints["prod"], DeepEquals, &DockerEndpointConfig{
+		Host: "tcp://prod.example.com:2376", TLSCert: "/certs/cert.pem", TLSKey: "/certs/key.pem", TLSCA: "/certs/ca.pem",
+	})
+
+	a := conf.dockerClient(conf.RunJobs["a"].DockerEndpoint, conf.RunJobs["a"].DockerHost)
+	b := conf.dockerClient(conf.ExecJobs["b"].DockerEndpoint, conf.ExecJobs["b"].DockerHost)
+	c.Assert(a, NotNil)
+	c.Assert(b != a, Equals, true)
+	c.Assert(conf.dockerClient("build", ""), Equals, a)
+
+	// the clients are created lazily, once per endpoint
+	c.Assert(s.created, DeepEquals, []string{"ssh://builder@build.example.com", "tcp://prod.example.com:2376"})
+}
+
+func (s *SuiteDockerEndpoints) TestDockerOptions(c *C) {
+	conf := s.buildConfig(c, `
+		[global]
+		docker-retry-attempts = 5
+		docker-max-ops-per-second = 2
+		docker-pull-timeout = 5m
+		docker-inspect-timeout = 30s
+	`)
+
+	a, options := conf.dockerTarget("build", "")
+	c.Assert(a, Equals, conf.dockerClient("build", ""))
+	c.Assert(options.RetryAttempts, Equals, 5)
+	c.Assert(options.Limiter, NotNil)
+	c.Assert(options.PullTimeout, Equals, 5*time.Minute)
+	c.Assert(options.InspectTimeout, Equals, 30*time.Second)
+
+	// the options are shared by the jobs of the client, each client has its
+	// own limiter
+	_, same := conf.dockerTarget("build", "")
+	c.Assert(same, Equals, options)
+
+	_, other := conf.dockerTarget("prod", "")
+	c.Assert(other.Limiter, NotNil)
+	c.Assert(other.Limiter != options.Limiter, Equals, true)
+
+	// unlimited without docker-max-ops-per-second
+	conf = s.buildConfig(c, "")
+	_, options = conf.dockerTarget("build", "")
+	c.Assert(options, DeepEquals, &core.DockerOptions{})
+
+	client, none := conf.dockerTarget("unknown", "")
+	c.Assert(client, IsNil)
+	c.Assert(none, IsNil)
+}
+
+func (s *SuiteDockerEndpoints) TestHostSelection(c *C) {
+	conf := s.buildConfig(c, `
+		[docker]
+		host = ssh://user@default
+
+		[job-run "a"]
+		schedule = @hourly
+		image = busybox
+		docker-host = ssh://user@remote
+
+		[job-exec "b"]
+		schedule = @hourly
+		container = foo
+		docker-host = ftp://remote
+	`)
+	c.Assert(conf.Docker.Host, Equals, "ssh://user@default")
+	c.Assert(conf.RunJobs["a"].DockerHost, Equals, "ssh://user@remote")
+	c.Assert(core.ValidateJob(conf.ExecJobs["b"]), ErrorMatches, "invalid docker-host.*")
+
+	// without a Docker handler there is no global client
+	c.Assert(conf.dockerClient("", ""), IsNil)
+
+	a := conf.dockerClient("", "ssh://user@remote")
+	c.Assert(a, NotNil)
+	c.Assert(conf.dockerClient("", "ssh://user@remote"), Equals, a)
+	c.Assert(conf.dockerClient("", "tcp://other:2375") != a, Equals, true)
+	c.Assert(conf.dockerClient("", "tcp://broken:2375"), IsNil)
+	c.Assert(conf.dockerClient("unknown", ""), IsNil)
+	c.Assert(s.created, DeepEquals, []string{"ssh://user@remote", "tcp://other:2375"})
+}
+
+func (s *SuiteDockerEndpoints) TestValidation(c *C) {
+	conf := s.buildConfig(c, `
+		[job-run "a"]
+		schedule = @hourly
+		image = busybox
+		docker-endpoint = staging
+	`)
+	c.Assert(conf.validateDockerEndpoints(), ErrorMatches, `job "a": unknown docker-endpoint "staging"`)
+
+	conf.RunJobs["a"].DockerEndpoint = "build"
+	conf.RunJobs["a"].DockerHost = "tcp://other:2375"
+	c.Assert(conf.validateDockerEndpoints(), ErrorMatches, `job "a": docker-endpoint and docker-host can't be used together`)
+
+	conf.RunJobs["a"].DockerHost = ""
+	c.Assert(conf.validateDockerEndpoints(), IsNil)
+
+	conf.DockerEndpoints["build"].TLSCert = "/certs/cert.pem"
+	c.Assert(conf.validateDockerEndpoints(), ErrorMatches, `docker-endpoint "build": the TLS files can't be used with an ssh:// host`)
+
+	conf.DockerEndpoints["build"] = &DockerEndpointConfig{Host: "tcp://build:2376", TLSCA: "/certs/ca.pem"}
+	c.Assert(conf.validateDockerEndpoints(), ErrorMatches, `docker-endpoint "build": tls-cert and tls-key are required with TLS`)
+
+	conf.DockerEndpoints["build"] = &DockerEndpointConfig{}
+	c.Assert(conf.validateDockerEndpoints(), ErrorMatches, `docker-endpoint "build": host is required`)
+
+	conf.DockerEndpoints["build"] = &DockerEndpointConfig{Host: "tcp://build:2375"}
+	conf.Global.DockerRetryAttempts = -1
+	c.Assert(conf.validateDockerEndpoints(), ErrorMatches, `invalid docker-retry-attempts -1`)
+}
+
+func (s *SuiteDockerEndpoints) TestDropInvalidLabelJobs(c *C) {
+	conf := s.buildConfig(c, "")
+
+	labels := &Config{}
+	err := labels.buildFromDockerLabels(map[string]map[string]string{
+		"worker": {
+			requiredLabel:                               "true",
+			serviceLabel:                                "true",
+			labelPrefix + ".job-exec.a.schedule":        "@hourly",
+			labelPrefix + ".job-exec.a.command":         "true",
+			labelPrefix + ".job-exec.a.docker-endpoint": "build",
+			labelPrefix + ".job-run.b.schedule":         "@hourly",
+			labelPrefix + ".job-run.b.image":            "busybox",
+			labelPrefix + ".job-run.b.docker-endpoint":  "staging",
+		},
+	})
+	c.Assert(err, IsNil)
+
+	conf.dropInvalidDockerTargets(labels)
+	c.Assert(labels.ExecJobs, HasLen, 1)
+	c.Assert(labels.RunJobs, HasLen, 0)
+}
+
+func (s *SuiteDockerEndpoints) TestDockerTLS(c *C) {
+	dir := c.MkDir()
+	for _, name := range []string{"cert.pem", "key.pem", "ca.pem"} {
+		c.Assert(os.WriteFile(filepath.Join(dir, name), nil, 0o600), IsNil)
+	}
+
+	conf := &Config{}
+	t, err := conf.dockerTLS()
+	c.Assert(err, IsNil)
+	c.Assert(t, IsNil)
+
+	conf.Global.DockerTLSCert = dir + "/./cert.pem"
+	conf.Global.DockerTLSKey = filepath.Join(dir, "key.pem")
+	conf.Global.DockerTLSCA = filepath.Join(dir, "ca.pem")
+	t, err = conf.dockerTLS()
+	c.Assert(err, IsNil)
+	c.Assert(t, DeepEquals, &core.DockerTLS{
+		Cert:   filepath.Join(dir, "cert.pem"),
+		Key:    filepath.Join(dir, "key.pem"),
+		CA:     filepath.Join(dir, "ca.pem"),
+		Verify: true,
+	})
+
+	conf.Global.DockerTLSVerify = "false"
+	t, err = conf.dockerTLS()
+	c.Assert(err, IsNil)
+	c.Assert(t.Verify, Equals, false)
+
+	conf.Global.DockerTLSVerify = "maybe"
+	_, err = conf.dockerTLS()
+	c.Assert(err, ErrorMatches, `invalid docker-tls-verify "maybe".*`)
+
+	conf.Global.DockerTLSVerify = ""
+	conf.Global.DockerTLSCA = filepath.Join(dir, "missing.pem")
+	_, err = conf.dockerTLS()
+	c.Assert(err, ErrorMatches, "docker-tls-ca: .*no such file or directory")
+
+	conf.Global.DockerTLSKey = ""
+	_, err = conf.dockerTLS()
+	c.Assert(err, ErrorMatches, "docker-tls-cert and docker-tls-key must be set together")
+}
@@ -0,0 +1,165 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/netresearch/ofelia/core"
+
+	defaults "github.com/mcuadros/go-defaults"
+)
+
+// sourceINI is the source of the jobs read from the config file, the jobs
+// defined with Docker labels aren't listed by a dry run since reading them
+// requires a connection to the Docker daemon
+const sourceINI = "ini"
+
+// DryRunJob describes a job as it would be registered by the daemon
+type DryRunJob struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Schedule  string `json:"schedule"`
+	Command   string `json:"command"`
+	Image     string `json:"image,omitempty"`
+	Container string `json:"container,omitempty"`
+	Source    string `json:"source"`
+	Error     string `json:"error,omitempty"`
+}
+
+// DryRunReport is the result of a dry run
+type DryRunReport struct {
+	Valid bool        `json:"valid"`
+	Error string      `json:"error,omitempty"`
+	Jobs  []DryRunJob `json:"jobs"`
+}
+
+// dryRun resolves the defaults of the jobs and validates them, without
+// creating any Docker client nor scheduler
+func (c *Config) dryRun() *DryRunReport {
+	r := &DryRunReport{Valid: true, Jobs: []DryRunJob{}}
+	add := func(name, typ string, j core.Job, image, container string) {
+		defaults.SetDefaults(j)
+		job := DryRunJob{
+			Name:      name,
+			Type:      typ,
+			Schedule:  j.GetSchedule(),
+			Command:   j.GetCommand(),
+			Image:     image,
+			Container: container,
+			Source:    sourceINI,
+		}
+
+		if err := core.ValidateJob(j); err != nil {
+			job.Error = err.Error()
+			r.Valid = false
+		}
+
+		r.Jobs = append(r.Jobs, job)
+	}
+
+	for name, j := range c.ExecJobs {
+		add(name, jobExec, j, "", j.Container)
+	}
+
+	for name, j := range c.RunJobs {
+		add(name, jobRun, j, j.Image, j.Container)
+	}
+
+	for name, j := range c.LocalJobs {
+		add(name, jobLocal, j, "", "")
+	}
+
+	for name, j := range c.ServiceJobs {
+		add(name, jobServiceRun, j, j.Image, "")
+	}
+
+	sort.Slice(r.Jobs, func(i, j int) bool {
+		if r.Jobs[i].Type != r.Jobs[j].Type {
+			return r.Jobs[i].Type < r.Jobs[j].Type
+		}
+
+		return r.Jobs[i].Name < r.Jobs[j].Name
+	})
+
+	if _, err := c.defaultJitter(); err != nil {
+		r.Error = err.Error()
+		r.Valid = false
+	}
+
+	if _, err := core.ParseMaxOutput(c.Global.MaxOutput, 0); err != nil && r.Error == "" {
+		r.Error = err.Error()
+		r.Valid = false
+	}
+
+	if err := validateLogFormat(c.Global.LogFormat); err != nil && r.Error == "" {
+		r.Error = err.Error()
+		r.Valid = false
+	}
+
+	if _, err := c.sweepAge(); err != nil && r.Error == "" {
+		r.Error = err.Error()
+		r.Valid = false
+	}
+
+	if _, err := c.dockerReadiness(); err != nil && r.Error == "" {
+		r.Error = err.Error()
+		r.Valid = false
+	}
+
+	if _, err := c.shutdownTimeout(); err != nil && r.Error == "" {
+		r.Error = err.Error()
+		r.Valid = false
+	}
+
+	if err := c.validateNotifications(); err != nil && r.Error == "" {
+		r.Error = err.Error()
+		r.Valid = false
+	}
+
+	if err := c.validateDockerEndpoints(); err != nil && r.Error == "" {
+		r.Error = err.Error()
+		r.Valid = false
+	}
+
+	return r
+}
+
+// WriteTable writes the report as a human readable table
+func (r *DryRunReport) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tNAME\tSCHEDULE\tCOMMAND\tIMAGE\tSOURCE\tERROR")
+	for _, j := range r.Jobs {
+		image := j.Image
+		if image == "" {
+			image = j.Container
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			j.Type, j.Name, j.Schedule, j.Command, dash(image), j.Source, dash(j.Error),
+		)
+	}
+
+	if r.Error != "" {
+		fmt.Fprintf(tw, "\n%s\n", r.Error)
+	}
+
+	return tw.Flush()
+}
+
+// WriteJSON writes the report as JSON
+func (r *DryRunReport) WriteJSON(w io.Writer) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(r)
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
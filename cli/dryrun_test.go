@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteDryRun struct{}
+
+var _ = Suite(&SuiteDryRun{})
+
+func (s *SuiteDryRun) TestDryRun(c *C) {
+	conf, err := BuildFromString(`
+		[job-run "b"]
+		schedule = @hourly
+		image = busybox
+		command = echo b
+		[job-local "a"]
+		schedule = @every 10s
+		command = echo a
+		[job-exec "c"]
+		schedule = foo
+		container = nginx
+		command = echo c
+	`, &TestLogger{})
+	c.Assert(err, IsNil)
+
+	r := conf.dryRun()
+	c.Assert(r.Valid, Equals, false)
+	c.Assert(r.Jobs, HasLen, 3)
+	c.Assert(r.Jobs[0].Type, Equals, jobExec)
+	c.Assert(r.Jobs[0].Container, Equals, "nginx")
+	c.Assert(r.Jobs[0].Error, Matches, "invalid schedule.*")
+	c.Assert(r.Jobs[1], DeepEquals, DryRunJob{
+		Name: "a", Type: jobLocal, Schedule: "@every 10s", Command: "echo a", Source: sourceINI,
+	})
+	c.Assert(r.Jobs[2], DeepEquals, DryRunJob{
+		Name: "b", Type: jobRun, Schedule: "@hourly", Command: "echo b", Image: "busybox", Source: sourceINI,
+	})
+}
+
+func (s *SuiteDryRun) TestDryRunDefaultJitter(c *C) {
+	conf, err := BuildFromString(`
+		[global]
+		default-jitter = foo
+	`, &TestLogger{})
+	c.Assert(err, IsNil)
+
+	r := conf.dryRun()
+	c.Assert(r.Valid, Equals, false)
+	c.Assert(r.Error, Matches, "invalid default-jitter.*")
+
+	conf.Global.DefaultJitter = "-10s"
+	r = conf.dryRun()
+	c.Assert(r.Valid, Equals, false)
+	c.Assert(r.Error, Equals, `invalid default-jitter "-10s", can't be negative`)
+}
+
+func (s *SuiteDryRun) TestDaemonDryRun(c *C) {
+	file := filepath.Join(c.MkDir(), "ofelia.conf")
+	c.Assert(os.WriteFile(file, []byte(`
+[job-local "a"]
+schedule = @every 10s
+command = echo a
+`), 0644), IsNil)
+
+	cmd := &DaemonCommand{ConfigFile: file, DryRun: true, Logger: &TestLogger{}}
+	var table bytes.Buffer
+	c.Assert(cmd.dryRun(&table), IsNil)
+	lines := strings.Split(strings.TrimSpace(table.String()), "\n")
+	c.Assert(lines, HasLen, 2)
+	c.Assert(strings.Fields(lines[1]), DeepEquals, []string{"job-local", "a", "@every", "10s", "echo", "a", "-", "ini", "-"})
+	c.Assert(cmd.scheduler, IsNil)
+
+	cmd.JSON = true
+	var out bytes.Buffer
+	c.Assert(cmd.dryRun(&out), IsNil)
+
+	var r DryRunReport
+	c.Assert(json.Unmarshal(out.Bytes(), &r), IsNil)
+	c.Assert(r.Valid, Equals, true)
+	c.Assert(r.Jobs, HasLen, 1)
+	c.Assert(r.Jobs[0].Name, Equals, "a")
+}
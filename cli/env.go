@@ -0,0 +1,224 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+const (
+	// missingEnvEmpty expands the unset variables to an empty string, the
+	// default, missingEnvError fails on them
+	missingEnvEmpty = "empty"
+	missingEnvError = "error"
+)
+
+var (
+	errUnclosedReference = errors.New("unclosed variable reference, expected }")
+	errControlCharacter  = errors.New("contains control characters")
+)
+
+// expandConfigEnv expands the references to environment variables in the
+// string values of the config once decoded, so a variable can't change the
+// syntax of the file. The commands and the environment of the jobs are
+// expanded too, a `${VAR}` meant for their shell is written `$${VAR}`.
+func (c *Config) expandConfigEnv() error {
+	strict, err := c.strictEnv()
+	if err != nil {
+		return err
+	}
+
+	return expandValue(reflect.ValueOf(c).Elem(), strict)
+}
+
+// strictEnv parses the missing-env option, true if the unset variables are
+// an error
+func (c *Config) strictEnv() (bool, error) {
+	switch c.Global.MissingEnv {
+	case "", missingEnvEmpty:
+		return false, nil
+	case missingEnvError:
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid missing-env %q, expected empty or error", c.Global.MissingEnv)
+	}
+}
+
+// expandValue expands the strings of v, a section of the config: its exported
+// fields, the items of its lists and the sections of its maps. The other
+// pointers, such as the Docker clients, aren't followed.
+func expandValue(v reflect.Value, strict bool) error {
+	switch v.Kind() {
+	case reflect.String:
+		if !v.CanSet() {
+			return nil
+		}
+
+		s, err := expandEnv(v.String(), strict)
+		if err != nil {
+			return err
+		}
+
+		v.SetString(s)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return nil
+		}
+
+		for i := 0; i < v.Len(); i++ {
+			if err := expandValue(v.Index(i), strict); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if !v.Type().Field(i).IsExported() {
+				continue
+			}
+
+			if err := expandValue(v.Field(i), strict); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if e := iter.Value(); e.Kind() == reflect.Pointer && !e.IsNil() {
+				if err := expandValue(e.Elem(), strict); err != nil {
+					return fmt.Errorf("%q: %w", iter.Key().String(), err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// expandParams expands the values of the parameters read from the labels,
+// once their JSON lists are parsed
+func expandParams(params map[string]interface{}, strict bool) error {
+	for name, value := range params {
+		var err error
+		switch v := value.(type) {
+		case string:
+			params[name], err = expandEnv(v, strict)
+		case []string:
+			for i := range v {
+				if v[i], err = expandEnv(v[i], strict); err != nil {
+					break
+				}
+			}
+		}
+
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// expandEnv replaces the references to environment variables in a config
+// value: `${VAR}` is replaced by the value of VAR, empty if it isn't set
+// unless strict, `${VAR:-default}` by the default if VAR is unset or empty,
+// and `${VAR:?message}` fails if VAR is unset or empty. `$$` is a literal
+// `$`, any other `$` is kept as is. The values of the variables can't
+// contain control characters.
+func expandEnv(s string, strict bool) (string, error) {
+	if !strings.Contains(s, "$") {
+		return s, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		switch s[i+1] {
+		case '$':
+			b.WriteByte('$')
+			i++
+		case '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("%w: %q", errUnclosedReference, s[i:])
+			}
+
+			v, err := resolveReference(s[i+2:i+end], strict)
+			if err != nil {
+				return "", err
+			}
+
+			b.WriteString(v)
+			i += end
+		default:
+			b.WriteByte('$')
+		}
+	}
+
+	return b.String(), nil
+}
+
+// resolveReference returns the value of a reference, without the `${` and
+// `}` delimiters
+func resolveReference(ref string, strict bool) (string, error) {
+	name, rest, hasOp := strings.Cut(ref, ":")
+	if !isEnvName(name) || (hasOp && rest == "") {
+		return "", fmt.Errorf("invalid variable reference %q", "${"+ref+"}")
+	}
+
+	value, set := os.LookupEnv(name)
+	if !set && !hasOp && strict {
+		return "", fmt.Errorf("variable %s: not set", name)
+	}
+
+	if hasOp {
+		switch op, arg := rest[0], rest[1:]; op {
+		case '-':
+			if value == "" {
+				return arg, nil
+			}
+		case '?':
+			if value == "" {
+				if arg == "" {
+					arg = "not set"
+				}
+
+				return "", fmt.Errorf("variable %s: %s", name, arg)
+			}
+		default:
+			return "", fmt.Errorf("invalid variable reference %q", "${"+ref+"}")
+		}
+	}
+
+	if strings.IndexFunc(value, isForbiddenControl) >= 0 {
+		return "", fmt.Errorf("variable %s %w", name, errControlCharacter)
+	}
+
+	return value, nil
+}
+
+func isEnvName(name string) bool {
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		return false
+	}
+
+	for _, r := range name {
+		if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isForbiddenControl reports the control characters not allowed in the
+// values of the variables, tabs are allowed
+func isForbiddenControl(r rune) bool {
+	return unicode.IsControl(r) && r != '\t'
+}
@@ -0,0 +1,231 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteEnv struct{}
+
+var _ = Suite(&SuiteEnv{})
+
+func (s *SuiteEnv) SetUpTest(c *C) {
+	os.Setenv("OFELIA_TEST_IMAGE", "busybox")
+	os.Setenv("OFELIA_TEST_EMPTY", "")
+	os.Unsetenv("OFELIA_TEST_MISSING")
+}
+
+func (s *SuiteEnv) TearDownTest(c *C) {
+	os.Unsetenv("OFELIA_TEST_IMAGE")
+	os.Unsetenv("OFELIA_TEST_EMPTY")
+	os.Unsetenv("OFELIA_TEST_INJECTED")
+	os.Unsetenv("OFELIA_TEST_SYNTAX")
+}
+
+func (s *SuiteEnv) TestExpandEnv(c *C) {
+	testcases := map[string]string{
+		"no variable":                              "no variable",
+		"${OFELIA_TEST_IMAGE}":                     "busybox",
+		"${OFELIA_TEST_IMAGE}:latest":              "busybox:latest",
+		"${OFELIA_TEST_MISSING}":                   "",
+		"${OFELIA_TEST_MISSING:-alpine}":           "alpine",
+		"${OFELIA_TEST_EMPTY:-alpine}":             "alpine",
+		"${OFELIA_TEST_IMAGE:-alpine}":             "busybox",
+		"${OFELIA_TEST_MISSING:-}":                 "",
+		"echo $$HOME $${OFELIA_TEST_IMAGE}":        "echo $HOME ${OFELIA_TEST_IMAGE}",
+		"echo $HOME $1 $":                          "echo $HOME $1 $",
+		"${OFELIA_TEST_IMAGE}${OFELIA_TEST_IMAGE}": "busyboxbusybox",
+	}
+
+	for in, out := range testcases {
+		v, err := expandEnv(in, false)
+		c.Assert(err, IsNil, Commentf("value %q", in))
+		c.Assert(v, Equals, out, Commentf("value %q", in))
+	}
+}
+
+func (s *SuiteEnv) TestExpandEnvErrors(c *C) {
+	os.Setenv("OFELIA_TEST_INJECTED", "busybox\n[job-local \"evil\"]")
+
+	testcases := map[string]string{
+		"${OFELIA_TEST_MISSING:?}":                    "variable OFELIA_TEST_MISSING: not set",
+		"${OFELIA_TEST_EMPTY:?the image is required}": "variable OFELIA_TEST_EMPTY: the image is required",
+		"${OFELIA_TEST_IMAGE":                         "unclosed variable reference.*",
+		"${}":                                         "invalid variable reference.*",
+		"${1FOO}":                                     "invalid variable reference.*",
+		"${FOO BAR}":                                  "invalid variable reference.*",
+		"${FOO:}":                                     "invalid variable reference.*",
+		"${FOO:+bar}":                                 "invalid variable reference.*",
+		"${OFELIA_TEST_INJECTED}":                     "variable OFELIA_TEST_INJECTED contains control characters",
+	}
+
+	for in, msg := range testcases {
+		_, err := expandEnv(in, false)
+		c.Assert(err, ErrorMatches, msg, Commentf("value %q", in))
+	}
+}
+
+func (s *SuiteEnv) TestExpandEnvStrict(c *C) {
+	_, err := expandEnv("${OFELIA_TEST_MISSING}", true)
+	c.Assert(err, ErrorMatches, "variable OFELIA_TEST_MISSING: not set")
+
+	for in, out := range map[string]string{
+		"${OFELIA_TEST_EMPTY}":           "",
+		"${OFELIA_TEST_MISSING:-alpine}": "alpine",
+		"${OFELIA_TEST_IMAGE}":           "busybox",
+	} {
+		v, err := expandEnv(in, true)
+		c.Assert(err, IsNil, Commentf("value %q", in))
+		c.Assert(v, Equals, out, Commentf("value %q", in))
+	}
+}
+
+func (s *SuiteEnv) TestShellVariables(c *C) {
+	// the variables of the container shell escaped with $$ survive
+	conf, err := BuildFromString(`
+[job-run "foo"]
+schedule = @hourly
+image = ${OFELIA_TEST_IMAGE}
+command = echo $$HOME $${HOME:-/root} $HOME $$$$
+environment = CACHE=$${HOME}/cache
+`, &TestLogger{})
+	c.Assert(err, IsNil)
+	c.Assert(conf.RunJobs["foo"].Image, Equals, "busybox")
+	c.Assert(conf.RunJobs["foo"].Command, Equals, "echo $HOME ${HOME:-/root} $HOME $$")
+	c.Assert(conf.RunJobs["foo"].Environment, DeepEquals, []string{"CACHE=${HOME}/cache"})
+}
+
+func (s *SuiteEnv) TestSyntaxInValues(c *C) {
+	os.Setenv("OFELIA_TEST_SYNTAX", `abc;def#ghi "x" \ [job-local "evil"]`)
+
+	conf, err := BuildFromString(`
+[global]
+slack-webhook = https://hooks.example.com/${OFELIA_TEST_SYNTAX}
+
+[job-local "foo"]
+schedule = @hourly
+command = echo ${OFELIA_TEST_SYNTAX}
+`, &TestLogger{})
+	c.Assert(err, IsNil)
+	c.Assert(conf.LocalJobs, HasLen, 1)
+	c.Assert(conf.LocalJobs["foo"].Command, Equals, `echo abc;def#ghi "x" \ [job-local "evil"]`)
+	c.Assert(conf.Global.SlackWebhook, Equals, `https://hooks.example.com/abc;def#ghi "x" \ [job-local "evil"]`)
+
+	file := filepath.Join(c.MkDir(), "ofelia.yaml")
+	c.Assert(os.WriteFile(file, []byte(`
+job-local:
+  foo:
+    schedule: "@hourly"
+    command: echo ${OFELIA_TEST_SYNTAX}
+`), 0644), IsNil)
+
+	conf, err = BuildFromFile(file, &TestLogger{})
+	c.Assert(err, IsNil)
+	c.Assert(conf.LocalJobs["foo"].Command, Equals, `echo abc;def#ghi "x" \ [job-local "evil"]`)
+}
+
+func (s *SuiteEnv) TestMissingEnv(c *C) {
+	config := `
+[global]
+missing-env = %s
+
+[job-run "foo"]
+schedule = @hourly
+image = ${OFELIA_TEST_MISSING}
+`
+	conf, err := BuildFromString(fmt.Sprintf(config, "empty"), &TestLogger{})
+	c.Assert(err, IsNil)
+	c.Assert(conf.RunJobs["foo"].Image, Equals, "")
+
+	_, err = BuildFromString(fmt.Sprintf(config, "error"), &TestLogger{})
+	c.Assert(err, ErrorMatches, `"foo": variable OFELIA_TEST_MISSING: not set`)
+
+	_, err = BuildFromString(fmt.Sprintf(config, "ignore"), &TestLogger{})
+	c.Assert(err, ErrorMatches, `invalid missing-env "ignore", expected empty or error`)
+}
+
+func (s *SuiteEnv) TestBuildFromFile(c *C) {
+	filename := filepath.Join(c.MkDir(), "ofelia.ini")
+	c.Assert(os.WriteFile(filename, []byte(`
+[global]
+slack-webhook = https://hooks.example.com/${OFELIA_TEST_MISSING:-default}
+
+[job-run "foo"]
+schedule = @hourly
+image = ${OFELIA_TEST_IMAGE}
+command = echo $$HOME
+`), 0644), IsNil)
+
+	conf, err := BuildFromFile(filename, &TestLogger{})
+	c.Assert(err, IsNil)
+	c.Assert(conf.Global.SlackWebhook, Equals, "https://hooks.example.com/default")
+	c.Assert(conf.RunJobs["foo"].Image, Equals, "busybox")
+	c.Assert(conf.RunJobs["foo"].Command, Equals, "echo $HOME")
+
+	os.Setenv("OFELIA_TEST_INJECTED", "busybox\ncommand = rm -rf /")
+	c.Assert(os.WriteFile(filename, []byte(`
+[job-run "foo"]
+schedule = @hourly
+image = ${OFELIA_TEST_INJECTED}
+`), 0644), IsNil)
+
+	_, err = BuildFromFile(filename, &TestLogger{})
+	c.Assert(err, ErrorMatches, ".*variable OFELIA_TEST_INJECTED contains control characters")
+}
+
+func (s *SuiteEnv) TestDockerLabels(c *C) {
+	conf := Config{}
+	err := conf.buildFromDockerLabels(map[string]map[string]string{
+		"some": {
+			requiredLabel:                  "true",
+			serviceLabel:                   "true",
+			labelPrefix + ".slack-webhook": "${OFELIA_TEST_MISSING:-http://localhost}",
+			labelPrefix + "." + jobRun + ".foo.schedule": "@hourly",
+			labelPrefix + "." + jobRun + ".foo.image":    "${OFELIA_TEST_IMAGE}",
+		},
+	})
+
+	c.Assert(err, IsNil)
+	c.Assert(conf.Global.SlackWebhook, Equals, "http://localhost")
+	c.Assert(conf.RunJobs["foo"].Image, Equals, "busybox")
+
+	// only the job failing to expand is dropped
+	conf = Config{}
+	err = conf.buildFromDockerLabels(map[string]map[string]string{
+		"some": {
+			requiredLabel: "true",
+			serviceLabel:  "true",
+			labelPrefix + "." + jobRun + ".foo.image":   "${OFELIA_TEST_MISSING:?}",
+			labelPrefix + "." + jobRun + ".bar.image":   "${OFELIA_TEST_IMAGE}",
+			labelPrefix + "." + jobLocal + ".baz.image": "${OFELIA_TEST_MISSING:?}",
+		},
+	})
+	c.Assert(err, ErrorMatches, `job-local "baz": image: variable OFELIA_TEST_MISSING: not set, job-run "foo": image: variable OFELIA_TEST_MISSING: not set`)
+	c.Assert(conf.RunJobs, HasLen, 1)
+	c.Assert(conf.RunJobs["bar"].Image, Equals, "busybox")
+	c.Assert(conf.LocalJobs, HasLen, 0)
+
+	// the JSON lists are parsed before the expansion
+	os.Setenv("OFELIA_TEST_SYNTAX", `a"b`)
+	conf = Config{}
+	err = conf.buildFromDockerLabels(map[string]map[string]string{
+		"some": {
+			requiredLabel: "true",
+			serviceLabel:  "true",
+			labelPrefix + "." + jobRun + ".foo.schedule":    "@hourly",
+			labelPrefix + "." + jobRun + ".foo.environment": `["KEY=${OFELIA_TEST_SYNTAX}", "OTHER=1"]`,
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(conf.RunJobs["foo"].Environment, DeepEquals, []string{`KEY=a"b`, "OTHER=1"})
+
+	conf = Config{}
+	conf.Global.MissingEnv = missingEnvError
+	err = conf.buildFromDockerLabels(map[string]map[string]string{
+		"some": {labelPrefix + "." + jobRun + ".foo.image": "${OFELIA_TEST_MISSING}"},
+	})
+	c.Assert(err, ErrorMatches, `job-run "foo": image: variable OFELIA_TEST_MISSING: not set`)
+}
@@ -0,0 +1,41 @@
+package cli
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/netresearch/ofelia/core"
+)
+
+// newHealthHandler serves the probes of the daemon: /healthz, the liveness
+// of the scheduler, and /readyz, whether ping reaches the Docker daemon. A
+// nil ping is always ready.
+func newHealthHandler(sh *core.Scheduler, ping func() error) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeProbe(w, sh.Health())
+	})
+
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		if ping != nil {
+			err = ping()
+		}
+
+		writeProbe(w, err)
+	})
+
+	return mux
+}
+
+// writeProbe answers 200 if err is nil, 503 with the error otherwise
+func writeProbe(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, err)
+		return
+	}
+
+	fmt.Fprintln(w, "ok")
+}
@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/netresearch/ofelia/core"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteHealth struct{}
+
+var _ = Suite(&SuiteHealth{})
+
+// probe requests path and returns the status code and body
+func (s *SuiteHealth) probe(h http.Handler, path string) (int, string) {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec.Code, rec.Body.String()
+}
+
+func (s *SuiteHealth) TestHealthz(c *C) {
+	sc := core.NewScheduler(&TestLogger{})
+	h := newHealthHandler(sc, nil)
+
+	code, body := s.probe(h, "/healthz")
+	c.Assert(code, Equals, http.StatusServiceUnavailable)
+	c.Assert(body, Equals, "scheduler not running\n")
+
+	c.Assert(sc.Start(), IsNil)
+	code, body = s.probe(h, "/healthz")
+	for i := 0; i < 100 && code != http.StatusOK; i++ {
+		time.Sleep(10 * time.Millisecond)
+		code, body = s.probe(h, "/healthz")
+	}
+
+	c.Assert(code, Equals, http.StatusOK)
+	c.Assert(body, Equals, "ok\n")
+
+	c.Assert(sc.Stop(), IsNil)
+	code, _ = s.probe(h, "/healthz")
+	c.Assert(code, Equals, http.StatusServiceUnavailable)
+}
+
+func (s *SuiteHealth) TestReadyz(c *C) {
+	var pingErr error
+	h := newHealthHandler(core.NewScheduler(&TestLogger{}), func() error { return pingErr })
+
+	code, _ := s.probe(h, "/readyz")
+	c.Assert(code, Equals, http.StatusOK)
+
+	pingErr = errors.New("connection refused")
+	code, body := s.probe(h, "/readyz")
+	c.Assert(code, Equals, http.StatusServiceUnavailable)
+	c.Assert(body, Equals, "connection refused\n")
+}
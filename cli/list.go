@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/netresearch/ofelia/core"
+)
+
+// ListCommand prints the jobs of the config file
+type ListCommand struct {
+	ConfigFile   string `long:"config" description:"configuration file" default:"/etc/ofelia.conf"`
+	ConfigFormat string `long:"config-format" description:"format of the configuration file, ini or yaml, detected from the extension by default"`
+	ConfigDir    string `long:"config-dir" description:"directory of INI configuration files, merged in sorted order, instead of --config"`
+	JSON         bool   `long:"json" description:"Print the jobs as JSON"`
+	Logger       core.Logger
+}
+
+// ListedJob is a job of the config file with its next activation
+type ListedJob struct {
+	Name     string     `json:"name"`
+	Type     string     `json:"type"`
+	Schedule string     `json:"schedule"`
+	NextRun  *time.Time `json:"next_run"`
+	Source   string     `json:"source"`
+}
+
+// Execute runs the list command
+func (c *ListCommand) Execute(args []string) error {
+	return c.list(os.Stdout, time.Now())
+}
+
+// list prints the jobs, it never starts the scheduler nor connects to Docker
+func (c *ListCommand) list(w io.Writer, now time.Time) error {
+	conf, err := BuildFromFileFormat(configPath(c.ConfigFile, c.ConfigDir), c.ConfigFormat, c.Logger)
+	if err != nil {
+		return err
+	}
+
+	jobs := listJobs(conf.dryRun(), now)
+	if c.JSON {
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+		return e.Encode(jobs)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tTYPE\tSCHEDULE\tNEXT RUN\tSOURCE")
+	for _, j := range jobs {
+		next := "-"
+		if j.NextRun != nil {
+			next = j.NextRun.Format(time.RFC3339)
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", j.Name, j.Type, j.Schedule, next, j.Source)
+	}
+
+	return tw.Flush()
+}
+
+// listJobs returns the jobs of a dry run report with their next activation
+// after now, nil if the schedule is invalid or won't fire anymore
+func listJobs(r *DryRunReport, now time.Time) []ListedJob {
+	jobs := make([]ListedJob, 0, len(r.Jobs))
+	for _, j := range r.Jobs {
+		job := ListedJob{Name: j.Name, Type: j.Type, Schedule: j.Schedule, Source: j.Source}
+		if next, err := core.NextRun(j.Schedule, now); err == nil && !next.IsZero() {
+			job.NextRun = &next
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	return jobs
+}
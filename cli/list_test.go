@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteList struct {
+	cmd *ListCommand
+	now time.Time
+}
+
+var _ = Suite(&SuiteList{})
+
+func (s *SuiteList) SetUpTest(c *C) {
+	file := filepath.Join(c.MkDir(), "ofelia.conf")
+	c.Assert(os.WriteFile(file, []byte(`
+[job-exec "flush"]
+schedule = @hourly
+container = nginx
+command = /flush.sh
+
+[job-run "backup"]
+schedule = 0 0 2 * * *
+image = busybox
+
+[job-local "cleanup"]
+schedule = @every 10m
+command = rm -rf /tmp/cache
+
+[job-service-run "report"]
+schedule = foo
+image = reporter
+`), 0644), IsNil)
+
+	s.cmd = &ListCommand{ConfigFile: file, Logger: &TestLogger{}}
+	s.now = time.Date(2024, 1, 1, 10, 30, 0, 0, time.Local)
+}
+
+func (s *SuiteList) TestListTable(c *C) {
+	var b bytes.Buffer
+	c.Assert(s.cmd.list(&b, s.now), IsNil)
+
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	c.Assert(lines, HasLen, 5)
+	c.Assert(strings.Fields(lines[0]), DeepEquals, []string{"NAME", "TYPE", "SCHEDULE", "NEXT", "RUN", "SOURCE"})
+	c.Assert(strings.Fields(lines[1]), DeepEquals, []string{
+		"flush", jobExec, "@hourly", time.Date(2024, 1, 1, 11, 0, 0, 0, time.Local).Format(time.RFC3339), sourceINI,
+	})
+	c.Assert(strings.Fields(lines[4]), DeepEquals, []string{"report", jobServiceRun, "foo", "-", sourceINI})
+}
+
+func (s *SuiteList) TestListJSON(c *C) {
+	s.cmd.JSON = true
+
+	var b bytes.Buffer
+	c.Assert(s.cmd.list(&b, s.now), IsNil)
+
+	var jobs []map[string]interface{}
+	c.Assert(json.Unmarshal(b.Bytes(), &jobs), IsNil)
+	c.Assert(jobs, HasLen, 4)
+
+	c.Assert(jobs[0], DeepEquals, map[string]interface{}{
+		"name":     "flush",
+		"type":     jobExec,
+		"schedule": "@hourly",
+		"next_run": time.Date(2024, 1, 1, 11, 0, 0, 0, time.Local).Format(time.RFC3339),
+		"source":   sourceINI,
+	})
+	c.Assert(jobs[1]["name"], Equals, "cleanup")
+	c.Assert(jobs[1]["type"], Equals, jobLocal)
+	c.Assert(jobs[1]["next_run"], Equals, s.now.Add(10*time.Minute).Format(time.RFC3339))
+	c.Assert(jobs[2]["name"], Equals, "backup")
+	c.Assert(jobs[2]["type"], Equals, jobRun)
+	c.Assert(jobs[2]["next_run"], Equals, time.Date(2024, 1, 2, 2, 0, 0, 0, time.Local).Format(time.RFC3339))
+	c.Assert(jobs[3]["name"], Equals, "report")
+	c.Assert(jobs[3]["type"], Equals, jobServiceRun)
+	c.Assert(jobs[3]["next_run"], IsNil)
+}
+
+func (s *SuiteList) TestListMissingFile(c *C) {
+	s.cmd.ConfigFile = filepath.Join(c.MkDir(), "missing.conf")
+	c.Assert(s.cmd.list(&bytes.Buffer{}, s.now), NotNil)
+}
@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/op/go-logging"
+)
+
+// Log formats, text being the default one
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+func validateLogFormat(format string) error {
+	switch format {
+	case "", logFormatText, logFormatJSON:
+		return nil
+	default:
+		return fmt.Errorf("invalid log-format %q, expected text or json", format)
+	}
+}
+
+// setLogFormat switches the logs written to w to the given format, the text
+// format being the one the logger was built with it is left as is
+func setLogFormat(format string, w io.Writer) error {
+	if err := validateLogFormat(format); err != nil {
+		return err
+	}
+
+	if format == logFormatJSON {
+		logging.SetBackend(logging.NewBackendFormatter(logging.NewLogBackend(w, "", 0), jsonFormatter{}))
+	}
+
+	return nil
+}
+
+// jobLogPrefix matches the prefix of the messages logged for an execution,
+// see core.Context.Log
+var jobLogPrefix = regexp.MustCompile(`^\[Job ("(?:[^"\\]|\\.)*") \(([^)]*)\)\] `)
+
+// jsonFormatter writes every record as a JSON object on a single line, with
+// the job and the execution of the messages about an execution
+type jsonFormatter struct{}
+
+type jsonRecord struct {
+	Time      string `json:"time"`
+	Level     string `json:"level"`
+	Module    string `json:"module,omitempty"`
+	Job       string `json:"job,omitempty"`
+	Execution string `json:"execution,omitempty"`
+	Message   string `json:"message"`
+}
+
+func (jsonFormatter) Format(calldepth int, r *logging.Record, w io.Writer) error {
+	rec := jsonRecord{
+		Time:    r.Time.Format(time.RFC3339Nano),
+		Level:   strings.ToLower(r.Level.String()),
+		Module:  r.Module,
+		Message: strings.TrimRight(r.Message(), "\n"),
+	}
+
+	if m := jobLogPrefix.FindStringSubmatch(rec.Message); m != nil {
+		if job, err := strconv.Unquote(m[1]); err == nil {
+			rec.Job, rec.Execution = job, m[2]
+			rec.Message = rec.Message[len(m[0]):]
+		}
+	}
+
+	return json.NewEncoder(w).Encode(rec)
+}
@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/netresearch/ofelia/core"
+	"github.com/op/go-logging"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteLogging struct{}
+
+var _ = Suite(&SuiteLogging{})
+
+func (s *SuiteLogging) TearDownTest(c *C) {
+	logging.SetBackend(logging.NewLogBackend(os.Stderr, "", log.LstdFlags))
+}
+
+func (s *SuiteLogging) TestJSON(c *C) {
+	var b bytes.Buffer
+	c.Assert(setLogFormat(logFormatJSON, &b), IsNil)
+	logger := logging.MustGetLogger("ofelia")
+
+	job := &countingJob{}
+	job.Name = `backup "db"`
+	e := core.NewExecution()
+	ctx := core.NewContext(core.NewScheduler(logger), job, e)
+	ctx.Log("Started - echo (a)")
+	logger.Warningf("Signal received: %s", "interrupt")
+
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	c.Assert(lines, HasLen, 2)
+
+	records := make([]map[string]string, len(lines))
+	for i, line := range lines {
+		c.Assert(json.Unmarshal([]byte(line), &records[i]), IsNil, Commentf("line %q", line))
+		for _, key := range []string{"time", "level", "message"} {
+			c.Assert(records[i][key], Not(Equals), "", Commentf("line %q, key %q", line, key))
+		}
+	}
+
+	c.Assert(records[0]["level"], Equals, "notice")
+	c.Assert(records[0]["job"], Equals, `backup "db"`)
+	c.Assert(records[0]["execution"], Equals, e.ID)
+	c.Assert(records[0]["message"], Equals, "Started - echo (a)")
+
+	c.Assert(records[1]["level"], Equals, "warning")
+	c.Assert(records[1]["message"], Equals, "Signal received: interrupt")
+	_, ok := records[1]["job"]
+	c.Assert(ok, Equals, false)
+}
+
+func (s *SuiteLogging) TestLogFormat(c *C) {
+	var b bytes.Buffer
+	c.Assert(setLogFormat("", &b), IsNil)
+	c.Assert(setLogFormat(logFormatText, &b), IsNil)
+	c.Assert(setLogFormat("xml", &b), ErrorMatches, `invalid log-format "xml", expected text or json`)
+}
@@ -0,0 +1,338 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/netresearch/ofelia/core"
+
+	"github.com/fsnotify/fsnotify"
+	defaults "github.com/mcuadros/go-defaults"
+)
+
+// configReloadDelay is the time waited after the last change of the config
+// file before reloading it, since editors often write a file in several
+// steps
+var configReloadDelay = 500 * time.Millisecond
+
+// jobsMu serializes the changes of the jobs, made by the reloads of the
+// config file and the updates of the Docker labels
+var jobsMu sync.Mutex
+
+// jobKey identifies a job, the names are unique per job type only
+type jobKey struct {
+	Type string
+	Name string
+}
+
+// Sources of the job changes, the config file or the Docker labels
+const (
+	sourceFile   = "file"
+	sourceLabels = "labels"
+)
+
+// Kinds of job changes
+const (
+	jobAdded   = "added"
+	jobRemoved = "removed"
+	jobUpdated = "updated"
+)
+
+// jobChange is a change of the jobs applied by a reload of the config file
+// or an update of the Docker labels
+type jobChange struct {
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Change string `json:"change"`
+	Source string `json:"source"`
+}
+
+func (ch jobChange) String() string {
+	return fmt.Sprintf("%s %s %q (%s)", ch.Change, ch.Type, ch.Name, ch.Source)
+}
+
+// reloadEvent is the payload posted to the reload-webhook
+type reloadEvent struct {
+	Time    time.Time   `json:"time"`
+	Changes []jobChange `json:"changes"`
+}
+
+// jobConfig is implemented by the configurations of every job type
+type jobConfig interface {
+	core.Job
+	Hash() string
+	buildMiddlewares()
+}
+
+// fileJobKeys returns the keys of the jobs defined in the config file, the
+// jobs defined with Docker labels aren't merged yet when it's called
+func (c *Config) fileJobKeys() map[jobKey]bool {
+	keys := make(map[jobKey]bool)
+	for name := range c.ExecJobs {
+		keys[jobKey{jobExec, name}] = true
+	}
+
+	for name := range c.RunJobs {
+		keys[jobKey{jobRun, name}] = true
+	}
+
+	for name := range c.LocalJobs {
+		keys[jobKey{jobLocal, name}] = true
+	}
+
+	for name := range c.ServiceJobs {
+		keys[jobKey{jobServiceRun, name}] = true
+	}
+
+	return keys
+}
+
+// watchConfig reloads the config file, or the directory of INI files, every
+// time it changes, until done is closed
+func (c *Config) watchConfig(filename, format string, done <-chan struct{}) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	// the directory is watched since editors usually replace the file
+	filename = filepath.Clean(filename)
+	dir, changed := filepath.Dir(filename), func(name string) bool {
+		return filepath.Clean(name) == filename
+	}
+
+	if fi, err := os.Stat(filename); err == nil && fi.IsDir() {
+		dir, changed = filename, func(name string) bool {
+			return filepath.Dir(filepath.Clean(name)) == filename && filepath.Ext(name) == ".ini"
+		}
+	}
+
+	if err := w.Add(dir); err != nil {
+		w.Close()
+		return err
+	}
+
+	go func() {
+		defer w.Close()
+
+		var timer *time.Timer
+		for {
+			select {
+			case e := <-w.Events:
+				if !changed(e.Name) || e.Op == fsnotify.Chmod {
+					continue
+				}
+
+				if timer != nil {
+					timer.Stop()
+				}
+
+				timer = time.AfterFunc(configReloadDelay, func() {
+					if err := c.reloadConfig(filename, format); err != nil {
+						c.logger.Errorf("Can't reload %q, keeping the previous config: %s", filename, err)
+					}
+				})
+			case err := <-w.Errors:
+				c.logger.Errorf("Error watching %q: %s", filename, err)
+			case <-done:
+				if timer != nil {
+					timer.Stop()
+				}
+
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// reloadConfig reads the config file again and applies the changes of its
+// jobs to the scheduler: the jobs removed from the file are removed, the new
+// ones are added and the modified ones replaced. The jobs defined with
+// Docker labels are kept. If the file can't be read or any job is invalid,
+// nothing changes. The global options aren't reloaded.
+func (c *Config) reloadConfig(filename, format string) error {
+	updated, err := BuildFromFileFormat(filename, format, c.logger)
+	if err != nil {
+		return err
+	}
+
+	if err := updated.validateNotifications(); err != nil {
+		return err
+	}
+
+	// the docker-endpoint sections aren't reloaded, like the global options
+	updated.DockerEndpoints = c.DockerEndpoints
+	if err := updated.validateDockerEndpoints(); err != nil {
+		return err
+	}
+
+	if err := prepareJobs(updated.ExecJobs, func(name string, j *ExecJobConfig) {
+		j.Name = name
+		j.Client, j.Docker = c.dockerTarget(j.DockerEndpoint, j.DockerHost)
+	}); err != nil {
+		return err
+	}
+
+	if err := prepareJobs(updated.RunJobs, func(name string, j *RunJobConfig) {
+		j.Name = name
+		j.Client, j.Docker = c.dockerTarget(j.DockerEndpoint, j.DockerHost)
+	}); err != nil {
+		return err
+	}
+
+	if err := prepareJobs(updated.LocalJobs, func(name string, j *LocalJobConfig) {
+		j.Name = name
+	}); err != nil {
+		return err
+	}
+
+	if err := prepareJobs(updated.ServiceJobs, func(name string, j *RunServiceConfig) {
+		j.Name = name
+		j.Client, j.Docker = c.dockerTarget(j.DockerEndpoint, j.DockerHost)
+	}); err != nil {
+		return err
+	}
+
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+
+	var changes []jobChange
+	changes = append(changes, syncJobMap(c, jobExec, c.ExecJobs, updated.ExecJobs)...)
+	changes = append(changes, syncJobMap(c, jobRun, c.RunJobs, updated.RunJobs)...)
+	changes = append(changes, syncJobMap(c, jobLocal, c.LocalJobs, updated.LocalJobs)...)
+	changes = append(changes, syncJobMap(c, jobServiceRun, c.ServiceJobs, updated.ServiceJobs)...)
+
+	c.logger.Noticef("Reloaded %q", filename)
+	c.reportJobChanges(changes)
+	return nil
+}
+
+// reportJobChanges logs the changes of the jobs and posts them to the
+// reload-webhook, in the background
+func (c *Config) reportJobChanges(changes []jobChange) {
+	if len(changes) == 0 {
+		return
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Type != changes[j].Type {
+			return changes[i].Type < changes[j].Type
+		}
+
+		return changes[i].Name < changes[j].Name
+	})
+
+	summary := make([]string, 0, len(changes))
+	for _, ch := range changes {
+		summary = append(summary, ch.String())
+	}
+
+	c.logger.Noticef("Jobs changed: %s", strings.Join(summary, ", "))
+
+	if c.Global.ReloadWebhook != "" {
+		go c.postJobChanges(reloadEvent{Time: time.Now(), Changes: changes})
+	}
+}
+
+func (c *Config) postJobChanges(e reloadEvent) {
+	content, _ := json.Marshal(e)
+	r, err := http.Post(c.Global.ReloadWebhook, "application/json", bytes.NewReader(content))
+	if err != nil {
+		c.logger.Errorf("Reload webhook error calling %q error: %q", c.Global.ReloadWebhook, err)
+		return
+	}
+	r.Body.Close()
+
+	if r.StatusCode >= 300 {
+		c.logger.Errorf("Reload webhook error non-2xx status code calling %q", c.Global.ReloadWebhook)
+	}
+}
+
+// prepareJobs fills the jobs read from the config file as InitializeApp
+// does, and validates them
+func prepareJobs[J jobConfig](jobs map[string]J, prepare func(name string, j J)) error {
+	for name, j := range jobs {
+		defaults.SetDefaults(j)
+		prepare(name, j)
+		if err := core.ValidateJob(j); err != nil {
+			return fmt.Errorf("job %q: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// syncJobMap applies the changes between the running jobs of a type and the
+// ones read from the config file, and returns them
+func syncJobMap[J jobConfig](c *Config, typ string, jobs, updated map[string]J) []jobChange {
+	var changes []jobChange
+	for name, j := range jobs {
+		key := jobKey{typ, name}
+		if _, ok := updated[name]; !ok && c.fileJobs[key] {
+			c.sh.RemoveJob(j)
+			delete(jobs, name)
+			delete(c.fileJobs, key)
+			changes = append(changes, jobChange{typ, name, jobRemoved, sourceFile})
+		}
+	}
+
+	for name, j := range updated {
+		key := jobKey{typ, name}
+		old, ok := jobs[name]
+		if ok && !c.fileJobs[key] {
+			// the jobs defined with Docker labels take precedence
+			continue
+		}
+
+		c.fileJobs[key] = true
+		if ok && !jobChanged(old, j) {
+			continue
+		}
+
+		change := jobAdded
+		if ok {
+			c.sh.RemoveJob(old)
+			delete(jobs, name)
+			change = jobUpdated
+		}
+
+		j.buildMiddlewares()
+		if err := c.sh.AddJob(j); err != nil {
+			c.logger.Errorf("Can't add job %q: %s", name, err)
+			delete(c.fileJobs, key)
+			if ok {
+				changes = append(changes, jobChange{typ, name, jobRemoved, sourceFile})
+			}
+
+			continue
+		}
+
+		jobs[name] = j
+		changes = append(changes, jobChange{typ, name, change, sourceFile})
+	}
+
+	return changes
+}
+
+// jobChanged reports whether a job has to be replaced: its parameters are
+// compared by hash, the rest of its config, such as the notifications, by
+// value
+func jobChanged(old, updated jobConfig) bool {
+	if old.Hash() != updated.Hash() {
+		return true
+	}
+
+	a, errA := json.Marshal(old)
+	b, errB := json.Marshal(updated)
+	return errA != nil || errB != nil || !bytes.Equal(a, b)
+}
@@ -0,0 +1,465 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/netresearch/ofelia/core"
+
+	defaults "github.com/mcuadros/go-defaults"
+	. "gopkg.in/check.v1"
+)
+
+type SuiteReload struct {
+	filename string
+	servers  []*httptest.Server
+}
+
+var _ = Suite(&SuiteReload{})
+
+func (s *SuiteReload) SetUpTest(c *C) {
+	s.filename = filepath.Join(c.MkDir(), "ofelia.ini")
+}
+
+func (s *SuiteReload) TearDownTest(c *C) {
+	for _, ts := range s.servers {
+		ts.Close()
+	}
+
+	s.servers = nil
+}
+
+func (s *SuiteReload) write(c *C, content string) {
+	c.Assert(os.WriteFile(s.filename, []byte(content), 0644), IsNil)
+}
+
+// load registers the local jobs of the config file as InitializeApp does,
+// without connecting to Docker
+func (s *SuiteReload) load(c *C) *Config {
+	conf, err := BuildFromFile(s.filename, &TestLogger{})
+	c.Assert(err, IsNil)
+
+	conf.sh = core.NewScheduler(&TestLogger{})
+	conf.fileJobs = conf.fileJobKeys()
+	for name, j := range conf.LocalJobs {
+		defaults.SetDefaults(j)
+		j.Name = name
+		j.buildMiddlewares()
+		c.Assert(conf.sh.AddJob(j), IsNil)
+	}
+
+	return conf
+}
+
+// entries returns the registered jobs as `name schedule`, sorted
+func entries(conf *Config) []string {
+	var names []string
+	for _, j := range conf.sh.Entries() {
+		names = append(names, j.GetName()+" "+j.GetSchedule())
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func (s *SuiteReload) TestReloadConfig(c *C) {
+	s.write(c, `
+		[job-local "kept"]
+		schedule = @hourly
+		command = echo kept
+		[job-local "changed"]
+		schedule = @hourly
+		command = echo changed
+		[job-local "removed"]
+		schedule = @hourly
+		command = echo removed
+	`)
+
+	conf := s.load(c)
+	kept := conf.LocalJobs["kept"]
+
+	s.write(c, `
+		[job-local "kept"]
+		schedule = @hourly
+		command = echo kept
+		[job-local "changed"]
+		schedule = @daily
+		command = echo changed
+		[job-local "added"]
+		schedule = @weekly
+		command = echo added
+	`)
+
+	c.Assert(conf.reloadConfig(s.filename, ""), IsNil)
+	c.Assert(entries(conf), DeepEquals, []string{"added @weekly", "changed @daily", "kept @hourly"})
+	c.Assert(conf.LocalJobs["kept"], Equals, kept)
+	c.Assert(conf.LocalJobs, HasLen, 3)
+}
+
+func (s *SuiteReload) TestReloadServiceJob(c *C) {
+	s.write(c, `
+		[job-service-run "backup"]
+		schedule = @hourly
+		image = busybox
+		command = echo backup
+		extra-hosts = db:10.0.0.2
+	`)
+
+	conf := s.load(c)
+	for name, j := range conf.ServiceJobs {
+		defaults.SetDefaults(j)
+		j.Name = name
+		j.buildMiddlewares()
+		c.Assert(conf.sh.AddJob(j), IsNil)
+	}
+
+	url, events := s.reloadWebhook(c)
+	conf.Global.ReloadWebhook = url
+
+	s.write(c, `
+		[job-service-run "backup"]
+		schedule = @hourly
+		image = busybox
+		command = echo backup
+		extra-hosts = db:10.0.0.3
+	`)
+	c.Assert(conf.reloadConfig(s.filename, ""), IsNil)
+
+	e := receive(c, events)
+	c.Assert(e.Changes, DeepEquals, []jobChange{{jobServiceRun, "backup", jobUpdated, sourceFile}})
+	c.Assert(conf.ServiceJobs["backup"].ExtraHosts, DeepEquals, []string{"db:10.0.0.3"})
+}
+
+// reloadWebhook returns the URL of a reload-webhook receiving the events on
+// the returned channel
+func (s *SuiteReload) reloadWebhook(c *C) (string, <-chan reloadEvent) {
+	events := make(chan reloadEvent, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e reloadEvent
+		c.Check(json.NewDecoder(r.Body).Decode(&e), IsNil)
+		events <- e
+	}))
+	s.servers = append(s.servers, ts)
+
+	return ts.URL, events
+}
+
+// receive returns the next event posted to the reload-webhook
+func receive(c *C, events <-chan reloadEvent) reloadEvent {
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(5 * time.Second):
+		c.Fatal("the reload webhook wasn't called")
+		return reloadEvent{}
+	}
+}
+
+func (s *SuiteReload) TestReloadJobChanges(c *C) {
+	s.write(c, `
+		[job-local "kept"]
+		schedule = @hourly
+		command = echo kept
+		[job-local "changed"]
+		schedule = @hourly
+		command = echo changed
+		[job-local "removed"]
+		schedule = @hourly
+		command = echo removed
+	`)
+
+	conf := s.load(c)
+	url, events := s.reloadWebhook(c)
+	conf.Global.ReloadWebhook = url
+
+	s.write(c, `
+		[job-local "kept"]
+		schedule = @hourly
+		command = echo kept
+		[job-local "changed"]
+		schedule = @daily
+		command = echo changed
+		[job-local "added"]
+		schedule = @weekly
+		command = echo added
+	`)
+	c.Assert(conf.reloadConfig(s.filename, ""), IsNil)
+
+	e := receive(c, events)
+	c.Assert(e.Time.IsZero(), Equals, false)
+	c.Assert(e.Changes, DeepEquals, []jobChange{
+		{jobLocal, "added", jobAdded, sourceFile},
+		{jobLocal, "changed", jobUpdated, sourceFile},
+		{jobLocal, "removed", jobRemoved, sourceFile},
+	})
+
+	// nothing is posted without changes
+	c.Assert(conf.reloadConfig(s.filename, ""), IsNil)
+	select {
+	case e := <-events:
+		c.Fatalf("unexpected post %v", e)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func (s *SuiteReload) TestLabelJobChanges(c *C) {
+	s.write(c, "")
+	conf := s.load(c)
+	url, events := s.reloadWebhook(c)
+	conf.Global.ReloadWebhook = url
+
+	labels := map[string]map[string]string{
+		"app": {
+			requiredLabel:                            "true",
+			labelPrefix + ".job-exec.flush.schedule": "@hourly",
+			labelPrefix + ".job-exec.flush.command":  "nginx -s reopen",
+		},
+	}
+
+	conf.dockerLabelsUpdate(labels)
+	c.Assert(receive(c, events).Changes, DeepEquals, []jobChange{
+		{jobExec, "flush", jobAdded, sourceLabels},
+	})
+
+	labels["app"][labelPrefix+".job-exec.flush.schedule"] = "@daily"
+	conf.dockerLabelsUpdate(labels)
+	c.Assert(receive(c, events).Changes, DeepEquals, []jobChange{
+		{jobExec, "flush", jobUpdated, sourceLabels},
+	})
+}
+
+// errorLogger keeps the errors logged
+type errorLogger struct {
+	TestLogger
+	errors []string
+}
+
+func (l *errorLogger) Errorf(format string, args ...interface{}) {
+	l.errors = append(l.errors, fmt.Sprintf(format, args...))
+}
+
+func (s *SuiteReload) TestInvalidLabelJob(c *C) {
+	s.write(c, "")
+	conf := s.load(c)
+	logger := &errorLogger{}
+	conf.logger = logger
+
+	labels := map[string]map[string]string{
+		"app": {
+			requiredLabel:                                  "true",
+			labelPrefix + ".job-exec.flush.schedule":       "@hourly",
+			labelPrefix + ".job-exec.flush.command":        "nginx -s reopen",
+			labelPrefix + ".job-exec.flush.overlap-policy": "sometimes",
+		},
+	}
+
+	conf.dockerLabelsUpdate(labels)
+	c.Assert(entries(conf), HasLen, 0)
+	c.Assert(conf.ExecJobs, HasLen, 0)
+	c.Assert(logger.errors, DeepEquals, []string{`Can't add job-exec "flush": unknown overlap policy: "sometimes"`})
+
+	// fixed, then broken again
+	labels["app"][labelPrefix+".job-exec.flush.overlap-policy"] = "skip"
+	conf.dockerLabelsUpdate(labels)
+	c.Assert(entries(conf), DeepEquals, []string{"flush @hourly"})
+
+	labels["app"][labelPrefix+".job-exec.flush.jitter"] = "soon"
+	conf.dockerLabelsUpdate(labels)
+	c.Assert(entries(conf), HasLen, 0)
+	c.Assert(conf.ExecJobs, HasLen, 0)
+	c.Assert(logger.errors, HasLen, 2)
+}
+
+func (s *SuiteReload) TestUnexpandedLabelJob(c *C) {
+	s.write(c, "")
+	conf := s.load(c)
+	logger := &errorLogger{}
+	conf.logger = logger
+
+	labels := map[string]map[string]string{
+		"app": {
+			requiredLabel:                            "true",
+			labelPrefix + ".job-exec.flush.schedule": "@hourly",
+			labelPrefix + ".job-exec.flush.command":  "nginx -s reopen",
+			labelPrefix + ".job-exec.purge.schedule": "@daily",
+			labelPrefix + ".job-exec.purge.command":  "purge",
+		},
+	}
+
+	conf.dockerLabelsUpdate(labels)
+	c.Assert(entries(conf), DeepEquals, []string{"flush @hourly", "purge @daily"})
+
+	// the job failing to expand is logged and left as it was, like the
+	// other jobs
+	labels["app"][labelPrefix+".job-exec.flush.schedule"] = "@daily"
+	labels["app"][labelPrefix+".job-exec.purge.command"] = "purge ${OFELIA_TEST_MISSING:?required}"
+	conf.dockerLabelsUpdate(labels)
+	c.Assert(entries(conf), DeepEquals, []string{"flush @daily", "purge @daily"})
+	c.Assert(conf.ExecJobs["purge"].Command, Equals, "purge")
+	c.Assert(logger.errors, DeepEquals, []string{
+		`Can't read the Docker labels of job-exec "purge": command: variable OFELIA_TEST_MISSING: required`,
+	})
+
+	// nothing changes if the labels can't be read at all
+	conf.Global.MissingEnv = "sometimes"
+	labels["app"][labelPrefix+".job-exec.flush.schedule"] = "@hourly"
+	conf.dockerLabelsUpdate(labels)
+	c.Assert(entries(conf), DeepEquals, []string{"flush @daily", "purge @daily"})
+	c.Assert(logger.errors[1], Equals, `Can't read the Docker labels: invalid missing-env "sometimes", expected empty or error`)
+}
+
+func (s *SuiteReload) TestReloadConfigMiddlewares(c *C) {
+	s.write(c, `
+		[job-local "foo"]
+		schedule = @hourly
+		command = echo foo
+	`)
+
+	conf := s.load(c)
+	s.write(c, `
+		[job-local "foo"]
+		schedule = @hourly
+		command = echo foo
+		slack-webhook = http://localhost/slack
+	`)
+
+	c.Assert(conf.reloadConfig(s.filename, ""), IsNil)
+	c.Assert(conf.LocalJobs["foo"].SlackWebhook, Equals, "http://localhost/slack")
+	c.Assert(conf.sh.Entries(), DeepEquals, []core.Job{conf.LocalJobs["foo"]})
+}
+
+func (s *SuiteReload) TestReloadConfigInvalid(c *C) {
+	s.write(c, `
+		[job-local "foo"]
+		schedule = @hourly
+		command = echo foo
+	`)
+
+	conf := s.load(c)
+	foo := conf.LocalJobs["foo"]
+
+	s.write(c, `
+		[job-local "foo"
+		schedule = @daily
+	`)
+	c.Assert(conf.reloadConfig(s.filename, ""), NotNil)
+
+	s.write(c, `
+		[job-local "foo"]
+		schedule = @daily
+		command = echo foo
+		[job-local "bar"]
+		schedule = every day
+		command = echo bar
+	`)
+	c.Assert(conf.reloadConfig(s.filename, ""), ErrorMatches, `job "bar": invalid schedule.*`)
+
+	c.Assert(entries(conf), DeepEquals, []string{"foo @hourly"})
+	c.Assert(conf.LocalJobs["foo"], Equals, foo)
+}
+
+func (s *SuiteReload) TestReloadConfigKeepsLabelJobs(c *C) {
+	s.write(c, `
+		[job-local "foo"]
+		schedule = @hourly
+		command = echo foo
+	`)
+
+	conf := s.load(c)
+	label := &LocalJobConfig{}
+	label.Name = "label"
+	label.Schedule = "@daily"
+	label.Command = "echo label"
+	c.Assert(conf.sh.AddJob(label), IsNil)
+	conf.LocalJobs["label"] = label
+
+	s.write(c, `
+		[job-local "label"]
+		schedule = @weekly
+		command = echo file
+	`)
+
+	c.Assert(conf.reloadConfig(s.filename, ""), IsNil)
+	c.Assert(entries(conf), DeepEquals, []string{"label @daily"})
+	c.Assert(conf.LocalJobs["label"], Equals, label)
+}
+
+func (s *SuiteReload) TestWatchConfig(c *C) {
+	defer func(d time.Duration) { configReloadDelay = d }(configReloadDelay)
+	configReloadDelay = 10 * time.Millisecond
+
+	s.write(c, `
+		[job-local "foo"]
+		schedule = @hourly
+		command = echo foo
+	`)
+
+	conf := s.load(c)
+	done := make(chan struct{})
+	defer close(done)
+	c.Assert(conf.watchConfig(s.filename, "", done), IsNil)
+
+	s.write(c, `
+		[job-local "foo"]
+		schedule = @daily
+		command = echo foo
+	`)
+
+	for i := 0; i < 100; i++ {
+		jobsMu.Lock()
+		names := entries(conf)
+		jobsMu.Unlock()
+
+		if names[0] == "foo @daily" {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	c.Fatal("the config file wasn't reloaded")
+}
+
+func (s *SuiteReload) TestWatchConfigDir(c *C) {
+	defer func(d time.Duration) { configReloadDelay = d }(configReloadDelay)
+	configReloadDelay = 10 * time.Millisecond
+
+	s.filename = c.MkDir()
+	c.Assert(os.WriteFile(filepath.Join(s.filename, "foo.ini"), []byte(`
+		[job-local "foo"]
+		schedule = @hourly
+		command = echo foo
+	`), 0644), IsNil)
+
+	conf := s.load(c)
+	done := make(chan struct{})
+	defer close(done)
+	c.Assert(conf.watchConfig(s.filename, "", done), IsNil)
+
+	c.Assert(os.WriteFile(filepath.Join(s.filename, "bar.ini"), []byte(`
+		[job-local "bar"]
+		schedule = @daily
+		command = echo bar
+	`), 0644), IsNil)
+
+	for i := 0; i < 100; i++ {
+		jobsMu.Lock()
+		names := entries(conf)
+		jobsMu.Unlock()
+
+		if len(names) == 2 {
+			c.Assert(names, DeepEquals, []string{"bar @daily", "foo @hourly"})
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	c.Fatal("the config directory wasn't reloaded")
+}
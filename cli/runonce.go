@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/netresearch/ofelia/core"
+)
+
+var (
+	errJobsFailed  = errors.New("jobs failed")
+	errJobsSkipped = errors.New("jobs skipped")
+)
+
+// runOnce runs every registered job once, all at the same time, waits for
+// them to finish and returns an error listing the ones that failed or were
+// skipped, e.g. by their overlap policy or a lack of free resources. The
+// scheduler is never started and the Docker clients are closed at the end.
+func (c *DaemonCommand) runOnce() error {
+	defer c.config.closeDockerClients()
+	defer c.config.flushNotifications()
+	defer c.scheduler.Stop()
+
+	jobs := c.scheduler.Entries()
+	c.Logger.Noticef("Running %d jobs once", len(jobs))
+
+	var mu sync.Mutex
+	var failed, skipped []string
+	var wg sync.WaitGroup
+	for _, j := range jobs {
+		wg.Add(1)
+		go func(j core.Job) {
+			defer wg.Done()
+
+			e, err := c.scheduler.RunEntry(j)
+			if err != nil {
+				c.Logger.Errorf("Job %q: %s", j.GetName(), err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err != nil || e.Failed:
+				failed = append(failed, j.GetName())
+			case e.Skipped:
+				c.Logger.Warningf("Job %q: skipped", j.GetName())
+				skipped = append(skipped, j.GetName())
+			}
+		}(j)
+	}
+
+	wg.Wait()
+
+	var errs []error
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		errs = append(errs, fmt.Errorf("%d of %d %w: %s", len(failed), len(jobs), errJobsFailed, strings.Join(failed, ", ")))
+	}
+
+	if len(skipped) > 0 {
+		sort.Strings(skipped)
+		errs = append(errs, fmt.Errorf("%d of %d %w: %s", len(skipped), len(jobs), errJobsSkipped, strings.Join(skipped, ", ")))
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	c.Logger.Noticef("All the %d jobs succeeded", len(jobs))
+	return nil
+}
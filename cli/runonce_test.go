@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"github.com/netresearch/ofelia/core"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteRunOnce struct{}
+
+var _ = Suite(&SuiteRunOnce{})
+
+// countingJob counts its executions and fails if err is set
+type countingJob struct {
+	core.BareJob
+	calls int32
+	err   error
+}
+
+func (j *countingJob) Run(ctx *core.Context) error {
+	atomic.AddInt32(&j.calls, 1)
+	return j.err
+}
+
+func (s *SuiteRunOnce) daemon(c *C, jobs ...*countingJob) *DaemonCommand {
+	sh := core.NewScheduler(&TestLogger{})
+	for _, j := range jobs {
+		j.Schedule = "@daily"
+		c.Assert(sh.AddJob(j), IsNil)
+	}
+
+	return &DaemonCommand{Logger: &TestLogger{}, scheduler: sh, config: NewConfig(&TestLogger{})}
+}
+
+func (s *SuiteRunOnce) TestRunOnce(c *C) {
+	a, b := &countingJob{}, &countingJob{}
+	a.Name, b.Name = "a", "b"
+
+	c.Assert(s.daemon(c, a, b).runOnce(), IsNil)
+	c.Assert(atomic.LoadInt32(&a.calls), Equals, int32(1))
+	c.Assert(atomic.LoadInt32(&b.calls), Equals, int32(1))
+}
+
+func (s *SuiteRunOnce) TestRunOnceFailures(c *C) {
+	a, b, d := &countingJob{}, &countingJob{err: errors.New("boom")}, &countingJob{err: errors.New("boom")}
+	a.Name, b.Name, d.Name = "a", "b", "d"
+
+	err := s.daemon(c, a, b, d).runOnce()
+	c.Assert(errors.Is(err, errJobsFailed), Equals, true)
+	c.Assert(err, ErrorMatches, "2 of 3 jobs failed: b, d")
+	for _, j := range []*countingJob{a, b, d} {
+		c.Assert(atomic.LoadInt32(&j.calls), Equals, int32(1), Commentf("job %q", j.Name))
+	}
+}
+
+func (s *SuiteRunOnce) TestRunOnceSameName(c *C) {
+	// the names are unique per job type only
+	a, b := &countingJob{}, &countingJob{}
+	a.Name, b.Name = "backup", "backup"
+
+	c.Assert(s.daemon(c, a, b).runOnce(), IsNil)
+	c.Assert(atomic.LoadInt32(&a.calls), Equals, int32(1))
+	c.Assert(atomic.LoadInt32(&b.calls), Equals, int32(1))
+}
+
+func (s *SuiteRunOnce) TestRunOnceSkipped(c *C) {
+	a, b := &countingJob{}, &countingJob{err: core.ErrSkippedExecution}
+	a.Name, b.Name = "a", "b"
+
+	err := s.daemon(c, a, b).runOnce()
+	c.Assert(errors.Is(err, errJobsSkipped), Equals, true)
+	c.Assert(errors.Is(err, errJobsFailed), Equals, false)
+	c.Assert(err, ErrorMatches, "1 of 2 jobs skipped: b")
+}
+
+func (s *SuiteRunOnce) TestRunOnceNoJobs(c *C) {
+	c.Assert(s.daemon(c).runOnce(), IsNil)
+}
@@ -0,0 +1,184 @@
+package cli
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/netresearch/ofelia/core"
+)
+
+// SchemaCommand prints the JSON schema of the configuration
+type SchemaCommand struct {
+	Logger core.Logger
+}
+
+// Execute runs the schema command
+func (c *SchemaCommand) Execute(args []string) error {
+	return writeSchema(os.Stdout)
+}
+
+// requiredKeys are the keys every job of a section must set, the other keys
+// are optional. A run job needs either an image or a container, so none of
+// them is required, as the schedule which is either schedule or cron.
+var requiredKeys = map[string][]string{
+	jobExec:       {"command", "container"},
+	jobRun:        nil,
+	jobLocal:      {"command"},
+	jobServiceRun: {"image"},
+}
+
+// scheduleKeys are the keys setting the schedule of a job, one is required
+var scheduleKeys = []interface{}{
+	map[string]interface{}{"required": []string{"schedule"}},
+	map[string]interface{}{"required": []string{"cron"}},
+}
+
+// schemaSkippedKeys are set by Ofelia itself, the name of a job being the
+// one of its section
+var schemaSkippedKeys = map[string]bool{"name": true}
+
+// writeSchema writes the JSON schema of the configuration, in its YAML
+// layout which is also the one of the INI sections: the global options and
+// the named sections, such as the jobs, indexed by name
+func writeSchema(w io.Writer) error {
+	c := &Config{}
+	named := func(section string, t reflect.Type) map[string]interface{} {
+		object := objectSchema(t, requiredKeys[section])
+		if _, isJob := requiredKeys[section]; isJob {
+			object["anyOf"] = scheduleKeys
+		}
+
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": object,
+		}
+	}
+
+	schema := map[string]interface{}{
+		"$schema":              "http://json-schema.org/draft-07/schema#",
+		"title":                "Ofelia configuration",
+		"type":                 "object",
+		"additionalProperties": false,
+		"properties": map[string]interface{}{
+			"global":          objectSchema(reflect.TypeOf(c.Global), nil),
+			"docker":          objectSchema(reflect.TypeOf(c.Docker), nil),
+			"registry-auth":   named("registry-auth", reflect.TypeOf(RegistryAuthConfig{})),
+			"docker-endpoint": named("docker-endpoint", reflect.TypeOf(DockerEndpointConfig{})),
+			jobExec:           named(jobExec, reflect.TypeOf(ExecJobConfig{})),
+			jobRun:            named(jobRun, reflect.TypeOf(RunJobConfig{})),
+			jobLocal:          named(jobLocal, reflect.TypeOf(LocalJobConfig{})),
+			jobServiceRun:     named(jobServiceRun, reflect.TypeOf(RunServiceConfig{})),
+		},
+	}
+
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(schema)
+}
+
+// objectSchema describes the keys of a config struct, the embedded structs
+// being squashed into it
+func objectSchema(t reflect.Type, required []string) map[string]interface{} {
+	properties := make(map[string]interface{})
+	addProperties(t, properties)
+
+	schema := map[string]interface{}{
+		"type":                 "object",
+		"additionalProperties": false,
+		"properties":           properties,
+	}
+
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+
+	return schema
+}
+
+func addProperties(t reflect.Type, properties map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			addProperties(f.Type, properties)
+			continue
+		}
+
+		key := schemaKey(f)
+		if !f.IsExported() || key == "-" || schemaSkippedKeys[key] {
+			continue
+		}
+
+		if p := propertySchema(f); p != nil {
+			properties[key] = p
+		}
+	}
+}
+
+// schemaKey returns the key of a field, as read by mapstructure and gcfg
+func schemaKey(f reflect.StructField) string {
+	if name, _, _ := strings.Cut(f.Tag.Get("mapstructure"), ","); name != "" {
+		return name
+	}
+
+	if name := f.Tag.Get("gcfg"); name != "" {
+		return name
+	}
+
+	return strings.ToLower(f.Name)
+}
+
+// propertySchema describes a field, nil if it can't be configured
+func propertySchema(f reflect.StructField) map[string]interface{} {
+	var p map[string]interface{}
+	switch f.Type.Kind() {
+	case reflect.String:
+		p = map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		p = map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		p = map[string]interface{}{"type": "integer"}
+	case reflect.Slice:
+		if f.Type.Elem().Kind() != reflect.String {
+			return nil
+		}
+
+		// a single value is accepted as well, as with labels and INI, and
+		// YAML allows a mapping for the `key=value` entries
+		item := map[string]interface{}{"type": "string"}
+		p = map[string]interface{}{"anyOf": []interface{}{
+			item,
+			map[string]interface{}{"type": "array", "items": item},
+			map[string]interface{}{"type": "object"},
+		}}
+	default:
+		return nil
+	}
+
+	if value, ok := f.Tag.Lookup("default"); ok {
+		p["default"] = defaultValue(f.Type.Kind(), value)
+	}
+
+	return p
+}
+
+// defaultValue converts the default tag of a field to the type of the field
+func defaultValue(kind reflect.Kind, value string) interface{} {
+	switch kind {
+	case reflect.Bool:
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return n
+		}
+	}
+
+	return value
+}
@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteSchema struct{}
+
+var _ = Suite(&SuiteSchema{})
+
+type schemaObject struct {
+	Properties           map[string]map[string]interface{} `json:"properties"`
+	Required             []string                          `json:"required"`
+	AnyOf                []map[string][]string             `json:"anyOf"`
+	AdditionalProperties bool                              `json:"additionalProperties"`
+}
+
+func (s *SuiteSchema) schema(c *C) map[string]json.RawMessage {
+	var b bytes.Buffer
+	c.Assert(writeSchema(&b), IsNil)
+
+	var schema struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	c.Assert(json.Unmarshal(b.Bytes(), &schema), IsNil)
+	return schema.Properties
+}
+
+// job returns the schema of the jobs of a section
+func (s *SuiteSchema) job(c *C, section string) schemaObject {
+	var named struct {
+		AdditionalProperties schemaObject `json:"additionalProperties"`
+	}
+	c.Assert(json.Unmarshal(s.schema(c)[section], &named), IsNil)
+	return named.AdditionalProperties
+}
+
+func (s *SuiteSchema) TestSections(c *C) {
+	sections := s.schema(c)
+	for _, name := range []string{"global", "docker", "registry-auth", "docker-endpoint", jobExec, jobRun, jobLocal, jobServiceRun} {
+		c.Assert(sections[name], NotNil, Commentf("section %q", name))
+	}
+
+	c.Assert(sections, HasLen, 8)
+}
+
+func (s *SuiteSchema) TestRunJob(c *C) {
+	run := s.job(c, jobRun)
+	c.Assert(run.Required, HasLen, 0)
+	c.Assert(run.AdditionalProperties, Equals, false)
+
+	c.Assert(run.Properties["schedule"], DeepEquals, map[string]interface{}{"type": "string"})
+	c.Assert(run.Properties["image"], DeepEquals, map[string]interface{}{"type": "string"})
+	c.Assert(run.Properties["pull"], DeepEquals, map[string]interface{}{"type": "string", "default": "missing"})
+	c.Assert(run.Properties["tty"], DeepEquals, map[string]interface{}{"type": "boolean", "default": false})
+	c.Assert(run.Properties["max-concurrent"], DeepEquals, map[string]interface{}{"type": "integer"})
+	c.Assert(run.Properties["volume"]["anyOf"], HasLen, 3)
+	c.Assert(run.Properties["slack-webhook"], NotNil)
+
+	// set by Ofelia or not configurable
+	for _, key := range []string{"name", "client", "history"} {
+		_, ok := run.Properties[key]
+		c.Assert(ok, Equals, false, Commentf("key %q", key))
+	}
+}
+
+func (s *SuiteSchema) TestRequired(c *C) {
+	c.Assert(s.job(c, jobExec).Required, DeepEquals, []string{"command", "container"})
+	c.Assert(s.job(c, jobLocal).Required, DeepEquals, []string{"command"})
+	c.Assert(s.job(c, jobServiceRun).Required, DeepEquals, []string{"image"})
+
+	// the schedule is set with either key
+	for _, section := range []string{jobExec, jobRun, jobLocal, jobServiceRun} {
+		c.Assert(s.job(c, section).AnyOf, DeepEquals, []map[string][]string{
+			{"required": {"schedule"}},
+			{"required": {"cron"}},
+		}, Commentf("section %q", section))
+	}
+}
+
+func (s *SuiteSchema) TestGlobal(c *C) {
+	var global schemaObject
+	c.Assert(json.Unmarshal(s.schema(c)["global"], &global), IsNil)
+	c.Assert(global.Required, IsNil)
+	c.Assert(global.Properties["default-jitter"], DeepEquals, map[string]interface{}{"type": "string"})
+	c.Assert(global.Properties["docker-retry-attempts"], DeepEquals, map[string]interface{}{"type": "integer"})
+	c.Assert(global.Properties["smtp-password"], NotNil)
+}
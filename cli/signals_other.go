@@ -0,0 +1,12 @@
+//go:build !unix
+
+package cli
+
+import "os"
+
+// sigPause and sigResume are nil without SIGUSR1 and SIGUSR2, the scheduled
+// executions can't be paused with a signal
+var (
+	sigPause  os.Signal
+	sigResume os.Signal
+)
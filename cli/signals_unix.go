@@ -0,0 +1,14 @@
+//go:build unix
+
+package cli
+
+import (
+	"os"
+	"syscall"
+)
+
+// sigPause and sigResume pause and resume the scheduled executions
+var (
+	sigPause  os.Signal = syscall.SIGUSR1
+	sigResume os.Signal = syscall.SIGUSR2
+)
@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/netresearch/ofelia/core"
+)
+
+// listenTrigger runs the jobs named on the lines written to the Unix socket
+// at path, e.g. `echo backup | nc -U /run/ofelia.sock`, until the returned
+// listener is closed. Each line is answered with `ok` or the error, the
+// unknown jobs are logged and ignored.
+func listenTrigger(path string, sh *core.Scheduler, logger core.Logger) (net.Listener, error) {
+	// the socket left by a previous process is replaced, not another file
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&fs.ModeSocket == 0 {
+			return nil, fmt.Errorf("trigger-socket %q exists and isn't a socket", path)
+		}
+
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(path, 0660); err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+
+			if err != nil {
+				logger.Errorf("Trigger socket error: %s", err)
+				continue
+			}
+
+			go serveTrigger(conn, sh, logger)
+		}
+	}()
+
+	return l, nil
+}
+
+// serveTrigger runs the jobs named by a client of the trigger socket
+func serveTrigger(conn net.Conn, sh *core.Scheduler, logger core.Logger) {
+	defer conn.Close()
+
+	s := bufio.NewScanner(conn)
+	for s.Scan() {
+		name := strings.TrimSpace(s.Text())
+		if name == "" {
+			continue
+		}
+
+		j, err := sh.JobNamed(name)
+		if err != nil {
+			logger.Warningf("Trigger socket: %s, ignored", err)
+			fmt.Fprintf(conn, "error: %s\n", err)
+			continue
+		}
+
+		logger.Noticef("Trigger socket: running job %q", name)
+		go sh.RunEntry(j)
+		fmt.Fprintln(conn, "ok")
+	}
+}
@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/netresearch/ofelia/core"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteTrigger struct{}
+
+var _ = Suite(&SuiteTrigger{})
+
+// triggeredJob sends its name when it runs
+type triggeredJob struct {
+	core.BareJob
+	runs chan string
+}
+
+func (j *triggeredJob) Run(ctx *core.Context) error {
+	j.runs <- j.Name
+	return nil
+}
+
+func (s *SuiteTrigger) TestListenTrigger(c *C) {
+	job := &triggeredJob{runs: make(chan string, 1)}
+	job.Name = "backup"
+	job.Schedule = "@daily"
+
+	sc := core.NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(job), IsNil)
+
+	path := filepath.Join(c.MkDir(), "ofelia.sock")
+	l, err := listenTrigger(path, sc, &TestLogger{})
+	c.Assert(err, IsNil)
+	defer l.Close()
+
+	conn, err := net.Dial("unix", path)
+	c.Assert(err, IsNil)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("unknown\n\nbackup\n"))
+	c.Assert(err, IsNil)
+
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	c.Assert(err, IsNil)
+	c.Assert(line, Equals, "error: job not found: \"unknown\"\n")
+
+	line, err = r.ReadString('\n')
+	c.Assert(err, IsNil)
+	c.Assert(line, Equals, "ok\n")
+
+	select {
+	case name := <-job.runs:
+		c.Assert(name, Equals, "backup")
+	case <-time.After(5 * time.Second):
+		c.Fatal("the job wasn't triggered")
+	}
+}
+
+func (s *SuiteTrigger) TestListenTriggerStale(c *C) {
+	sc := core.NewScheduler(&TestLogger{})
+	path := filepath.Join(c.MkDir(), "ofelia.sock")
+
+	// the socket of a previous process, still on disk
+	stale, err := net.Listen("unix", path)
+	c.Assert(err, IsNil)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	l, err := listenTrigger(path, sc, &TestLogger{})
+	c.Assert(err, IsNil)
+	l.Close()
+
+	_, err = os.Stat(path)
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	// never a regular file
+	c.Assert(os.WriteFile(path, nil, 0644), IsNil)
+	_, err = listenTrigger(path, sc, &TestLogger{})
+	c.Assert(err, ErrorMatches, `trigger-socket ".*" exists and isn't a socket`)
+}
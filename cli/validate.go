@@ -1,23 +1,189 @@
 package cli
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
 	"github.com/netresearch/ofelia/core"
 )
 
 // ValidateCommand validates the config file
 type ValidateCommand struct {
-	ConfigFile string `long:"config" description:"configuration file" default:"/etc/ofelia.conf"`
-	Logger     core.Logger
+	ConfigFile   string `long:"config" description:"configuration file" default:"/etc/ofelia.conf"`
+	ConfigFormat string `long:"config-format" description:"format of the configuration file, ini or yaml, detected from the extension by default"`
+	ConfigDir    string `long:"config-dir" description:"directory of INI configuration files, merged in sorted order, instead of --config"`
+	JSON         bool   `long:"json" description:"Print the errors and warnings as JSON"`
+	Logger       core.Logger
+}
+
+// ValidateReport is the result of the validation of a config file, the
+// notices are hints less important than the warnings
+type ValidateReport struct {
+	Valid    bool     `json:"valid"`
+	Errors   []string `json:"errors"`
+	Warnings []string `json:"warnings"`
+	Notices  []string `json:"notices"`
 }
 
 // Execute runs the validation command
 func (c *ValidateCommand) Execute(args []string) error {
-	c.Logger.Debugf("Validating %q ... ", c.ConfigFile)
-	_, err := BuildFromFile(c.ConfigFile, c.Logger)
+	return c.validate(os.Stdout)
+}
+
+// validate checks the config file, it never connects to Docker
+func (c *ValidateCommand) validate(w io.Writer) error {
+	path := configPath(c.ConfigFile, c.ConfigDir)
+	c.Logger.Debugf("Validating %q ... ", path)
+
+	var r *ValidateReport
+	conf, err := BuildFromFileFormat(path, c.ConfigFormat, c.Logger)
 	if err != nil {
-		c.Logger.Errorf("ERROR")
-		return err
+		r = &ValidateReport{Errors: []string{err.Error()}, Warnings: []string{}, Notices: []string{}}
+	} else {
+		r = conf.validate()
 	}
-	c.Logger.Debugf("OK")
+
+	if c.JSON {
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+		if err := e.Encode(r); err != nil {
+			return err
+		}
+	} else {
+		c.logReport(r)
+	}
+
+	if !r.Valid {
+		return errInvalidConfig
+	}
+
 	return nil
 }
+
+func (c *ValidateCommand) logReport(r *ValidateReport) {
+	for _, e := range r.Errors {
+		c.Logger.Errorf("%s", e)
+	}
+
+	for _, w := range r.Warnings {
+		c.Logger.Warningf("%s", w)
+	}
+
+	for _, n := range r.Notices {
+		c.Logger.Noticef("%s", n)
+	}
+
+	if r.Valid {
+		c.Logger.Debugf("OK")
+	}
+}
+
+// validate checks the global options and every job, reporting all the
+// errors found instead of the first one. The warnings are only reported if
+// the config is valid.
+func (c *Config) validate() *ValidateReport {
+	r := &ValidateReport{Errors: []string{}, Warnings: []string{}, Notices: []string{}}
+	check := func(err error) {
+		if err != nil {
+			r.Errors = append(r.Errors, err.Error())
+		}
+	}
+
+	check(c.validateNotifications())
+	check(c.validateDockerEndpoints())
+	check(validateLogFormat(c.Global.LogFormat))
+
+	_, err := c.sweepAge()
+	check(err)
+
+	_, err = c.dockerReadiness()
+	check(err)
+
+	_, err = c.shutdownTimeout()
+	check(err)
+
+	_, err = c.labelPrefix()
+	check(err)
+
+	_, _, err = c.dockerTimeouts()
+	check(err)
+
+	_, err = c.maintenanceWindows()
+	check(err)
+
+	// the TLS files are loaded, the daemon itself is only reached by daemon
+	t, err := c.dockerTLS()
+	if err == nil && t != nil {
+		_, err = t.Config()
+	}
+	check(err)
+
+	var jobErrors []string
+	c.eachJob(func(name string, j core.Job) {
+		if err := core.ValidateJob(j); err != nil {
+			jobErrors = append(jobErrors, fmt.Sprintf("Job %q: %s", name, err))
+		}
+	})
+
+	sort.Strings(jobErrors)
+	r.Errors = append(r.Errors, jobErrors...)
+
+	r.Valid = len(r.Errors) == 0
+	if !r.Valid {
+		return r
+	}
+
+	var warnings []string
+	for schedule, names := range c.schedulesWithoutJitter() {
+		warnings = append(warnings, fmt.Sprintf(
+			"%d jobs share the schedule %q without jitter, consider setting `jitter` or `default-jitter`: %s",
+			len(names), schedule, strings.Join(names, ", "),
+		))
+	}
+
+	for registry, names := range c.registriesWithoutAuth() {
+		warnings = append(warnings, fmt.Sprintf(
+			"no credentials configured for the registry %q, consider adding a `registry-auth` section: %s",
+			registry, strings.Join(names, ", "),
+		))
+	}
+
+	for section, warning := range c.mailTLSWarnings() {
+		warnings = append(warnings, fmt.Sprintf("%s: %s", section, warning))
+	}
+
+	// the ones above come from maps
+	sort.Strings(warnings)
+	r.Warnings = append(r.Warnings, warnings...)
+
+	r.Warnings = append(r.Warnings, c.secretFileWarnings()...)
+	r.Warnings = append(r.Warnings, c.onFailureWarnings()...)
+	r.Warnings = append(r.Warnings, c.disabledMiddlewareWarnings()...)
+
+	if names := c.rootJobs(); len(names) > 0 {
+		r.Warnings = append(r.Warnings, fmt.Sprintf(
+			"jobs running as root, consider setting a `user` or `allow-root = true`: %s",
+			strings.Join(names, ", "),
+		))
+	}
+
+	if names := c.readOnlyWithoutMounts(); len(names) > 0 {
+		r.Notices = append(r.Notices, fmt.Sprintf(
+			"read-only jobs without tmpfs nor volume may fail to write, consider adding a `tmpfs` mount: %s",
+			strings.Join(names, ", "),
+		))
+	}
+
+	if names := c.shellWrappersWithoutInit(); len(names) > 0 {
+		r.Notices = append(r.Notices, fmt.Sprintf(
+			"jobs running a shell wrapper without init may leave zombie processes, consider setting `init`: %s",
+			strings.Join(names, ", "),
+		))
+	}
+
+	return r
+}
@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteValidate struct{}
+
+var _ = Suite(&SuiteValidate{})
+
+// validate runs the validate command on the given config, with the JSON
+// output, and returns its report
+func (s *SuiteValidate) validate(c *C, config string) (*ValidateReport, error) {
+	file := filepath.Join(c.MkDir(), "ofelia.conf")
+	c.Assert(os.WriteFile(file, []byte(config), 0644), IsNil)
+
+	cmd := &ValidateCommand{ConfigFile: file, JSON: true, Logger: &TestLogger{}}
+	var out bytes.Buffer
+	err := cmd.validate(&out)
+
+	var r ValidateReport
+	c.Assert(json.Unmarshal(out.Bytes(), &r), IsNil)
+	return &r, err
+}
+
+func (s *SuiteValidate) TestValid(c *C) {
+	r, err := s.validate(c, `
+[job-run "backup"]
+schedule = @hourly
+image = busybox
+user = nobody
+command = echo backup
+`)
+	c.Assert(err, IsNil)
+	c.Assert(r, DeepEquals, &ValidateReport{Valid: true, Errors: []string{}, Warnings: []string{}, Notices: []string{}})
+}
+
+func (s *SuiteValidate) TestInvalid(c *C) {
+	r, err := s.validate(c, `
+[global]
+log-format = xml
+
+[job-local "a"]
+schedule = every day
+command = echo a
+
+[job-run "b"]
+schedule = @hourly
+user = nobody
+command = echo b
+`)
+	c.Assert(err, Equals, errInvalidConfig)
+	c.Assert(r.Valid, Equals, false)
+	c.Assert(r.Errors, HasLen, 3)
+	c.Assert(r.Errors[0], Matches, `invalid log-format "xml".*`)
+	c.Assert(r.Errors[1], Matches, `Job "a": invalid schedule "every day".*`)
+	c.Assert(r.Errors[2], Equals, `Job "b": image is required without container`)
+}
+
+func (s *SuiteValidate) TestWarnings(c *C) {
+	r, err := s.validate(c, `
+[job-run "backup"]
+schedule = @hourly
+image = busybox
+command = echo backup
+`)
+	c.Assert(err, IsNil)
+	c.Assert(r.Valid, Equals, true)
+	c.Assert(r.Warnings, DeepEquals, []string{
+		"jobs running as root, consider setting a `user` or `allow-root = true`: backup",
+	})
+}
+
+func (s *SuiteValidate) TestText(c *C) {
+	file := filepath.Join(c.MkDir(), "ofelia.conf")
+	c.Assert(os.WriteFile(file, []byte("[job-local \"a\"]\nschedule = foo\ncommand = echo a\n"), 0644), IsNil)
+
+	var out bytes.Buffer
+	cmd := &ValidateCommand{ConfigFile: file, Logger: &TestLogger{}}
+	c.Assert(cmd.validate(&out), Equals, errInvalidConfig)
+	c.Assert(out.Len(), Equals, 0)
+}
@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	configFormatINI  = "ini"
+	configFormatYAML = "yaml"
+)
+
+// configFormat returns the format of a config file, the given one or the
+// one matching the extension of the file, INI by default
+func configFormat(filename, format string) (string, error) {
+	switch strings.ToLower(format) {
+	case configFormatINI:
+		return configFormatINI, nil
+	case configFormatYAML, "yml":
+		return configFormatYAML, nil
+	case "":
+	default:
+		return "", fmt.Errorf("unknown config format %q, expected ini or yaml", format)
+	}
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		return configFormatYAML, nil
+	default:
+		return configFormatINI, nil
+	}
+}
+
+// readYAML reads a YAML config, its top-level keys are the INI sections:
+// `global`, `docker`, `registry-auth`, `docker-endpoint` and the job types,
+// each job type being a mapping of the jobs by name. As with INI, unknown
+// sections and keys are rejected.
+func (c *Config) readYAML(data []byte) error {
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	sections := map[string]interface{}{
+		"global":          &c.Global,
+		"docker":          &c.Docker,
+		"registry-auth":   &c.RegistryAuths,
+		"docker-endpoint": &c.DockerEndpoints,
+		jobExec:           &c.ExecJobs,
+		jobRun:            &c.RunJobs,
+		jobServiceRun:     &c.ServiceJobs,
+		jobLocal:          &c.LocalJobs,
+	}
+
+	for name, value := range raw {
+		target, ok := sections[name]
+		if !ok {
+			return fmt.Errorf("unknown section %q", name)
+		}
+
+		if err := decodeYAMLSection(value, target); err != nil {
+			return fmt.Errorf("section %q: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func decodeYAMLSection(value, target interface{}) error {
+	d, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:       mapToKeyValues,
+		ErrorUnused:      true,
+		WeaklyTypedInput: true,
+		Result:           target,
+	})
+	if err != nil {
+		return err
+	}
+
+	return d.Decode(value)
+}
+
+// mapToKeyValues allows mappings for the lists of `key=value` entries, such
+// as `environment`, the entries are sorted by key
+func mapToKeyValues(from, to reflect.Type, data interface{}) (interface{}, error) {
+	m, ok := data.(map[string]interface{})
+	if !ok || to != reflect.TypeOf([]string{}) {
+		return data, nil
+	}
+
+	entries := make([]string, 0, len(m))
+	for k, v := range m {
+		if v == nil {
+			v = ""
+		}
+
+		entries = append(entries, fmt.Sprintf("%s=%v", k, v))
+	}
+
+	sort.Strings(entries)
+	return entries, nil
+}
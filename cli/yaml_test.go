@@ -0,0 +1,164 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteYAML struct{}
+
+var _ = Suite(&SuiteYAML{})
+
+const iniFixture = `
+[global]
+slack-webhook = http://localhost/slack
+default-jitter = 30s
+
+[docker]
+filters = label=app=foo
+
+[registry-auth "ghcr.io"]
+username = bot
+password = secret
+
+[job-exec "flush"]
+schedule = @hourly
+container = nginx
+command = /flush.sh
+tty = true
+working-dir = /srv
+
+[job-run "backup"]
+schedule = 0 0 2 * * *
+image = ghcr.io/acme/backup
+command = backup --all
+volume = /data:/data:ro
+volume = /backups:/backups
+environment = FOO=bar
+environment = TOKEN=
+extra-hosts = db:10.0.0.2
+retries = 3
+retry-backoff = 10s
+slack-only-on-error = true
+
+[job-local "cleanup"]
+schedule = @every 10m
+command = rm -rf /tmp/cache
+overlap-policy = skip
+
+[job-service-run "report"]
+schedule = @daily
+image = reporter
+network = swarm_net
+`
+
+const yamlFixture = `
+global:
+  slack-webhook: http://localhost/slack
+  default-jitter: 30s
+docker:
+  filters: [label=app=foo]
+registry-auth:
+  ghcr.io:
+    username: bot
+    password: secret
+job-exec:
+  flush:
+    schedule: "@hourly"
+    container: nginx
+    command: /flush.sh
+    tty: true
+    working-dir: /srv
+job-run:
+  backup:
+    schedule: 0 0 2 * * *
+    image: ghcr.io/acme/backup
+    command: backup --all
+    volume:
+      - /data:/data:ro
+      - /backups:/backups
+    environment:
+      FOO: bar
+      TOKEN:
+    extra-hosts: [db:10.0.0.2]
+    retries: 3
+    retry-backoff: 10s
+    slack-only-on-error: true
+job-local:
+  cleanup:
+    schedule: "@every 10m"
+    command: rm -rf /tmp/cache
+    overlap-policy: skip
+job-service-run:
+  report:
+    schedule: "@daily"
+    image: reporter
+    network: swarm_net
+`
+
+func (s *SuiteYAML) writeConfig(c *C, name, content string) string {
+	filename := filepath.Join(c.MkDir(), name)
+	c.Assert(os.WriteFile(filename, []byte(content), 0644), IsNil)
+	return filename
+}
+
+func (s *SuiteYAML) TestEquivalentINI(c *C) {
+	ini, err := BuildFromFile(s.writeConfig(c, "ofelia.ini", iniFixture), &TestLogger{})
+	c.Assert(err, IsNil)
+
+	yml, err := BuildFromFile(s.writeConfig(c, "ofelia.yaml", yamlFixture), &TestLogger{})
+	c.Assert(err, IsNil)
+
+	c.Assert(yml.Global, DeepEquals, ini.Global)
+	c.Assert(yml.Docker, DeepEquals, ini.Docker)
+	c.Assert(yml.RegistryAuths, DeepEquals, ini.RegistryAuths)
+	c.Assert(yml.ExecJobs, DeepEquals, ini.ExecJobs)
+	c.Assert(yml.RunJobs, DeepEquals, ini.RunJobs)
+	c.Assert(yml.LocalJobs, DeepEquals, ini.LocalJobs)
+	c.Assert(yml.ServiceJobs, DeepEquals, ini.ServiceJobs)
+
+	c.Assert(yml.RunJobs["backup"].Environment, DeepEquals, []string{"FOO=bar", "TOKEN="})
+	c.Assert(yml.RunJobs["backup"].Retries, Equals, 3)
+	c.Assert(yml.ExecJobs["flush"].TTY, Equals, true)
+}
+
+func (s *SuiteYAML) TestConfigFormat(c *C) {
+	testcases := []struct {
+		Filename, Format, Expected string
+	}{
+		{"/etc/ofelia.conf", "", configFormatINI},
+		{"/etc/ofelia.ini", "", configFormatINI},
+		{"/etc/ofelia.yaml", "", configFormatYAML},
+		{"/etc/ofelia.YML", "", configFormatYAML},
+		{"/etc/ofelia.conf", "yaml", configFormatYAML},
+		{"/etc/ofelia.yaml", "INI", configFormatINI},
+	}
+
+	for _, t := range testcases {
+		format, err := configFormat(t.Filename, t.Format)
+		c.Assert(err, IsNil)
+		c.Assert(format, Equals, t.Expected, Commentf("%s %s", t.Filename, t.Format))
+	}
+
+	_, err := configFormat("/etc/ofelia.conf", "toml")
+	c.Assert(err, ErrorMatches, `unknown config format "toml".*`)
+}
+
+func (s *SuiteYAML) TestFormatOverride(c *C) {
+	conf, err := BuildFromFileFormat(s.writeConfig(c, "ofelia.conf", yamlFixture), configFormatYAML, &TestLogger{})
+	c.Assert(err, IsNil)
+	c.Assert(conf.RunJobs, HasLen, 1)
+}
+
+func (s *SuiteYAML) TestUnknownKeys(c *C) {
+	_, err := BuildFromFile(s.writeConfig(c, "ofelia.yaml", "jobs-run:\n  foo:\n    schedule: '@daily'\n"), &TestLogger{})
+	c.Assert(err, ErrorMatches, `unknown section "jobs-run"`)
+
+	_, err = BuildFromFile(s.writeConfig(c, "ofelia.yaml", "job-local:\n  foo:\n    schedul: '@daily'\n"), &TestLogger{})
+	c.Assert(err, ErrorMatches, `(?s)section "job-local": .*'\[foo\]' has invalid keys: schedul`)
+
+	_, err = BuildFromFile(s.writeConfig(c, "ofelia.yaml", "job-local: [foo"), &TestLogger{})
+	c.Assert(err, NotNil)
+}
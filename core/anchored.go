@@ -0,0 +1,76 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// parseAnchored parses the @weekly and @monthly schedules given a day and
+// optionally a time, e.g. `@weekly mon 09:00` or `@monthly 15`, into the
+// equivalent cron schedule. It returns nil if the schedule isn't one.
+func parseAnchored(schedule string) (cron.Schedule, error) {
+	fields := strings.Fields(schedule)
+	if len(fields) < 2 || (fields[0] != "@weekly" && fields[0] != "@monthly") {
+		return nil, nil
+	}
+
+	invalid := func() error {
+		anchor := strings.Join(fields[1:], " ")
+		if fields[0] == "@weekly" {
+			return fmt.Errorf("invalid @weekly anchor %q, expected a day and a time such as mon 09:00", anchor)
+		}
+
+		return fmt.Errorf("invalid @monthly anchor %q, expected a day of the month and a time such as 15 09:00", anchor)
+	}
+
+	if len(fields) > 3 {
+		return nil, invalid()
+	}
+
+	hour, minute := 0, 0
+	if len(fields) == 3 {
+		t, err := time.Parse("15:04", fields[2])
+		if err != nil {
+			return nil, invalid()
+		}
+
+		hour, minute = t.Hour(), t.Minute()
+	}
+
+	var spec string
+	if fields[0] == "@weekly" {
+		day, ok := parseWeekday(fields[1])
+		if !ok {
+			return nil, invalid()
+		}
+
+		spec = fmt.Sprintf("0 %d %d * * %d", minute, hour, day)
+	} else {
+		day, err := strconv.Atoi(fields[1])
+		if err != nil || day < 1 || day > 31 {
+			return nil, invalid()
+		}
+
+		spec = fmt.Sprintf("0 %d %d %d * *", minute, hour, day)
+	}
+
+	return cronParser.Parse(spec)
+}
+
+// parseWeekday parses a day by its name or its three first letters, case
+// insensitive, e.g. `Monday` or `mon`
+func parseWeekday(name string) (time.Weekday, bool) {
+	name = strings.ToLower(name)
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		full := strings.ToLower(d.String())
+		if name == full || name == full[:3] {
+			return d, true
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,70 @@
+package core
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteAnchored struct{}
+
+var _ = Suite(&SuiteAnchored{})
+
+func (s *SuiteAnchored) TestWeekly(c *C) {
+	// a Wednesday
+	from := time.Date(2025, 6, 4, 12, 0, 0, 0, time.Local)
+
+	next, err := NextRun("@weekly mon 09:00", from)
+	c.Assert(err, IsNil)
+	c.Assert(next, Equals, time.Date(2025, 6, 9, 9, 0, 0, 0, time.Local))
+
+	next, err = NextRun("@weekly mon 09:00", next)
+	c.Assert(err, IsNil)
+	c.Assert(next, Equals, time.Date(2025, 6, 16, 9, 0, 0, 0, time.Local))
+	c.Assert(next.Weekday(), Equals, time.Monday)
+
+	// the full names and the midnight by default
+	next, err = NextRun("@weekly Friday", from)
+	c.Assert(err, IsNil)
+	c.Assert(next, Equals, time.Date(2025, 6, 6, 0, 0, 0, 0, time.Local))
+
+	// the plain descriptor is still the one of cron
+	next, err = NextRun("@weekly", from)
+	c.Assert(err, IsNil)
+	c.Assert(next, Equals, time.Date(2025, 6, 8, 0, 0, 0, 0, time.Local))
+}
+
+func (s *SuiteAnchored) TestMonthly(c *C) {
+	from := time.Date(2025, 6, 20, 12, 0, 0, 0, time.Local)
+
+	next, err := NextRun("@monthly 15 06:30", from)
+	c.Assert(err, IsNil)
+	c.Assert(next, Equals, time.Date(2025, 7, 15, 6, 30, 0, 0, time.Local))
+
+	// the months without the day are skipped
+	next, err = NextRun("@monthly 31", from)
+	c.Assert(err, IsNil)
+	c.Assert(next, Equals, time.Date(2025, 7, 31, 0, 0, 0, 0, time.Local))
+}
+
+func (s *SuiteAnchored) TestInvalid(c *C) {
+	for _, schedule := range []string{
+		"@weekly mo 09:00",
+		"@weekly funday",
+		"@weekly mon 25:00",
+		"@weekly mon 9am",
+		"@weekly mon 09:00 utc",
+	} {
+		_, err := parseSchedule(schedule)
+		c.Assert(err, ErrorMatches, `invalid @weekly anchor .*`, Commentf("schedule %q", schedule))
+	}
+
+	for _, schedule := range []string{"@monthly 0", "@monthly 32 09:00", "@monthly mon", "@monthly 1 09:60"} {
+		_, err := parseSchedule(schedule)
+		c.Assert(err, ErrorMatches, `invalid @monthly anchor .*`, Commentf("schedule %q", schedule))
+	}
+
+	job := &TestJob{}
+	job.Schedule = "@weekly mon noon"
+	c.Assert(ValidateJob(job), ErrorMatches, `invalid schedule "@weekly mon noon": invalid @weekly anchor "mon noon".*`)
+}
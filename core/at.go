@@ -0,0 +1,77 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// ScheduleAt is the prefix of the schedules running a job once at the given
+// time, e.g. `@at 2025-06-01T02:00:00Z`
+const ScheduleAt = "@at "
+
+var ErrPastSchedule = errors.New("the time of the @at schedule is in the past")
+
+// atSchedule fires once at its time and then never again, the job stays
+// registered but dormant
+type atSchedule struct {
+	at time.Time
+	// past lets it fire even if its time is already gone, as soon as the
+	// scheduler is running
+	past bool
+
+	mu        sync.Mutex
+	scheduled bool
+}
+
+// parseAt parses an @at schedule, nil if the schedule isn't one
+func parseAt(schedule string) (*atSchedule, error) {
+	value, ok := strings.CutPrefix(schedule, ScheduleAt)
+	if !ok {
+		return nil, nil
+	}
+
+	at, err := time.Parse(time.RFC3339, strings.TrimSpace(value))
+	if err != nil {
+		return nil, fmt.Errorf("invalid @at time %q, expected a RFC 3339 timestamp such as 2025-06-01T02:00:00Z", value)
+	}
+
+	return &atSchedule{at: at}, nil
+}
+
+// Next returns the time of the schedule until it has been handed over to
+// cron, then the zero time, which cron never fires
+func (s *atSchedule) Next(t time.Time) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t.Before(s.at) || (s.past && !s.scheduled) {
+		s.scheduled = true
+		return s.at
+	}
+
+	return time.Time{}
+}
+
+// parseSchedule parses the schedule of a job, a cron expression, a cron
+// descriptor, an anchored @weekly or @monthly or an @at time
+func parseSchedule(schedule string) (cron.Schedule, error) {
+	at, err := parseAt(schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	if at != nil {
+		return at, nil
+	}
+
+	if sched, err := parseAnchored(schedule); sched != nil || err != nil {
+		return sched, err
+	}
+
+	return cronParser.Parse(schedule)
+}
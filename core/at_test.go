@@ -0,0 +1,101 @@
+package core
+
+import (
+	"errors"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteAt struct{}
+
+var _ = Suite(&SuiteAt{})
+
+var atTime = time.Date(2025, 6, 1, 2, 0, 0, 0, time.UTC)
+
+func (s *SuiteAt) TestParseAt(c *C) {
+	at, err := parseAt("@at 2025-06-01T04:00:00+02:00")
+	c.Assert(err, IsNil)
+	c.Assert(at.at.Equal(atTime), Equals, true)
+
+	at, err = parseAt("@hourly")
+	c.Assert(err, IsNil)
+	c.Assert(at, IsNil)
+
+	_, err = parseAt("@at tomorrow")
+	c.Assert(err, ErrorMatches, `invalid @at time "tomorrow".*`)
+}
+
+func (s *SuiteAt) TestNext(c *C) {
+	at, err := parseAt("@at 2025-06-01T02:00:00Z")
+	c.Assert(err, IsNil)
+
+	c.Assert(at.Next(atTime.Add(-time.Hour)), Equals, atTime)
+	c.Assert(at.Next(atTime.Add(-time.Nanosecond)), Equals, atTime)
+
+	// once fired, at or after its time
+	c.Assert(at.Next(atTime).IsZero(), Equals, true)
+	c.Assert(at.Next(atTime.Add(time.Second)).IsZero(), Equals, true)
+}
+
+func (s *SuiteAt) TestNextPast(c *C) {
+	at, err := parseAt("@at 2025-06-01T02:00:00Z")
+	c.Assert(err, IsNil)
+	at.past = true
+
+	// fires right away, then never again
+	c.Assert(at.Next(atTime.Add(time.Hour)), Equals, atTime)
+	c.Assert(at.Next(atTime.Add(time.Hour)).IsZero(), Equals, true)
+}
+
+func (s *SuiteAt) TestNextRun(c *C) {
+	next, err := NextRun("@at 2025-06-01T02:00:00Z", atTime.Add(-time.Minute))
+	c.Assert(err, IsNil)
+	c.Assert(next, Equals, atTime)
+
+	next, err = NextRun("@at 2025-06-01T02:00:00Z", atTime.Add(time.Minute))
+	c.Assert(err, IsNil)
+	c.Assert(next.IsZero(), Equals, true)
+}
+
+func (s *SuiteAt) TestAddJob(c *C) {
+	job := &TestJob{}
+	job.Name = "once"
+	job.Schedule = "@at 2025-06-01T02:00:00Z"
+	c.Assert(ValidateJob(job), IsNil)
+
+	sc := NewScheduler(&TestLogger{})
+	sc.now = func() time.Time { return atTime.Add(-time.Second) }
+	c.Assert(sc.AddJob(job), IsNil)
+	c.Assert(sc.Entries(), DeepEquals, []Job{job})
+
+	sc = NewScheduler(&TestLogger{})
+	sc.now = func() time.Time { return atTime }
+	err := sc.AddJob(job)
+	c.Assert(errors.Is(err, ErrPastSchedule), Equals, true)
+	c.Assert(sc.Entries(), HasLen, 0)
+
+	sc.RunPastAt = true
+	c.Assert(sc.AddJob(job), IsNil)
+	c.Assert(sc.Entries(), DeepEquals, []Job{job})
+
+	job.Schedule = "@at 2025-06-01"
+	c.Assert(ValidateJob(job), ErrorMatches, `invalid schedule "@at 2025-06-01": invalid @at time.*`)
+}
+
+func (s *SuiteAt) TestRunPastAt(c *C) {
+	job := &TestJob{}
+	job.Name = "once"
+	job.Schedule = "@at 2025-06-01T02:00:00Z"
+
+	sc := NewScheduler(&TestLogger{})
+	sc.RunPastAt = true
+	c.Assert(sc.AddJob(job), IsNil)
+
+	sc.Start()
+	time.Sleep(time.Millisecond * 1500)
+	sc.Stop()
+
+	c.Assert(job.Called, Equals, 1)
+	c.Assert(sc.Entries(), HasLen, 1)
+}
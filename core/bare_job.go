@@ -2,14 +2,56 @@ package core
 
 import (
 	"reflect"
+	"strings"
 	"sync"
 	"sync/atomic"
 )
 
 type BareJob struct {
 	Schedule string `hash:"true"`
-	Name     string `hash:"true"`
-	Command  string `hash:"true"`
+	// Cron is an alias of Schedule, both can only be set to the same value
+	Cron          string `hash:"true"`
+	Name          string `hash:"true"`
+	Command       string `hash:"true"`
+	OverlapPolicy string `gcfg:"overlap-policy" mapstructure:"overlap-policy" hash:"true"`
+	QueueDepth    int    `gcfg:"queue-depth" mapstructure:"queue-depth" hash:"true"`
+	MaxConcurrent int    `gcfg:"max-concurrent" mapstructure:"max-concurrent" hash:"true"`
+	// MaxRuns is the number of scheduled executions after which the job is
+	// removed from the scheduler, unlimited if zero
+	MaxRuns int    `gcfg:"max-runs" mapstructure:"max-runs" hash:"true"`
+	Jitter  string `hash:"true"`
+	// Retries is the number of times a failed execution is retried, waiting
+	// RetryBackoff, then twice as long on every attempt up to RetryMaxBackoff
+	Retries         int    `hash:"true"`
+	RetryBackoff    string `gcfg:"retry-backoff" mapstructure:"retry-backoff" hash:"true"`
+	RetryMaxBackoff string `gcfg:"retry-max-backoff" mapstructure:"retry-max-backoff" hash:"true"`
+	// MaxOutput is the size of the output kept of each stream, e.g. `1m`,
+	// OutputKeep tells if its head or its tail is kept
+	MaxOutput  string `gcfg:"max-output" mapstructure:"max-output" hash:"true"`
+	OutputKeep string `gcfg:"output-keep" mapstructure:"output-keep" hash:"true"`
+	// OutputEncoding is how the streams are rendered in the notifications
+	// and the saved reports: text, base64 or drop
+	OutputEncoding string `gcfg:"output-encoding" mapstructure:"output-encoding" hash:"true"`
+	// RequireFreeMemory and RequireFreeDisk are the sizes, e.g. `1g`, of
+	// memory and disk space the host must have free, the execution being
+	// skipped otherwise
+	RequireFreeMemory string `gcfg:"require-free-memory" mapstructure:"require-free-memory" hash:"true"`
+	RequireFreeDisk   string `gcfg:"require-free-disk" mapstructure:"require-free-disk" hash:"true"`
+	// CommandTemplate renders Command as a Go template at every execution,
+	// see command
+	CommandTemplate bool `gcfg:"command-template" mapstructure:"command-template" default:"false" hash:"true"`
+	// OnFailure is the name of a job run when an execution of this one fails
+	OnFailure string `gcfg:"on-failure" mapstructure:"on-failure" hash:"true"`
+	// NotifyEmpty sends the notifications of the successful executions
+	// without output, it's a string since a boolean defaulting to true
+	// couldn't be set to false
+	NotifyEmpty string `gcfg:"notify-empty" mapstructure:"notify-empty" default:"true" hash:"true"`
+	// IgnoreMaintenance runs the job during the maintenance windows of the
+	// scheduler, for the critical ones
+	IgnoreMaintenance bool `gcfg:"ignore-maintenance" mapstructure:"ignore-maintenance" default:"false" hash:"true"`
+	// DisableMiddlewares are the names of the middlewares skipped by the
+	// job, e.g. `save`, the global ones included
+	DisableMiddlewares []string `gcfg:"disable-middlewares" mapstructure:"disable-middlewares" hash:"true"`
 
 	middlewareContainer
 	running int32
@@ -22,14 +64,68 @@ func (j *BareJob) GetName() string {
 	return j.Name
 }
 
+// GetSchedule returns the schedule of the job, set with schedule or cron
 func (j *BareJob) GetSchedule() string {
+	if j.Schedule == "" {
+		return j.Cron
+	}
+
 	return j.Schedule
 }
 
+func (j *BareJob) GetCron() string {
+	return j.Cron
+}
+
 func (j *BareJob) GetCommand() string {
 	return j.Command
 }
 
+// GetSchedulingOptions returns the options of the job applied by the
+// scheduler and the middlewares
+func (j *BareJob) GetSchedulingOptions() SchedulingOptions {
+	return SchedulingOptions{
+		OverlapPolicy:      j.OverlapPolicy,
+		QueueDepth:         j.QueueDepth,
+		MaxConcurrent:      j.MaxConcurrent,
+		MaxRuns:            j.MaxRuns,
+		Jitter:             j.Jitter,
+		Retries:            j.Retries,
+		RetryBackoff:       j.RetryBackoff,
+		RetryMaxBackoff:    j.RetryMaxBackoff,
+		MaxOutput:          j.MaxOutput,
+		OutputKeep:         j.OutputKeep,
+		OutputEncoding:     j.OutputEncoding,
+		RequireFreeMemory:  j.RequireFreeMemory,
+		RequireFreeDisk:    j.RequireFreeDisk,
+		CommandTemplate:    j.CommandTemplate,
+		OnFailure:          j.OnFailure,
+		NotifyEmpty:        j.NotifyEmpty,
+		IgnoreMaintenance:  j.IgnoreMaintenance,
+		DisableMiddlewares: j.DisableMiddlewares,
+	}
+}
+
+// Use adds the middlewares to the job, except the ones disabled with
+// DisableMiddlewares
+func (j *BareJob) Use(ms ...Middleware) {
+	for _, m := range ms {
+		if m != nil && !j.middlewareDisabled(MiddlewareName(m)) {
+			j.middlewareContainer.Use(m)
+		}
+	}
+}
+
+func (j *BareJob) middlewareDisabled(name string) bool {
+	for _, disabled := range j.DisableMiddlewares {
+		if strings.EqualFold(strings.TrimSpace(disabled), name) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (j *BareJob) Running() int32 {
 	return atomic.LoadInt32(&j.running)
 }
@@ -18,6 +18,26 @@ func (s *SuiteBareJob) TestGetters(c *C) {
 	c.Assert(job.GetCommand(), Equals, "qux")
 }
 
+func (s *SuiteBareJob) TestGetSchedulingOptions(c *C) {
+	job := &BareJob{
+		OverlapPolicy:      OverlapPolicyQueue,
+		QueueDepth:         2,
+		Retries:            3,
+		OnFailure:          "notify",
+		IgnoreMaintenance:  true,
+		DisableMiddlewares: []string{"save"},
+	}
+
+	c.Assert(job.GetSchedulingOptions(), DeepEquals, SchedulingOptions{
+		OverlapPolicy:      OverlapPolicyQueue,
+		QueueDepth:         2,
+		Retries:            3,
+		OnFailure:          "notify",
+		IgnoreMaintenance:  true,
+		DisableMiddlewares: []string{"save"},
+	})
+}
+
 func (s *SuiteBareJob) TestNotifyStartStop(c *C) {
 	job := &BareJob{}
 
@@ -27,3 +47,12 @@ func (s *SuiteBareJob) TestNotifyStartStop(c *C) {
 	job.NotifyStop()
 	c.Assert(job.Running(), Equals, int32(0))
 }
+
+func (s *SuiteBareJob) TestUseDisableMiddlewares(c *C) {
+	job := &BareJob{DisableMiddlewares: []string{" TestMiddleware"}}
+	c.Assert(MiddlewareName(&TestMiddleware{}), Equals, "testmiddleware")
+
+	alt := &TestMiddlewareAltA{}
+	job.Use(&TestMiddleware{}, alt, nil)
+	c.Assert(job.Middlewares(), DeepEquals, []Middleware{alt})
+}
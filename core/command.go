@@ -0,0 +1,113 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gobs/args"
+)
+
+var ErrUnsafeCommand = errors.New("the rendered command contains a control character")
+
+// commandData is the data of the command templates
+type commandData struct {
+	// Now is the time the command is rendered, right before it runs
+	Now         time.Time
+	JobName     string
+	ExecutionID string
+	// Env are the environment variables of Ofelia
+	Env map[string]string
+}
+
+func parseCommandTemplate(command string) (*template.Template, error) {
+	t, err := template.New("command").Option("missingkey=error").Parse(command)
+	if err != nil {
+		return nil, fmt.Errorf("invalid command template: %w", err)
+	}
+
+	return t, nil
+}
+
+// command returns the command of the job for the execution. With
+// command-template, the command is rendered as a Go template with the time,
+// the job name, the execution ID and the environment, e.g.
+// `backup --date {{.Now.Format "2006-01-02"}}`. The values are inserted as
+// is, before the command is split into arguments, so a rendered command with
+// a line break or another control character is rejected.
+func (j *BareJob) command(ctx *Context) (string, error) {
+	if !j.CommandTemplate {
+		return j.Command, nil
+	}
+
+	t, err := parseCommandTemplate(j.Command)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now
+	if ctx.Scheduler != nil && ctx.Scheduler.now != nil {
+		now = ctx.Scheduler.now
+	}
+
+	data := commandData{
+		Now:     now(),
+		JobName: j.Name,
+		Env:     make(map[string]string),
+	}
+
+	if ctx.Execution != nil {
+		data.ExecutionID = ctx.Execution.ID
+	}
+
+	for _, e := range os.Environ() {
+		if key, value, ok := strings.Cut(e, "="); ok {
+			data.Env[key] = value
+		}
+	}
+
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("error rendering the command template: %w", err)
+	}
+
+	rendered := b.String()
+	if strings.IndexFunc(rendered, isControl) >= 0 {
+		return "", ErrUnsafeCommand
+	}
+
+	return rendered, nil
+}
+
+func isControl(r rune) bool {
+	return (r < ' ' && r != '\t') || r == 0x7f
+}
+
+// defaultShellPath is the shell of the jobs without shell-path
+const defaultShellPath = "/bin/sh"
+
+// ShellCommand runs the command of a job with a shell, as
+// `/bin/sh -c "<command>"`, instead of splitting it into arguments, so it can
+// use pipes, redirections or variables
+type ShellCommand struct {
+	Shell     bool   `default:"false" hash:"true"`
+	ShellPath string `gcfg:"shell-path" mapstructure:"shell-path" default:"/bin/sh" hash:"true"`
+}
+
+// commandArgs returns the arguments running the command, an empty command
+// keeps the default one of the image
+func (s *ShellCommand) commandArgs(command string) []string {
+	if !s.Shell || command == "" {
+		return args.GetArgs(command)
+	}
+
+	shell := s.ShellPath
+	if shell == "" {
+		shell = defaultShellPath
+	}
+
+	return []string{shell, "-c", command}
+}
@@ -0,0 +1,89 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteCommand struct{}
+
+var _ = Suite(&SuiteCommand{})
+
+// render renders the command of a job with the given template setting
+func (s *SuiteCommand) render(command string, template bool) (string, error) {
+	job := &TestJob{}
+	job.Name = "backup"
+	job.Command = command
+	job.CommandTemplate = template
+
+	sc := NewScheduler(&TestLogger{})
+	sc.now = func() time.Time { return time.Date(2025, 6, 1, 2, 0, 0, 0, time.UTC) }
+
+	e := NewExecution()
+	e.ID = "abc123"
+	return job.command(NewContext(sc, job, e))
+}
+
+func (s *SuiteCommand) TestCommand(c *C) {
+	os.Setenv("OFELIA_TEST_BUCKET", "s3://backups")
+	defer os.Unsetenv("OFELIA_TEST_BUCKET")
+
+	cmd, err := s.render(`backup --date {{.Now.Format "2006-01-02"}} --id {{.JobName}}-{{.ExecutionID}} {{.Env.OFELIA_TEST_BUCKET}}`, true)
+	c.Assert(err, IsNil)
+	c.Assert(cmd, Equals, "backup --date 2025-06-01 --id backup-abc123 s3://backups")
+}
+
+func (s *SuiteCommand) TestCommandWithoutTemplate(c *C) {
+	cmd, err := s.render(`docker ps --format '{{.Names}}'`, false)
+	c.Assert(err, IsNil)
+	c.Assert(cmd, Equals, `docker ps --format '{{.Names}}'`)
+}
+
+func (s *SuiteCommand) TestCommandMissing(c *C) {
+	_, err := s.render(`echo {{.Env.OFELIA_TEST_MISSING}}`, true)
+	c.Assert(err, ErrorMatches, `error rendering the command template: .*map has no entry for key "OFELIA_TEST_MISSING"`)
+
+	_, err = s.render(`echo {{.Names}}`, true)
+	c.Assert(err, ErrorMatches, `error rendering the command template: .*can't evaluate field Names.*`)
+
+	_, err = s.render(`echo {{.JobName`, true)
+	c.Assert(err, ErrorMatches, `invalid command template: .*`)
+}
+
+func (s *SuiteCommand) TestCommandUnsafe(c *C) {
+	os.Setenv("OFELIA_TEST_NAME", "x\nrm -rf /")
+	defer os.Unsetenv("OFELIA_TEST_NAME")
+
+	_, err := s.render(`echo {{.Env.OFELIA_TEST_NAME}}`, true)
+	c.Assert(errors.Is(err, ErrUnsafeCommand), Equals, true)
+}
+
+func (s *SuiteCommand) TestValidate(c *C) {
+	job := &TestJob{}
+	job.Schedule = "@daily"
+	job.Command = `echo {{.JobName`
+	c.Assert(ValidateJob(job), IsNil)
+
+	job.CommandTemplate = true
+	c.Assert(ValidateJob(job), ErrorMatches, "invalid command template: .*")
+}
+
+func (s *SuiteCommand) TestLocalJob(c *C) {
+	job := &LocalJob{}
+	job.Name = "echo"
+	job.Schedule = "@daily"
+	job.Command = `echo {{.JobName}} {{.Now.Format "20060102"}}`
+	job.CommandTemplate = true
+
+	sc := NewScheduler(&TestLogger{})
+	sc.now = func() time.Time { return time.Date(2025, 6, 1, 2, 0, 0, 0, time.UTC) }
+	c.Assert(sc.AddJob(job), IsNil)
+
+	e, err := sc.RunJob("echo")
+	c.Assert(err, IsNil)
+	c.Assert(e.Failed, Equals, false)
+	c.Assert(e.OutputStream.String(), Equals, "echo 20250601\n")
+}
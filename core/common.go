@@ -1,15 +1,16 @@
 package core
 
 import (
+	"context"
 	"crypto/rand"
 	"errors"
 	"fmt"
+	"os/exec"
 	"reflect"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/armon/circbuf"
 	docker "github.com/fsouza/go-dockerclient"
 )
 
@@ -20,9 +21,48 @@ var (
 	ErrUnexpected         = errors.New("error unexpected, docker has returned exit code -1, maybe wrong user?")
 	ErrMaxTimeRunning     = errors.New("the job has exceed the maximum allowed time running.")
 	ErrLocalImageNotFound = errors.New("couldn't find image on the host")
+	ErrRelativeWorkingDir = errors.New("working-dir must be an absolute path")
+	ErrUnhealthy          = errors.New("the container didn't become healthy")
+	ErrMissingImage       = errors.New("image is required")
+	// ErrExecCancelPrevious is returned by the exec jobs with the
+	// cancel-previous overlap policy, Docker can't stop an exec process so
+	// the cancelled execution would keep running in the container
+	ErrExecCancelPrevious = errors.New("overlap-policy cancel-previous isn't supported by the exec jobs")
 )
 
+// NonZeroExitError is returned when the command of a job exits with a
+// non-zero code
+type NonZeroExitError struct {
+	ExitCode int
+}
+
+func (e *NonZeroExitError) Error() string {
+	return fmt.Sprintf("error non-zero exit code: %d", e.ExitCode)
+}
+
+// ExitCode returns the exit code of an execution ending with err, 0 if err is
+// nil or ErrSkippedExecution and -1 if the code is unknown
+func ExitCode(err error) int {
+	if err == nil || err == ErrSkippedExecution {
+		return 0
+	}
+
+	var nz *NonZeroExitError
+	if errors.As(err, &nz) {
+		return nz.ExitCode
+	}
+
+	var ee *exec.ExitError
+	if errors.As(err, &ee) {
+		return ee.ExitCode()
+	}
+
+	return -1
+}
+
 const (
+	// DockerHubRegistry is the registry name used for images without registry
+	DockerHubRegistry = "docker.io"
 	// maximum size of a stdout/stderr stream to be kept in memory and optional stored/sent via mail
 	maxStreamSize = 10 * 1024 * 1024
 	logPrefix     = "[Job %q (%s)] %s"
@@ -31,7 +71,9 @@ const (
 type Job interface {
 	GetName() string
 	GetSchedule() string
+	GetCron() string
 	GetCommand() string
+	GetSchedulingOptions() SchedulingOptions
 	Middlewares() []Middleware
 	Use(...Middleware)
 	Run(*Context) error
@@ -42,6 +84,29 @@ type Job interface {
 	SetCronJobID(int)
 }
 
+// SchedulingOptions are the options of a job applied by the scheduler and
+// the middlewares, as set in BareJob
+type SchedulingOptions struct {
+	OverlapPolicy      string
+	QueueDepth         int
+	MaxConcurrent      int
+	MaxRuns            int
+	Jitter             string
+	Retries            int
+	RetryBackoff       string
+	RetryMaxBackoff    string
+	MaxOutput          string
+	OutputKeep         string
+	OutputEncoding     string
+	RequireFreeMemory  string
+	RequireFreeDisk    string
+	CommandTemplate    bool
+	OnFailure          string
+	NotifyEmpty        string
+	IgnoreMaintenance  bool
+	DisableMiddlewares []string
+}
+
 type Context struct {
 	Scheduler *Scheduler
 	Logger    Logger
@@ -51,15 +116,37 @@ type Context struct {
 	current     int
 	executed    bool
 	middlewares []Middleware
+	ctx         context.Context
+	cancel      context.CancelFunc
 }
 
 func NewContext(s *Scheduler, j Job, e *Execution) *Context {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Context{
 		Scheduler:   s,
 		Logger:      s.Logger,
 		Job:         j,
 		Execution:   e,
 		middlewares: j.Middlewares(),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+// Ctx returns the context.Context bound to this execution, it is done when
+// the execution has been cancelled and the job should stop as soon as possible.
+func (c *Context) Ctx() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+
+	return c.ctx
+}
+
+// Cancel requests the job to abort the current execution.
+func (c *Context) Cancel() {
+	if c.cancel != nil {
+		c.cancel()
 	}
 }
 
@@ -95,7 +182,38 @@ func (c *Context) doNext() error {
 	}
 
 	c.executed = true
-	return c.Job.Run(c)
+	return c.runJob()
+}
+
+// runJob runs the job, retrying it with an exponential backoff while it fails
+// and the execution isn't cancelled
+func (c *Context) runJob() error {
+	err := c.Job.Run(c)
+
+	retries := c.Job.GetSchedulingOptions().Retries
+	if retries <= 0 {
+		return err
+	}
+
+	base, max, _ := parseRetryBackoff(c.Job)
+	for attempt := 1; attempt <= retries && c.shouldRetry(err); attempt++ {
+		wait := retryBackoff(base, max, attempt)
+		c.Warn(fmt.Sprintf("Failed, retry %d/%d in %s: %s", attempt, retries, wait, err))
+
+		select {
+		case <-c.Ctx().Done():
+			return err
+		case <-retryAfter(wait):
+		}
+
+		err = c.Job.Run(c)
+	}
+
+	return err
+}
+
+func (c *Context) shouldRetry(err error) bool {
+	return err != nil && err != ErrSkippedExecution && c.Ctx().Err() == nil
 }
 
 func (c *Context) getNext() (Middleware, bool) {
@@ -143,21 +261,40 @@ type Execution struct {
 	Failed    bool
 	Skipped   bool
 	Error     error
-
-	OutputStream, ErrorStream *circbuf.Buffer `json:"-"`
+	// Truncated is set when the output or the error stream exceeded the
+	// max-output of the job, only part of it being kept
+	Truncated bool
+	// QueueWait is the time the execution waited for its overlap policy and
+	// max-concurrent before starting
+	QueueWait time.Duration
+	// OutputEncoding is how the streams are rendered, see Render, the raw
+	// bytes being kept in the streams
+	OutputEncoding string
+
+	OutputStream, ErrorStream OutputBuffer `json:"-"`
 }
 
 // NewExecution returns a new Execution, with a random ID
 func NewExecution() *Execution {
-	bufOut, _ := circbuf.NewBuffer(maxStreamSize)
-	bufErr, _ := circbuf.NewBuffer(maxStreamSize)
+	return newExecution(maxStreamSize, OutputKeepTail)
+}
+
+// newExecution returns a new Execution keeping at most size bytes of each
+// stream, their head or their tail
+func newExecution(size int64, keep string) *Execution {
 	return &Execution{
 		ID:           randomID(),
-		OutputStream: bufOut,
-		ErrorStream:  bufErr,
+		OutputStream: newOutputBuffer(size, keep),
+		ErrorStream:  newOutputBuffer(size, keep),
 	}
 }
 
+// Render renders a stream of the execution for the notifications and the
+// saved reports, as set by its output encoding
+func (e *Execution) Render(b OutputBuffer) string {
+	return RenderOutput(b.Bytes(), e.OutputEncoding)
+}
+
 // Start start the exection, initialize the running flags and the start date.
 func (e *Execution) Start() {
 	e.IsRunning = true
@@ -170,6 +307,7 @@ func (e *Execution) Start() {
 func (e *Execution) Stop(err error) {
 	e.IsRunning = false
 	e.Duration = time.Since(e.Date)
+	e.Truncated = truncated(e.OutputStream) || truncated(e.ErrorStream)
 
 	if err != nil && err != ErrSkippedExecution {
 		e.Error = err
@@ -191,6 +329,17 @@ type Middleware interface {
 	ContinueOnStop() bool
 }
 
+// MiddlewareName returns the name of a middleware, its type in lower case,
+// e.g. `save` for a *middlewares.Save
+func MiddlewareName(m Middleware) string {
+	t := reflect.TypeOf(m)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return strings.ToLower(t.Name())
+}
+
 type middlewareContainer struct {
 	m     map[string]Middleware
 	order []string
@@ -242,6 +391,176 @@ func randomID() string {
 	return fmt.Sprintf("%x", b)
 }
 
+// Image pull policies, used by the `pull` option of the jobs creating
+// containers.
+const (
+	// PullAlways pulls the image before every execution
+	PullAlways = "always"
+	// PullMissing pulls the image only if it isn't available on the host
+	PullMissing = "missing"
+	// PullNever never pulls the image, it must be available on the host
+	PullNever = "never"
+)
+
+// parsePullPolicy normalizes the `pull` option. The former boolean values are
+// still accepted: `true` means always and `false` missing.
+func parsePullPolicy(value string) (string, error) {
+	switch strings.ToLower(value) {
+	case "", PullMissing, "false":
+		return PullMissing, nil
+	case PullAlways, "true":
+		return PullAlways, nil
+	case PullNever:
+		return PullNever, nil
+	default:
+		return "", fmt.Errorf("unknown pull policy %q", value)
+	}
+}
+
+// imageRequest describes the image needed by a job and how to get it
+type imageRequest struct {
+	Image string
+	// Pull is the pull policy: always, missing or never
+	Pull string
+	// Platform is the `os/arch[/variant]` to pull, the daemon one if empty
+	Platform string
+	Auth     RegistryAuth
+	// Docker are the options of the calls to the client
+	Docker *DockerOptions
+}
+
+// ensureImage makes sure the image is available on the host, pulling it
+// according to the given pull policy.
+func ensureImage(ctx *Context, client *docker.Client, r imageRequest) error {
+	image := r.Image
+	policy, err := parsePullPolicy(r.Pull)
+	if err != nil {
+		return err
+	}
+
+	switch policy {
+	case PullAlways:
+		pullErr := pullImage(ctx, client, r)
+		if pullErr == nil {
+			ctx.Log("Pulled image " + image)
+			return nil
+		}
+
+		// the registry may be unreachable, keep going with the local copy
+		if searchLocalImage(client, r.Docker, image) == nil {
+			ctx.Warn(pullErr.Error() + ", using local image")
+			return nil
+		}
+
+		return pullErr
+	case PullNever:
+		if err := searchLocalImage(client, r.Docker, image); err != nil {
+			if err == ErrLocalImageNotFound {
+				return fmt.Errorf("%w: %q, pull policy is %q", err, image, PullNever)
+			}
+
+			return err
+		}
+	default:
+		err := searchLocalImage(client, r.Docker, image)
+		if err == ErrLocalImageNotFound {
+			if err := pullImage(ctx, client, r); err != nil {
+				return err
+			}
+
+			ctx.Log("Pulled image " + image)
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	ctx.Log("Found locally image " + image)
+	return nil
+}
+
+func searchLocalImage(client *docker.Client, o *DockerOptions, image string) error {
+	var imgs []docker.APIImages
+	err := o.Retry(func() (err error) {
+		imgs, err = client.ListImages(buildFindLocalImageOptions(image))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(imgs) != 1 {
+		return ErrLocalImageNotFound
+	}
+
+	return nil
+}
+
+func pullImage(ctx *Context, client *docker.Client, r imageRequest) error {
+	o, a := buildPullOptions(r.Image)
+	o.Platform = r.Platform
+	if r.Auth.RegistryUser != "" {
+		a = docker.AuthConfiguration{
+			Username:      r.Auth.RegistryUser,
+			Password:      r.Auth.RegistryPassword,
+			ServerAddress: o.Registry,
+		}
+	} else if ctx.Scheduler != nil {
+		if v, ok := ctx.Scheduler.RegistryAuths[registryKey(o.Registry)]; ok {
+			a = v
+		}
+	}
+
+	err := r.Docker.Retry(func() error {
+		return withDockerTimeout(ctx.Ctx(), r.Docker.pullTimeout(), "pulling image "+r.Image, func(c context.Context) error {
+			o.Context = c
+			return client.PullImage(o, a)
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("error pulling image %q: %w", r.Image, err)
+	}
+
+	return nil
+}
+
+// RegistryAuth holds the credentials used to pull the image of a job, they
+// take precedence over the ones configured globally. They are hashed so the
+// job is replaced when they are rotated.
+type RegistryAuth struct {
+	RegistryUser     string `gcfg:"registry-user" mapstructure:"registry-user" hash:"true"`
+	RegistryPassword string `gcfg:"registry-password" mapstructure:"registry-password" json:"-" hash:"true"`
+}
+
+// ImageRegistry returns the registry of the image, empty for Docker Hub
+func ImageRegistry(image string) string {
+	repository, _ := docker.ParseRepositoryTag(image)
+	return parseRegistry(repository)
+}
+
+// HasDockerConfigAuth reports whether the Docker config file of the host
+// contains credentials for the registry
+func HasDockerConfigAuth(registry string) bool {
+	if dockercfg == nil {
+		return false
+	}
+
+	_, ok := dockercfg.Configs[registry]
+	return ok
+}
+
+// registryKey returns the key of Scheduler.RegistryAuths for the registry,
+// Docker Hub is keyed as `docker.io`
+func registryKey(registry string) string {
+	if registry == "" {
+		return DockerHubRegistry
+	}
+
+	return registry
+}
+
 func buildFindLocalImageOptions(image string) docker.ListImagesOptions {
 	return docker.ListImagesOptions{
 		Filters: map[string][]string{
@@ -324,6 +643,8 @@ func getHash(t reflect.Type, v reflect.Value, hash *string) {
 				*hash += strconv.FormatInt(fieldv.Int(), 10)
 			} else if kind == reflect.Bool {
 				*hash += strconv.FormatBool(fieldv.Bool())
+			} else if kind == reflect.Slice && field.Type.Elem().Kind() == reflect.String {
+				*hash += strings.Join(fieldv.Interface().([]string), ",")
 			} else {
 				panic("Unsupported field type")
 			}
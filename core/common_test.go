@@ -3,6 +3,7 @@ package core
 import (
 	"errors"
 	"fmt"
+	"os/exec"
 	"testing"
 	"time"
 
@@ -184,6 +185,17 @@ func (s *SuiteCommon) TestContextNext(c *C) {
 	c.Assert(j.Called, Equals, 1)
 }
 
+func (s *SuiteCommon) TestExitCode(c *C) {
+	c.Assert(ExitCode(nil), Equals, 0)
+	c.Assert(ExitCode(ErrSkippedExecution), Equals, 0)
+	c.Assert(ExitCode(&NonZeroExitError{ExitCode: 42}), Equals, 42)
+	c.Assert(ExitCode(fmt.Errorf("wrapped: %w", &NonZeroExitError{ExitCode: 3})), Equals, 3)
+	c.Assert(ExitCode(errors.New("foo")), Equals, -1)
+
+	err := exec.Command("sh", "-c", "exit 7").Run()
+	c.Assert(ExitCode(err), Equals, 7)
+}
+
 func (s *SuiteCommon) TestExecutionStart(c *C) {
 	exe := &Execution{}
 	exe.Start()
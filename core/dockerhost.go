@@ -0,0 +1,265 @@
+package core
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// sshEndpoint is the endpoint given to the Docker client of an SSH host, the
+// requests never reach it since the connections are made through ssh
+const sshEndpoint = "http://docker.ssh"
+
+var (
+	ErrInvalidDockerHost = errors.New("invalid docker-host, expected unix://, tcp://, http(s):// or ssh://[user@]host[:port]")
+
+	// sshCommand is the ssh client used to reach the SSH hosts
+	sshCommand = "ssh"
+)
+
+// SSHHost is a Docker daemon reached over SSH, the connections run
+// `docker system dial-stdio` on the remote host, as the Docker CLI does
+type SSHHost struct {
+	User string
+	Host string
+	Port string
+	// Socket is the path of the socket of the remote daemon, the default one
+	// if empty
+	Socket string
+}
+
+// ParseSSHHost parses a `ssh://[user@]host[:port][/socket]` connection
+// string
+func ParseSSHHost(host string) (*SSHHost, error) {
+	u, err := url.Parse(host)
+	if err != nil || u.Scheme != "ssh" || u.Hostname() == "" || u.RawQuery != "" || u.Fragment != "" {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidDockerHost, host)
+	}
+
+	if _, hasPassword := u.User.Password(); hasPassword {
+		return nil, fmt.Errorf("%w: %q, passwords aren't supported, use a key", ErrInvalidDockerHost, u.Redacted())
+	}
+
+	h := &SSHHost{User: u.User.Username(), Host: u.Hostname(), Port: u.Port()}
+	if u.Path != "" && u.Path != "/" {
+		h.Socket = u.Path
+	}
+
+	return h, nil
+}
+
+// args returns the arguments of the ssh command opening a connection
+func (h *SSHHost) args() []string {
+	var args []string
+	if h.User != "" {
+		args = append(args, "-l", h.User)
+	}
+
+	if h.Port != "" {
+		args = append(args, "-p", h.Port)
+	}
+
+	args = append(args, "--", h.Host, "docker")
+	if h.Socket != "" {
+		args = append(args, "--host", "unix://"+h.Socket)
+	}
+
+	return append(args, "system", "dial-stdio")
+}
+
+// Dial opens a connection to the remote daemon, the network and address are
+// ignored
+func (h *SSHHost) Dial(network, address string) (net.Conn, error) {
+	return h.DialContext(context.Background(), network, address)
+}
+
+// DialContext opens a connection to the remote daemon, the network and
+// address are ignored
+func (h *SSHHost) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	cmd := exec.Command(sshCommand, h.args()...)
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("error connecting to %s over ssh: %w", h.Host, err)
+	}
+
+	return &commandConn{cmd: cmd, stdin: stdin, stdout: stdout, host: h.Host}, nil
+}
+
+// ValidateDockerHost checks a docker-host connection string, empty being
+// the default daemon
+func ValidateDockerHost(host string) error {
+	if host == "" {
+		return nil
+	}
+
+	_, err := NewDockerClient(host)
+	return err
+}
+
+// NewDockerClient returns a client of the Docker daemon at host, an SSH
+// host being reached with the ssh command. No connection is made.
+func NewDockerClient(host string) (*docker.Client, error) {
+	if !strings.HasPrefix(host, "ssh://") {
+		c, err := docker.NewClient(host)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidDockerHost, host)
+		}
+
+		return c, nil
+	}
+
+	h, err := ParseSSHHost(host)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := docker.NewClient(sshEndpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	// every connection is an ssh process, they are reused as much as possible
+	c.HTTPClient = &http.Client{Transport: &http.Transport{
+		DialContext:     h.DialContext,
+		MaxIdleConns:    2,
+		IdleConnTimeout: 30 * time.Second,
+	}}
+	c.Dialer = h
+
+	return c, nil
+}
+
+// DockerTLS are the files securing the connection to a Docker daemon with
+// TLS, the client certificate and key are optional
+type DockerTLS struct {
+	Cert string
+	Key  string
+	CA   string
+	// Verify checks the certificate of the daemon, against CA if set or the
+	// system roots otherwise
+	Verify bool
+}
+
+// Config returns the TLS configuration of the files
+func (t *DockerTLS) Config() (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: !t.Verify}
+	if t.Cert != "" || t.Key != "" {
+		cert, err := tls.LoadX509KeyPair(t.Cert, t.Key)
+		if err != nil {
+			return nil, fmt.Errorf("error loading the Docker client certificate: %w", err)
+		}
+
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if t.CA != "" {
+		ca, err := os.ReadFile(t.CA)
+		if err != nil {
+			return nil, fmt.Errorf("error loading the Docker CA: %w", err)
+		}
+
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("error loading the Docker CA: no certificate found in %q", t.CA)
+		}
+	}
+
+	return cfg, nil
+}
+
+// NewDockerTLSClient returns a client of the Docker daemon at host, a
+// tcp:// or https:// one, secured by TLS. No connection is made.
+func NewDockerTLSClient(host string, t *DockerTLS) (*docker.Client, error) {
+	if host == "" || strings.HasPrefix(host, "ssh://") || strings.HasPrefix(host, "unix://") {
+		return nil, fmt.Errorf("%w: %q, TLS requires a tcp:// host", ErrInvalidDockerHost, host)
+	}
+
+	cfg, err := t.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := docker.NewVersionedTLSClientFromBytes(host, nil, nil, nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidDockerHost, host)
+	}
+
+	// used by the requests and the hijacked connections
+	c.HTTPClient.Transport.(*http.Transport).TLSClientConfig = cfg
+	c.TLSConfig = cfg
+	return c, nil
+}
+
+// commandConn is a connection over the standard input and output of a
+// command, closing it stops the command
+type commandConn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+	host   string
+	once   sync.Once
+}
+
+func (c *commandConn) Read(p []byte) (int, error) {
+	return c.stdout.Read(p)
+}
+
+func (c *commandConn) Write(p []byte) (int, error) {
+	return c.stdin.Write(p)
+}
+
+func (c *commandConn) Close() error {
+	c.once.Do(func() {
+		c.stdin.Close()
+		c.stdout.Close()
+		if c.cmd.Process != nil {
+			c.cmd.Process.Kill()
+		}
+
+		c.cmd.Wait()
+	})
+
+	return nil
+}
+
+func (c *commandConn) LocalAddr() net.Addr {
+	return sshAddr("local")
+}
+
+func (c *commandConn) RemoteAddr() net.Addr {
+	return sshAddr(c.host)
+}
+
+// the deadlines aren't supported by the pipes of the command
+func (c *commandConn) SetDeadline(t time.Time) error      { return nil }
+func (c *commandConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *commandConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type sshAddr string
+
+func (a sshAddr) Network() string { return "ssh" }
+func (a sshAddr) String() string  { return string(a) }
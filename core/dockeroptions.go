@@ -0,0 +1,57 @@
+package core
+
+import "time"
+
+// DockerOptions are the options of the Docker calls of the jobs sharing a
+// client, the defaults are used if nil
+type DockerOptions struct {
+	// RetryAttempts is the number of attempts of the idempotent calls
+	// failing with a transient error, DefaultDockerRetryAttempts if zero, 1
+	// disables the retries
+	RetryAttempts int
+	// Limiter spaces the calls creating or starting the containers, execs
+	// and services, nil if unlimited
+	Limiter *RateLimiter
+	// PullTimeout bounds each pull of an image and InspectTimeout each
+	// inspect of a container, made while waiting for it to exit among
+	// others, unlimited if zero. Unlike the runtime of a job, they stop a
+	// single call to a hung daemon.
+	PullTimeout    time.Duration
+	InspectTimeout time.Duration
+}
+
+// Retry calls fn with RetryDocker and the attempts of the options
+func (o *DockerOptions) Retry(fn func() error) error {
+	if o == nil {
+		return RetryDocker(0, fn)
+	}
+
+	return RetryDocker(o.RetryAttempts, fn)
+}
+
+// waitOp waits for the turn of a Docker operation of the execution
+func (o *DockerOptions) waitOp(ctx *Context) error {
+	if o == nil {
+		return nil
+	}
+
+	return o.Limiter.Wait(ctx.Ctx())
+}
+
+// pullTimeout is the PullTimeout of the options, unlimited if nil
+func (o *DockerOptions) pullTimeout() time.Duration {
+	if o == nil {
+		return 0
+	}
+
+	return o.PullTimeout
+}
+
+// inspectTimeout is the InspectTimeout of the options, unlimited if nil
+func (o *DockerOptions) inspectTimeout() time.Duration {
+	if o == nil {
+		return 0
+	}
+
+	return o.InspectTimeout
+}
@@ -0,0 +1,102 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+const (
+	// DefaultDockerRetryAttempts is the number of attempts of an idempotent
+	// Docker call without docker-retry-attempts
+	DefaultDockerRetryAttempts = 3
+
+	dockerRetryBackoff    = 200 * time.Millisecond
+	dockerRetryMaxBackoff = 2 * time.Second
+
+	dockerWaitBackoff    = 500 * time.Millisecond
+	dockerWaitMaxBackoff = 5 * time.Second
+)
+
+var ErrDockerNotReady = errors.New("the Docker daemon isn't ready")
+
+// IsTransientDockerError reports whether a failed Docker call may succeed if
+// made again: the daemon being unreachable for a moment, the connection
+// being reset or a 5xx answer other than 501
+func IsTransientDockerError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var dockerErr *docker.Error
+	if errors.As(err, &dockerErr) {
+		return dockerErr.Status >= http.StatusInternalServerError && dockerErr.Status != http.StatusNotImplemented
+	}
+
+	if errors.Is(err, docker.ErrConnectionRefused) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// RetryDocker calls fn until it succeeds, fails with an error that isn't
+// transient or attempts are made, DefaultDockerRetryAttempts if zero. It must
+// only wrap calls that don't change the state of the daemon, such as an
+// inspect or a list.
+func RetryDocker(attempts int, fn func() error) error {
+	if attempts <= 0 {
+		attempts = DefaultDockerRetryAttempts
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if attempt >= attempts || !IsTransientDockerError(err) {
+			return err
+		}
+
+		<-retryAfter(retryBackoff(dockerRetryBackoff, dockerRetryMaxBackoff, attempt))
+	}
+}
+
+// WaitForDocker pings the daemon until it answers, waiting between the
+// attempts with an exponential backoff for up to timeout in total. Every
+// error is retried, such as the socket not created yet by a booting daemon.
+func WaitForDocker(client *docker.Client, timeout time.Duration, logger Logger) error {
+	var waited time.Duration
+	for attempt := 1; ; attempt++ {
+		err := client.Ping()
+		if err == nil {
+			if attempt > 1 {
+				logger.Noticef("Docker daemon ready after %s", waited)
+			}
+
+			return nil
+		}
+
+		if waited >= timeout {
+			return fmt.Errorf("%w after %s: %w", ErrDockerNotReady, timeout, err)
+		}
+
+		wait := retryBackoff(dockerWaitBackoff, dockerWaitMaxBackoff, attempt)
+		if wait > timeout-waited {
+			wait = timeout - waited
+		}
+
+		logger.Warningf("Docker daemon not ready, retrying in %s: %s", wait, err)
+		<-retryAfter(wait)
+		waited += wait
+	}
+}
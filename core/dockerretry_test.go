@@ -0,0 +1,192 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/fsouza/go-dockerclient/testing"
+	. "gopkg.in/check.v1"
+)
+
+type SuiteDockerRetry struct {
+	server *testing.DockerServer
+	client *docker.Client
+	waits  []time.Duration
+}
+
+var _ = Suite(&SuiteDockerRetry{})
+
+func (s *SuiteDockerRetry) SetUpTest(c *C) {
+	var err error
+	s.server, err = testing.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, IsNil)
+
+	s.client, err = docker.NewClient(s.server.URL())
+	c.Assert(err, IsNil)
+
+	s.waits = nil
+	retryAfter = func(d time.Duration) <-chan time.Time {
+		s.waits = append(s.waits, d)
+		ch := make(chan time.Time, 1)
+		ch <- time.Now()
+		return ch
+	}
+}
+
+func (s *SuiteDockerRetry) TearDownTest(c *C) {
+	retryAfter = time.After
+	s.server.Stop()
+}
+
+// failFirst makes the requests matching path fail with status the given
+// number of times, before the default handler answers them
+func (s *SuiteDockerRetry) failFirst(path string, failures int32, status int) *int32 {
+	var calls int32
+	s.server.CustomHandler(path, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= failures {
+			http.Error(w, "daemon hiccup", status)
+			return
+		}
+
+		s.server.DefaultHandler().ServeHTTP(w, r)
+	}))
+
+	return &calls
+}
+
+func (s *SuiteDockerRetry) createContainer(c *C) *RunJob {
+	err := s.client.PullImage(docker.PullImageOptions{Repository: "busybox"}, docker.AuthConfiguration{})
+	c.Assert(err, IsNil)
+
+	job := &RunJob{Client: s.client}
+	job.Image = "busybox"
+	container, err := job.buildContainer(job.Command)
+	c.Assert(err, IsNil)
+	job.containerID = container.ID
+
+	return job
+}
+
+func (s *SuiteDockerRetry) TestIsTransientDockerError(c *C) {
+	reset := &url.Error{Op: "Get", URL: "http://docker", Err: &net.OpError{
+		Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET),
+	}}
+
+	transient := []error{
+		&docker.Error{Status: http.StatusInternalServerError},
+		&docker.Error{Status: http.StatusServiceUnavailable},
+		fmt.Errorf("inspect: %w", &docker.Error{Status: http.StatusBadGateway}),
+		docker.ErrConnectionRefused,
+		reset,
+		&net.OpError{Op: "dial", Net: "unix", Err: syscall.ECONNREFUSED},
+	}
+
+	for _, err := range transient {
+		c.Assert(IsTransientDockerError(err), Equals, true, Commentf("error %v", err))
+	}
+
+	permanent := []error{
+		nil,
+		&docker.Error{Status: http.StatusNotFound},
+		&docker.Error{Status: http.StatusConflict},
+		&docker.Error{Status: http.StatusNotImplemented},
+		&docker.NoSuchContainer{ID: "foo"},
+		errors.New("invalid reference format"),
+	}
+
+	for _, err := range permanent {
+		c.Assert(IsTransientDockerError(err), Equals, false, Commentf("error %v", err))
+	}
+}
+
+func (s *SuiteDockerRetry) TestInspectRetried(c *C) {
+	job := s.createContainer(c)
+	calls := s.failFirst("/containers/.*/json", 2, http.StatusInternalServerError)
+
+	container, err := job.getContainer()
+	c.Assert(err, IsNil)
+	c.Assert(container.ID, Equals, job.containerID)
+	c.Assert(atomic.LoadInt32(calls), Equals, int32(3))
+	c.Assert(s.waits, DeepEquals, []time.Duration{200 * time.Millisecond, 400 * time.Millisecond})
+}
+
+func (s *SuiteDockerRetry) TestRetriesExhausted(c *C) {
+	job := s.createContainer(c)
+	job.Docker = &DockerOptions{RetryAttempts: 2}
+	calls := s.failFirst("/containers/.*/json", 5, http.StatusServiceUnavailable)
+
+	_, err := job.getContainer()
+	c.Assert(err, ErrorMatches, `API error \(503\): daemon hiccup\n`)
+	c.Assert(atomic.LoadInt32(calls), Equals, int32(2))
+}
+
+func (s *SuiteDockerRetry) TestPermanentErrorNotRetried(c *C) {
+	job := s.createContainer(c)
+	calls := s.failFirst("/containers/.*/json", 1, http.StatusNotFound)
+
+	_, err := job.getContainer()
+	c.Assert(err, NotNil)
+	c.Assert(atomic.LoadInt32(calls), Equals, int32(1))
+	c.Assert(s.waits, HasLen, 0)
+}
+
+func (s *SuiteDockerRetry) TestPullRetried(c *C) {
+	calls := s.failFirst("/images/create", 1, http.StatusInternalServerError)
+
+	ctx := &Context{Execution: NewExecution(), Logger: &TestLogger{}}
+	c.Assert(pullImage(ctx, s.client, imageRequest{Image: "busybox"}), IsNil)
+	c.Assert(atomic.LoadInt32(calls), Equals, int32(2))
+}
+
+func (s *SuiteDockerRetry) TestStartNotRetried(c *C) {
+	job := s.createContainer(c)
+	calls := s.failFirst("/containers/.*/start", 1, http.StatusInternalServerError)
+
+	c.Assert(job.startContainer(), NotNil)
+	c.Assert(atomic.LoadInt32(calls), Equals, int32(1))
+}
+
+func (s *SuiteDockerRetry) TestCreateNotRetried(c *C) {
+	job := s.createContainer(c)
+	calls := s.failFirst("/containers/create", 1, http.StatusInternalServerError)
+
+	_, err := job.buildContainer(job.Command)
+	c.Assert(err, NotNil)
+	c.Assert(atomic.LoadInt32(calls), Equals, int32(1))
+}
+
+func (s *SuiteDockerRetry) TestWaitForDocker(c *C) {
+	calls := s.failFirst("/_ping", 3, http.StatusServiceUnavailable)
+
+	c.Assert(WaitForDocker(s.client, time.Minute, &TestLogger{}), IsNil)
+	c.Assert(atomic.LoadInt32(calls), Equals, int32(4))
+	c.Assert(s.waits, DeepEquals, []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second})
+}
+
+func (s *SuiteDockerRetry) TestWaitForDockerTimeout(c *C) {
+	calls := s.failFirst("/_ping", 100, http.StatusServiceUnavailable)
+
+	err := WaitForDocker(s.client, 8*time.Second, &TestLogger{})
+	c.Assert(errors.Is(err, ErrDockerNotReady), Equals, true)
+	c.Assert(err, ErrorMatches, `the Docker daemon isn't ready after 8s: API error \(503\): daemon hiccup\n`)
+	c.Assert(atomic.LoadInt32(calls), Equals, int32(6))
+	c.Assert(s.waits, DeepEquals, []time.Duration{
+		500 * time.Millisecond, time.Second, 2 * time.Second, 4 * time.Second, 500 * time.Millisecond,
+	})
+}
+
+func (s *SuiteDockerRetry) TestWaitForDockerWithoutTimeout(c *C) {
+	calls := s.failFirst("/_ping", 1, http.StatusServiceUnavailable)
+
+	c.Assert(WaitForDocker(s.client, 0, &TestLogger{}), NotNil)
+	c.Assert(atomic.LoadInt32(calls), Equals, int32(1))
+	c.Assert(s.waits, HasLen, 0)
+}
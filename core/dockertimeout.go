@@ -0,0 +1,29 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrDockerTimeout = errors.New("docker operation timed out")
+
+// withDockerTimeout calls op with a context done with parent or once timeout
+// has elapsed, if positive. The expiry of the timeout is reported as
+// ErrDockerTimeout, which isn't retried by RetryDocker.
+func withDockerTimeout(parent context.Context, timeout time.Duration, operation string, op func(context.Context) error) error {
+	if timeout <= 0 {
+		return op(parent)
+	}
+
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+
+	err := op(ctx)
+	if err != nil && parent.Err() == nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %s took more than %s", ErrDockerTimeout, operation, timeout)
+	}
+
+	return err
+}
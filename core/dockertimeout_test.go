@@ -0,0 +1,86 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/fsouza/go-dockerclient/testing"
+	. "gopkg.in/check.v1"
+)
+
+type SuiteDockerTimeout struct {
+	server *testing.DockerServer
+	client *docker.Client
+}
+
+var _ = Suite(&SuiteDockerTimeout{})
+
+func (s *SuiteDockerTimeout) SetUpTest(c *C) {
+	var err error
+	s.server, err = testing.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, IsNil)
+
+	s.client, err = docker.NewClient(s.server.URL())
+	c.Assert(err, IsNil)
+}
+
+func (s *SuiteDockerTimeout) TearDownTest(c *C) {
+	s.server.Stop()
+}
+
+// hang makes the requests matching path block until they are cancelled
+func (s *SuiteDockerTimeout) hang(path string) *int32 {
+	var calls int32
+	s.server.CustomHandler(path, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-r.Context().Done()
+	}))
+
+	return &calls
+}
+
+func (s *SuiteDockerTimeout) TestPullTimeout(c *C) {
+	calls := s.hang("/images/create")
+
+	ctx := &Context{Execution: NewExecution(), Logger: &TestLogger{}}
+	options := &DockerOptions{PullTimeout: 50 * time.Millisecond}
+	err := pullImage(ctx, s.client, imageRequest{Image: "busybox", Docker: options})
+	c.Assert(errors.Is(err, ErrDockerTimeout), Equals, true)
+	c.Assert(err, ErrorMatches, `.*docker operation timed out: pulling image busybox took more than 50ms`)
+	c.Assert(atomic.LoadInt32(calls), Equals, int32(1))
+}
+
+func (s *SuiteDockerTimeout) TestPullCancelled(c *C) {
+	s.hang("/images/create")
+
+	parent, cancel := context.WithCancel(context.Background())
+	ctx := &Context{Execution: NewExecution(), Logger: &TestLogger{}, ctx: parent}
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	options := &DockerOptions{PullTimeout: time.Minute}
+	err := pullImage(ctx, s.client, imageRequest{Image: "busybox", Docker: options})
+	c.Assert(err, NotNil)
+	c.Assert(errors.Is(err, ErrDockerTimeout), Equals, false)
+}
+
+func (s *SuiteDockerTimeout) TestInspectTimeout(c *C) {
+	s.hang("/containers/.*/json")
+
+	job := &RunJob{Client: s.client, Docker: &DockerOptions{InspectTimeout: 50 * time.Millisecond}}
+	_, err := job.inspectContainer("foo")
+	c.Assert(errors.Is(err, ErrDockerTimeout), Equals, true)
+	c.Assert(err, ErrorMatches, `docker operation timed out: inspecting container foo took more than 50ms`)
+}
+
+func (s *SuiteDockerTimeout) TestWithoutTimeout(c *C) {
+	err := withDockerTimeout(context.Background(), 0, "nothing", func(ctx context.Context) error {
+		_, ok := ctx.Deadline()
+		c.Assert(ok, Equals, false)
+		return nil
+	})
+	c.Assert(err, IsNil)
+}
@@ -0,0 +1,157 @@
+package core
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ErrInvalidEnvFile is returned for the lines of an env file that can't be
+// parsed, the content of the line is never part of the error since it may
+// contain secrets
+var ErrInvalidEnvFile = errors.New("invalid env-file")
+
+// readEnvFile reads the `KEY=VALUE` pairs of a dotenv-style file
+func readEnvFile(filename string) ([]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading env-file %q: %w", filename, err)
+	}
+	defer f.Close()
+
+	env, err := parseEnvFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q: %s", ErrInvalidEnvFile, filename, err)
+	}
+
+	return env, nil
+}
+
+// parseEnvFile parses a dotenv-style content: empty lines and comments are
+// ignored, an `export` prefix is allowed, values can be single quoted
+// (literal) or double quoted (with `\n`, `\"` and `\\` escapes), unquoted
+// values end at the first ` #`
+func parseEnvFile(r io.Reader) ([]string, error) {
+	var env []string
+
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", n)
+		}
+
+		value, err := parseEnvValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+
+		env = append(env, key+"="+value)
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return env, nil
+}
+
+func parseEnvValue(v string) (string, error) {
+	if v == "" {
+		return v, nil
+	}
+
+	switch q := v[0]; q {
+	case '\'', '"':
+		end := closingQuote(v, q)
+		if end < 0 {
+			return "", errors.New("unterminated quoted value")
+		}
+
+		if rest := strings.TrimSpace(v[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", errors.New("unexpected characters after quoted value")
+		}
+
+		if q == '\'' {
+			return v[1:end], nil
+		}
+
+		return unescapeEnvValue(v[1:end]), nil
+	}
+
+	if i := strings.Index(v, " #"); i >= 0 {
+		v = strings.TrimSpace(v[:i])
+	}
+
+	return v, nil
+}
+
+// closingQuote returns the index of the quote closing the value, skipping
+// the escaped ones in double quoted values
+func closingQuote(v string, q byte) int {
+	for i := 1; i < len(v); i++ {
+		switch {
+		case q == '"' && v[i] == '\\':
+			i++
+		case v[i] == q:
+			return i
+		}
+	}
+
+	return -1
+}
+
+var envValueReplacer = strings.NewReplacer(`\n`, "\n", `\"`, `"`, `\\`, `\`)
+
+func unescapeEnvValue(v string) string {
+	return envValueReplacer.Replace(v)
+}
+
+// mergeEnv returns the variables read from a file followed by the inline
+// ones, the inline variables take precedence over the file ones
+func mergeEnv(file, inline []string) []string {
+	if len(file) == 0 {
+		return inline
+	}
+
+	keys := make(map[string]bool, len(inline))
+	for _, e := range inline {
+		k, _, _ := strings.Cut(e, "=")
+		keys[k] = true
+	}
+
+	env := make([]string, 0, len(file)+len(inline))
+	for _, e := range file {
+		k, _, _ := strings.Cut(e, "=")
+		if !keys[k] {
+			env = append(env, e)
+		}
+	}
+
+	return append(env, inline...)
+}
+
+// buildEnv reads the env file, if any, and merges it with the inline
+// variables
+func buildEnv(envFile string, inline []string) ([]string, error) {
+	if envFile == "" {
+		return inline, nil
+	}
+
+	file, err := readEnvFile(envFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeEnv(file, inline), nil
+}
@@ -0,0 +1,84 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteEnvFile struct{}
+
+var _ = Suite(&SuiteEnvFile{})
+
+func (s *SuiteEnvFile) TestParseEnvFile(c *C) {
+	env, err := parseEnvFile(strings.NewReader(`
+# database settings
+DB_HOST=db.local
+export DB_USER = admin
+DB_PASSWORD="s3cr#t \"quoted\"\nnext"
+DB_NAME='literal \n $value'
+DB_PORT=5432 # default port
+EMPTY=
+URL=http://a?b=c#anchor
+`))
+
+	c.Assert(err, IsNil)
+	c.Assert(env, DeepEquals, []string{
+		"DB_HOST=db.local",
+		"DB_USER=admin",
+		"DB_PASSWORD=s3cr#t \"quoted\"\nnext",
+		`DB_NAME=literal \n $value`,
+		"DB_PORT=5432",
+		"EMPTY=",
+		"URL=http://a?b=c#anchor",
+	})
+}
+
+func (s *SuiteEnvFile) TestParseEnvFileMalformed(c *C) {
+	testcases := map[string]string{
+		"FOO=bar\nsecret-value\n": "line 2: expected KEY=VALUE",
+		"=value":                  "line 1: expected KEY=VALUE",
+		"MY KEY=value":            "line 1: expected KEY=VALUE",
+		`FOO="unterminated`:       "line 1: unterminated quoted value",
+		`FOO='a' b`:               "line 1: unexpected characters after quoted value",
+	}
+
+	for content, msg := range testcases {
+		_, err := parseEnvFile(strings.NewReader(content))
+		c.Assert(err, ErrorMatches, msg, Commentf("content %q", content))
+	}
+}
+
+func (s *SuiteEnvFile) TestReadEnvFile(c *C) {
+	filename := filepath.Join(c.MkDir(), ".env")
+	c.Assert(os.WriteFile(filename, []byte("TOKEN=abc\nsecret-value\n"), 0600), IsNil)
+
+	_, err := readEnvFile(filename)
+	c.Assert(err, ErrorMatches, `invalid env-file ".*": line 2: expected KEY=VALUE`)
+	c.Assert(strings.Contains(err.Error(), "secret-value"), Equals, false)
+
+	_, err = readEnvFile(filepath.Join(c.MkDir(), "missing"))
+	c.Assert(err, ErrorMatches, `error reading env-file ".*missing": .*no such file or directory`)
+}
+
+func (s *SuiteEnvFile) TestMergeEnv(c *C) {
+	c.Assert(mergeEnv(nil, []string{"A=1"}), DeepEquals, []string{"A=1"})
+
+	env := mergeEnv([]string{"A=file", "B=file", "C=file"}, []string{"B=inline", "D=inline"})
+	c.Assert(env, DeepEquals, []string{"A=file", "C=file", "B=inline", "D=inline"})
+}
+
+func (s *SuiteEnvFile) TestBuildEnv(c *C) {
+	env, err := buildEnv("", []string{"A=1"})
+	c.Assert(err, IsNil)
+	c.Assert(env, DeepEquals, []string{"A=1"})
+
+	filename := filepath.Join(c.MkDir(), ".env")
+	c.Assert(os.WriteFile(filename, []byte("A=2\nB=2\n"), 0600), IsNil)
+
+	env, err = buildEnv(filename, []string{"A=1"})
+	c.Assert(err, IsNil)
+	c.Assert(env, DeepEquals, []string{"B=2", "A=1"})
+}
@@ -2,18 +2,39 @@ package core
 
 import (
 	"fmt"
+	"io"
+	"path"
+	"reflect"
 
 	docker "github.com/fsouza/go-dockerclient"
-	"github.com/gobs/args"
 )
 
 type ExecJob struct {
 	BareJob     `mapstructure:",squash"`
 	Client      *docker.Client `json:"-"`
+	Docker      *DockerOptions `json:"-"`
 	Container   string         `hash:"true"`
 	User        string         `default:"root" hash:"true"`
 	TTY         bool           `default:"false" hash:"true"`
 	Environment []string
+	// EnvFile is a dotenv file read at every execution, the variables of
+	// Environment take precedence over the ones of the file
+	EnvFile    string `gcfg:"env-file" mapstructure:"env-file" hash:"true"`
+	WorkingDir string `gcfg:"working-dir" mapstructure:"working-dir" hash:"true"`
+	Privileged bool   `default:"false" hash:"true"`
+
+	ShellCommand `mapstructure:",squash"`
+	CommandHooks `mapstructure:",squash"`
+
+	// AllowRoot silences the warning of the jobs running as root
+	AllowRoot bool `gcfg:"allow-root" mapstructure:"allow-root"`
+
+	// DockerHost is the daemon running the job, e.g. `ssh://user@host`, the
+	// global one by default
+	DockerHost string `gcfg:"docker-host" mapstructure:"docker-host" hash:"true"`
+	// DockerEndpoint selects a docker-endpoint section by name, instead of
+	// DockerHost
+	DockerEndpoint string `gcfg:"docker-endpoint" mapstructure:"docker-endpoint" hash:"true"`
 
 	execID string
 }
@@ -22,8 +43,59 @@ func NewExecJob(c *docker.Client) *ExecJob {
 	return &ExecJob{Client: c}
 }
 
+// Returns a hash of all the job attributes. Used to detect changes
+func (j *ExecJob) Hash() string {
+	var hash string
+	getHash(reflect.TypeOf(j).Elem(), reflect.ValueOf(j).Elem(), &hash)
+	return hash
+}
+
+// ValidateParams checks the parameters specific to the exec jobs
+func (j *ExecJob) ValidateParams() error {
+	if err := ValidateDockerHost(j.DockerHost); err != nil {
+		return err
+	}
+
+	if err := validateUser(j.User); err != nil {
+		return err
+	}
+
+	if j.WorkingDir != "" && !path.IsAbs(j.WorkingDir) {
+		return fmt.Errorf("%w: %q", ErrRelativeWorkingDir, j.WorkingDir)
+	}
+
+	if j.OverlapPolicy == OverlapPolicyCancelPrevious {
+		return ErrExecCancelPrevious
+	}
+
+	return nil
+}
+
 func (j *ExecJob) Run(ctx *Context) error {
-	exec, err := j.buildExec()
+	cmd, err := j.command(ctx)
+	if err != nil {
+		return err
+	}
+
+	run := func(cmd string, stdout, stderr io.Writer) error {
+		return j.exec(ctx, cmd, stdout, stderr)
+	}
+
+	if err := j.preCommand(ctx, run); err != nil {
+		return err
+	}
+
+	err = j.exec(ctx, cmd, ctx.Execution.OutputStream, ctx.Execution.ErrorStream)
+	return j.postCommand(ctx, run, err)
+}
+
+// exec runs cmd in the container, writing its output to stdout and stderr
+func (j *ExecJob) exec(ctx *Context, cmd string, stdout, stderr io.Writer) error {
+	if err := j.Docker.waitOp(ctx); err != nil {
+		return err
+	}
+
+	exec, err := j.buildExec(cmd)
 	if err != nil {
 		return err
 	}
@@ -32,7 +104,11 @@ func (j *ExecJob) Run(ctx *Context) error {
 		j.execID = exec.ID
 	}
 
-	if err := j.startExec(ctx.Execution); err != nil {
+	if err := j.Docker.waitOp(ctx); err != nil {
+		return err
+	}
+
+	if err := j.startExec(ctx, stdout, stderr); err != nil {
 		return err
 	}
 
@@ -47,20 +123,27 @@ func (j *ExecJob) Run(ctx *Context) error {
 	case -1:
 		return ErrUnexpected
 	default:
-		return fmt.Errorf("error non-zero exit code: %d", inspect.ExitCode)
+		return &NonZeroExitError{ExitCode: inspect.ExitCode}
 	}
 }
 
-func (j *ExecJob) buildExec() (*docker.Exec, error) {
+func (j *ExecJob) buildExec(cmd string) (*docker.Exec, error) {
+	env, err := buildEnv(j.EnvFile, j.Environment)
+	if err != nil {
+		return nil, err
+	}
+
 	exec, err := j.Client.CreateExec(docker.CreateExecOptions{
 		AttachStdin:  false,
 		AttachStdout: true,
 		AttachStderr: true,
 		Tty:          j.TTY,
-		Cmd:          args.GetArgs(j.Command),
+		Cmd:          j.commandArgs(cmd),
 		Container:    j.Container,
 		User:         j.User,
-		Env:          j.Environment,
+		Env:          env,
+		WorkingDir:   j.WorkingDir,
+		Privileged:   j.Privileged,
 	})
 
 	if err != nil {
@@ -70,12 +153,13 @@ func (j *ExecJob) buildExec() (*docker.Exec, error) {
 	return exec, nil
 }
 
-func (j *ExecJob) startExec(e *Execution) error {
+func (j *ExecJob) startExec(ctx *Context, stdout, stderr io.Writer) error {
 	err := j.Client.StartExec(j.execID, docker.StartExecOptions{
 		Tty:          j.TTY,
-		OutputStream: e.OutputStream,
-		ErrorStream:  e.ErrorStream,
+		OutputStream: stdout,
+		ErrorStream:  stderr,
 		RawTerminal:  j.TTY,
+		Context:      ctx.Ctx(),
 	})
 
 	if err != nil {
@@ -86,7 +170,11 @@ func (j *ExecJob) startExec(e *Execution) error {
 }
 
 func (j *ExecJob) inspectExec() (*docker.ExecInspect, error) {
-	i, err := j.Client.InspectExec(j.execID)
+	var i *docker.ExecInspect
+	err := j.Docker.Retry(func() (err error) {
+		i, err = j.Client.InspectExec(j.execID)
+		return err
+	})
 
 	if err != nil {
 		return i, fmt.Errorf("error inspecting exec: %s", err)
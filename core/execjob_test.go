@@ -4,7 +4,12 @@ import (
 	"archive/tar"
 	"bytes"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 
 	docker "github.com/fsouza/go-dockerclient"
 	"github.com/fsouza/go-dockerclient/testing"
@@ -31,7 +36,7 @@ func versionDockerHandler(w http.ResponseWriter, r *http.Request) {
 		"GoVersion":     "go1.17.1",
 		"GitCommit":     "9e83765",
 		"Arch":          "amd64",
-		"ApiVersion":    "1.27",
+		"ApiVersion":    "1.35",
 		"BuildTime":     "2015-12-01T07:09:13.444803460+00:00",
 		"Experimental":  false,
 	}
@@ -85,6 +90,179 @@ func (s *SuiteExecJob) TestRun(c *C) {
 	// no way to check for env :|
 }
 
+func (s *SuiteExecJob) TestRunWorkingDirPrivileged(c *C) {
+	var opts docker.CreateExecOptions
+	s.server.CustomHandler("/containers/.*/exec", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &opts)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		s.server.DefaultHandler().ServeHTTP(w, r)
+	}))
+
+	job := &ExecJob{Client: s.client}
+	job.Container = ContainerFixture
+	job.Command = "pwd"
+	job.WorkingDir = "/srv/app"
+	job.Privileged = true
+
+	c.Assert(job.Run(&Context{Execution: NewExecution()}), IsNil)
+	c.Assert(opts.WorkingDir, Equals, "/srv/app")
+	c.Assert(opts.Privileged, Equals, true)
+}
+
+func (s *SuiteExecJob) TestRunShell(c *C) {
+	var opts docker.CreateExecOptions
+	s.server.CustomHandler("/containers/.*/exec", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &opts)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		s.server.DefaultHandler().ServeHTTP(w, r)
+	}))
+
+	job := &ExecJob{Client: s.client}
+	job.Container = ContainerFixture
+	job.Command = `pg_dump app | gzip > "/backup/app.sql.gz"`
+
+	c.Assert(job.Run(&Context{Execution: NewExecution()}), IsNil)
+	// split into arguments, the pipe isn't understood
+	c.Assert(opts.Cmd, DeepEquals, []string{"pg_dump", "app", `| gzip > "/backup/app.sql.gz"`})
+
+	job.Shell = true
+	c.Assert(job.Run(&Context{Execution: NewExecution()}), IsNil)
+	c.Assert(opts.Cmd, DeepEquals, []string{"/bin/sh", "-c", `pg_dump app | gzip > "/backup/app.sql.gz"`})
+
+	job.ShellPath = "/bin/bash"
+	c.Assert(job.Run(&Context{Execution: NewExecution()}), IsNil)
+	c.Assert(opts.Cmd, DeepEquals, []string{"/bin/bash", "-c", `pg_dump app | gzip > "/backup/app.sql.gz"`})
+}
+
+func (s *SuiteExecJob) TestRunEnvFile(c *C) {
+	var opts docker.CreateExecOptions
+	s.server.CustomHandler("/containers/.*/exec", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &opts)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		s.server.DefaultHandler().ServeHTTP(w, r)
+	}))
+
+	filename := filepath.Join(c.MkDir(), ".env")
+	c.Assert(os.WriteFile(filename, []byte("A=file\nB=file\n"), 0600), IsNil)
+
+	job := &ExecJob{Client: s.client}
+	job.Container = ContainerFixture
+	job.Command = "env"
+	job.Environment = []string{"B=inline"}
+	job.EnvFile = filename
+
+	c.Assert(job.Run(&Context{Execution: NewExecution()}), IsNil)
+	c.Assert(opts.Env, DeepEquals, []string{"A=file", "B=inline"})
+
+	job.EnvFile = filepath.Join(c.MkDir(), "missing")
+	c.Assert(job.Run(&Context{Execution: NewExecution()}), ErrorMatches, "error reading env-file.*")
+}
+
+func (s *SuiteExecJob) TestValidateParams(c *C) {
+	job := &ExecJob{}
+	c.Assert(job.ValidateParams(), IsNil)
+
+	job.WorkingDir = "/srv/app"
+	c.Assert(job.ValidateParams(), IsNil)
+
+	job.WorkingDir = "srv/app"
+	c.Assert(job.ValidateParams(), ErrorMatches, "working-dir must be an absolute path.*")
+
+	job.Schedule = "@hourly"
+	c.Assert(ValidateJob(job), ErrorMatches, "working-dir must be an absolute path.*")
+
+	job.WorkingDir = ""
+	job.OverlapPolicy = OverlapPolicyCancelPrevious
+	c.Assert(ValidateJob(job), Equals, ErrExecCancelPrevious)
+
+	job.OverlapPolicy = OverlapPolicySkip
+	c.Assert(ValidateJob(job), IsNil)
+}
+
+func (s *SuiteExecJob) TestHash(c *C) {
+	job := &ExecJob{}
+	job.WorkingDir = "/srv/app"
+	hash := job.Hash()
+
+	job.WorkingDir = "/srv/other"
+	c.Assert(job.Hash(), Not(Equals), hash)
+
+	hash = job.Hash()
+	job.Privileged = true
+	c.Assert(job.Hash(), Not(Equals), hash)
+
+	hash = job.Hash()
+	job.PreCommand = "mount-prep"
+	c.Assert(job.Hash(), Not(Equals), hash)
+
+	hash = job.Hash()
+	job.NotifyEmpty = "false"
+	c.Assert(job.Hash(), Not(Equals), hash)
+}
+
+// recordExecs records the commands of the execs, in order, the ones in fail
+// exiting with the code 1
+func (s *SuiteExecJob) recordExecs(fail ...string) *[]string {
+	var cmds []string
+	s.server.CustomHandler("/containers/.*/exec", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var opts docker.CreateExecOptions
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &opts)
+		cmds = append(cmds, strings.Join(opts.Cmd, " "))
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		s.server.DefaultHandler().ServeHTTP(w, r)
+	}))
+
+	s.server.CustomHandler("/exec/.*/json", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code := 0
+		for _, f := range fail {
+			if cmds[len(cmds)-1] == f {
+				code = 1
+			}
+		}
+
+		json.NewEncoder(w).Encode(docker.ExecInspect{ExitCode: code})
+	}))
+
+	return &cmds
+}
+
+func (s *SuiteExecJob) TestRunHooks(c *C) {
+	job := &ExecJob{Client: s.client}
+	job.Name = "hooks"
+	job.Container = ContainerFixture
+	job.Command = "main"
+	job.PreCommand = "pre"
+	job.PostCommand = "post"
+	run := func() error {
+		return job.Run(NewContext(NewScheduler(&TestLogger{}), job, NewExecution()))
+	}
+
+	cmds := s.recordExecs()
+	c.Assert(run(), IsNil)
+	c.Assert(*cmds, DeepEquals, []string{"pre", "main", "post"})
+
+	// a failed pre-command aborts the job
+	cmds = s.recordExecs("pre")
+	err := run()
+	c.Assert(err, ErrorMatches, "pre-command failed: .*")
+	c.Assert(errors.As(err, new(*NonZeroExitError)), Equals, true)
+	c.Assert(*cmds, DeepEquals, []string{"pre"})
+
+	// the post-command runs after a failure, which is kept
+	cmds = s.recordExecs("main", "post")
+	err = run()
+	c.Assert(err, DeepEquals, &NonZeroExitError{ExitCode: 1})
+	c.Assert(*cmds, DeepEquals, []string{"pre", "main", "post"})
+
+	// a failed post-command fails the job
+	s.recordExecs("post")
+	c.Assert(run(), ErrorMatches, "post-command failed: .*")
+}
+
 func (s *SuiteExecJob) buildContainer(c *C) {
 	inputbuf := bytes.NewBuffer(nil)
 	tr := tar.NewWriter(inputbuf)
@@ -0,0 +1,75 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+var ErrHooksWithContainer = errors.New("pre-command and post-command need an image, not a container")
+
+// hookOutputSize is the size of the tail kept of each stream of the hooks,
+// their output is only logged
+const hookOutputSize = 64 * 1024
+
+// CommandHooks are commands run around the command of a job, in the same
+// context: an exec in the same container or a container of the same image.
+// A failing PreCommand aborts the execution, PostCommand runs even if the
+// command failed, like a finally.
+type CommandHooks struct {
+	PreCommand  string `gcfg:"pre-command" mapstructure:"pre-command" hash:"true"`
+	PostCommand string `gcfg:"post-command" mapstructure:"post-command" hash:"true"`
+}
+
+// hookRunner runs a command of the job, writing its output to stdout and
+// stderr
+type hookRunner func(cmd string, stdout, stderr io.Writer) error
+
+// preCommand runs the pre-command, if any, the execution must be aborted if
+// it returns an error
+func (h *CommandHooks) preCommand(ctx *Context, run hookRunner) error {
+	return h.runHook(ctx, "pre-command", h.PreCommand, run)
+}
+
+// postCommand runs the post-command, if any, once the command has returned
+// err. The error of the post-command is returned if the command succeeded,
+// and only logged otherwise.
+func (h *CommandHooks) postCommand(ctx *Context, run hookRunner, err error) error {
+	hookErr := h.runHook(ctx, "post-command", h.PostCommand, run)
+	if hookErr == nil {
+		return err
+	}
+
+	if err == nil {
+		return hookErr
+	}
+
+	ctx.Warn(hookErr.Error())
+	return err
+}
+
+// runHook runs a hook, its output is logged apart from the one of the
+// command
+func (h *CommandHooks) runHook(ctx *Context, name, cmd string, run hookRunner) error {
+	if cmd == "" {
+		return nil
+	}
+
+	stdout := newOutputBuffer(hookOutputSize, OutputKeepTail)
+	stderr := newOutputBuffer(hookOutputSize, OutputKeepTail)
+	err := run(cmd, stdout, stderr)
+
+	if stdout.TotalWritten() > 0 {
+		ctx.Log(name + " StdOut: " + stdout.String())
+	}
+
+	if stderr.TotalWritten() > 0 {
+		ctx.Log(name + " StdErr: " + stderr.String())
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s failed: %w", name, err)
+	}
+
+	return nil
+}
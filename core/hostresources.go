@@ -0,0 +1,86 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// memInfoFile is where the memory of the host is read, on Linux only
+const memInfoFile = "/proc/meminfo"
+
+// readFreeMemory returns the memory available on the host in bytes, the
+// MemAvailable of /proc/meminfo
+func readFreeMemory() (int64, error) {
+	f, err := os.Open(memInfoFile)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		// e.g. `MemAvailable:    8010500 kB`
+		fields := strings.Fields(s.Text())
+		if len(fields) == 3 && fields[0] == "MemAvailable:" && fields[2] == "kB" {
+			kb, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid MemAvailable in %s: %w", memInfoFile, err)
+			}
+
+			return kb << 10, nil
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return 0, err
+	}
+
+	return 0, fmt.Errorf("no MemAvailable in %s", memInfoFile)
+}
+
+// parseRequiredFree parses a require-free-* size, e.g. `1g`
+func parseRequiredFree(option, value string) (int64, error) {
+	size, err := ParseMemory(value)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("invalid %s %q, expected a size like 512m or 10g", option, value)
+	}
+
+	return size, nil
+}
+
+// checkResources returns why the host lacks the free memory or disk space
+// required by the job, empty if it has them. A resource that can't be read
+// is logged and doesn't prevent the execution.
+func (w *jobWrapper) checkResources() string {
+	o := w.j.GetSchedulingOptions()
+	checks := []struct {
+		option, value, name string
+		read                func() (int64, error)
+	}{
+		{"require-free-memory", o.RequireFreeMemory, "memory", w.s.freeMemory},
+		{"require-free-disk", o.RequireFreeDisk, "disk space", w.s.freeDisk},
+	}
+
+	for _, c := range checks {
+		if c.value == "" {
+			continue
+		}
+
+		// validated when the job was added
+		required, _ := parseRequiredFree(c.option, c.value)
+		free, err := c.read()
+		if err != nil {
+			w.s.Logger.Warningf("Job %q: can't read the free %s, running it anyway: %s", w.j.GetName(), c.name, err)
+			continue
+		}
+
+		if free < required {
+			return fmt.Sprintf("free %s %dm below the required %s", c.name, free>>20, c.value)
+		}
+	}
+
+	return ""
+}
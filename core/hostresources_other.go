@@ -0,0 +1,11 @@
+//go:build !unix
+
+package core
+
+import "errors"
+
+// readFreeDisk isn't supported without statfs, require-free-disk is logged
+// as unreadable and doesn't prevent the executions
+func readFreeDisk() (int64, error) {
+	return 0, errors.New("the free disk space can't be read on this platform")
+}
@@ -0,0 +1,90 @@
+package core
+
+import (
+	"errors"
+	"runtime"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteHostResources struct{}
+
+var _ = Suite(&SuiteHostResources{})
+
+func (s *SuiteHostResources) TestReadFree(c *C) {
+	if runtime.GOOS != "linux" {
+		c.Skip("the memory is read from /proc/meminfo")
+	}
+
+	free, err := readFreeMemory()
+	c.Assert(err, IsNil)
+	c.Assert(free > 0, Equals, true)
+
+	free, err = readFreeDisk()
+	c.Assert(err, IsNil)
+	c.Assert(free > 0, Equals, true)
+}
+
+func (s *SuiteHostResources) TestSkip(c *C) {
+	job := &TestJob{}
+	job.Name = "backup"
+	job.Schedule = "@daily"
+	job.RequireFreeMemory = "1g"
+	job.RequireFreeDisk = "10g"
+
+	sc := NewScheduler(&TestLogger{})
+	sc.freeMemory = func() (int64, error) { return 512 << 20, nil }
+	sc.freeDisk = func() (int64, error) { return 20 << 30, nil }
+	c.Assert(sc.AddJob(job), IsNil)
+
+	e, err := sc.RunJob("backup")
+	c.Assert(err, IsNil)
+	c.Assert(e.Skipped, Equals, true)
+	c.Assert(e.Failed, Equals, false)
+	c.Assert(job.Called, Equals, 0)
+
+	sc.freeMemory = func() (int64, error) { return 2 << 30, nil }
+	sc.freeDisk = func() (int64, error) { return 5 << 30, nil }
+	e, err = sc.RunJob("backup")
+	c.Assert(err, IsNil)
+	c.Assert(e.Skipped, Equals, true)
+	c.Assert(job.Called, Equals, 0)
+
+	// enough resources
+	sc.freeDisk = func() (int64, error) { return 20 << 30, nil }
+	e, err = sc.RunJob("backup")
+	c.Assert(err, IsNil)
+	c.Assert(e.Skipped, Equals, false)
+	c.Assert(job.Called, Equals, 1)
+
+	// unknown, the job runs
+	sc.freeMemory = func() (int64, error) { return 0, errors.New("no /proc/meminfo") }
+	e, err = sc.RunJob("backup")
+	c.Assert(err, IsNil)
+	c.Assert(e.Skipped, Equals, false)
+	c.Assert(job.Called, Equals, 2)
+}
+
+func (s *SuiteHostResources) TestCheckResources(c *C) {
+	job := &TestJob{}
+	job.RequireFreeMemory = "1g"
+
+	sc := NewScheduler(&TestLogger{})
+	sc.freeMemory = func() (int64, error) { return 512 << 20, nil }
+	c.Assert(newJobWrapper(sc, job).checkResources(), Equals, "free memory 512m below the required 1g")
+
+	job.RequireFreeMemory = ""
+	c.Assert(newJobWrapper(sc, job).checkResources(), Equals, "")
+}
+
+func (s *SuiteHostResources) TestValidate(c *C) {
+	job := &TestJob{}
+	job.Schedule = "@daily"
+
+	job.RequireFreeMemory = "lots"
+	c.Assert(ValidateJob(job), ErrorMatches, `invalid require-free-memory "lots", expected a size like 512m or 10g`)
+
+	job.RequireFreeMemory = ""
+	job.RequireFreeDisk = "-1"
+	c.Assert(ValidateJob(job), ErrorMatches, `invalid require-free-disk "-1".*`)
+}
@@ -0,0 +1,16 @@
+//go:build unix
+
+package core
+
+import "syscall"
+
+// readFreeDisk returns the space available on the root filesystem in bytes,
+// the data of Docker when Ofelia runs in a container
+func readFreeDisk() (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs("/", &st); err != nil {
+		return 0, err
+	}
+
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
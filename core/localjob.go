@@ -3,14 +3,13 @@ package core
 import (
 	"os"
 	"os/exec"
-
-	"github.com/gobs/args"
 )
 
 type LocalJob struct {
-	BareJob     `mapstructure:",squash"`
-	Dir         string
-	Environment []string
+	BareJob      `mapstructure:",squash"`
+	ShellCommand `mapstructure:",squash"`
+	Dir          string
+	Environment  []string
 }
 
 func NewLocalJob() *LocalJob {
@@ -27,20 +26,25 @@ func (j *LocalJob) Run(ctx *Context) error {
 }
 
 func (j *LocalJob) buildCommand(ctx *Context) (*exec.Cmd, error) {
-	args := args.GetArgs(j.Command)
+	command, err := j.command(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	args := j.commandArgs(command)
 	bin, err := exec.LookPath(args[0])
 	if err != nil {
 		return nil, err
 	}
 
-	return &exec.Cmd{
-		Path:   bin,
-		Args:   args,
-		Stdout: ctx.Execution.OutputStream,
-		Stderr: ctx.Execution.ErrorStream,
-		// add custom env variables to the existing ones
-		// instead of overwriting them
-		Env: append(os.Environ(), j.Environment...),
-		Dir: j.Dir,
-	}, nil
+	cmd := exec.CommandContext(ctx.Ctx(), bin)
+	cmd.Args = args
+	cmd.Stdout = ctx.Execution.OutputStream
+	cmd.Stderr = ctx.Execution.ErrorStream
+	// add custom env variables to the existing ones
+	// instead of overwriting them
+	cmd.Env = append(os.Environ(), j.Environment...)
+	cmd.Dir = j.Dir
+
+	return cmd, nil
 }
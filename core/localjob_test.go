@@ -25,6 +25,20 @@ func (s *SuiteLocalJob) TestRun(c *C) {
 	c.Assert(b.String(), Equals, "foo bar\n")
 }
 
+func (s *SuiteLocalJob) TestRunShell(c *C) {
+	job := &LocalJob{}
+	job.Command = `echo "foo bar" | tr a-z A-Z`
+	job.Shell = true
+
+	b, _ := circbuf.NewBuffer(1000)
+	e := NewExecution()
+	e.OutputStream = b
+
+	err := job.Run(&Context{Execution: e})
+	c.Assert(err, IsNil)
+	c.Assert(b.String(), Equals, "FOO BAR\n")
+}
+
 func (s *SuiteLocalJob) TestEnvironment(c *C) {
 	job := &LocalJob{}
 	job.Command = `env`
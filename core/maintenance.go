@@ -0,0 +1,152 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	// MaintenancePolicySkip drops the scheduled executions falling in a
+	// maintenance window
+	MaintenancePolicySkip = "skip"
+	// MaintenancePolicyDefer runs them once the window has ended, once per
+	// job however many activations fell in the window
+	MaintenancePolicyDefer = "defer"
+)
+
+var (
+	ErrInvalidMaintenanceWindow = errors.New("invalid maintenance window")
+	ErrUnknownMaintenancePolicy = errors.New("unknown maintenance policy")
+)
+
+// maintenanceAfter waits for the end of a maintenance window, replaced by the
+// tests
+var maintenanceAfter = time.After
+
+// MaintenanceWindow is a period starting at each activation of a schedule,
+// during which the scheduled executions of the jobs don't run
+type MaintenanceWindow struct {
+	Spec     string
+	Duration time.Duration
+	schedule cron.Schedule
+}
+
+// ParseMaintenanceWindow parses a window written as a cron expression or
+// descriptor followed by its duration, e.g. `0 2 * * * 2h` or `@daily 30m`
+func ParseMaintenanceWindow(spec string) (MaintenanceWindow, error) {
+	spec = strings.TrimSpace(spec)
+	i := strings.LastIndexByte(spec, ' ')
+	if i < 0 {
+		return MaintenanceWindow{}, fmt.Errorf("%w %q, expected a schedule and a duration", ErrInvalidMaintenanceWindow, spec)
+	}
+
+	schedule, duration := strings.TrimSpace(spec[:i]), spec[i+1:]
+	d, err := time.ParseDuration(duration)
+	if err != nil || d <= 0 {
+		return MaintenanceWindow{}, fmt.Errorf("%w %q, expected a positive duration: %q", ErrInvalidMaintenanceWindow, spec, duration)
+	}
+
+	sched, err := cronParser.Parse(schedule)
+	if err != nil {
+		return MaintenanceWindow{}, fmt.Errorf("%w %q: %s", ErrInvalidMaintenanceWindow, spec, err)
+	}
+
+	// the activations of @every depend on the time they are computed from
+	if _, ok := sched.(cron.ConstantDelaySchedule); ok {
+		return MaintenanceWindow{}, fmt.Errorf("%w %q, @every isn't supported", ErrInvalidMaintenanceWindow, spec)
+	}
+
+	return MaintenanceWindow{Spec: spec, Duration: d, schedule: sched}, nil
+}
+
+// end returns the end of the window containing t, if any, the one of its last
+// activation when they overlap
+func (w MaintenanceWindow) end(t time.Time) (time.Time, bool) {
+	start := w.schedule.Next(t.Add(-w.Duration))
+	if start.IsZero() || start.After(t) {
+		return time.Time{}, false
+	}
+
+	for next := w.schedule.Next(start); !next.IsZero() && !next.After(t); next = w.schedule.Next(next) {
+		start = next
+	}
+
+	return start.Add(w.Duration), true
+}
+
+// ValidateMaintenancePolicy checks the policy applied to the executions falling
+// in a maintenance window, skip if empty
+func ValidateMaintenancePolicy(policy string) error {
+	switch policy {
+	case "", MaintenancePolicySkip, MaintenancePolicyDefer:
+		return nil
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownMaintenancePolicy, policy)
+	}
+}
+
+// maintenanceEnd returns the end of the maintenance windows containing t, the
+// latest one when several overlap
+func (s *Scheduler) maintenanceEnd(t time.Time) (time.Time, bool) {
+	var end time.Time
+	for _, w := range s.MaintenanceWindows {
+		if e, ok := w.end(t); ok && e.After(end) {
+			end = e
+		}
+	}
+
+	return end, !end.IsZero()
+}
+
+// maintenance applies the maintenance windows to a scheduled execution of the
+// job. It returns false if the execution must not run: skipped during a
+// window, already deferred, or the scheduler was stopped while deferred.
+func (w *jobWrapper) maintenance() bool {
+	if w.j.GetSchedulingOptions().IgnoreMaintenance {
+		return true
+	}
+
+	for {
+		now := w.s.now()
+		end, ok := w.s.maintenanceEnd(now)
+		if !ok {
+			return true
+		}
+
+		if w.s.MaintenancePolicy != MaintenancePolicyDefer {
+			w.s.Logger.Noticef("Job %q not executed, maintenance window until %s", w.j.GetName(), end.Format(time.RFC3339))
+			return false
+		}
+
+		w.mu.Lock()
+		if w.deferred {
+			w.mu.Unlock()
+			w.s.Logger.Debugf("Job %q not executed, an execution is already deferred until %s", w.j.GetName(), end.Format(time.RFC3339))
+			return false
+		}
+		w.deferred = true
+		w.mu.Unlock()
+
+		w.s.Logger.Noticef("Job %q deferred until the end of the maintenance window at %s", w.j.GetName(), end.Format(time.RFC3339))
+
+		var stopped bool
+		select {
+		case <-maintenanceAfter(end.Sub(now)):
+		case <-w.s.stopped():
+			stopped = true
+		}
+
+		w.mu.Lock()
+		w.deferred = false
+		w.mu.Unlock()
+
+		if stopped {
+			w.s.Logger.Debugf("Job %q not executed, the scheduler is stopping", w.j.GetName())
+			return false
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package core
+
+import (
+	"errors"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteMaintenance struct {
+	now   time.Time
+	waits []time.Duration
+}
+
+var _ = Suite(&SuiteMaintenance{})
+
+func (s *SuiteMaintenance) SetUpTest(c *C) {
+	s.now = time.Date(2025, 6, 1, 2, 30, 0, 0, time.Local)
+	s.waits = nil
+	maintenanceAfter = func(d time.Duration) <-chan time.Time {
+		s.waits = append(s.waits, d)
+		s.now = s.now.Add(d)
+		ch := make(chan time.Time, 1)
+		ch <- s.now
+		return ch
+	}
+}
+
+func (s *SuiteMaintenance) TearDownTest(c *C) {
+	maintenanceAfter = time.After
+}
+
+// wrapper returns the wrapper of a job added to a scheduler with a nightly
+// window from 2 to 4, at the time of the suite
+func (s *SuiteMaintenance) wrapper(c *C, policy string) (*jobWrapper, *TestJob) {
+	w, err := ParseMaintenanceWindow("0 2 * * * 2h")
+	c.Assert(err, IsNil)
+
+	sc := NewScheduler(&TestLogger{})
+	sc.now = func() time.Time { return s.now }
+	sc.MaintenanceWindows = []MaintenanceWindow{w}
+	sc.MaintenancePolicy = policy
+
+	job := &TestJob{}
+	job.Name = "backup"
+	job.Schedule = "@hourly"
+	c.Assert(sc.AddJob(job), IsNil)
+
+	return sc.wrappers()[0], job
+}
+
+func (s *SuiteMaintenance) TestParse(c *C) {
+	w, err := ParseMaintenanceWindow(" @daily 30m ")
+	c.Assert(err, IsNil)
+	c.Assert(w.Spec, Equals, "@daily 30m")
+	c.Assert(w.Duration, Equals, 30*time.Minute)
+
+	for spec, msg := range map[string]string{
+		"@daily":          `invalid maintenance window "@daily", expected a schedule and a duration`,
+		"0 2 * * * soon":  `invalid maintenance window "0 2 \* \* \* soon", expected a positive duration: "soon"`,
+		"0 2 * * * -1h":   `invalid maintenance window "0 2 \* \* \* -1h", expected a positive duration: "-1h"`,
+		"0 2 * * 2h":      `invalid maintenance window "0 2 \* \* 2h": .*`,
+		"@every 1h 10m":   `invalid maintenance window "@every 1h 10m", @every isn't supported`,
+		"0 99 * * * 1h":   `invalid maintenance window "0 99 \* \* \* 1h": .*`,
+		"nightly for 2h":  `invalid maintenance window "nightly for 2h": .*`,
+		"0 2 * * * 2h 1h": `invalid maintenance window "0 2 \* \* \* 2h 1h": .*`,
+	} {
+		_, err := ParseMaintenanceWindow(spec)
+		c.Assert(errors.Is(err, ErrInvalidMaintenanceWindow), Equals, true, Commentf(spec))
+		c.Assert(err, ErrorMatches, msg, Commentf(spec))
+	}
+}
+
+func (s *SuiteMaintenance) TestEnd(c *C) {
+	w, err := ParseMaintenanceWindow("0 2 * * * 2h")
+	c.Assert(err, IsNil)
+
+	day := time.Date(2025, 6, 1, 0, 0, 0, 0, time.Local)
+	for _, t := range []struct {
+		at     time.Duration
+		inside bool
+	}{
+		{time.Hour + 59*time.Minute, false},
+		{2 * time.Hour, true},
+		{3*time.Hour + 59*time.Minute, true},
+		{4 * time.Hour, false},
+	} {
+		end, ok := w.end(day.Add(t.at))
+		c.Assert(ok, Equals, t.inside, Commentf("%s", t.at))
+		if ok {
+			c.Assert(end, Equals, day.Add(4*time.Hour))
+		}
+	}
+
+	// overlapping activations extend the window
+	w, err = ParseMaintenanceWindow("0 * * * * 90m")
+	c.Assert(err, IsNil)
+	end, ok := w.end(day.Add(2*time.Hour + 10*time.Minute))
+	c.Assert(ok, Equals, true)
+	c.Assert(end, Equals, day.Add(3*time.Hour+30*time.Minute))
+}
+
+func (s *SuiteMaintenance) TestSkip(c *C) {
+	w, job := s.wrapper(c, "")
+
+	w.Run()
+	c.Assert(job.Called, Equals, 0)
+	c.Assert(s.waits, HasLen, 0)
+
+	s.now = s.now.Add(2 * time.Hour)
+	w.Run()
+	c.Assert(job.Called, Equals, 1)
+}
+
+func (s *SuiteMaintenance) TestIgnoreMaintenance(c *C) {
+	w, job := s.wrapper(c, MaintenancePolicySkip)
+	job.IgnoreMaintenance = true
+
+	w.Run()
+	c.Assert(job.Called, Equals, 1)
+}
+
+func (s *SuiteMaintenance) TestDefer(c *C) {
+	w, job := s.wrapper(c, MaintenancePolicyDefer)
+
+	w.Run()
+	c.Assert(job.Called, Equals, 1)
+	c.Assert(s.waits, DeepEquals, []time.Duration{90 * time.Minute})
+	c.Assert(w.deferred, Equals, false)
+}
+
+func (s *SuiteMaintenance) TestDeferOnce(c *C) {
+	w, job := s.wrapper(c, MaintenancePolicyDefer)
+
+	// an activation already waits for the end of the window
+	w.deferred = true
+	w.Run()
+	c.Assert(job.Called, Equals, 0)
+	c.Assert(s.waits, HasLen, 0)
+}
+
+func (s *SuiteMaintenance) TestDeferStopped(c *C) {
+	w, job := s.wrapper(c, MaintenancePolicyDefer)
+	maintenanceAfter = func(time.Duration) <-chan time.Time { return nil }
+	close(w.s.stopping)
+
+	w.Run()
+	c.Assert(job.Called, Equals, 0)
+	c.Assert(w.deferred, Equals, false)
+}
+
+func (s *SuiteMaintenance) TestValidatePolicy(c *C) {
+	c.Assert(ValidateMaintenancePolicy(""), IsNil)
+	c.Assert(ValidateMaintenancePolicy(MaintenancePolicyDefer), IsNil)
+	c.Assert(ValidateMaintenancePolicy("later"), ErrorMatches, `unknown maintenance policy: "later"`)
+}
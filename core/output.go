@@ -0,0 +1,158 @@
+package core
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/armon/circbuf"
+)
+
+// Output keep policies, they define which part of a stream longer than
+// max-output is kept
+const (
+	// OutputKeepTail keeps the last bytes, the default
+	OutputKeepTail = "tail"
+	// OutputKeepHead keeps the first bytes
+	OutputKeepHead = "head"
+)
+
+// Output encodings, they define how the captured streams are rendered in the
+// notifications and the saved reports
+const (
+	// OutputEncodingText renders the streams as text, the invalid UTF-8
+	// sequences replaced, the default
+	OutputEncodingText = "text"
+	// OutputEncodingBase64 renders the streams encoded in base64, for
+	// binary output
+	OutputEncodingBase64 = "base64"
+	// OutputEncodingDrop leaves the streams out
+	OutputEncodingDrop = "drop"
+)
+
+// OutputBuffer captures a stream of an execution, keeping at most Size bytes
+// of it
+type OutputBuffer interface {
+	io.Writer
+	Bytes() []byte
+	String() string
+	Size() int64
+	TotalWritten() int64
+}
+
+// newOutputBuffer returns a buffer of the given size, maxStreamSize if zero,
+// keeping the head or the tail of the stream
+func newOutputBuffer(size int64, keep string) OutputBuffer {
+	if size <= 0 {
+		size = maxStreamSize
+	}
+
+	if keep == OutputKeepHead {
+		return &headBuffer{size: size}
+	}
+
+	b, _ := circbuf.NewBuffer(size)
+	return b
+}
+
+// truncated reports whether part of the stream written to b was dropped
+func truncated(b OutputBuffer) bool {
+	return b != nil && b.TotalWritten() > b.Size()
+}
+
+// ParseMaxOutput parses a max-output size, e.g. `1m`, the fallback being
+// used if empty
+func ParseMaxOutput(value string, fallback int64) (int64, error) {
+	if value == "" {
+		return fallback, nil
+	}
+
+	size, err := ParseMemory(value)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("invalid max-output %q, expected a size like 512k or 1m", value)
+	}
+
+	return size, nil
+}
+
+func validateOutputKeep(keep string) error {
+	switch keep {
+	case "", OutputKeepTail, OutputKeepHead:
+		return nil
+	default:
+		return fmt.Errorf("invalid output-keep %q, expected tail or head", keep)
+	}
+}
+
+func validateOutputEncoding(encoding string) error {
+	switch encoding {
+	case "", OutputEncodingText, OutputEncodingBase64, OutputEncodingDrop:
+		return nil
+	default:
+		return fmt.Errorf("invalid output-encoding %q, expected text, base64 or drop", encoding)
+	}
+}
+
+// RenderOutput renders the bytes captured of a stream with the given output
+// encoding, text if empty
+func RenderOutput(b []byte, encoding string) string {
+	switch encoding {
+	case OutputEncodingBase64:
+		return base64.StdEncoding.EncodeToString(b)
+	case OutputEncodingDrop:
+		return ""
+	default:
+		return strings.ToValidUTF8(string(b), "\uFFFD")
+	}
+}
+
+// headBuffer keeps the first bytes written, the following ones are only
+// counted
+type headBuffer struct {
+	mu      sync.Mutex
+	data    []byte
+	size    int64
+	written int64
+}
+
+func (b *headBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// the dropped bytes are reported as written, as circbuf does
+	n := len(p)
+	b.written += int64(n)
+	if room := b.size - int64(len(b.data)); room > 0 {
+		if int64(len(p)) > room {
+			p = p[:room]
+		}
+
+		b.data = append(b.data, p...)
+	}
+
+	return n, nil
+}
+
+func (b *headBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]byte(nil), b.data...)
+}
+
+func (b *headBuffer) String() string {
+	return string(b.Bytes())
+}
+
+func (b *headBuffer) Size() int64 {
+	return b.size
+}
+
+func (b *headBuffer) TotalWritten() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.written
+}
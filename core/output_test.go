@@ -0,0 +1,104 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteOutput struct{}
+
+var _ = Suite(&SuiteOutput{})
+
+// chattyJob writes lines numbered from 0 to its output stream
+type chattyJob struct {
+	BareJob
+	lines int
+}
+
+func (j *chattyJob) Run(ctx *Context) error {
+	for i := 0; i < j.lines; i++ {
+		fmt.Fprintf(ctx.Execution.OutputStream, "%04d\n", i)
+	}
+
+	return nil
+}
+
+func (s *SuiteOutput) run(c *C, sc *Scheduler, job *chattyJob) *Execution {
+	job.Name = "chatty"
+	job.Schedule = "@daily"
+	c.Assert(sc.AddJob(job), IsNil)
+
+	e, err := sc.RunJob("chatty")
+	c.Assert(err, IsNil)
+	return e
+}
+
+func (s *SuiteOutput) TestKeepTail(c *C) {
+	job := &chattyJob{lines: 100}
+	job.MaxOutput = "10b"
+
+	e := s.run(c, NewScheduler(&TestLogger{}), job)
+	c.Assert(e.Truncated, Equals, true)
+	c.Assert(e.OutputStream.String(), Equals, "0098\n0099\n")
+}
+
+func (s *SuiteOutput) TestKeepHead(c *C) {
+	job := &chattyJob{lines: 100}
+	job.MaxOutput = "12b"
+	job.OutputKeep = OutputKeepHead
+
+	e := s.run(c, NewScheduler(&TestLogger{}), job)
+	c.Assert(e.Truncated, Equals, true)
+	c.Assert(e.OutputStream.String(), Equals, "0000\n0001\n00")
+	c.Assert(e.OutputStream.TotalWritten(), Equals, int64(500))
+}
+
+func (s *SuiteOutput) TestDefaultMaxOutput(c *C) {
+	sc := NewScheduler(&TestLogger{})
+	sc.DefaultMaxOutput = 1024
+
+	e := s.run(c, sc, &chattyJob{lines: 100})
+	c.Assert(e.Truncated, Equals, false)
+	c.Assert(e.OutputStream.Size(), Equals, int64(1024))
+	c.Assert(strings.HasPrefix(e.OutputStream.String(), "0000\n"), Equals, true)
+}
+
+func (s *SuiteOutput) TestValidate(c *C) {
+	job := &chattyJob{}
+	job.Schedule = "@daily"
+
+	job.MaxOutput = "lots"
+	c.Assert(ValidateJob(job), ErrorMatches, `invalid max-output "lots", expected a size like 512k or 1m`)
+
+	job.MaxOutput = "0"
+	c.Assert(ValidateJob(job), ErrorMatches, `invalid max-output "0".*`)
+
+	job.MaxOutput = "1m"
+	job.OutputKeep = "middle"
+	c.Assert(ValidateJob(job), ErrorMatches, `invalid output-keep "middle", expected tail or head`)
+
+	job.OutputKeep = ""
+	job.OutputEncoding = "hex"
+	c.Assert(ValidateJob(job), ErrorMatches, `invalid output-encoding "hex", expected text, base64 or drop`)
+}
+
+func (s *SuiteOutput) TestRenderOutput(c *C) {
+	b := []byte("ok \xff\xfe\n")
+	c.Assert(RenderOutput(b, ""), Equals, "ok \uFFFD\n")
+	c.Assert(RenderOutput(b, OutputEncodingText), Equals, "ok \uFFFD\n")
+	c.Assert(RenderOutput(b, OutputEncodingBase64), Equals, "b2sg//4K")
+	c.Assert(RenderOutput(b, OutputEncodingDrop), Equals, "")
+}
+
+func (s *SuiteOutput) TestOutputEncoding(c *C) {
+	job := &chattyJob{lines: 1}
+	job.OutputEncoding = OutputEncodingBase64
+
+	e := s.run(c, NewScheduler(&TestLogger{}), job)
+	c.Assert(e.OutputEncoding, Equals, OutputEncodingBase64)
+	c.Assert(e.Render(e.OutputStream), Equals, "MDAwMAo=")
+	// the raw bytes are kept
+	c.Assert(e.OutputStream.String(), Equals, "0000\n")
+}
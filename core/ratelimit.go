@@ -0,0 +1,71 @@
+package core
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket holding a single token, refilled at a fixed
+// rate, so the bursts of operations are spread evenly instead of dropped
+type RateLimiter struct {
+	interval time.Duration
+
+	mu sync.Mutex
+	// next is when the next token is available
+	next time.Time
+
+	now   func() time.Time
+	after func(time.Duration) <-chan time.Time
+}
+
+// NewRateLimiter returns a limiter allowing perSecond operations per second,
+// nil if perSecond isn't positive
+func NewRateLimiter(perSecond float64) *RateLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+
+	return &RateLimiter{
+		interval: time.Duration(float64(time.Second) / perSecond),
+		now:      time.Now,
+		after:    time.After,
+	}
+}
+
+// Wait blocks until the operation can be made or ctx is done, a nil limiter
+// never blocks
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := l.now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+
+	slot := l.next
+	l.next = slot.Add(l.interval)
+	l.mu.Unlock()
+
+	wait := slot.Sub(now)
+	if wait <= 0 {
+		return nil
+	}
+
+	select {
+	case <-l.after(wait):
+		return nil
+	case <-ctx.Done():
+		// the token is given back if no one reserved the next one
+		l.mu.Lock()
+		if l.next.Equal(slot.Add(l.interval)) {
+			l.next = slot
+		}
+		l.mu.Unlock()
+
+		return ctx.Err()
+	}
+}
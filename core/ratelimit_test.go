@@ -0,0 +1,104 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteRateLimit struct{}
+
+var _ = Suite(&SuiteRateLimit{})
+
+// fakeClock is the clock of a limiter, its timers fire right away unless
+// blocked and record the durations waited for
+type fakeClock struct {
+	now     time.Time
+	waits   []time.Duration
+	blocked bool
+}
+
+func (f *fakeClock) limiter(perSecond float64) *RateLimiter {
+	l := NewRateLimiter(perSecond)
+	l.now = func() time.Time { return f.now }
+	l.after = func(d time.Duration) <-chan time.Time {
+		f.waits = append(f.waits, d)
+		ch := make(chan time.Time, 1)
+		if !f.blocked {
+			ch <- f.now.Add(d)
+		}
+		return ch
+	}
+
+	return l
+}
+
+func (s *SuiteRateLimit) TestWait(c *C) {
+	clock := &fakeClock{now: time.Date(2025, 6, 1, 2, 0, 0, 0, time.UTC)}
+	l := clock.limiter(2)
+
+	// rapid creates, all made at the same time
+	for i := 0; i < 5; i++ {
+		c.Assert(l.Wait(context.Background()), IsNil)
+	}
+
+	c.Assert(clock.waits, DeepEquals, []time.Duration{
+		500 * time.Millisecond, time.Second, 1500 * time.Millisecond, 2 * time.Second,
+	})
+
+	// the tokens are refilled meanwhile, not accumulated
+	clock.waits = nil
+	clock.now = clock.now.Add(time.Minute)
+	c.Assert(l.Wait(context.Background()), IsNil)
+	c.Assert(l.Wait(context.Background()), IsNil)
+	c.Assert(clock.waits, DeepEquals, []time.Duration{500 * time.Millisecond})
+}
+
+func (s *SuiteRateLimit) TestWaitCancelled(c *C) {
+	clock := &fakeClock{now: time.Date(2025, 6, 1, 2, 0, 0, 0, time.UTC)}
+	l := clock.limiter(1)
+	c.Assert(l.Wait(context.Background()), IsNil)
+
+	clock.blocked = true
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.Assert(l.Wait(ctx), Equals, context.Canceled)
+
+	// the cancelled operation gave its turn back
+	clock.blocked = false
+	c.Assert(l.Wait(context.Background()), IsNil)
+	c.Assert(clock.waits, DeepEquals, []time.Duration{time.Second, time.Second})
+}
+
+func (s *SuiteRateLimit) TestUnlimited(c *C) {
+	c.Assert(NewRateLimiter(0), IsNil)
+	c.Assert(NewRateLimiter(-1), IsNil)
+
+	var l *RateLimiter
+	c.Assert(l.Wait(context.Background()), IsNil)
+}
+
+func (s *SuiteRateLimit) TestWaitDockerOp(c *C) {
+	clock := &fakeClock{now: time.Date(2025, 6, 1, 2, 0, 0, 0, time.UTC)}
+	options := &DockerOptions{Limiter: clock.limiter(10)}
+
+	job := &TestJob{}
+	ctx := NewContext(NewScheduler(&TestLogger{}), job, NewExecution())
+	for i := 0; i < 3; i++ {
+		c.Assert(options.waitOp(ctx), IsNil)
+	}
+
+	c.Assert(clock.waits, DeepEquals, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond})
+
+	// the options of another client have their own limiter, and none
+	// without the options
+	other := &DockerOptions{Limiter: clock.limiter(10)}
+	c.Assert(other.waitOp(ctx), IsNil)
+	c.Assert((*DockerOptions)(nil).waitOp(ctx), IsNil)
+	c.Assert(clock.waits, HasLen, 2)
+
+	clock.blocked = true
+	ctx.Cancel()
+	c.Assert(options.waitOp(ctx), Equals, context.Canceled)
+}
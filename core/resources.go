@@ -0,0 +1,687 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+var (
+	ErrInvalidMemory    = errors.New("invalid memory value")
+	ErrUnknownSignal    = errors.New("unknown stop signal")
+	ErrInvalidHost      = errors.New("invalid extra host, expected host:ip")
+	ErrInvalidLabel     = errors.New("invalid container label, expected key=value")
+	ErrReservedLabel    = errors.New("container labels with the ofelia prefix are reserved")
+	ErrInvalidPlatform  = errors.New("invalid platform, expected os/arch[/variant]")
+	ErrUnknownCap       = errors.New("unknown capability")
+	ErrInvalidTmpfs     = errors.New("invalid tmpfs, expected an absolute path with optional options")
+	ErrInvalidDevice    = errors.New("invalid device, expected host[:container][:permissions]")
+	ErrInvalidGPUs      = errors.New("invalid gpus, expected all, a count or device=ids")
+	ErrInvalidUlimit    = errors.New("invalid ulimit, expected name=soft[:hard]")
+	ErrInvalidSysctl    = errors.New("invalid sysctl, expected key=value")
+	ErrInvalidIP        = errors.New("invalid ip, expected an IPv4 or IPv6 address")
+	ErrDefaultNetwork   = errors.New("network-aliases and ip require a user-defined network")
+	ErrInvalidSecret    = errors.New("invalid secret file, expected host-path:container-path with absolute paths")
+	ErrInvalidUser      = errors.New("invalid user, expected name, uid, uid:gid or name:group")
+	ErrUnknownLogDriver = errors.New("unknown log driver")
+	ErrInvalidLogOpt    = errors.New("invalid log option, expected key=value")
+	ErrInvalidNetMode   = errors.New("invalid network-mode, expected bridge, host, none or container:<name|id>")
+	ErrNetModeConflict  = errors.New("network-mode conflicts with network")
+)
+
+var memoryUnits = map[string]int64{
+	"":  1,
+	"b": 1,
+	"k": 1 << 10,
+	"m": 1 << 20,
+	"g": 1 << 30,
+}
+
+// ParseMemory converts a human readable memory size, like `512m` or `1.5g`,
+// into bytes. The suffixes `b`, `k`, `m` and `g` are supported, case
+// insensitive and optionally followed by a `b` (e.g. `512mb`). A value of `-1`
+// is accepted as unlimited.
+func ParseMemory(value string) (int64, error) {
+	s := strings.ToLower(strings.TrimSpace(value))
+	if s == "-1" {
+		return -1, nil
+	}
+
+	if len(s) > 1 && strings.HasSuffix(s, "b") {
+		if _, ok := memoryUnits[s[len(s)-2:len(s)-1]]; ok {
+			s = s[:len(s)-1]
+		}
+	}
+
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i == -1 {
+		i = len(s)
+	}
+
+	unit, ok := memoryUnits[s[i:]]
+	if !ok || i == 0 {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidMemory, value)
+	}
+
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidMemory, value)
+	}
+
+	return int64(n * float64(unit)), nil
+}
+
+// parseCPUs converts a number of CPUs, like `1.5`, into nano CPUs
+func parseCPUs(value string) (int64, error) {
+	n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid cpus value: %q", value)
+	}
+
+	return int64(n * 1e9), nil
+}
+
+// stopSignals are the signals accepted by stop-signal
+var stopSignals = map[string]docker.Signal{
+	"SIGHUP":   docker.SIGHUP,
+	"SIGINT":   docker.SIGINT,
+	"SIGQUIT":  docker.SIGQUIT,
+	"SIGKILL":  docker.SIGKILL,
+	"SIGUSR1":  docker.SIGUSR1,
+	"SIGUSR2":  docker.SIGUSR2,
+	"SIGTERM":  docker.SIGTERM,
+	"SIGWINCH": docker.SIGWINCH,
+}
+
+// parseStopSignal parses a signal name such as `SIGINT` or `int`, an empty
+// value returns 0
+func parseStopSignal(value string) (docker.Signal, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	name := strings.ToUpper(value)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+
+	signal, ok := stopSignals[name]
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrUnknownSignal, value)
+	}
+
+	return signal, nil
+}
+
+// capabilities are the Linux capabilities accepted by cap-add and cap-drop
+var capabilities = map[string]bool{
+	"CAP_AUDIT_CONTROL":      true,
+	"CAP_AUDIT_READ":         true,
+	"CAP_AUDIT_WRITE":        true,
+	"CAP_BLOCK_SUSPEND":      true,
+	"CAP_BPF":                true,
+	"CAP_CHECKPOINT_RESTORE": true,
+	"CAP_CHOWN":              true,
+	"CAP_DAC_OVERRIDE":       true,
+	"CAP_DAC_READ_SEARCH":    true,
+	"CAP_FOWNER":             true,
+	"CAP_FSETID":             true,
+	"CAP_IPC_LOCK":           true,
+	"CAP_IPC_OWNER":          true,
+	"CAP_KILL":               true,
+	"CAP_LEASE":              true,
+	"CAP_LINUX_IMMUTABLE":    true,
+	"CAP_MAC_ADMIN":          true,
+	"CAP_MAC_OVERRIDE":       true,
+	"CAP_MKNOD":              true,
+	"CAP_NET_ADMIN":          true,
+	"CAP_NET_BIND_SERVICE":   true,
+	"CAP_NET_BROADCAST":      true,
+	"CAP_NET_RAW":            true,
+	"CAP_PERFMON":            true,
+	"CAP_SETFCAP":            true,
+	"CAP_SETGID":             true,
+	"CAP_SETPCAP":            true,
+	"CAP_SETUID":             true,
+	"CAP_SYS_ADMIN":          true,
+	"CAP_SYS_BOOT":           true,
+	"CAP_SYS_CHROOT":         true,
+	"CAP_SYS_MODULE":         true,
+	"CAP_SYS_NICE":           true,
+	"CAP_SYS_PACCT":          true,
+	"CAP_SYS_PTRACE":         true,
+	"CAP_SYS_RAWIO":          true,
+	"CAP_SYS_RESOURCE":       true,
+	"CAP_SYS_TIME":           true,
+	"CAP_SYS_TTY_CONFIG":     true,
+	"CAP_SYSLOG":             true,
+	"CAP_WAKE_ALARM":         true,
+}
+
+// capAll adds or drops all the capabilities
+const capAll = "ALL"
+
+// parseCapabilities normalizes capability names such as `net_admin` or
+// `CAP_NET_ADMIN` to the `CAP_NET_ADMIN` form, `ALL` is kept as is
+func parseCapabilities(values []string) ([]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	caps := make([]string, 0, len(values))
+	for _, v := range values {
+		name := strings.ToUpper(strings.TrimSpace(v))
+		if name != capAll && !strings.HasPrefix(name, "CAP_") {
+			name = "CAP_" + name
+		}
+
+		if name != capAll && !capabilities[name] {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownCap, v)
+		}
+
+		caps = append(caps, name)
+	}
+
+	return caps, nil
+}
+
+// parseTmpfs parses tmpfs entries in the `path[:options]` form, like
+// `/tmp:rw,size=64m`, into the mounts expected by the HostConfig
+func parseTmpfs(entries []string) (map[string]string, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	mounts := make(map[string]string, len(entries))
+	for _, e := range entries {
+		p, options, _ := strings.Cut(e, ":")
+		if !path.IsAbs(p) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidTmpfs, e)
+		}
+
+		if err := validateTmpfsOptions(options); err != nil {
+			return nil, fmt.Errorf("%w: %q: %s", ErrInvalidTmpfs, e, err)
+		}
+
+		mounts[p] = options
+	}
+
+	return mounts, nil
+}
+
+// tmpfsFlags are the mount flags accepted by the tmpfs options
+var tmpfsFlags = map[string]bool{
+	"rw": true, "ro": true, "exec": true, "noexec": true, "suid": true, "nosuid": true,
+	"dev": true, "nodev": true, "sync": true, "async": true, "dirsync": true,
+	"atime": true, "noatime": true, "diratime": true, "nodiratime": true,
+	"relatime": true, "norelatime": true, "strictatime": true, "nostrictatime": true,
+	"mand": true, "nomand": true, "tmpcopyup": true, "notmpcopyup": true,
+}
+
+// validateTmpfsOptions checks the comma separated options of a tmpfs: the
+// mount flags, the size, e.g. `64m`, the mode in octal, e.g. `1777`, the
+// uid, gid and nr_inodes
+func validateTmpfsOptions(options string) error {
+	if options == "" {
+		return nil
+	}
+
+	for _, o := range strings.Split(options, ",") {
+		key, value, hasValue := strings.Cut(o, "=")
+		if !hasValue {
+			if !tmpfsFlags[key] {
+				return fmt.Errorf("unknown option %q", o)
+			}
+
+			continue
+		}
+
+		var err error
+		switch key {
+		case "size":
+			var size int64
+			if size, err = ParseMemory(value); err == nil && size <= 0 {
+				err = errors.New("expected a positive size")
+			}
+		case "mode":
+			_, err = strconv.ParseUint(value, 8, 12)
+		case "uid", "gid":
+			_, err = strconv.ParseUint(value, 10, 32)
+		case "nr_inodes":
+			var n int64
+			if n, err = ParseMemory(value); err == nil && n < 0 {
+				err = errors.New("expected a positive number")
+			}
+		default:
+			return fmt.Errorf("unknown option %q", o)
+		}
+
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: %w", key, value, err)
+		}
+	}
+
+	return nil
+}
+
+// hostGateway is resolved by Docker to the IP of the host
+const hostGateway = "host-gateway"
+
+// parseExtraHost splits an extra host entry in the `host:ip` form, like
+// `docker run --add-host`
+func parseExtraHost(entry string) (host, ip string, err error) {
+	host, ip, ok := strings.Cut(entry, ":")
+	if !ok || host == "" || (ip != hostGateway && net.ParseIP(ip) == nil) {
+		return "", "", fmt.Errorf("%w: %q", ErrInvalidHost, entry)
+	}
+
+	return host, ip, nil
+}
+
+func validateExtraHosts(entries []string) error {
+	for _, e := range entries {
+		if _, _, err := parseExtraHost(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reservedLabelPrefix is the prefix of the labels read by Ofelia, a created
+// container carrying them could be taken for a job configuration
+const reservedLabelPrefix = "ofelia."
+
+// parseLabels converts `key=value` entries into a labels map, an entry
+// without `=` is a label with an empty value
+func parseLabels(entries []string) (map[string]string, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	labels := make(map[string]string, len(entries))
+	for _, e := range entries {
+		key, value, _ := strings.Cut(e, "=")
+		key = strings.TrimSpace(key)
+		if key == "" {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidLabel, e)
+		}
+
+		if strings.HasPrefix(key, reservedLabelPrefix) {
+			return nil, fmt.Errorf("%w: %q", ErrReservedLabel, key)
+		}
+
+		labels[key] = value
+	}
+
+	return labels, nil
+}
+
+var platformPattern = regexp.MustCompile(`^[a-z0-9_]+/[a-z0-9_]+(/[a-z0-9_.]+)?$`)
+
+// validatePlatform checks the `os/arch[/variant]` format of a platform
+func validatePlatform(platform string) error {
+	if platform != "" && !platformPattern.MatchString(platform) {
+		return fmt.Errorf("%w: %q", ErrInvalidPlatform, platform)
+	}
+
+	return nil
+}
+
+// devicePermissions are the cgroup permissions given to a device when not
+// set, read, write and mknod
+const devicePermissions = "rwm"
+
+// parseDevices parses device entries in the `host[:container][:permissions]`
+// form, like `docker run --device`, the device is mapped to the same path
+// in the container with all the permissions by default
+func parseDevices(entries []string) ([]docker.Device, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	devices := make([]docker.Device, 0, len(entries))
+	for _, e := range entries {
+		parts := strings.Split(e, ":")
+		d := docker.Device{PathOnHost: parts[0], CgroupPermissions: devicePermissions}
+		switch len(parts) {
+		case 1:
+			d.PathInContainer = d.PathOnHost
+		case 2:
+			if validDevicePermissions(parts[1]) {
+				d.PathInContainer, d.CgroupPermissions = d.PathOnHost, parts[1]
+			} else {
+				d.PathInContainer = parts[1]
+			}
+		case 3:
+			d.PathInContainer, d.CgroupPermissions = parts[1], parts[2]
+		default:
+			return nil, fmt.Errorf("%w: %q", ErrInvalidDevice, e)
+		}
+
+		if !path.IsAbs(d.PathOnHost) || !path.IsAbs(d.PathInContainer) || !validDevicePermissions(d.CgroupPermissions) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidDevice, e)
+		}
+
+		devices = append(devices, d)
+	}
+
+	return devices, nil
+}
+
+// validDevicePermissions reports whether p is made of the `r`, `w` and `m`
+// permissions, each at most once
+func validDevicePermissions(p string) bool {
+	if p == "" || len(p) > len(devicePermissions) {
+		return false
+	}
+
+	for i, r := range p {
+		if !strings.ContainsRune(devicePermissions, r) || strings.ContainsRune(p[i+1:], r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseGPUs parses a GPU request like `docker run --gpus`: `all`, a number
+// of GPUs or comma separated `count=`, `device=`, `driver=` and
+// `capabilities=` options, e.g. `device=0,1` or `driver=nvidia,count=2`.
+// The values following `device=` or `capabilities=` without a `=` are
+// added to their list.
+func parseGPUs(spec string) ([]docker.DeviceRequest, error) {
+	if spec == "" {
+		return nil, nil
+	}
+
+	invalid := fmt.Errorf("%w: %q", ErrInvalidGPUs, spec)
+	req := docker.DeviceRequest{}
+	var caps []string
+	if spec == "all" {
+		req.Count = -1
+	} else if n, err := strconv.Atoi(spec); err == nil {
+		if n <= 0 {
+			return nil, invalid
+		}
+
+		req.Count = n
+	} else {
+		var list *[]string
+		for _, field := range strings.Split(spec, ",") {
+			key, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+			if !ok {
+				if list == nil || key == "" {
+					return nil, invalid
+				}
+
+				*list = append(*list, key)
+				continue
+			}
+
+			list = nil
+			switch key {
+			case "count":
+				if value == "all" {
+					req.Count = -1
+				} else if req.Count, err = strconv.Atoi(value); err != nil || req.Count <= 0 {
+					return nil, invalid
+				}
+			case "device":
+				req.DeviceIDs, list = append(req.DeviceIDs, value), &req.DeviceIDs
+			case "driver":
+				req.Driver = value
+			case "capabilities":
+				caps, list = append(caps, value), &caps
+			default:
+				return nil, invalid
+			}
+		}
+
+		if (req.Count != 0) == (len(req.DeviceIDs) != 0) {
+			return nil, invalid
+		}
+	}
+
+	if len(caps) == 0 {
+		caps = []string{"gpu"}
+	}
+
+	req.Capabilities = [][]string{caps}
+	return []docker.DeviceRequest{req}, nil
+}
+
+// ulimits are the resource limits that can be set on a container
+var ulimits = map[string]bool{
+	"core": true, "cpu": true, "data": true, "fsize": true, "locks": true,
+	"memlock": true, "msgqueue": true, "nice": true, "nofile": true,
+	"nproc": true, "rss": true, "rtprio": true, "rttime": true,
+	"sigpending": true, "stack": true,
+}
+
+// parseUlimit parses a ulimit in the `name=soft[:hard]` form, like
+// `docker run --ulimit`, e.g. `nofile=1024:2048`. The hard limit is the soft
+// one when not set and `-1` means unlimited.
+func parseUlimit(entry string) (docker.ULimit, error) {
+	invalid := fmt.Errorf("%w: %q", ErrInvalidUlimit, entry)
+	name, limits, ok := strings.Cut(entry, "=")
+	if !ok || !ulimits[name] {
+		return docker.ULimit{}, invalid
+	}
+
+	soft, hard, hasHard := strings.Cut(limits, ":")
+	if !hasHard {
+		hard = soft
+	}
+
+	u := docker.ULimit{Name: name}
+	var err error
+	if u.Soft, err = strconv.ParseInt(soft, 10, 64); err != nil || u.Soft < -1 {
+		return docker.ULimit{}, invalid
+	}
+
+	if u.Hard, err = strconv.ParseInt(hard, 10, 64); err != nil || u.Hard < -1 {
+		return docker.ULimit{}, invalid
+	}
+
+	if u.Hard != -1 && (u.Soft == -1 || u.Soft > u.Hard) {
+		return docker.ULimit{}, fmt.Errorf("%w: %q, the soft limit exceeds the hard one", ErrInvalidUlimit, entry)
+	}
+
+	return u, nil
+}
+
+func parseUlimits(entries []string) ([]docker.ULimit, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	limits := make([]docker.ULimit, 0, len(entries))
+	for _, e := range entries {
+		u, err := parseUlimit(e)
+		if err != nil {
+			return nil, err
+		}
+
+		limits = append(limits, u)
+	}
+
+	return limits, nil
+}
+
+// parseSysctls converts `key=value` entries, like
+// `net.core.somaxconn=1024`, into the sysctls map of the HostConfig
+func parseSysctls(entries []string) (map[string]string, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	sysctls := make(map[string]string, len(entries))
+	for _, e := range entries {
+		key, value, ok := strings.Cut(e, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidSysctl, e)
+		}
+
+		sysctls[key] = value
+	}
+
+	return sysctls, nil
+}
+
+// logDrivers are the log drivers accepted for the job containers
+var logDrivers = map[string]bool{
+	"json-file": true,
+	"journald":  true,
+	"syslog":    true,
+	"fluentd":   true,
+	"none":      true,
+}
+
+// parseLogConfig converts a log driver and its `key=value` options, like
+// `docker run --log-driver --log-opt`, into the LogConfig of the HostConfig.
+// Without driver the options are given to the default driver of the daemon.
+func parseLogConfig(driver string, opts []string) (docker.LogConfig, error) {
+	if driver != "" && !logDrivers[driver] {
+		return docker.LogConfig{}, fmt.Errorf("%w: %q", ErrUnknownLogDriver, driver)
+	}
+
+	if driver == "none" && len(opts) > 0 {
+		return docker.LogConfig{}, fmt.Errorf("%w: the none driver takes no options", ErrInvalidLogOpt)
+	}
+
+	lc := docker.LogConfig{Type: driver}
+	for _, o := range opts {
+		key, value, ok := strings.Cut(o, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return docker.LogConfig{}, fmt.Errorf("%w: %q", ErrInvalidLogOpt, o)
+		}
+
+		if lc.Config == nil {
+			lc.Config = make(map[string]string, len(opts))
+		}
+
+		lc.Config[key] = value
+	}
+
+	return lc, nil
+}
+
+// parseSecretFiles converts `host:container` entries, like
+// `/etc/secrets/db:/run/secrets/db`, into read-only binds with clean paths
+func parseSecretFiles(entries []string) ([]string, error) {
+	var binds []string
+	for _, e := range entries {
+		host, container, ok := strings.Cut(e, ":")
+		if !ok || !path.IsAbs(host) || !path.IsAbs(container) || strings.Contains(container, ":") {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidSecret, e)
+		}
+
+		binds = append(binds, path.Clean(host)+":"+path.Clean(container)+":ro")
+	}
+
+	return binds, nil
+}
+
+// userName matches the user and group names, which can't start with a dash
+var userName = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*\$?$`)
+
+// validateUser checks the `user[:group]` format of a user, like
+// `docker run --user`, each part being a name or a numeric id. An empty user
+// is the one of the image.
+func validateUser(user string) error {
+	if user == "" {
+		return nil
+	}
+
+	parts := strings.Split(user, ":")
+	if len(parts) > 2 {
+		return fmt.Errorf("%w: %q", ErrInvalidUser, user)
+	}
+
+	for _, part := range parts {
+		if !userName.MatchString(part) {
+			return fmt.Errorf("%w: %q", ErrInvalidUser, user)
+		}
+
+		// the ids have to fit the 32 bits of a uid or gid
+		if strings.Trim(part, "0123456789") == "" {
+			if _, err := strconv.ParseUint(part, 10, 32); err != nil {
+				return fmt.Errorf("%w: %q", ErrInvalidUser, user)
+			}
+		}
+	}
+
+	return nil
+}
+
+// IsRootUser reports whether the user, in the `user[:group]` format, is root
+// by name or by uid
+func IsRootUser(user string) bool {
+	name, _, _ := strings.Cut(user, ":")
+	return name == "root" || (name != "" && strings.Trim(name, "0") == "")
+}
+
+// defaultNetworks are the networks created by Docker, they support neither
+// aliases nor static addresses
+var defaultNetworks = map[string]bool{"": true, "default": true, "bridge": true, "host": true, "none": true}
+
+// parseNetworkMode checks a network mode, like `docker run --network`
+// given a driver or a container, which can't be combined with a network
+// the container is connected to
+func parseNetworkMode(mode, network string) (string, error) {
+	switch {
+	case mode == "":
+		return "", nil
+	case mode == "bridge" || mode == "host" || mode == "none":
+	case strings.HasPrefix(mode, "container:"):
+		if strings.TrimSpace(strings.TrimPrefix(mode, "container:")) == "" {
+			return "", fmt.Errorf("%w: %q", ErrInvalidNetMode, mode)
+		}
+	default:
+		return "", fmt.Errorf("%w: %q", ErrInvalidNetMode, mode)
+	}
+
+	if network != "" && mode != "bridge" {
+		return "", fmt.Errorf("%w: %q and %q", ErrNetModeConflict, mode, network)
+	}
+
+	return mode, nil
+}
+
+// endpointConfig builds the settings of the container in the network, its
+// aliases and its static address, nil if there are none
+func endpointConfig(network string, aliases []string, ip string) (*docker.EndpointConfig, error) {
+	if len(aliases) == 0 && ip == "" {
+		return nil, nil
+	}
+
+	if defaultNetworks[network] || strings.HasPrefix(network, "container:") {
+		return nil, fmt.Errorf("%w, not %q", ErrDefaultNetwork, network)
+	}
+
+	c := &docker.EndpointConfig{Aliases: aliases}
+	if ip != "" {
+		addr := net.ParseIP(ip)
+		switch {
+		case addr == nil:
+			return nil, fmt.Errorf("%w: %q", ErrInvalidIP, ip)
+		case addr.To4() != nil:
+			c.IPAMConfig = &docker.EndpointIPAMConfig{IPv4Address: ip}
+		default:
+			c.IPAMConfig = &docker.EndpointIPAMConfig{IPv6Address: ip}
+		}
+	}
+
+	return c, nil
+}
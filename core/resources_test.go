@@ -0,0 +1,364 @@
+package core
+
+import (
+	"fmt"
+
+	docker "github.com/fsouza/go-dockerclient"
+	. "gopkg.in/check.v1"
+)
+
+type SuiteResources struct{}
+
+var _ = Suite(&SuiteResources{})
+
+func (s *SuiteResources) TestParseMemory(c *C) {
+	testcases := map[string]int64{
+		"1024": 1024,
+		"512b": 512,
+		"1k":   1024,
+		"1K":   1024,
+		"1kb":  1024,
+		"512m": 512 * 1024 * 1024,
+		"512M": 512 * 1024 * 1024,
+		"2g":   2 * 1024 * 1024 * 1024,
+		"1.5g": 1536 * 1024 * 1024,
+		"2GB":  2 * 1024 * 1024 * 1024,
+		"-1":   -1,
+	}
+
+	for value, expected := range testcases {
+		n, err := ParseMemory(value)
+		c.Assert(err, IsNil, Commentf("value %q", value))
+		c.Assert(n, Equals, expected, Commentf("value %q", value))
+	}
+}
+
+func (s *SuiteResources) TestParseMemoryInvalid(c *C) {
+	for _, value := range []string{"", "m", "kb", "foo", "12x", "1.2.3m", "-5m", "5mm"} {
+		_, err := ParseMemory(value)
+		c.Assert(err, ErrorMatches, "invalid memory value.*", Commentf("value %q", value))
+	}
+}
+
+func (s *SuiteResources) TestParseCPUs(c *C) {
+	n, err := parseCPUs("1.5")
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, int64(1500000000))
+
+	for _, value := range []string{"", "foo", "0", "-1"} {
+		_, err := parseCPUs(value)
+		c.Assert(err, NotNil, Commentf("value %q", value))
+	}
+}
+
+func (s *SuiteResources) TestParseStopSignal(c *C) {
+	testcases := map[string]docker.Signal{
+		"":        0,
+		"SIGINT":  docker.SIGINT,
+		"sigterm": docker.SIGTERM,
+		"QUIT":    docker.SIGQUIT,
+		"usr1":    docker.SIGUSR1,
+	}
+
+	for value, expected := range testcases {
+		signal, err := parseStopSignal(value)
+		c.Assert(err, IsNil, Commentf("value %q", value))
+		c.Assert(signal, Equals, expected, Commentf("value %q", value))
+	}
+
+	_, err := parseStopSignal("SIGFOO")
+	c.Assert(err, ErrorMatches, `unknown stop signal: "SIGFOO"`)
+}
+
+func (s *SuiteResources) TestParseExtraHost(c *C) {
+	host, ip, err := parseExtraHost("db:10.0.0.2")
+	c.Assert(err, IsNil)
+	c.Assert(host, Equals, "db")
+	c.Assert(ip, Equals, "10.0.0.2")
+
+	host, ip, err = parseExtraHost("db6:2001:db8::1")
+	c.Assert(err, IsNil)
+	c.Assert(host, Equals, "db6")
+	c.Assert(ip, Equals, "2001:db8::1")
+
+	_, ip, err = parseExtraHost("docker:host-gateway")
+	c.Assert(err, IsNil)
+	c.Assert(ip, Equals, hostGateway)
+
+	for _, entry := range []string{"db", "db:", ":10.0.0.2", "db:foo", "10.0.0.2 db"} {
+		_, _, err := parseExtraHost(entry)
+		c.Assert(err, ErrorMatches, "invalid extra host.*", Commentf("entry %q", entry))
+	}
+}
+
+func (s *SuiteResources) TestParseLabels(c *C) {
+	labels, err := parseLabels(nil)
+	c.Assert(err, IsNil)
+	c.Assert(labels, IsNil)
+
+	labels, err = parseLabels([]string{"team=ops", "cost-center=42", "temporary", "url=http://a?b=c"})
+	c.Assert(err, IsNil)
+	c.Assert(labels, DeepEquals, map[string]string{
+		"team":        "ops",
+		"cost-center": "42",
+		"temporary":   "",
+		"url":         "http://a?b=c",
+	})
+
+	_, err = parseLabels([]string{"=foo"})
+	c.Assert(err, ErrorMatches, "invalid container label.*")
+
+	_, err = parseLabels([]string{"ofelia.enabled=true"})
+	c.Assert(err, ErrorMatches, "container labels with the ofelia prefix are reserved.*")
+}
+
+func (s *SuiteResources) TestValidatePlatform(c *C) {
+	for _, p := range []string{"", "linux/amd64", "linux/arm64/v8", "windows/amd64", "linux/arm/v7"} {
+		c.Assert(validatePlatform(p), IsNil, Commentf("platform %q", p))
+	}
+
+	for _, p := range []string{"linux", "linux/", "/amd64", "Linux/AMD64", "linux/arm/v7/extra", "linux amd64"} {
+		c.Assert(validatePlatform(p), ErrorMatches, "invalid platform.*", Commentf("platform %q", p))
+	}
+}
+
+func (s *SuiteResources) TestParseCapabilities(c *C) {
+	caps, err := parseCapabilities(nil)
+	c.Assert(err, IsNil)
+	c.Assert(caps, IsNil)
+
+	caps, err = parseCapabilities([]string{"all", "net_admin", "CAP_SYS_TIME", "Cap_Chown"})
+	c.Assert(err, IsNil)
+	c.Assert(caps, DeepEquals, []string{"ALL", "CAP_NET_ADMIN", "CAP_SYS_TIME", "CAP_CHOWN"})
+
+	_, err = parseCapabilities([]string{"NET_ADMIN", "FOO"})
+	c.Assert(err, ErrorMatches, `unknown capability: "FOO"`)
+}
+
+func (s *SuiteResources) TestParseTmpfs(c *C) {
+	mounts, err := parseTmpfs(nil)
+	c.Assert(err, IsNil)
+	c.Assert(mounts, IsNil)
+
+	mounts, err = parseTmpfs([]string{"/tmp:rw,noexec,size=64m", "/run"})
+	c.Assert(err, IsNil)
+	c.Assert(mounts, DeepEquals, map[string]string{"/tmp": "rw,noexec,size=64m", "/run": ""})
+
+	mounts, err = parseTmpfs([]string{"/scratch:size=1.5g,mode=1777,uid=1000,gid=1000,nr_inodes=10k,nosuid"})
+	c.Assert(err, IsNil)
+	c.Assert(mounts, DeepEquals, map[string]string{"/scratch": "size=1.5g,mode=1777,uid=1000,gid=1000,nr_inodes=10k,nosuid"})
+
+	for _, entry := range []string{"", "tmp", ":size=1m"} {
+		_, err = parseTmpfs([]string{entry})
+		c.Assert(err, ErrorMatches, "invalid tmpfs.*", Commentf("entry %q", entry))
+	}
+
+	for entry, reason := range map[string]string{
+		"/tmp:size=big":        `invalid size "big".*`,
+		"/tmp:size=0":          `invalid size "0": expected a positive size`,
+		"/tmp:size=-1":         `invalid size "-1": expected a positive size`,
+		"/tmp:mode=999":        `invalid mode "999".*`,
+		"/tmp:mode=17777":      `invalid mode "17777".*`,
+		"/tmp:uid=-1":          `invalid uid "-1".*`,
+		"/tmp:rw,,size=1m":     `unknown option ""`,
+		"/tmp:noexex":          `unknown option "noexex"`,
+		"/tmp:sizes=1m":        `unknown option "sizes=1m"`,
+		"/tmp:nr_inodes=a_lot": `invalid nr_inodes "a_lot".*`,
+	} {
+		_, err = parseTmpfs([]string{entry})
+		c.Assert(err, ErrorMatches, fmt.Sprintf("invalid tmpfs.*: %q: %s", entry, reason), Commentf("entry %q", entry))
+	}
+}
+
+func (s *SuiteResources) TestParseDevices(c *C) {
+	devices, err := parseDevices(nil)
+	c.Assert(err, IsNil)
+	c.Assert(devices, IsNil)
+
+	devices, err = parseDevices([]string{"/dev/nvidia0", "/dev/sda:/dev/xvda", "/dev/fuse:rw", "/dev/snd:/dev/audio:r"})
+	c.Assert(err, IsNil)
+	c.Assert(devices, DeepEquals, []docker.Device{
+		{PathOnHost: "/dev/nvidia0", PathInContainer: "/dev/nvidia0", CgroupPermissions: "rwm"},
+		{PathOnHost: "/dev/sda", PathInContainer: "/dev/xvda", CgroupPermissions: "rwm"},
+		{PathOnHost: "/dev/fuse", PathInContainer: "/dev/fuse", CgroupPermissions: "rw"},
+		{PathOnHost: "/dev/snd", PathInContainer: "/dev/audio", CgroupPermissions: "r"},
+	})
+
+	for _, entry := range []string{"", "dev/sda", "/dev/sda:xvda", "/dev/sda:/dev/xvda:rx", "/dev/sda:/dev/xvda:rr", "/dev/sda:/dev/xvda:r:w"} {
+		_, err = parseDevices([]string{entry})
+		c.Assert(err, ErrorMatches, "invalid device.*", Commentf("entry %q", entry))
+	}
+}
+
+func (s *SuiteResources) TestParseGPUs(c *C) {
+	requests, err := parseGPUs("")
+	c.Assert(err, IsNil)
+	c.Assert(requests, IsNil)
+
+	gpu := [][]string{{"gpu"}}
+	for spec, expected := range map[string]docker.DeviceRequest{
+		"all":                               {Count: -1, Capabilities: gpu},
+		"2":                                 {Count: 2, Capabilities: gpu},
+		"count=all":                         {Count: -1, Capabilities: gpu},
+		"device=0,1":                        {DeviceIDs: []string{"0", "1"}, Capabilities: gpu},
+		"device=GPU-3a23c669":               {DeviceIDs: []string{"GPU-3a23c669"}, Capabilities: gpu},
+		"driver=nvidia,count=1":             {Driver: "nvidia", Count: 1, Capabilities: gpu},
+		"device=0,capabilities=gpu,utility": {DeviceIDs: []string{"0"}, Capabilities: [][]string{{"gpu", "utility"}}},
+	} {
+		requests, err = parseGPUs(spec)
+		c.Assert(err, IsNil, Commentf("spec %q", spec))
+		c.Assert(requests, DeepEquals, []docker.DeviceRequest{expected}, Commentf("spec %q", spec))
+	}
+
+	for _, spec := range []string{"some", "0", "-1", "count=0", "count=2,device=0", "driver=nvidia", "0,1", "device=0,,1", "vendor=amd"} {
+		_, err = parseGPUs(spec)
+		c.Assert(err, ErrorMatches, "invalid gpus.*", Commentf("spec %q", spec))
+	}
+}
+
+func (s *SuiteResources) TestParseUlimit(c *C) {
+	for entry, expected := range map[string]docker.ULimit{
+		"nofile=1024:2048": {Name: "nofile", Soft: 1024, Hard: 2048},
+		"nproc=512":        {Name: "nproc", Soft: 512, Hard: 512},
+		"memlock=-1:-1":    {Name: "memlock", Soft: -1, Hard: -1},
+		"core=0:-1":        {Name: "core", Soft: 0, Hard: -1},
+	} {
+		u, err := parseUlimit(entry)
+		c.Assert(err, IsNil, Commentf("entry %q", entry))
+		c.Assert(u, DeepEquals, expected, Commentf("entry %q", entry))
+	}
+
+	for _, entry := range []string{"", "nofile", "files=1024", "nofile=", "nofile=a:b", "nofile=1024:", "nofile=-2", "nofile=1:2:3"} {
+		_, err := parseUlimit(entry)
+		c.Assert(err, ErrorMatches, "invalid ulimit.*", Commentf("entry %q", entry))
+	}
+
+	_, err := parseUlimit("nofile=2048:1024")
+	c.Assert(err, ErrorMatches, `invalid ulimit.*: "nofile=2048:1024", the soft limit exceeds the hard one`)
+}
+
+func (s *SuiteResources) TestParseSysctls(c *C) {
+	sysctls, err := parseSysctls(nil)
+	c.Assert(err, IsNil)
+	c.Assert(sysctls, IsNil)
+
+	sysctls, err = parseSysctls([]string{"net.core.somaxconn=1024", "net.ipv4.ip_forward=1", "kernel.msgmax="})
+	c.Assert(err, IsNil)
+	c.Assert(sysctls, DeepEquals, map[string]string{
+		"net.core.somaxconn":  "1024",
+		"net.ipv4.ip_forward": "1",
+		"kernel.msgmax":       "",
+	})
+
+	for _, entry := range []string{"", "net.core.somaxconn", "=1", "net core=1"} {
+		_, err = parseSysctls([]string{entry})
+		c.Assert(err, ErrorMatches, "invalid sysctl.*", Commentf("entry %q", entry))
+	}
+}
+
+func (s *SuiteResources) TestParseLogConfig(c *C) {
+	lc, err := parseLogConfig("", nil)
+	c.Assert(err, IsNil)
+	c.Assert(lc, DeepEquals, docker.LogConfig{})
+
+	lc, err = parseLogConfig("fluentd", []string{"fluentd-address=localhost:24224", "tag=ofelia.{{.Name}}"})
+	c.Assert(err, IsNil)
+	c.Assert(lc, DeepEquals, docker.LogConfig{Type: "fluentd", Config: map[string]string{
+		"fluentd-address": "localhost:24224",
+		"tag":             "ofelia.{{.Name}}",
+	}})
+
+	_, err = parseLogConfig("splunk", nil)
+	c.Assert(err, ErrorMatches, `unknown log driver: "splunk"`)
+
+	_, err = parseLogConfig("none", []string{"max-size=10m"})
+	c.Assert(err, ErrorMatches, "invalid log option.*")
+
+	for _, opt := range []string{"", "max-size", "=10m"} {
+		_, err = parseLogConfig("json-file", []string{opt})
+		c.Assert(err, ErrorMatches, "invalid log option.*", Commentf("option %q", opt))
+	}
+}
+
+func (s *SuiteResources) TestParseNetworkMode(c *C) {
+	for _, mode := range []string{"", "bridge", "host", "none", "container:db"} {
+		m, err := parseNetworkMode(mode, "")
+		c.Assert(err, IsNil)
+		c.Assert(m, Equals, mode)
+	}
+
+	m, err := parseNetworkMode("bridge", "backend")
+	c.Assert(err, IsNil)
+	c.Assert(m, Equals, "bridge")
+
+	for _, mode := range []string{"container:", "container: ", "overlay", "Host"} {
+		_, err = parseNetworkMode(mode, "")
+		c.Assert(err, ErrorMatches, "invalid network-mode.*", Commentf("mode %q", mode))
+	}
+
+	_, err = parseNetworkMode("host", "backend")
+	c.Assert(err, ErrorMatches, `network-mode conflicts with network: "host" and "backend"`)
+}
+
+func (s *SuiteResources) TestParseSecretFiles(c *C) {
+	binds, err := parseSecretFiles(nil)
+	c.Assert(err, IsNil)
+	c.Assert(binds, IsNil)
+
+	binds, err = parseSecretFiles([]string{"/etc/secrets/db:/run/secrets/db", "/etc/secrets/../api//token:/run/secrets/token/"})
+	c.Assert(err, IsNil)
+	c.Assert(binds, DeepEquals, []string{
+		"/etc/secrets/db:/run/secrets/db:ro",
+		"/etc/api/token:/run/secrets/token:ro",
+	})
+
+	for _, entry := range []string{"", "/etc/secrets/db", "secrets/db:/run/secrets/db", "/etc/secrets/db:db", "/etc/secrets/db:/run/secrets/db:rw"} {
+		_, err = parseSecretFiles([]string{entry})
+		c.Assert(err, ErrorMatches, "invalid secret file.*", Commentf("entry %q", entry))
+	}
+}
+
+func (s *SuiteResources) TestValidateUser(c *C) {
+	for _, user := range []string{"", "root", "www-data", "nobody:nogroup", "1000", "1000:1000", "app:1000", "0", "4294967295", "machine$"} {
+		c.Assert(validateUser(user), IsNil, Commentf("user %q", user))
+	}
+
+	for _, user := range []string{":", "1000:", ":1000", "a:b:c", "-u", "john doe", "4294967296", "1000:99999999999", "user:$"} {
+		c.Assert(validateUser(user), ErrorMatches, "invalid user.*", Commentf("user %q", user))
+	}
+}
+
+func (s *SuiteResources) TestIsRootUser(c *C) {
+	for _, user := range []string{"root", "0", "root:www-data", "0:1000", "00"} {
+		c.Assert(IsRootUser(user), Equals, true, Commentf("user %q", user))
+	}
+
+	for _, user := range []string{"", "1000", "rooter", "1000:0", "www-data:root"} {
+		c.Assert(IsRootUser(user), Equals, false, Commentf("user %q", user))
+	}
+}
+
+func (s *SuiteResources) TestEndpointConfig(c *C) {
+	config, err := endpointConfig("bridge", nil, "")
+	c.Assert(err, IsNil)
+	c.Assert(config, IsNil)
+
+	config, err = endpointConfig("backend", []string{"worker", "cron"}, "172.20.0.5")
+	c.Assert(err, IsNil)
+	c.Assert(config, DeepEquals, &docker.EndpointConfig{
+		Aliases:    []string{"worker", "cron"},
+		IPAMConfig: &docker.EndpointIPAMConfig{IPv4Address: "172.20.0.5"},
+	})
+
+	config, err = endpointConfig("backend", nil, "fd00::5")
+	c.Assert(err, IsNil)
+	c.Assert(config, DeepEquals, &docker.EndpointConfig{IPAMConfig: &docker.EndpointIPAMConfig{IPv6Address: "fd00::5"}})
+
+	_, err = endpointConfig("backend", nil, "172.20.0")
+	c.Assert(err, ErrorMatches, `invalid ip.*: "172.20.0"`)
+
+	for _, network := range []string{"", "bridge", "host", "none", "container:db"} {
+		_, err = endpointConfig(network, []string{"worker"}, "")
+		c.Assert(err, ErrorMatches, "network-aliases and ip require a user-defined network.*", Commentf("network %q", network))
+	}
+}
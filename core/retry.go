@@ -0,0 +1,60 @@
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// defaultRetryBackoff is the wait before the first retry of a job
+	// without retry-backoff
+	defaultRetryBackoff = time.Second
+	// defaultRetryMaxBackoff caps the wait between retries of a job without
+	// retry-max-backoff
+	defaultRetryMaxBackoff = time.Minute
+)
+
+// retryAfter is replaced in the tests to not wait for real
+var retryAfter = time.After
+
+// parseRetryBackoff returns the base and max backoff of the job retries
+func parseRetryBackoff(j Job) (base, max time.Duration, err error) {
+	o := j.GetSchedulingOptions()
+	base, max = defaultRetryBackoff, defaultRetryMaxBackoff
+	if v := o.RetryBackoff; v != "" {
+		if base, err = time.ParseDuration(v); err != nil {
+			return 0, 0, fmt.Errorf("invalid retry-backoff %q: %w", v, err)
+		}
+
+		if base < 0 {
+			return 0, 0, fmt.Errorf("invalid retry-backoff %q, can't be negative", v)
+		}
+	}
+
+	if v := o.RetryMaxBackoff; v != "" {
+		if max, err = time.ParseDuration(v); err != nil {
+			return 0, 0, fmt.Errorf("invalid retry-max-backoff %q: %w", v, err)
+		}
+
+		if max < 0 {
+			return 0, 0, fmt.Errorf("invalid retry-max-backoff %q, can't be negative", v)
+		}
+	}
+
+	return base, max, nil
+}
+
+// retryBackoff returns the wait before the given attempt, starting at 1: base
+// doubled on every attempt, capped at max
+func retryBackoff(base, max time.Duration, attempt int) time.Duration {
+	wait := base
+	for i := 1; i < attempt && wait < max; i++ {
+		wait *= 2
+	}
+
+	if wait > max {
+		wait = max
+	}
+
+	return wait
+}
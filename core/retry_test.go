@@ -0,0 +1,124 @@
+package core
+
+import (
+	"fmt"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteRetry struct {
+	waits []time.Duration
+}
+
+var _ = Suite(&SuiteRetry{})
+
+func (s *SuiteRetry) SetUpTest(c *C) {
+	s.waits = nil
+	retryAfter = func(d time.Duration) <-chan time.Time {
+		s.waits = append(s.waits, d)
+		ch := make(chan time.Time, 1)
+		ch <- time.Now()
+		return ch
+	}
+}
+
+func (s *SuiteRetry) TearDownTest(c *C) {
+	retryAfter = time.After
+}
+
+func (s *SuiteRetry) TestRetryUntilSuccess(c *C) {
+	job := &FailingTestJob{Failures: 3}
+	job.Retries = 5
+	job.RetryBackoff = "1s"
+
+	ctx := NewContext(NewScheduler(&TestLogger{}), job, NewExecution())
+	c.Assert(ctx.runJob(), IsNil)
+	c.Assert(job.Called, Equals, 4)
+	c.Assert(s.waits, DeepEquals, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second})
+}
+
+func (s *SuiteRetry) TestRetryExhausted(c *C) {
+	job := &FailingTestJob{Failures: 10}
+	job.Retries = 4
+	job.RetryBackoff = "1s"
+	job.RetryMaxBackoff = "3s"
+
+	ctx := NewContext(NewScheduler(&TestLogger{}), job, NewExecution())
+	c.Assert(ctx.runJob(), ErrorMatches, "failure 5")
+	c.Assert(job.Called, Equals, 5)
+	c.Assert(s.waits, DeepEquals, []time.Duration{
+		time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second,
+	})
+}
+
+func (s *SuiteRetry) TestNoRetries(c *C) {
+	job := &FailingTestJob{Failures: 1}
+
+	ctx := NewContext(NewScheduler(&TestLogger{}), job, NewExecution())
+	c.Assert(ctx.runJob(), NotNil)
+	c.Assert(job.Called, Equals, 1)
+	c.Assert(s.waits, HasLen, 0)
+}
+
+func (s *SuiteRetry) TestRetryCancelledDuringBackoff(c *C) {
+	job := &FailingTestJob{Failures: 10}
+	job.Retries = 5
+
+	ctx := NewContext(NewScheduler(&TestLogger{}), job, NewExecution())
+	retryAfter = func(d time.Duration) <-chan time.Time {
+		ctx.Cancel()
+		return make(chan time.Time)
+	}
+
+	c.Assert(ctx.runJob(), ErrorMatches, "failure 1")
+	c.Assert(job.Called, Equals, 1)
+}
+
+func (s *SuiteRetry) TestRetryBackoff(c *C) {
+	c.Assert(retryBackoff(time.Second, time.Minute, 1), Equals, time.Second)
+	c.Assert(retryBackoff(time.Second, time.Minute, 3), Equals, 4*time.Second)
+	c.Assert(retryBackoff(time.Second, time.Minute, 100), Equals, time.Minute)
+	c.Assert(retryBackoff(time.Minute, time.Second, 1), Equals, time.Second)
+}
+
+func (s *SuiteRetry) TestParseRetryBackoff(c *C) {
+	job := &TestJob{}
+	base, max, err := parseRetryBackoff(job)
+	c.Assert(err, IsNil)
+	c.Assert(base, Equals, defaultRetryBackoff)
+	c.Assert(max, Equals, defaultRetryMaxBackoff)
+
+	job.RetryBackoff = "foo"
+	_, _, err = parseRetryBackoff(job)
+	c.Assert(err, ErrorMatches, "invalid retry-backoff.*")
+
+	job.RetryBackoff = "-1s"
+	_, _, err = parseRetryBackoff(job)
+	c.Assert(err, ErrorMatches, `invalid retry-backoff "-1s", can't be negative`)
+
+	job.RetryBackoff = ""
+	job.RetryMaxBackoff = "foo"
+	_, _, err = parseRetryBackoff(job)
+	c.Assert(err, ErrorMatches, "invalid retry-max-backoff.*")
+
+	job.RetryMaxBackoff = "-1m"
+	_, _, err = parseRetryBackoff(job)
+	c.Assert(err, ErrorMatches, `invalid retry-max-backoff "-1m", can't be negative`)
+}
+
+// FailingTestJob fails the first Failures executions
+type FailingTestJob struct {
+	BareJob
+	Failures int
+	Called   int
+}
+
+func (j *FailingTestJob) Run(ctx *Context) error {
+	j.Called++
+	if j.Called <= j.Failures {
+		return fmt.Errorf("failure %d", j.Called)
+	}
+
+	return nil
+}
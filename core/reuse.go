@@ -0,0 +1,89 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+var (
+	ErrReuseWithContainer     = errors.New("reuse-container needs an image, not a container")
+	ErrReusedContainerRunning = errors.New("the reused container is still running")
+	ErrReusedNameCollision    = errors.New("the reused container belongs to another job")
+)
+
+// ReuseHashLabel is set on the containers kept by the run jobs with
+// reuse-container, with the hash of the options they were created with
+const ReuseHashLabel = reservedLabelPrefix + "config-hash"
+
+// reusedNameInvalid are the characters not allowed in a container name
+var reusedNameInvalid = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+// reusedName returns the stable name of the container kept by the job, the
+// same for the names differing only by invalid characters, e.g. `a/b` and
+// `a_b`, see reusedContainer
+func (j *RunJob) reusedName() string {
+	return "ofelia-" + reusedNameInvalid.ReplaceAllString(j.Name, "_")
+}
+
+// reusedContainer returns the container kept from the previous executions
+// of the job, stopped since their end. It is created if there is none, and
+// recreated if it was created with other options, e.g. another image. The
+// container of another job with the same name, or one not created by Ofelia,
+// is left untouched and the execution fails.
+func (j *RunJob) reusedContainer(cmd string) (*docker.Container, error) {
+	opts, err := j.containerOptions(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := j.containerOptionsHash(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	opts.Name = j.reusedName()
+	opts.Config.Labels[ReuseHashLabel] = hash
+
+	c, err := j.inspectContainer(opts.Name)
+	var noSuch *docker.NoSuchContainer
+	switch {
+	case errors.As(err, &noSuch):
+	case err != nil:
+		return nil, err
+	case c.Config == nil || c.Config.Labels[RunJobLabel] != j.Name:
+		return nil, fmt.Errorf("%w: %q isn't labelled %s=%s", ErrReusedNameCollision, opts.Name, RunJobLabel, j.Name)
+	case c.State.Running:
+		return nil, fmt.Errorf("%w: %q", ErrReusedContainerRunning, opts.Name)
+	case c.Config.Labels[ReuseHashLabel] == hash:
+		return c, nil
+	default:
+		if err := j.Client.RemoveContainer(docker.RemoveContainerOptions{ID: c.ID}); err != nil {
+			return nil, fmt.Errorf("error removing the outdated container %q: %w", opts.Name, err)
+		}
+	}
+
+	return j.createContainer(opts)
+}
+
+// containerOptionsHash returns the hash of the options creating a container,
+// and of the network settings applied once it's created, see createContainer
+func (j *RunJob) containerOptionsHash(opts docker.CreateContainerOptions) (string, error) {
+	b, err := json.Marshal(struct {
+		Options        docker.CreateContainerOptions
+		Network        string
+		NetworkAliases []string
+		IP             string
+	}{opts, j.Network, j.NetworkAliases, j.IP})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -1,12 +1,16 @@
 package core
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"math"
+	"reflect"
 	"strconv"
 	"time"
 
+	"github.com/docker/docker/api/types"
 	docker "github.com/fsouza/go-dockerclient"
-	"github.com/gobs/args"
 )
 
 var dockercfg *docker.AuthConfigurations
@@ -18,23 +22,108 @@ func init() {
 type RunJob struct {
 	BareJob `mapstructure:",squash"`
 	Client  *docker.Client `json:"-"`
+	Docker  *DockerOptions `json:"-"`
 	User    string         `default:"root"`
+	// AllowRoot silences the warning of the jobs running as root
+	AllowRoot bool `gcfg:"allow-root" mapstructure:"allow-root"`
 
 	TTY bool `default:"false"`
 
+	ShellCommand `mapstructure:",squash"`
+	// CommandHooks run in containers of the same image, created like the
+	// one of the command
+	CommandHooks `mapstructure:",squash"`
+
 	// do not use bool values with "default:true" because if
 	// user would set it to "false" explicitly, it still will be
 	// changed to "true" https://github.com/netresearch/ofelia/issues/135
 	// so lets use strings here as workaround
 	Delete string `default:"true"`
-	Pull   string `default:"true"`
-
-	Image       string
+	// ReuseContainer keeps the container between the executions, started
+	// again instead of created, see reusedContainer
+	ReuseContainer bool `gcfg:"reuse-container" mapstructure:"reuse-container" default:"false" hash:"true"`
+	// Pull is the image pull policy: always, missing or never
+	Pull         string `default:"missing"`
+	RegistryAuth `mapstructure:",squash"`
+
+	Image string
+	// Platform selects the image variant, e.g. `linux/arm64`
+	Platform    string `hash:"true"`
 	Network     string
 	Hostname    string
 	Container   string
 	Volume      []string
 	Environment []string
+	// SecretFiles are host files mounted read only in the container, as
+	// `host-path:container-path`, instead of passing secrets in Environment
+	SecretFiles []string `gcfg:"secret-files" mapstructure:"secret-files" hash:"true"`
+	// EnvFile is a dotenv file read at every execution, the variables of
+	// Environment take precedence over the ones of the file
+	EnvFile    string   `gcfg:"env-file" mapstructure:"env-file" hash:"true"`
+	ExtraHosts []string `gcfg:"extra-hosts" mapstructure:"extra-hosts" hash:"true"`
+	// ContainerLabels are `key=value` labels set on the created container
+	ContainerLabels []string `gcfg:"container-labels" mapstructure:"container-labels" hash:"true"`
+
+	// NetworkAliases and IP are the aliases and the static address of the
+	// container in Network, which must be a user-defined network
+	NetworkAliases []string `gcfg:"network-aliases" mapstructure:"network-aliases" hash:"true"`
+	IP             string   `hash:"true"`
+	// NetworkMode is the network stack of the container: bridge, host,
+	// none or container:<name|id> to share the one of another container
+	NetworkMode string `gcfg:"network-mode" mapstructure:"network-mode" hash:"true"`
+
+	// resource limits, e.g. `1.5` CPUs or `512m` of memory
+	CPUs       string `hash:"true"`
+	Memory     string `hash:"true"`
+	MemorySwap string `gcfg:"memory-swap" mapstructure:"memory-swap" hash:"true"`
+
+	// Devices are the host devices added to the container, as
+	// `host[:container][:permissions]`, GPUs requests GPUs like
+	// `docker run --gpus`, e.g. `all` or `device=0,1`
+	Devices []string `hash:"true"`
+	GPUs    string   `hash:"true"`
+
+	// Ulimits are resource limits as `name=soft[:hard]`, e.g.
+	// `nofile=1024:2048`, Sysctls are kernel parameters as `key=value`
+	Ulimits []string `hash:"true"`
+	Sysctls []string `hash:"true"`
+
+	// LogDriver is the log driver of the container, e.g. `journald`, with
+	// its LogOpts as `key=value`, the default ones of the daemon if empty
+	LogDriver string   `gcfg:"log-driver" mapstructure:"log-driver" hash:"true"`
+	LogOpts   []string `gcfg:"log-opts" mapstructure:"log-opts" hash:"true"`
+
+	// Init runs Docker's init as the first process of the container, reaping
+	// the zombie processes left by the command, like `docker run --init`
+	Init bool `default:"false" hash:"true"`
+
+	// ReadOnly mounts the root filesystem of the container as read only,
+	// Tmpfs mounts, as `path[:options]`, give it writable scratch space
+	ReadOnly bool     `gcfg:"read-only" mapstructure:"read-only" default:"false" hash:"true"`
+	Tmpfs    []string `hash:"true"`
+
+	// CapAdd and CapDrop are the Linux capabilities added to and dropped
+	// from the container, e.g. `ALL` or `NET_ADMIN`
+	CapAdd  []string `gcfg:"cap-add" mapstructure:"cap-add" hash:"true"`
+	CapDrop []string `gcfg:"cap-drop" mapstructure:"cap-drop" hash:"true"`
+
+	// StopSignal is sent to the container when the execution is cancelled or
+	// runs for too long, it is killed if still running after StopTimeout
+	StopSignal  string `gcfg:"stop-signal" mapstructure:"stop-signal" hash:"true"`
+	StopTimeout string `gcfg:"stop-timeout" mapstructure:"stop-timeout" hash:"true"`
+
+	// WaitForHealthy waits for the healthcheck of the container to report it
+	// healthy before watching it, the job fails if it isn't within
+	// HealthTimeout
+	WaitForHealthy bool   `gcfg:"wait-for-healthy" mapstructure:"wait-for-healthy" default:"false" hash:"true"`
+	HealthTimeout  string `gcfg:"health-timeout" mapstructure:"health-timeout" hash:"true"`
+
+	// DockerHost is the daemon running the job, e.g. `ssh://user@host`, the
+	// global one by default
+	DockerHost string `gcfg:"docker-host" mapstructure:"docker-host" hash:"true"`
+	// DockerEndpoint selects a docker-endpoint section by name, instead of
+	// DockerHost
+	DockerEndpoint string `gcfg:"docker-endpoint" mapstructure:"docker-endpoint" hash:"true"`
 
 	containerID string
 }
@@ -43,75 +132,193 @@ func NewRunJob(c *docker.Client) *RunJob {
 	return &RunJob{Client: c}
 }
 
-func (j *RunJob) Run(ctx *Context) error {
-	var container *docker.Container
-	var err error
-	pull, _ := strconv.ParseBool(j.Pull)
-
-	if j.Image != "" && j.Container == "" {
-		if err = func() error {
-			var pullError error
-
-			// if Pull option "true"
-			// try pulling image first
-			if pull {
-				if pullError = j.pullImage(); pullError == nil {
-					ctx.Log("Pulled image " + j.Image)
-					return nil
-				}
-			}
+// Returns a hash of all the job attributes. Used to detect changes
+func (j *RunJob) Hash() string {
+	var hash string
+	getHash(reflect.TypeOf(j).Elem(), reflect.ValueOf(j).Elem(), &hash)
+	return hash
+}
 
-			// if Pull option "false"
-			// try to find image locally first
-			searchErr := j.searchLocalImage()
-			if searchErr == nil {
-				ctx.Log("Found locally image " + j.Image)
-				return nil
-			}
+// ValidateParams checks the parameters specific to the run jobs
+func (j *RunJob) ValidateParams() error {
+	if j.Image == "" && j.Container == "" {
+		return fmt.Errorf("%w without container", ErrMissingImage)
+	}
 
-			// if couldn't find image locally, still try to pull
-			if !pull && searchErr == ErrLocalImageNotFound {
-				if pullError = j.pullImage(); pullError == nil {
-					ctx.Log("Pulled image " + j.Image)
-					return nil
-				}
-			}
+	if j.Container != "" && (j.PreCommand != "" || j.PostCommand != "") {
+		return ErrHooksWithContainer
+	}
 
-			if pullError != nil {
-				return pullError
-			}
+	if j.Container != "" && j.ReuseContainer {
+		return ErrReuseWithContainer
+	}
 
-			if searchErr != nil {
-				return searchErr
-			}
+	if err := ValidateDockerHost(j.DockerHost); err != nil {
+		return err
+	}
 
-			return nil
-		}(); err != nil {
-			return err
-		}
+	if _, err := parsePullPolicy(j.Pull); err != nil {
+		return err
+	}
 
-		container, err = j.buildContainer()
-		if err != nil {
-			return err
-		}
-	} else {
-		container, err = j.Client.InspectContainer(j.Container)
+	if err := validateUser(j.User); err != nil {
+		return err
+	}
+
+	if err := validateExtraHosts(j.ExtraHosts); err != nil {
+		return err
+	}
+
+	if _, err := parseLabels(j.ContainerLabels); err != nil {
+		return err
+	}
+
+	if err := validatePlatform(j.Platform); err != nil {
+		return err
+	}
+
+	if _, err := parseTmpfs(j.Tmpfs); err != nil {
+		return err
+	}
+
+	if _, err := parseSecretFiles(j.SecretFiles); err != nil {
+		return err
+	}
+
+	if _, err := endpointConfig(j.Network, j.NetworkAliases, j.IP); err != nil {
+		return err
+	}
+
+	if _, err := parseNetworkMode(j.NetworkMode, j.Network); err != nil {
+		return err
+	}
+
+	if _, err := parseDevices(j.Devices); err != nil {
+		return err
+	}
+
+	if _, err := parseGPUs(j.GPUs); err != nil {
+		return err
+	}
+
+	if _, err := parseUlimits(j.Ulimits); err != nil {
+		return err
+	}
+
+	if _, err := parseSysctls(j.Sysctls); err != nil {
+		return err
+	}
+
+	if _, err := parseLogConfig(j.LogDriver, j.LogOpts); err != nil {
+		return err
+	}
+
+	if _, err := parseCapabilities(j.CapAdd); err != nil {
+		return err
+	}
+
+	if _, err := parseCapabilities(j.CapDrop); err != nil {
+		return err
+	}
+
+	if _, err := parseStopSignal(j.StopSignal); err != nil {
+		return err
+	}
+
+	if _, err := j.stopTimeout(); err != nil {
+		return err
+	}
+
+	_, err := j.healthTimeout()
+	return err
+}
+
+func (j *RunJob) Run(ctx *Context) error {
+	if j.Image == "" || j.Container != "" {
+		container, err := j.inspectContainer(j.Container)
 		if err != nil {
 			return err
 		}
+
+		return j.runContainer(ctx, container, true, ctx.Execution.OutputStream, ctx.Execution.ErrorStream)
 	}
 
-	if container != nil {
-		j.containerID = container.ID
+	if err := ensureImage(ctx, j.Client, imageRequest{
+		Image:    j.Image,
+		Pull:     j.Pull,
+		Platform: j.Platform,
+		Auth:     j.RegistryAuth,
+		Docker:   j.Docker,
+	}); err != nil {
+		return err
 	}
 
-	// cleanup container if it is a created one
-	if j.Container == "" {
-		defer func() {
-			if delErr := j.deleteContainer(); delErr != nil {
-				ctx.Warn("failed to delete container: " + delErr.Error())
-			}
-		}()
+	cmd, err := j.command(ctx)
+	if err != nil {
+		return err
+	}
+
+	// the hooks don't wait for the container to be healthy
+	run := func(cmd string, stdout, stderr io.Writer) error {
+		return j.createAndRun(ctx, cmd, false, stdout, stderr)
+	}
+
+	if err := j.preCommand(ctx, run); err != nil {
+		return err
+	}
+
+	err = j.runCommand(ctx, cmd)
+	return j.postCommand(ctx, run, err)
+}
+
+// runCommand runs cmd in a new container or, with reuse-container, in the
+// one kept from the previous executions
+func (j *RunJob) runCommand(ctx *Context, cmd string) error {
+	if !j.ReuseContainer {
+		return j.createAndRun(ctx, cmd, true, ctx.Execution.OutputStream, ctx.Execution.ErrorStream)
+	}
+
+	if err := j.Docker.waitOp(ctx); err != nil {
+		return err
+	}
+
+	container, err := j.reusedContainer(cmd)
+	if err != nil {
+		return err
+	}
+
+	return j.runContainer(ctx, container, true, ctx.Execution.OutputStream, ctx.Execution.ErrorStream)
+}
+
+// createAndRun creates a container running cmd and runs it, the container
+// is deleted once it has exited
+func (j *RunJob) createAndRun(ctx *Context, cmd string, healthy bool, stdout, stderr io.Writer) error {
+	if err := j.Docker.waitOp(ctx); err != nil {
+		return err
+	}
+
+	container, err := j.buildContainer(cmd)
+	if err != nil {
+		return err
+	}
+
+	j.containerID = container.ID
+	defer func() {
+		if delErr := j.deleteContainer(); delErr != nil {
+			ctx.Warn("failed to delete container: " + delErr.Error())
+		}
+	}()
+
+	return j.runContainer(ctx, container, healthy, stdout, stderr)
+}
+
+// runContainer starts the container and watches it until it exits, after
+// waiting for it to be healthy if healthy is set, its logs are written to
+// stdout and stderr
+func (j *RunJob) runContainer(ctx *Context, container *docker.Container, healthy bool, stdout, stderr io.Writer) error {
+	j.containerID = container.ID
+	if err := j.Docker.waitOp(ctx); err != nil {
+		return err
 	}
 
 	startTime := time.Now()
@@ -119,15 +326,22 @@ func (j *RunJob) Run(ctx *Context) error {
 		return err
 	}
 
-	err = j.watchContainer()
-	if err == ErrUnexpected {
-		return err
+	var err error
+	if healthy {
+		err = j.waitHealthy(ctx.Ctx())
+	}
+
+	if err == nil {
+		err = j.watchContainer(ctx.Ctx())
+		if err == ErrUnexpected {
+			return err
+		}
 	}
 
 	if logsErr := j.Client.Logs(docker.LogsOptions{
 		Container:    container.ID,
-		OutputStream: ctx.Execution.OutputStream,
-		ErrorStream:  ctx.Execution.ErrorStream,
+		OutputStream: stdout,
+		ErrorStream:  stderr,
 		Stdout:       true,
 		Stderr:       true,
 		Since:        startTime.Unix(),
@@ -139,47 +353,65 @@ func (j *RunJob) Run(ctx *Context) error {
 	return err
 }
 
-func (j *RunJob) searchLocalImage() error {
-	imgs, err := j.Client.ListImages(buildFindLocalImageOptions(j.Image))
+func (j *RunJob) buildContainer(cmd string) (*docker.Container, error) {
+	opts, err := j.containerOptions(cmd)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if len(imgs) != 1 {
-		return ErrLocalImageNotFound
+	return j.createContainer(opts)
+}
+
+// containerOptions returns the options creating the container running cmd
+func (j *RunJob) containerOptions(cmd string) (docker.CreateContainerOptions, error) {
+	hostConfig, err := j.buildHostConfig()
+	if err != nil {
+		return docker.CreateContainerOptions{}, err
 	}
 
-	return nil
-}
+	labels, err := parseLabels(j.ContainerLabels)
+	if err != nil {
+		return docker.CreateContainerOptions{}, err
+	}
 
-func (j *RunJob) pullImage() error {
-	o, a := buildPullOptions(j.Image)
-	if err := j.Client.PullImage(o, a); err != nil {
-		return fmt.Errorf("error pulling image %q: %s", j.Image, err)
+	if labels == nil {
+		labels = make(map[string]string, 1)
 	}
+	labels[RunJobLabel] = j.Name
 
-	return nil
-}
+	env, err := buildEnv(j.EnvFile, j.Environment)
+	if err != nil {
+		return docker.CreateContainerOptions{}, err
+	}
 
-func (j *RunJob) buildContainer() (*docker.Container, error) {
-	c, err := j.Client.CreateContainer(docker.CreateContainerOptions{
+	return docker.CreateContainerOptions{
+		Platform: j.Platform,
 		Config: &docker.Config{
 			Image:        j.Image,
 			AttachStdin:  false,
 			AttachStdout: true,
 			AttachStderr: true,
 			Tty:          j.TTY,
-			Cmd:          args.GetArgs(j.Command),
+			Cmd:          j.commandArgs(cmd),
 			User:         j.User,
-			Env:          j.Environment,
+			Env:          env,
 			Hostname:     j.Hostname,
+			Labels:       labels,
 		},
 		NetworkingConfig: &docker.NetworkingConfig{},
-		HostConfig: &docker.HostConfig{
-			Binds: j.Volume,
-		},
-	})
+		HostConfig:       hostConfig,
+	}, nil
+}
 
+// createContainer creates the container and connects it to the network of
+// the job
+func (j *RunJob) createContainer(opts docker.CreateContainerOptions) (*docker.Container, error) {
+	endpoint, err := endpointConfig(j.Network, j.NetworkAliases, j.IP)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := j.Client.CreateContainer(opts)
 	if err != nil {
 		return c, fmt.Errorf("error creating exec: %s", err)
 	}
@@ -191,7 +423,8 @@ func (j *RunJob) buildContainer() (*docker.Container, error) {
 		if networks, err := j.Client.FilteredListNetworks(networkOpts); err == nil {
 			for _, network := range networks {
 				if err := j.Client.ConnectNetwork(network.ID, docker.NetworkConnectionOptions{
-					Container: c.ID,
+					Container:      c.ID,
+					EndpointConfig: endpoint,
 				}); err != nil {
 					return c, fmt.Errorf("error connecting container to network: %s", err)
 				}
@@ -202,6 +435,80 @@ func (j *RunJob) buildContainer() (*docker.Container, error) {
 	return c, nil
 }
 
+func (j *RunJob) buildHostConfig() (*docker.HostConfig, error) {
+	hc := &docker.HostConfig{
+		Binds:          j.Volume,
+		ExtraHosts:     j.ExtraHosts,
+		ReadonlyRootfs: j.ReadOnly,
+		Init:           j.Init,
+	}
+
+	secrets, err := parseSecretFiles(j.SecretFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	// the volumes are copied so the binds of the secrets aren't added to
+	// the job
+	hc.Binds = append(j.Volume[:len(j.Volume):len(j.Volume)], secrets...)
+
+	if hc.Tmpfs, err = parseTmpfs(j.Tmpfs); err != nil {
+		return nil, err
+	}
+
+	if j.CPUs != "" {
+		if hc.NanoCPUs, err = parseCPUs(j.CPUs); err != nil {
+			return nil, err
+		}
+	}
+
+	if j.Memory != "" {
+		if hc.Memory, err = ParseMemory(j.Memory); err != nil {
+			return nil, err
+		}
+	}
+
+	if j.MemorySwap != "" {
+		if hc.MemorySwap, err = ParseMemory(j.MemorySwap); err != nil {
+			return nil, err
+		}
+	}
+
+	if hc.CapAdd, err = parseCapabilities(j.CapAdd); err != nil {
+		return nil, err
+	}
+
+	if hc.CapDrop, err = parseCapabilities(j.CapDrop); err != nil {
+		return nil, err
+	}
+
+	if hc.Devices, err = parseDevices(j.Devices); err != nil {
+		return nil, err
+	}
+
+	if hc.DeviceRequests, err = parseGPUs(j.GPUs); err != nil {
+		return nil, err
+	}
+
+	if hc.Ulimits, err = parseUlimits(j.Ulimits); err != nil {
+		return nil, err
+	}
+
+	if hc.Sysctls, err = parseSysctls(j.Sysctls); err != nil {
+		return nil, err
+	}
+
+	if hc.LogConfig, err = parseLogConfig(j.LogDriver, j.LogOpts); err != nil {
+		return nil, err
+	}
+
+	if hc.NetworkMode, err = parseNetworkMode(j.NetworkMode, j.Network); err != nil {
+		return nil, err
+	}
+
+	return hc, nil
+}
+
 func (j *RunJob) startContainer() error {
 	return j.Client.StartContainer(j.containerID, &docker.HostConfig{})
 }
@@ -211,30 +518,168 @@ func (j *RunJob) stopContainer(timeout uint) error {
 }
 
 func (j *RunJob) getContainer() (*docker.Container, error) {
-	container, err := j.Client.InspectContainer(j.containerID)
-	if err != nil {
-		return nil, err
-	}
-	return container, nil
+	return j.inspectContainer(j.containerID)
+}
+
+func (j *RunJob) inspectContainer(id string) (container *docker.Container, err error) {
+	err = j.Docker.Retry(func() error {
+		return withDockerTimeout(context.Background(), j.Docker.inspectTimeout(), "inspecting container "+id, func(c context.Context) (err error) {
+			container, err = j.Client.InspectContainerWithOptions(docker.InspectContainerOptions{ID: id, Context: c})
+			return err
+		})
+	})
+
+	return container, err
 }
 
 const (
-	watchDuration      = time.Millisecond * 100
-	maxProcessDuration = time.Hour * 24
+	watchDuration = time.Millisecond * 100
+	// time to wait for a cancelled container to stop before killing it
+	defaultStopTimeout = 10 * time.Second
+	// time to wait for the container to become healthy without
+	// health-timeout
+	defaultHealthTimeout = time.Minute
 )
 
-func (j *RunJob) watchContainer() error {
+var maxProcessDuration = time.Hour * 24
+
+// terminateContainer stops the running container, sending StopSignal if set
+// or SIGTERM otherwise, and kills it if still running after StopTimeout
+func (j *RunJob) terminateContainer() error {
+	timeout, err := j.stopTimeout()
+	if err != nil {
+		return err
+	}
+
+	signal, err := parseStopSignal(j.StopSignal)
+	if err != nil {
+		return err
+	}
+
+	if signal == 0 {
+		return j.stopContainer(uint(math.Ceil(timeout.Seconds())))
+	}
+
+	if err := j.Client.KillContainer(docker.KillContainerOptions{
+		ID:     j.containerID,
+		Signal: signal,
+	}); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if _, err := j.Client.WaitContainerWithContext(j.containerID, ctx); err == nil {
+		return nil
+	}
+
+	return j.Client.KillContainer(docker.KillContainerOptions{
+		ID:     j.containerID,
+		Signal: docker.SIGKILL,
+	})
+}
+
+func (j *RunJob) stopTimeout() (time.Duration, error) {
+	if j.StopTimeout == "" {
+		return defaultStopTimeout, nil
+	}
+
+	timeout, err := time.ParseDuration(j.StopTimeout)
+	if err != nil || timeout < 0 {
+		return 0, fmt.Errorf("invalid stop-timeout %q", j.StopTimeout)
+	}
+
+	return timeout, nil
+}
+
+func (j *RunJob) healthTimeout() (time.Duration, error) {
+	if j.HealthTimeout == "" {
+		return defaultHealthTimeout, nil
+	}
+
+	timeout, err := time.ParseDuration(j.HealthTimeout)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid health-timeout %q", j.HealthTimeout)
+	}
+
+	return timeout, nil
+}
+
+// waitHealthy waits for the container to be healthy if WaitForHealthy is set,
+// the container is stopped if it isn't within the health timeout
+func (j *RunJob) waitHealthy(ctx context.Context) error {
+	if !j.WaitForHealthy {
+		return nil
+	}
+
+	timeout, err := j.healthTimeout()
+	if err != nil {
+		return err
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	err = j.pollHealth(ctx, deadline.C, timeout)
+	if err == nil {
+		return nil
+	}
+
+	if stopErr := j.terminateContainer(); stopErr != nil {
+		return fmt.Errorf("%w, error stopping the container: %s", err, stopErr)
+	}
+
+	return err
+}
+
+func (j *RunJob) pollHealth(ctx context.Context, deadline <-chan time.Time, timeout time.Duration) error {
+	for {
+		c, err := j.getContainer()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case c.State.Health.Status == types.Healthy:
+			return nil
+		case !c.State.Running:
+			return fmt.Errorf("%w: it exited with code %d", ErrUnhealthy, c.State.ExitCode)
+		case c.State.Health.Status == "" || c.State.Health.Status == types.NoHealthcheck:
+			return fmt.Errorf("%w: it has no healthcheck", ErrUnhealthy)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline:
+			return fmt.Errorf("%w within %s, its status is %q", ErrUnhealthy, timeout, c.State.Health.Status)
+		case <-time.After(watchDuration):
+		}
+	}
+}
+
+func (j *RunJob) watchContainer(ctx context.Context) error {
 	var s docker.State
 	var r time.Duration
 	for {
-		time.Sleep(watchDuration)
+		select {
+		case <-ctx.Done():
+			if err := j.terminateContainer(); err != nil {
+				return fmt.Errorf("error stopping cancelled container: %s", err)
+			}
+			return ctx.Err()
+		case <-time.After(watchDuration):
+		}
 		r += watchDuration
 
 		if r > maxProcessDuration {
+			if err := j.terminateContainer(); err != nil {
+				return fmt.Errorf("error stopping container running for too long: %s", err)
+			}
 			return ErrMaxTimeRunning
 		}
 
-		c, err := j.Client.InspectContainer(j.containerID)
+		c, err := j.getContainer()
 		if err != nil {
 			return err
 		}
@@ -251,7 +696,7 @@ func (j *RunJob) watchContainer() error {
 	case -1:
 		return ErrUnexpected
 	default:
-		return fmt.Errorf("error non-zero exit code: %d", s.ExitCode)
+		return &NonZeroExitError{ExitCode: s.ExitCode}
 	}
 }
 
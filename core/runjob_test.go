@@ -3,6 +3,18 @@ package core
 import (
 	"archive/tar"
 	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	docker "github.com/fsouza/go-dockerclient"
@@ -59,8 +71,13 @@ func (s *SuiteRunJob) TestRun(c *C) {
 		}
 	}()
 
+	// the container is found through the client, the job is still running
 	time.Sleep(200 * time.Millisecond)
-	container, err := job.getContainer()
+	containers, err := s.client.ListContainers(docker.ListContainersOptions{All: true})
+	c.Assert(err, IsNil)
+	c.Assert(containers, HasLen, 1)
+
+	container, err := s.client.InspectContainer(containers[0].ID)
 	c.Assert(err, IsNil)
 	c.Assert(container.Config.Cmd, DeepEquals, []string{"echo", "-a", "foo bar"})
 	c.Assert(container.Config.User, Equals, job.User)
@@ -73,19 +90,959 @@ func (s *SuiteRunJob) TestRun(c *C) {
 	// c.Assert(container.HostConfig.Binds, DeepEquals, job.Volume)
 
 	// stop container, we don't need it anymore
-	err = job.stopContainer(0)
+	err = s.client.StopContainer(container.ID, 0)
 	c.Assert(err, IsNil)
 
 	// wait and double check if container was deleted on "stop"
 	time.Sleep(watchDuration * 2)
-	container, _ = job.getContainer()
-	c.Assert(container, IsNil)
+	_, err = s.client.InspectContainer(container.ID)
+	c.Assert(err, NotNil)
 
-	containers, err := s.client.ListContainers(docker.ListContainersOptions{All: true})
+	containers, err = s.client.ListContainers(docker.ListContainersOptions{All: true})
 	c.Assert(err, IsNil)
 	c.Assert(containers, HasLen, 0)
 }
 
+func (s *SuiteRunJob) TestEnsureImagePullPolicy(c *C) {
+	var pulls int32
+	s.server.CustomHandler("/images/create", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&pulls, 1)
+		s.server.DefaultHandler().ServeHTTP(w, r)
+	}))
+
+	job := &RunJob{Client: s.client}
+	job.Name = "test"
+	ctx := &Context{Execution: NewExecution(), Logger: &TestLogger{}, Job: job}
+
+	testcases := []struct {
+		Pull  string
+		Pulls int32
+	}{
+		{Pull: "", Pulls: 0},
+		{Pull: PullMissing, Pulls: 0},
+		{Pull: "false", Pulls: 0},
+		{Pull: PullNever, Pulls: 0},
+		{Pull: PullAlways, Pulls: 1},
+		{Pull: "true", Pulls: 1},
+	}
+
+	for _, t := range testcases {
+		atomic.StoreInt32(&pulls, 0)
+		err := ensureImage(ctx, s.client, imageRequest{Image: ImageFixture, Pull: t.Pull})
+		c.Assert(err, IsNil, Commentf("pull %q", t.Pull))
+		c.Assert(atomic.LoadInt32(&pulls), Equals, t.Pulls, Commentf("pull %q", t.Pull))
+	}
+
+	c.Assert(ensureImage(ctx, s.client, imageRequest{Image: ImageFixture, Pull: "sometimes"}), ErrorMatches, "unknown pull policy.*")
+
+	job.Image = ImageFixture
+	job.Pull = "sometimes"
+	c.Assert(job.ValidateParams(), ErrorMatches, `unknown pull policy "sometimes"`)
+}
+
+func (s *SuiteRunJob) TestEnsureImagePullPolicyMissingImage(c *C) {
+	var pulls int32
+	s.server.CustomHandler("/images/create", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&pulls, 1)
+	}))
+	s.server.CustomHandler("/images/json", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("[]"))
+	}))
+
+	job := &RunJob{Client: s.client}
+	job.Name = "test"
+	ctx := &Context{Execution: NewExecution(), Logger: &TestLogger{}, Job: job}
+
+	err := ensureImage(ctx, s.client, imageRequest{Image: "missing-image", Pull: PullNever})
+	c.Assert(err, ErrorMatches, "couldn't find image on the host.*")
+	c.Assert(atomic.LoadInt32(&pulls), Equals, int32(0))
+
+	err = ensureImage(ctx, s.client, imageRequest{Image: "missing-image", Pull: PullMissing})
+	c.Assert(err, IsNil)
+	c.Assert(atomic.LoadInt32(&pulls), Equals, int32(1))
+}
+
+func (s *SuiteRunJob) TestEnsureImageRegistryAuth(c *C) {
+	auths := make(chan docker.AuthConfiguration, 1)
+	s.server.CustomHandler("/images/create", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a docker.AuthConfiguration
+		data, _ := base64.URLEncoding.DecodeString(r.Header.Get("X-Registry-Auth"))
+		json.Unmarshal(data, &a)
+		auths <- a
+	}))
+
+	job := &RunJob{Client: s.client}
+	job.Name = "test"
+	sh := NewScheduler(&TestLogger{})
+	sh.RegistryAuths = map[string]docker.AuthConfiguration{
+		"registry.example.com": {Username: "global", Password: "secret", ServerAddress: "registry.example.com"},
+	}
+	ctx := &Context{Execution: NewExecution(), Logger: &TestLogger{}, Job: job, Scheduler: sh}
+
+	image := "registry.example.com/foo:latest"
+	c.Assert(ensureImage(ctx, s.client, imageRequest{Image: image, Pull: PullAlways}), IsNil)
+	c.Assert(<-auths, DeepEquals, docker.AuthConfiguration{
+		Username: "global", Password: "secret", ServerAddress: "registry.example.com",
+	})
+
+	inline := RegistryAuth{RegistryUser: "inline", RegistryPassword: "hunter2"}
+	c.Assert(ensureImage(ctx, s.client, imageRequest{Image: image, Pull: PullAlways, Auth: inline}), IsNil)
+	c.Assert(<-auths, DeepEquals, docker.AuthConfiguration{
+		Username: "inline", Password: "hunter2", ServerAddress: "registry.example.com",
+	})
+}
+
+func (s *SuiteRunJob) TestRegistryPasswordNotMarshaled(c *C) {
+	job := &RunJob{}
+	job.RegistryUser = "user"
+	job.RegistryPassword = "hunter2"
+
+	b, err := json.Marshal(job)
+	c.Assert(err, IsNil)
+	c.Assert(strings.Contains(string(b), "hunter2"), Equals, false)
+}
+
+func (s *SuiteRunJob) TestBuildHostConfigResources(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Volume = []string{"/test/tmp:/test/tmp:ro"}
+	job.CPUs = "1.5"
+	job.Memory = "512m"
+	job.MemorySwap = "1g"
+
+	hc, err := job.buildHostConfig()
+	c.Assert(err, IsNil)
+	c.Assert(hc.Binds, DeepEquals, job.Volume)
+	c.Assert(hc.NanoCPUs, Equals, int64(1500000000))
+	c.Assert(hc.Memory, Equals, int64(512*1024*1024))
+	c.Assert(hc.MemorySwap, Equals, int64(1024*1024*1024))
+
+	job.Memory = "lots"
+	_, err = job.buildHostConfig()
+	c.Assert(err, ErrorMatches, "invalid memory value.*")
+}
+
+func (s *SuiteRunJob) TestBuildContainerExtraHosts(c *C) {
+	var opts struct{ HostConfig *docker.HostConfig }
+	s.server.CustomHandler("/containers/create", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &opts)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		s.server.DefaultHandler().ServeHTTP(w, r)
+	}))
+
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.ExtraHosts = []string{"db:10.0.0.2"}
+
+	_, err := job.buildContainer(job.Command)
+	c.Assert(err, IsNil)
+	c.Assert(opts.HostConfig, NotNil)
+	c.Assert(opts.HostConfig.ExtraHosts, DeepEquals, []string{"db:10.0.0.2"})
+
+	c.Assert(job.ValidateParams(), IsNil)
+	job.ExtraHosts = []string{"db"}
+	c.Assert(job.ValidateParams(), ErrorMatches, "invalid extra host.*")
+}
+
+func (s *SuiteRunJob) TestBuildContainerLabels(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Name = "labelled"
+	job.Image = ImageFixture
+	job.ContainerLabels = []string{"team=ops", "temporary"}
+
+	container, err := job.buildContainer(job.Command)
+	c.Assert(err, IsNil)
+
+	container, err = s.client.InspectContainer(container.ID)
+	c.Assert(err, IsNil)
+	c.Assert(container.Config.Labels, DeepEquals, map[string]string{"team": "ops", "temporary": "", RunJobLabel: "labelled"})
+
+	job.ContainerLabels = []string{"ofelia.job-exec.foo.schedule=@hourly"}
+	_, err = job.buildContainer(job.Command)
+	c.Assert(err, ErrorMatches, "container labels with the ofelia prefix are reserved.*")
+	c.Assert(job.ValidateParams(), ErrorMatches, "container labels with the ofelia prefix are reserved.*")
+}
+
+func (s *SuiteRunJob) TestPlatform(c *C) {
+	var pulled, created string
+	s.server.CustomHandler("/images/create", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pulled = r.URL.Query().Get("platform")
+		s.server.DefaultHandler().ServeHTTP(w, r)
+	}))
+	s.server.CustomHandler("/containers/create", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		created = r.URL.Query().Get("platform")
+		s.server.DefaultHandler().ServeHTTP(w, r)
+	}))
+
+	job := &RunJob{Client: s.client}
+	job.Name = "test"
+	job.Image = ImageFixture
+	job.Platform = "linux/arm64"
+	ctx := &Context{Execution: NewExecution(), Logger: &TestLogger{}, Job: job}
+
+	err := ensureImage(ctx, s.client, imageRequest{Image: job.Image, Pull: PullAlways, Platform: job.Platform})
+	c.Assert(err, IsNil)
+	c.Assert(pulled, Equals, "linux/arm64")
+
+	_, err = job.buildContainer(job.Command)
+	c.Assert(err, IsNil)
+	c.Assert(created, Equals, "linux/arm64")
+
+	job.Platform = ""
+	c.Assert(ensureImage(ctx, s.client, imageRequest{Image: job.Image, Pull: PullAlways}), IsNil)
+	c.Assert(pulled, Equals, "")
+	_, err = job.buildContainer(job.Command)
+	c.Assert(err, IsNil)
+	c.Assert(created, Equals, "")
+
+	c.Assert(job.ValidateParams(), IsNil)
+	job.Platform = "arm64"
+	c.Assert(job.ValidateParams(), ErrorMatches, "invalid platform.*")
+}
+
+func (s *SuiteRunJob) TestBuildContainerEnvFile(c *C) {
+	filename := filepath.Join(c.MkDir(), ".env")
+	c.Assert(os.WriteFile(filename, []byte("A=file\nB=file\n"), 0600), IsNil)
+
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Environment = []string{"B=inline"}
+	job.EnvFile = filename
+
+	container, err := job.buildContainer(job.Command)
+	c.Assert(err, IsNil)
+
+	container, err = s.client.InspectContainer(container.ID)
+	c.Assert(err, IsNil)
+	c.Assert(container.Config.Env, DeepEquals, []string{"A=file", "B=inline"})
+
+	job.EnvFile = filepath.Join(c.MkDir(), "missing")
+	_, err = job.buildContainer(job.Command)
+	c.Assert(err, ErrorMatches, "error reading env-file.*")
+}
+
+func (s *SuiteRunJob) TestBuildContainerCapabilities(c *C) {
+	var opts struct{ HostConfig *docker.HostConfig }
+	s.server.CustomHandler("/containers/create", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &opts)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		s.server.DefaultHandler().ServeHTTP(w, r)
+	}))
+
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.CapDrop = []string{"all"}
+	job.CapAdd = []string{"net_bind_service", "CAP_CHOWN"}
+
+	_, err := job.buildContainer(job.Command)
+	c.Assert(err, IsNil)
+	c.Assert(opts.HostConfig, NotNil)
+	c.Assert(opts.HostConfig.CapDrop, DeepEquals, []string{"ALL"})
+	c.Assert(opts.HostConfig.CapAdd, DeepEquals, []string{"CAP_NET_BIND_SERVICE", "CAP_CHOWN"})
+
+	c.Assert(job.ValidateParams(), IsNil)
+	job.CapAdd = []string{"superpowers"}
+	c.Assert(job.ValidateParams(), ErrorMatches, "unknown capability.*")
+	_, err = job.buildContainer(job.Command)
+	c.Assert(err, ErrorMatches, "unknown capability.*")
+}
+
+func (s *SuiteRunJob) TestBuildContainerReadOnly(c *C) {
+	var opts struct{ HostConfig *docker.HostConfig }
+	s.server.CustomHandler("/containers/create", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &opts)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		s.server.DefaultHandler().ServeHTTP(w, r)
+	}))
+
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+
+	for _, readOnly := range []bool{true, false} {
+		opts.HostConfig = nil
+		job.ReadOnly = readOnly
+		_, err := job.buildContainer(job.Command)
+		c.Assert(err, IsNil)
+		c.Assert(opts.HostConfig, NotNil)
+		c.Assert(opts.HostConfig.ReadonlyRootfs, Equals, readOnly)
+	}
+
+	job.ReadOnly = true
+	job.Tmpfs = []string{"/tmp:rw,size=64m", "/run"}
+	_, err := job.buildContainer(job.Command)
+	c.Assert(err, IsNil)
+	c.Assert(opts.HostConfig.Tmpfs, DeepEquals, map[string]string{"/tmp": "rw,size=64m", "/run": ""})
+
+	opts.HostConfig = nil
+	job.Tmpfs = []string{"/scratch:size=64m,mode=1777"}
+	_, err = job.buildContainer(job.Command)
+	c.Assert(err, IsNil)
+	c.Assert(opts.HostConfig.Tmpfs, DeepEquals, map[string]string{"/scratch": "size=64m,mode=1777"})
+
+	c.Assert(job.ValidateParams(), IsNil)
+	job.Tmpfs = []string{"tmp"}
+	c.Assert(job.ValidateParams(), ErrorMatches, "invalid tmpfs.*")
+	job.Tmpfs = []string{"/scratch:size=64m,mode=rwx"}
+	c.Assert(job.ValidateParams(), ErrorMatches, `invalid tmpfs.*invalid mode "rwx".*`)
+}
+
+func (s *SuiteRunJob) TestBuildContainerShell(c *C) {
+	var opts docker.Config
+	s.server.CustomHandler("/containers/create", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &opts)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		s.server.DefaultHandler().ServeHTTP(w, r)
+	}))
+
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+
+	command := `find /data -mtime +7 | xargs rm -f`
+	_, err := job.buildContainer(command)
+	c.Assert(err, IsNil)
+	c.Assert(opts.Cmd, DeepEquals, []string{"find", "/data", "-mtime", "+7", "| xargs rm -f"})
+
+	job.Shell = true
+	_, err = job.buildContainer(command)
+	c.Assert(err, IsNil)
+	c.Assert(opts.Cmd, DeepEquals, []string{"/bin/sh", "-c", command})
+
+	// the default command of the image is kept
+	opts.Cmd = nil
+	_, err = job.buildContainer("")
+	c.Assert(err, IsNil)
+	c.Assert(opts.Cmd, HasLen, 0)
+}
+
+func (s *SuiteRunJob) TestBuildContainerDevices(c *C) {
+	var opts struct{ HostConfig *docker.HostConfig }
+	s.server.CustomHandler("/containers/create", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &opts)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		s.server.DefaultHandler().ServeHTTP(w, r)
+	}))
+
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Devices = []string{"/dev/nvidia0", "/dev/sda:/dev/xvda:r"}
+	job.GPUs = "device=0,1"
+
+	_, err := job.buildContainer(job.Command)
+	c.Assert(err, IsNil)
+	c.Assert(opts.HostConfig, NotNil)
+	c.Assert(opts.HostConfig.Devices, DeepEquals, []docker.Device{
+		{PathOnHost: "/dev/nvidia0", PathInContainer: "/dev/nvidia0", CgroupPermissions: "rwm"},
+		{PathOnHost: "/dev/sda", PathInContainer: "/dev/xvda", CgroupPermissions: "r"},
+	})
+	c.Assert(opts.HostConfig.DeviceRequests, DeepEquals, []docker.DeviceRequest{
+		{DeviceIDs: []string{"0", "1"}, Capabilities: [][]string{{"gpu"}}},
+	})
+
+	c.Assert(job.ValidateParams(), IsNil)
+	job.Devices = []string{"sda"}
+	c.Assert(job.ValidateParams(), ErrorMatches, "invalid device.*")
+	_, err = job.buildContainer(job.Command)
+	c.Assert(err, ErrorMatches, "invalid device.*")
+
+	job.Devices = nil
+	job.GPUs = "most"
+	c.Assert(job.ValidateParams(), ErrorMatches, "invalid gpus.*")
+}
+
+func (s *SuiteRunJob) TestHashDevices(c *C) {
+	job := &RunJob{}
+	hash := job.Hash()
+
+	job.Devices = []string{"/dev/fuse"}
+	c.Assert(job.Hash(), Not(Equals), hash)
+
+	hash = job.Hash()
+	job.GPUs = "all"
+	c.Assert(job.Hash(), Not(Equals), hash)
+}
+
+func (s *SuiteRunJob) TestHashRegistryAuth(c *C) {
+	job := &RunJob{}
+	job.RegistryUser = "ci"
+	job.RegistryPassword = "old"
+	hash := job.Hash()
+
+	job.RegistryPassword = "rotated"
+	c.Assert(job.Hash(), Not(Equals), hash)
+
+	service := &RunServiceJob{}
+	hash = service.Hash()
+	service.RegistryUser = "ci"
+	c.Assert(service.Hash(), Not(Equals), hash)
+}
+
+func (s *SuiteRunJob) TestBuildContainerUlimitsSysctls(c *C) {
+	var opts struct{ HostConfig *docker.HostConfig }
+	s.server.CustomHandler("/containers/create", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &opts)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		s.server.DefaultHandler().ServeHTTP(w, r)
+	}))
+
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Ulimits = []string{"nofile=1024:2048", "nproc=512"}
+	job.Sysctls = []string{"net.core.somaxconn=1024"}
+
+	_, err := job.buildContainer(job.Command)
+	c.Assert(err, IsNil)
+	c.Assert(opts.HostConfig, NotNil)
+	c.Assert(opts.HostConfig.Ulimits, DeepEquals, []docker.ULimit{
+		{Name: "nofile", Soft: 1024, Hard: 2048},
+		{Name: "nproc", Soft: 512, Hard: 512},
+	})
+	c.Assert(opts.HostConfig.Sysctls, DeepEquals, map[string]string{"net.core.somaxconn": "1024"})
+
+	c.Assert(job.ValidateParams(), IsNil)
+	job.Ulimits = []string{"nofile=lots"}
+	c.Assert(job.ValidateParams(), ErrorMatches, "invalid ulimit.*")
+
+	job.Ulimits = nil
+	job.Sysctls = []string{"net.core.somaxconn"}
+	c.Assert(job.ValidateParams(), ErrorMatches, "invalid sysctl.*")
+}
+
+func (s *SuiteRunJob) TestHashUlimitsSysctls(c *C) {
+	job := &RunJob{}
+	hash := job.Hash()
+
+	job.Ulimits = []string{"nofile=1024"}
+	c.Assert(job.Hash(), Not(Equals), hash)
+
+	hash = job.Hash()
+	job.Sysctls = []string{"net.ipv4.ip_forward=1"}
+	c.Assert(job.Hash(), Not(Equals), hash)
+}
+
+func (s *SuiteRunJob) TestBuildContainerLogConfig(c *C) {
+	var opts struct{ HostConfig *docker.HostConfig }
+	s.server.CustomHandler("/containers/create", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &opts)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		s.server.DefaultHandler().ServeHTTP(w, r)
+	}))
+
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.LogDriver = "syslog"
+	job.LogOpts = []string{"syslog-address=udp://logs:514", "tag=backup"}
+
+	_, err := job.buildContainer(job.Command)
+	c.Assert(err, IsNil)
+	c.Assert(opts.HostConfig, NotNil)
+	c.Assert(opts.HostConfig.LogConfig, DeepEquals, docker.LogConfig{Type: "syslog", Config: map[string]string{
+		"syslog-address": "udp://logs:514",
+		"tag":            "backup",
+	}})
+
+	c.Assert(job.ValidateParams(), IsNil)
+	job.LogDriver = "gelf"
+	c.Assert(job.ValidateParams(), ErrorMatches, `unknown log driver: "gelf"`)
+}
+
+func (s *SuiteRunJob) TestHashLogConfig(c *C) {
+	job := &RunJob{}
+	hash := job.Hash()
+
+	job.LogDriver = "journald"
+	c.Assert(job.Hash(), Not(Equals), hash)
+
+	hash = job.Hash()
+	job.LogOpts = []string{"tag=backup"}
+	c.Assert(job.Hash(), Not(Equals), hash)
+}
+
+func (s *SuiteRunJob) TestBuildContainerNetworkMode(c *C) {
+	var opts struct{ HostConfig *docker.HostConfig }
+	s.server.CustomHandler("/containers/create", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		opts.HostConfig = nil
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &opts)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		s.server.DefaultHandler().ServeHTTP(w, r)
+	}))
+
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+
+	for _, mode := range []string{"bridge", "host", "none", "container:db"} {
+		job.NetworkMode = mode
+		c.Assert(job.ValidateParams(), IsNil)
+
+		_, err := job.buildContainer(job.Command)
+		c.Assert(err, IsNil)
+		c.Assert(opts.HostConfig, NotNil)
+		c.Assert(opts.HostConfig.NetworkMode, Equals, mode)
+	}
+
+	job.NetworkMode = "container:"
+	c.Assert(job.ValidateParams(), ErrorMatches, `invalid network-mode.*: "container:"`)
+
+	job.NetworkMode = "host"
+	job.Network = "backend"
+	c.Assert(job.ValidateParams(), ErrorMatches, "network-mode conflicts with network.*")
+}
+
+func (s *SuiteRunJob) TestHashNetworkMode(c *C) {
+	job := &RunJob{}
+	hash := job.Hash()
+
+	job.NetworkMode = "host"
+	c.Assert(job.Hash(), Not(Equals), hash)
+}
+
+func (s *SuiteRunJob) TestBuildContainerInit(c *C) {
+	var opts struct{ HostConfig *docker.HostConfig }
+	s.server.CustomHandler("/containers/create", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &opts)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		s.server.DefaultHandler().ServeHTTP(w, r)
+	}))
+
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+
+	for _, init := range []bool{true, false} {
+		opts.HostConfig = nil
+		job.Init = init
+		_, err := job.buildContainer(job.Command)
+		c.Assert(err, IsNil)
+		c.Assert(opts.HostConfig, NotNil)
+		c.Assert(opts.HostConfig.Init, Equals, init)
+	}
+
+	hash := job.Hash()
+	job.Init = true
+	c.Assert(job.Hash(), Not(Equals), hash)
+}
+
+func (s *SuiteRunJob) TestBuildContainerSecretFiles(c *C) {
+	var opts struct{ HostConfig *docker.HostConfig }
+	s.server.CustomHandler("/containers/create", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &opts)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		s.server.DefaultHandler().ServeHTTP(w, r)
+	}))
+
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Volume = make([]string, 1, 4)
+	job.Volume[0] = "/data:/data"
+	hash := job.Hash()
+
+	job.SecretFiles = []string{"/etc/secrets/db:/run/secrets/db"}
+	c.Assert(job.ValidateParams(), IsNil)
+	c.Assert(job.Hash(), Not(Equals), hash)
+
+	_, err := job.buildContainer(job.Command)
+	c.Assert(err, IsNil)
+	c.Assert(opts.HostConfig.Binds, DeepEquals, []string{"/data:/data", "/etc/secrets/db:/run/secrets/db:ro"})
+	// neither the volumes nor their spare capacity are written to
+	c.Assert(job.Volume, DeepEquals, []string{"/data:/data"})
+	c.Assert(job.Volume[:2][1], Equals, "")
+
+	job.SecretFiles = []string{"/etc/secrets/db"}
+	c.Assert(job.ValidateParams(), ErrorMatches, "invalid secret file.*")
+}
+
+func (s *SuiteRunJob) TestBuildContainerNetworkEndpoint(c *C) {
+	var opts docker.NetworkConnectionOptions
+	s.server.CustomHandler("/networks/.*/connect", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &opts)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		s.server.DefaultHandler().ServeHTTP(w, r)
+	}))
+
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Network = "foo"
+	job.NetworkAliases = []string{"worker", "cron"}
+	job.IP = "172.20.0.5"
+
+	container, err := job.buildContainer(job.Command)
+	c.Assert(err, IsNil)
+	c.Assert(opts.Container, Equals, container.ID)
+	c.Assert(opts.EndpointConfig, DeepEquals, &docker.EndpointConfig{
+		Aliases:    []string{"worker", "cron"},
+		IPAMConfig: &docker.EndpointIPAMConfig{IPv4Address: "172.20.0.5"},
+	})
+
+	c.Assert(job.ValidateParams(), IsNil)
+	job.IP = "172.20.0"
+	c.Assert(job.ValidateParams(), ErrorMatches, "invalid ip.*")
+
+	job.IP = ""
+	job.Network = "bridge"
+	c.Assert(job.ValidateParams(), ErrorMatches, "network-aliases and ip require a user-defined network.*")
+
+	hash := job.Hash()
+	job.NetworkAliases = []string{"worker"}
+	c.Assert(job.Hash(), Not(Equals), hash)
+}
+
+func (s *SuiteRunJob) TestHashReadOnly(c *C) {
+	job := &RunJob{}
+	hash := job.Hash()
+
+	job.ReadOnly = true
+	c.Assert(job.Hash(), Not(Equals), hash)
+
+	hash = job.Hash()
+	job.Tmpfs = []string{"/tmp"}
+	c.Assert(job.Hash(), Not(Equals), hash)
+}
+
+func (s *SuiteRunJob) TestHashCapabilities(c *C) {
+	job := &RunJob{}
+	job.CapAdd = []string{"NET_ADMIN"}
+	hash := job.Hash()
+
+	job.CapAdd = []string{"SYS_TIME"}
+	c.Assert(job.Hash(), Not(Equals), hash)
+
+	hash = job.Hash()
+	job.CapDrop = []string{"ALL"}
+	c.Assert(job.Hash(), Not(Equals), hash)
+}
+
+func (s *SuiteRunJob) TestHashExtraHosts(c *C) {
+	job := &RunJob{}
+	job.ExtraHosts = []string{"db:10.0.0.2"}
+	hash := job.Hash()
+
+	job.ExtraHosts = []string{"db:10.0.0.3"}
+	c.Assert(job.Hash(), Not(Equals), hash)
+}
+
+func (s *SuiteRunJob) TestHashResources(c *C) {
+	job := &RunJob{}
+	job.Memory = "512m"
+	hash := job.Hash()
+
+	job.Memory = "1g"
+	c.Assert(job.Hash(), Not(Equals), hash)
+}
+
+// exitContainers reports the containers as exited right after their start,
+// the ones running a command in fail with the code 1. It returns the commands
+// of the containers created, in order.
+func (s *SuiteRunJob) exitContainers(fail ...string) *[]string {
+	var cmds []string
+	s.server.CustomHandler("/containers/create", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var opts docker.Config
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &opts)
+		cmds = append(cmds, strings.Join(opts.Cmd, " "))
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		s.server.DefaultHandler().ServeHTTP(w, r)
+	}))
+
+	s.server.CustomHandler("/containers/.*/json", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := httptest.NewRecorder()
+		s.server.DefaultHandler().ServeHTTP(rec, r)
+		if rec.Code != http.StatusOK {
+			w.WriteHeader(rec.Code)
+			w.Write(rec.Body.Bytes())
+			return
+		}
+
+		var container docker.Container
+		json.Unmarshal(rec.Body.Bytes(), &container)
+		container.State.Running = false
+		for _, f := range fail {
+			if strings.Join(container.Config.Cmd, " ") == f {
+				container.State.ExitCode = 1
+			}
+		}
+
+		json.NewEncoder(w).Encode(container)
+	}))
+
+	return &cmds
+}
+
+func (s *SuiteRunJob) TestRunHooks(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Name = "hooks"
+	job.Image = ImageFixture
+	job.Command = "main"
+	job.PreCommand = "pre"
+	job.PostCommand = "post"
+	run := func() error {
+		return job.Run(NewContext(NewScheduler(&TestLogger{}), job, NewExecution()))
+	}
+
+	cmds := s.exitContainers()
+	c.Assert(run(), IsNil)
+	c.Assert(*cmds, DeepEquals, []string{"pre", "main", "post"})
+
+	// a failed pre-command aborts the job
+	cmds = s.exitContainers("pre")
+	c.Assert(run(), ErrorMatches, "pre-command failed: .*")
+	c.Assert(*cmds, DeepEquals, []string{"pre"})
+
+	// the post-command runs after a failure, which is kept
+	cmds = s.exitContainers("main")
+	c.Assert(run(), DeepEquals, &NonZeroExitError{ExitCode: 1})
+	c.Assert(*cmds, DeepEquals, []string{"pre", "main", "post"})
+
+	job.Container = "backup"
+	c.Assert(job.ValidateParams(), Equals, ErrHooksWithContainer)
+}
+
+func (s *SuiteRunJob) TestRunReuseContainer(c *C) {
+	var created, started int
+	s.exitContainers()
+	s.server.CustomHandler("/containers/create", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		created++
+		s.server.DefaultHandler().ServeHTTP(w, r)
+	}))
+	s.server.CustomHandler("/containers/.*/start", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started++
+		s.server.DefaultHandler().ServeHTTP(w, r)
+	}))
+
+	job := &RunJob{Client: s.client}
+	job.Name = "cache/warm"
+	job.Image = ImageFixture
+	job.Command = "warm"
+	job.ReuseContainer = true
+	run := func() {
+		c.Assert(job.Run(NewContext(NewScheduler(&TestLogger{}), job, NewExecution())), IsNil)
+
+		// the test server never stops the containers by itself
+		c.Assert(s.client.StopContainer(job.containerID, 0), IsNil)
+	}
+
+	run()
+	first := job.containerID
+	c.Assert(created, Equals, 1)
+	c.Assert(started, Equals, 1)
+
+	container, err := s.client.InspectContainer("ofelia-cache_warm")
+	c.Assert(err, IsNil)
+	c.Assert(container.ID, Equals, first)
+	c.Assert(container.Config.Labels[ReuseHashLabel], Not(Equals), "")
+
+	// the container is kept and started again
+	run()
+	c.Assert(job.containerID, Equals, first)
+	c.Assert(created, Equals, 1)
+	c.Assert(started, Equals, 2)
+
+	// and recreated once the config changes
+	job.Environment = []string{"CACHE=1"}
+	run()
+	c.Assert(job.containerID, Not(Equals), first)
+	c.Assert(created, Equals, 2)
+	c.Assert(started, Equals, 3)
+
+	// as well as the network settings applied after its creation
+	job.Network = "backend"
+	run()
+	second := job.containerID
+	c.Assert(created, Equals, 3)
+
+	job.NetworkAliases = []string{"cache"}
+	run()
+	c.Assert(job.containerID, Not(Equals), second)
+	c.Assert(created, Equals, 4)
+
+	containers, err := s.client.ListContainers(docker.ListContainersOptions{All: true})
+	c.Assert(err, IsNil)
+	c.Assert(containers, HasLen, 1)
+
+	// the container of a job with the same reused name is kept
+	other := &RunJob{Client: s.client}
+	other.Name = "cache_warm"
+	other.Image = ImageFixture
+	other.Command = "warm"
+	other.ReuseContainer = true
+	err = other.Run(NewContext(NewScheduler(&TestLogger{}), other, NewExecution()))
+	c.Assert(errors.Is(err, ErrReusedNameCollision), Equals, true)
+	c.Assert(created, Equals, 4)
+
+	job.Container = "backup"
+	c.Assert(job.ValidateParams(), Equals, ErrReuseWithContainer)
+}
+
+func (s *SuiteRunJob) startContainer(c *C, job *RunJob) {
+	job.Image = ImageFixture
+	container, err := job.buildContainer(job.Command)
+	c.Assert(err, IsNil)
+	job.containerID = container.ID
+	c.Assert(job.startContainer(), IsNil)
+}
+
+func (s *SuiteRunJob) TestWatchContainerCancelStopSignal(c *C) {
+	signals := make(chan string, 2)
+	s.server.CustomHandler("/containers/.*/kill", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signals <- r.URL.Query().Get("signal")
+		s.server.DefaultHandler().ServeHTTP(w, r)
+	}))
+
+	job := &RunJob{Client: s.client}
+	job.StopSignal = "SIGINT"
+	job.StopTimeout = "5s"
+	s.startContainer(c, job)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	c.Assert(job.watchContainer(ctx), Equals, context.Canceled)
+	c.Assert(<-signals, Equals, strconv.Itoa(int(docker.SIGINT)))
+	c.Assert(signals, HasLen, 0)
+}
+
+func (s *SuiteRunJob) TestWatchContainerCancelStopTimeout(c *C) {
+	timeouts := make(chan string, 1)
+	s.server.CustomHandler("/containers/.*/stop", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeouts <- r.URL.Query().Get("t")
+		s.server.DefaultHandler().ServeHTTP(w, r)
+	}))
+
+	job := &RunJob{Client: s.client}
+	job.StopTimeout = "1500ms"
+	s.startContainer(c, job)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	c.Assert(job.watchContainer(ctx), Equals, context.Canceled)
+	c.Assert(<-timeouts, Equals, "2")
+}
+
+func (s *SuiteRunJob) TestWatchContainerMaxRuntime(c *C) {
+	defer func(d time.Duration) { maxProcessDuration = d }(maxProcessDuration)
+	maxProcessDuration = watchDuration
+
+	signals := make(chan string, 2)
+	s.server.CustomHandler("/containers/.*/kill", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signals <- r.URL.Query().Get("signal")
+		s.server.DefaultHandler().ServeHTTP(w, r)
+	}))
+
+	job := &RunJob{Client: s.client}
+	job.StopSignal = "quit"
+	s.startContainer(c, job)
+
+	c.Assert(job.watchContainer(context.Background()), Equals, ErrMaxTimeRunning)
+	c.Assert(<-signals, Equals, strconv.Itoa(int(docker.SIGQUIT)))
+}
+
+// healthSequence makes the inspections of the container report the given
+// health statuses in turn, the last one being kept
+func (s *SuiteRunJob) healthSequence(statuses ...string) *int32 {
+	var calls int32
+	s.server.CustomHandler("/containers/[^/]+/json", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i := int(atomic.AddInt32(&calls, 1)) - 1
+		if i >= len(statuses) {
+			i = len(statuses) - 1
+		}
+
+		rec := httptest.NewRecorder()
+		s.server.DefaultHandler().ServeHTTP(rec, r)
+
+		var container docker.Container
+		json.Unmarshal(rec.Body.Bytes(), &container)
+		if container.State.Running {
+			container.State.Health.Status = statuses[i]
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(container)
+	}))
+
+	return &calls
+}
+
+func (s *SuiteRunJob) TestWaitHealthy(c *C) {
+	job := &RunJob{Client: s.client}
+	job.WaitForHealthy = true
+	s.startContainer(c, job)
+	calls := s.healthSequence("starting", "unhealthy", "healthy")
+
+	c.Assert(job.waitHealthy(context.Background()), IsNil)
+	c.Assert(atomic.LoadInt32(calls), Equals, int32(3))
+
+	container, err := job.getContainer()
+	c.Assert(err, IsNil)
+	c.Assert(container.State.Running, Equals, true)
+}
+
+func (s *SuiteRunJob) TestWaitHealthyTimeout(c *C) {
+	job := &RunJob{Client: s.client}
+	job.WaitForHealthy = true
+	job.HealthTimeout = "300ms"
+	s.startContainer(c, job)
+	s.healthSequence("starting")
+
+	err := job.waitHealthy(context.Background())
+	c.Assert(errors.Is(err, ErrUnhealthy), Equals, true)
+	c.Assert(err, ErrorMatches, `the container didn't become healthy within 300ms, its status is "starting"`)
+
+	// the container is stopped
+	container, err := job.getContainer()
+	c.Assert(err, IsNil)
+	c.Assert(container.State.Running, Equals, false)
+}
+
+func (s *SuiteRunJob) TestWaitHealthyNoHealthcheck(c *C) {
+	job := &RunJob{Client: s.client}
+	job.WaitForHealthy = true
+	s.startContainer(c, job)
+
+	c.Assert(job.waitHealthy(context.Background()), ErrorMatches, ".*it has no healthcheck")
+
+	// without wait-for-healthy the health isn't checked
+	job.WaitForHealthy = false
+	c.Assert(job.waitHealthy(context.Background()), IsNil)
+}
+
+func (s *SuiteRunJob) TestValidateParamsStop(c *C) {
+	job := &RunJob{}
+	job.Image = ImageFixture
+	c.Assert(job.ValidateParams(), IsNil)
+
+	job.StopSignal = "SIGINT"
+	job.StopTimeout = "30s"
+	c.Assert(job.ValidateParams(), IsNil)
+
+	job.StopSignal = "SIGFOO"
+	c.Assert(job.ValidateParams(), ErrorMatches, "unknown stop signal.*")
+
+	job.StopSignal = ""
+	job.StopTimeout = "soon"
+	c.Assert(job.ValidateParams(), ErrorMatches, "invalid stop-timeout.*")
+
+	job.StopTimeout = ""
+	job.HealthTimeout = "0s"
+	c.Assert(job.ValidateParams(), ErrorMatches, "invalid health-timeout.*")
+}
+
+func (s *SuiteRunJob) TestValidateParamsImage(c *C) {
+	job := &RunJob{}
+	c.Assert(errors.Is(job.ValidateParams(), ErrMissingImage), Equals, true)
+
+	job.Container = "backup"
+	c.Assert(job.ValidateParams(), IsNil)
+}
+
 func (s *SuiteRunJob) TestBuildPullImageOptionsBareImage(c *C) {
 	o, _ := buildPullOptions("foo")
 	c.Assert(o.Repository, Equals, "foo")
@@ -129,3 +1086,31 @@ func (s *SuiteRunJob) createNetwork(c *C) {
 	})
 	c.Assert(err, IsNil)
 }
+
+func (s *SuiteRunJob) TestShutdownStopSignal(c *C) {
+	signals := make(chan string, 2)
+	s.server.CustomHandler("/containers/.*/kill", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signals <- r.URL.Query().Get("signal")
+		s.server.DefaultHandler().ServeHTTP(w, r)
+	}))
+
+	job := &RunJob{Client: s.client}
+	job.Name = "slow"
+	job.Schedule = "@hourly"
+	job.Image = ImageFixture
+	job.Pull = PullNever
+	job.StopSignal = "SIGINT"
+	job.StopTimeout = "1s"
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(job), IsNil)
+	c.Assert(sc.Start(), IsNil)
+
+	// the container of the test server runs until it is stopped
+	go sc.RunJob(job.Name)
+	time.Sleep(300 * time.Millisecond)
+
+	err := sc.StopWithTimeout(100 * time.Millisecond)
+	c.Assert(errors.Is(err, ErrShutdownTimeout), Equals, true)
+	c.Assert(<-signals, Equals, strconv.Itoa(int(docker.SIGINT)))
+}
@@ -1,7 +1,9 @@
 package core
 
 import (
+	"errors"
 	"fmt"
+	"reflect"
 	"strconv"
 	"strings"
 	"sync"
@@ -16,6 +18,7 @@ import (
 type RunServiceJob struct {
 	BareJob `mapstructure:",squash"`
 	Client  *docker.Client `json:"-"`
+	Docker  *DockerOptions `json:"-"`
 	User    string         `default:"root"`
 	TTY     bool           `default:"false"`
 	// do not use bool values with "default:true" because if
@@ -25,18 +28,104 @@ type RunServiceJob struct {
 	Delete  string `default:"true"`
 	Image   string
 	Network string
+	// Pull is the image pull policy: always, missing or never
+	Pull         string `default:"missing"`
+	RegistryAuth `mapstructure:",squash"`
+	ExtraHosts   []string `gcfg:"extra-hosts" mapstructure:"extra-hosts" hash:"true"`
+	// ContainerLabels are `key=value` labels set on the service containers
+	ContainerLabels []string `gcfg:"container-labels" mapstructure:"container-labels" hash:"true"`
+	// EnvFile is a dotenv file read at every execution, its variables are
+	// set in the service containers
+	EnvFile string `gcfg:"env-file" mapstructure:"env-file" hash:"true"`
+	// DockerHost is the daemon running the job, e.g. `ssh://user@host`, the
+	// global one by default
+	DockerHost string `gcfg:"docker-host" mapstructure:"docker-host" hash:"true"`
+	// DockerEndpoint selects a docker-endpoint section by name, instead of
+	// DockerHost
+	DockerEndpoint string `gcfg:"docker-endpoint" mapstructure:"docker-endpoint" hash:"true"`
+	// RestartOnFailure is the number of times swarm restarts the task of the
+	// service when it fails, the job fails once they are exhausted
+	RestartOnFailure int `gcfg:"restart-on-failure" mapstructure:"restart-on-failure" hash:"true"`
+	// AllowRoot silences the warning of the jobs running as root
+	AllowRoot bool `gcfg:"allow-root" mapstructure:"allow-root"`
+	// Secrets and Configs are the names of the swarm secrets and configs
+	// given to the service, in /run/secrets/<name> and /<name>
+	Secrets []string `gcfg:"secrets" mapstructure:"secrets" hash:"true"`
+	Configs []string `gcfg:"configs" mapstructure:"configs" hash:"true"`
 }
 
+var (
+	ErrEmptySwarmRef    = errors.New("secret and config names can't be empty")
+	ErrSwarmRefNotFound = errors.New("not found in the swarm")
+)
+
 func NewRunServiceJob(c *docker.Client) *RunServiceJob {
 	return &RunServiceJob{Client: c}
 }
 
+// Returns a hash of all the job attributes. Used to detect changes
+func (j *RunServiceJob) Hash() string {
+	var hash string
+	getHash(reflect.TypeOf(j).Elem(), reflect.ValueOf(j).Elem(), &hash)
+	return hash
+}
+
+// ValidateParams checks the parameters specific to the service jobs
+func (j *RunServiceJob) ValidateParams() error {
+	if j.Image == "" {
+		return ErrMissingImage
+	}
+
+	if err := ValidateDockerHost(j.DockerHost); err != nil {
+		return err
+	}
+
+	if _, err := parsePullPolicy(j.Pull); err != nil {
+		return err
+	}
+
+	if err := validateUser(j.User); err != nil {
+		return err
+	}
+
+	if err := validateExtraHosts(j.ExtraHosts); err != nil {
+		return err
+	}
+
+	if j.RestartOnFailure < 0 {
+		return fmt.Errorf("invalid restart-on-failure %d", j.RestartOnFailure)
+	}
+
+	for _, name := range append(j.Secrets[:len(j.Secrets):len(j.Secrets)], j.Configs...) {
+		if strings.TrimSpace(name) == "" {
+			return ErrEmptySwarmRef
+		}
+	}
+
+	_, err := parseLabels(j.ContainerLabels)
+	return err
+}
+
 func (j *RunServiceJob) Run(ctx *Context) error {
-	if err := j.pullImage(); err != nil {
+	if err := ensureImage(ctx, j.Client, imageRequest{
+		Image:  j.Image,
+		Pull:   j.Pull,
+		Auth:   j.RegistryAuth,
+		Docker: j.Docker,
+	}); err != nil {
 		return err
 	}
 
-	svc, err := j.buildService()
+	cmd, err := j.command(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := j.Docker.waitOp(ctx); err != nil {
+		return err
+	}
+
+	svc, err := j.buildService(cmd)
 
 	if err != nil {
 		return err
@@ -45,40 +134,86 @@ func (j *RunServiceJob) Run(ctx *Context) error {
 	ctx.Logger.Noticef("Created service %s for job %s\n", svc.ID, j.Name)
 
 	if err := j.watchContainer(ctx, svc.ID); err != nil {
+		var exit *NonZeroExitError
+		if errors.As(err, &exit) {
+			// the task is over, only the service is left
+			if delErr := j.deleteService(ctx, svc.ID); delErr != nil {
+				ctx.Warn("failed to delete service: " + delErr.Error())
+			}
+		} else if ctx.Ctx().Err() != nil {
+			// the execution was cancelled, the service is still running
+			if delErr := j.deleteService(ctx, svc.ID); delErr != nil {
+				ctx.Warn("failed to delete service: " + delErr.Error())
+			}
+		}
+
 		return err
 	}
 
 	return j.deleteService(ctx, svc.ID)
 }
 
-func (j *RunServiceJob) pullImage() error {
-	o, a := buildPullOptions(j.Image)
-	if err := j.Client.PullImage(o, a); err != nil {
-		return fmt.Errorf("error pulling image %q: %s", j.Image, err)
+func (j *RunServiceJob) buildService(cmd string) (*swarm.Service, error) {
+
+	//createOptions := types.ServiceCreateOptions{}
+
+	labels, err := parseLabels(j.ContainerLabels)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
-}
+	env, err := buildEnv(j.EnvFile, nil)
+	if err != nil {
+		return nil, err
+	}
 
-func (j *RunServiceJob) buildService() (*swarm.Service, error) {
+	secrets, err := j.secretReferences()
+	if err != nil {
+		return nil, err
+	}
 
-	//createOptions := types.ServiceCreateOptions{}
+	configs, err := j.configReferences()
+	if err != nil {
+		return nil, err
+	}
 
 	max := uint64(1)
 	createSvcOpts := docker.CreateServiceOptions{}
 
 	createSvcOpts.ServiceSpec.TaskTemplate.ContainerSpec =
 		&swarm.ContainerSpec{
-			Image: j.Image,
+			Image:   j.Image,
+			User:    j.User,
+			Labels:  labels,
+			Env:     env,
+			Secrets: secrets,
+			Configs: configs,
+		}
+
+	// swarm expects the hosts file format, `ip host`
+	for _, e := range j.ExtraHosts {
+		host, ip, err := parseExtraHost(e)
+		if err != nil {
+			return nil, err
 		}
 
-	// Make the service run once and not restart
+		spec := createSvcOpts.ServiceSpec.TaskTemplate.ContainerSpec
+		spec.Hosts = append(spec.Hosts, ip+" "+host)
+	}
+
+	// Make the service run once and not restart, unless it fails and
+	// restarts are allowed
 	createSvcOpts.ServiceSpec.TaskTemplate.RestartPolicy =
 		&swarm.RestartPolicy{
 			MaxAttempts: &max,
 			Condition:   swarm.RestartPolicyConditionNone,
 		}
 
+	if j.RestartOnFailure > 0 {
+		max = uint64(j.RestartOnFailure)
+		createSvcOpts.ServiceSpec.TaskTemplate.RestartPolicy.Condition = swarm.RestartPolicyConditionOnFailure
+	}
+
 	// For a service to interact with other services in a stack,
 	// we need to attach it to the same network
 	if j.Network != "" {
@@ -89,8 +224,8 @@ func (j *RunServiceJob) buildService() (*swarm.Service, error) {
 		}
 	}
 
-	if j.Command != "" {
-		createSvcOpts.ServiceSpec.TaskTemplate.ContainerSpec.Command = strings.Split(j.Command, " ")
+	if cmd != "" {
+		createSvcOpts.ServiceSpec.TaskTemplate.ContainerSpec.Command = strings.Split(cmd, " ")
 	}
 
 	svc, err := j.Client.CreateService(createSvcOpts)
@@ -101,6 +236,84 @@ func (j *RunServiceJob) buildService() (*swarm.Service, error) {
 	return svc, err
 }
 
+// CheckSwarmRefs checks that the secrets and configs of the job exist in the
+// swarm, they are looked up again at every execution
+func (j *RunServiceJob) CheckSwarmRefs() error {
+	if _, err := j.secretReferences(); err != nil {
+		return err
+	}
+
+	_, err := j.configReferences()
+	return err
+}
+
+// secretReferences resolves the secrets by name, like
+// `docker service create --secret`, the swarm requiring their ids
+func (j *RunServiceJob) secretReferences() ([]*swarm.SecretReference, error) {
+	var refs []*swarm.SecretReference
+	for _, name := range j.Secrets {
+		secrets, err := j.Client.ListSecrets(docker.ListSecretsOptions{
+			Filters: map[string][]string{"name": {name}},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// the name filter matches the prefixes too
+		var id string
+		for _, s := range secrets {
+			if s.Spec.Name == name {
+				id = s.ID
+			}
+		}
+
+		if id == "" {
+			return nil, fmt.Errorf("secret %q %w", name, ErrSwarmRefNotFound)
+		}
+
+		refs = append(refs, &swarm.SecretReference{
+			SecretID:   id,
+			SecretName: name,
+			File:       &swarm.SecretReferenceFileTarget{Name: name, UID: "0", GID: "0", Mode: 0444},
+		})
+	}
+
+	return refs, nil
+}
+
+// configReferences resolves the configs by name, like
+// `docker service create --config`
+func (j *RunServiceJob) configReferences() ([]*swarm.ConfigReference, error) {
+	var refs []*swarm.ConfigReference
+	for _, name := range j.Configs {
+		configs, err := j.Client.ListConfigs(docker.ListConfigsOptions{
+			Filters: map[string][]string{"name": {name}},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		var id string
+		for _, c := range configs {
+			if c.Spec.Name == name {
+				id = c.ID
+			}
+		}
+
+		if id == "" {
+			return nil, fmt.Errorf("config %q %w", name, ErrSwarmRefNotFound)
+		}
+
+		refs = append(refs, &swarm.ConfigReference{
+			ConfigID:   id,
+			ConfigName: name,
+			File:       &swarm.ConfigReferenceFileTarget{Name: "/" + name, UID: "0", GID: "0", Mode: 0444},
+		})
+	}
+
+	return refs, nil
+}
+
 const (
 
 	// TODO are these const defined somewhere in the docker API?
@@ -115,7 +328,11 @@ func (j *RunServiceJob) watchContainer(ctx *Context, svcID string) error {
 
 	ctx.Logger.Noticef("Checking for service ID %s (%s) termination\n", svcID, j.Name)
 
-	svc, err := j.Client.InspectService(svcID)
+	var svc *swarm.Service
+	err := j.Docker.Retry(func() (err error) {
+		svc, err = j.Client.InspectService(svcID)
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("Failed to inspect service %s: %s", svcID, err.Error())
 	}
@@ -126,7 +343,13 @@ func (j *RunServiceJob) watchContainer(ctx *Context, svcID string) error {
 
 	go func() {
 		defer wg.Done()
-		for _ = range svcChecker.C {
+		for {
+			select {
+			case <-ctx.Ctx().Done():
+				err = ctx.Ctx().Err()
+				return
+			case <-svcChecker.C:
+			}
 
 			if svc.CreatedAt.After(time.Now().Add(maxProcessDuration)) {
 				err = ErrMaxTimeRunning
@@ -145,6 +368,10 @@ func (j *RunServiceJob) watchContainer(ctx *Context, svcID string) error {
 	wg.Wait()
 
 	ctx.Logger.Noticef("Service ID %s (%s) has completed with exit code %d\n", svcID, j.Name, exitCode)
+	if err == nil && exitCode != 0 {
+		err = &NonZeroExitError{ExitCode: exitCode}
+	}
+
 	return err
 }
 
@@ -152,8 +379,12 @@ func (j *RunServiceJob) findtaskstatus(ctx *Context, taskID string) (int, bool)
 	taskFilters := make(map[string][]string)
 	taskFilters["service"] = []string{taskID}
 
-	tasks, err := j.Client.ListTasks(docker.ListTasksOptions{
-		Filters: taskFilters,
+	var tasks []swarm.Task
+	err := j.Docker.Retry(func() (err error) {
+		tasks, err = j.Client.ListTasks(docker.ListTasksOptions{
+			Filters: taskFilters,
+		})
+		return err
 	})
 
 	if err != nil {
@@ -166,36 +397,32 @@ func (j *RunServiceJob) findtaskstatus(ctx *Context, taskID string) (int, bool)
 		return 0, true
 	}
 
-	exitCode := 1
-	var done bool
-	stopStates := []swarm.TaskState{
-		swarm.TaskStateComplete,
-		swarm.TaskStateFailed,
-		swarm.TaskStateRejected,
-	}
+	return taskOutcome(tasks, j.RestartOnFailure)
+}
 
+// taskOutcome returns the exit code of the service once one of its tasks has
+// completed, or once more tasks have failed than the restarts allow
+func taskOutcome(tasks []swarm.Task, restarts int) (int, bool) {
+	exitCode, failures := 1, 0
 	for _, task := range tasks {
-
-		stop := false
-		for _, stopState := range stopStates {
-			if task.Status.State == stopState {
-				stop = true
-				break
-			}
+		code := 0
+		if task.Status.ContainerStatus != nil {
+			code = task.Status.ContainerStatus.ExitCode
 		}
 
-		if stop {
-
-			exitCode = task.Status.ContainerStatus.ExitCode
-
-			if exitCode == 0 && task.Status.State == swarm.TaskStateRejected {
-				exitCode = 255 // force non-zero exit for task rejected
+		switch task.Status.State {
+		case swarm.TaskStateComplete:
+			return code, true
+		case swarm.TaskStateFailed, swarm.TaskStateRejected:
+			failures++
+			exitCode = code
+			if exitCode == 0 {
+				exitCode = 255 // force non-zero exit for the tasks failing without one, e.g. rejected
 			}
-			done = true
-			break
 		}
 	}
-	return exitCode, done
+
+	return exitCode, failures > restarts
 }
 
 func (j *RunServiceJob) deleteService(ctx *Context, svcID string) error {
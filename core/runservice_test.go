@@ -3,7 +3,12 @@ package core
 import (
 	"archive/tar"
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
@@ -81,7 +86,7 @@ func (s *SuiteRunServiceJob) TestRun(c *C) {
 		wg.Done()
 	}()
 
-	err := job.Run(&Context{Execution: e, Logger: logger})
+	err := job.Run(&Context{Execution: e, Logger: logger, Job: job})
 	c.Assert(err, IsNil)
 	wg.Wait()
 
@@ -112,6 +117,254 @@ func (s *SuiteRunServiceJob) TestBuildPullImageOptionsRegistry(c *C) {
 	c.Assert(o.Registry, Equals, "quay.io")
 }
 
+func (s *SuiteRunServiceJob) TestBuildServiceExtraHosts(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+	job.ExtraHosts = []string{"db:10.0.0.2", "db6:2001:db8::1"}
+
+	svc, err := job.buildService(job.Command)
+	c.Assert(err, IsNil)
+	c.Assert(svc.Spec.TaskTemplate.ContainerSpec.Hosts, DeepEquals, []string{
+		"10.0.0.2 db", "2001:db8::1 db6",
+	})
+}
+
+func (s *SuiteRunServiceJob) TestBuildServiceUser(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+	job.User = "1000:1000"
+
+	svc, err := job.buildService(job.Command)
+	c.Assert(err, IsNil)
+	c.Assert(svc.Spec.TaskTemplate.ContainerSpec.User, Equals, "1000:1000")
+
+	job.User = "1000:"
+	c.Assert(job.ValidateParams(), ErrorMatches, "invalid user.*")
+}
+
+func (s *SuiteRunServiceJob) TestValidateParamsImage(c *C) {
+	job := &RunServiceJob{}
+	c.Assert(job.ValidateParams(), Equals, ErrMissingImage)
+
+	job.Image = ServiceImageFixture
+	c.Assert(job.ValidateParams(), IsNil)
+
+	job.Pull = "sometimes"
+	c.Assert(job.ValidateParams(), ErrorMatches, `unknown pull policy "sometimes"`)
+}
+
+func (s *SuiteRunServiceJob) TestHash(c *C) {
+	job := &RunServiceJob{}
+	hash := job.Hash()
+
+	job.ExtraHosts = []string{"db:10.0.0.2"}
+	c.Assert(job.Hash(), Not(Equals), hash)
+
+	hash = job.Hash()
+	job.RestartOnFailure = 2
+	c.Assert(job.Hash(), Not(Equals), hash)
+
+	hash = job.Hash()
+	job.Secrets = []string{"db-password"}
+	c.Assert(job.Hash(), Not(Equals), hash)
+}
+
+func (s *SuiteRunServiceJob) TestBuildServiceLabels(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+	job.ContainerLabels = []string{"team=ops"}
+
+	svc, err := job.buildService(job.Command)
+	c.Assert(err, IsNil)
+	c.Assert(svc.Spec.TaskTemplate.ContainerSpec.Labels, DeepEquals, map[string]string{"team": "ops"})
+
+	job.ContainerLabels = []string{"ofelia.enabled=true"}
+	c.Assert(job.ValidateParams(), ErrorMatches, "container labels with the ofelia prefix are reserved.*")
+}
+
+func (s *SuiteRunServiceJob) TestBuildServiceEnvFile(c *C) {
+	filename := filepath.Join(c.MkDir(), ".env")
+	c.Assert(os.WriteFile(filename, []byte("A=file\n"), 0600), IsNil)
+
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+	job.EnvFile = filename
+
+	svc, err := job.buildService(job.Command)
+	c.Assert(err, IsNil)
+	c.Assert(svc.Spec.TaskTemplate.ContainerSpec.Env, DeepEquals, []string{"A=file"})
+
+	job.EnvFile = filepath.Join(c.MkDir(), "missing")
+	_, err = job.buildService(job.Command)
+	c.Assert(err, ErrorMatches, "error reading env-file.*")
+}
+
+func (s *SuiteRunServiceJob) TestBuildServiceRestartOnFailure(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+
+	svc, err := job.buildService(job.Command)
+	c.Assert(err, IsNil)
+	c.Assert(svc.Spec.TaskTemplate.RestartPolicy.Condition, Equals, swarm.RestartPolicyConditionNone)
+	c.Assert(*svc.Spec.TaskTemplate.RestartPolicy.MaxAttempts, Equals, uint64(1))
+
+	job.RestartOnFailure = 3
+	svc, err = job.buildService(job.Command)
+	c.Assert(err, IsNil)
+	c.Assert(svc.Spec.TaskTemplate.RestartPolicy.Condition, Equals, swarm.RestartPolicyConditionOnFailure)
+	c.Assert(*svc.Spec.TaskTemplate.RestartPolicy.MaxAttempts, Equals, uint64(3))
+
+	job.RestartOnFailure = -1
+	c.Assert(job.ValidateParams(), ErrorMatches, "invalid restart-on-failure -1")
+}
+
+func (s *SuiteRunServiceJob) TestBuildServiceSecretsConfigs(c *C) {
+	s.server.CustomHandler("/secrets", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]swarm.Secret{
+			{ID: "s1", Spec: swarm.SecretSpec{Annotations: swarm.Annotations{Name: "db-password"}}},
+			{ID: "s2", Spec: swarm.SecretSpec{Annotations: swarm.Annotations{Name: "db-password-old"}}},
+		})
+	}))
+	s.server.CustomHandler("/configs", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]swarm.Config{
+			{ID: "c1", Spec: swarm.ConfigSpec{Annotations: swarm.Annotations{Name: "backup.conf"}}},
+		})
+	}))
+
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+	job.Secrets = []string{"db-password"}
+	job.Configs = []string{"backup.conf"}
+	c.Assert(job.ValidateParams(), IsNil)
+
+	svc, err := job.buildService(job.Command)
+	c.Assert(err, IsNil)
+
+	spec := svc.Spec.TaskTemplate.ContainerSpec
+	c.Assert(spec.Secrets, DeepEquals, []*swarm.SecretReference{{
+		SecretID:   "s1",
+		SecretName: "db-password",
+		File:       &swarm.SecretReferenceFileTarget{Name: "db-password", UID: "0", GID: "0", Mode: 0444},
+	}})
+	c.Assert(spec.Configs, DeepEquals, []*swarm.ConfigReference{{
+		ConfigID:   "c1",
+		ConfigName: "backup.conf",
+		File:       &swarm.ConfigReferenceFileTarget{Name: "/backup.conf", UID: "0", GID: "0", Mode: 0444},
+	}})
+
+	c.Assert(job.CheckSwarmRefs(), IsNil)
+
+	job.Secrets = []string{"db"}
+	_, err = job.buildService(job.Command)
+	c.Assert(err, ErrorMatches, `secret "db" not found in the swarm`)
+	c.Assert(errors.Is(job.CheckSwarmRefs(), ErrSwarmRefNotFound), Equals, true)
+
+	job.Secrets = nil
+	job.Configs = []string{"restore.conf"}
+	c.Assert(job.CheckSwarmRefs(), ErrorMatches, `config "restore.conf" not found in the swarm`)
+
+	job.Secrets = nil
+	job.Configs = []string{" "}
+	c.Assert(job.ValidateParams(), Equals, ErrEmptySwarmRef)
+}
+
+func stoppedTask(state swarm.TaskState, exitCode int) swarm.Task {
+	return swarm.Task{Status: swarm.TaskStatus{
+		State:           state,
+		ContainerStatus: &swarm.ContainerStatus{ExitCode: exitCode},
+	}}
+}
+
+func (s *SuiteRunServiceJob) TestTaskOutcome(c *C) {
+	running := swarm.Task{Status: swarm.TaskStatus{State: swarm.TaskStateRunning}}
+	failed := stoppedTask(swarm.TaskStateFailed, 2)
+	rejected := swarm.Task{Status: swarm.TaskStatus{State: swarm.TaskStateRejected}}
+
+	_, done := taskOutcome([]swarm.Task{running}, 0)
+	c.Assert(done, Equals, false)
+
+	code, done := taskOutcome([]swarm.Task{failed}, 0)
+	c.Assert(done, Equals, true)
+	c.Assert(code, Equals, 2)
+
+	code, done = taskOutcome([]swarm.Task{rejected}, 0)
+	c.Assert(done, Equals, true)
+	c.Assert(code, Equals, 255)
+
+	// restarted, within the budget
+	_, done = taskOutcome([]swarm.Task{failed, running}, 2)
+	c.Assert(done, Equals, false)
+
+	code, done = taskOutcome([]swarm.Task{failed, failed, stoppedTask(swarm.TaskStateComplete, 0)}, 2)
+	c.Assert(done, Equals, true)
+	c.Assert(code, Equals, 0)
+
+	code, done = taskOutcome([]swarm.Task{failed, rejected, failed}, 2)
+	c.Assert(done, Equals, true)
+	c.Assert(code, Equals, 2)
+}
+
+// serveTasks answers the task listings with the given lists in turn, the
+// last one being repeated
+func (s *SuiteRunServiceJob) serveTasks(lists ...[]swarm.Task) {
+	var mu sync.Mutex
+	s.server.CustomHandler("/tasks", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		tasks := lists[0]
+		if len(lists) > 1 {
+			lists = lists[1:]
+		}
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tasks)
+	}))
+}
+
+func (s *SuiteRunServiceJob) TestRunRestartOnFailure(c *C) {
+	failed := stoppedTask(swarm.TaskStateFailed, 1)
+	running := swarm.Task{Status: swarm.TaskStatus{State: swarm.TaskStateRunning}}
+	s.serveTasks(
+		[]swarm.Task{running},
+		[]swarm.Task{failed},
+		[]swarm.Task{failed, running},
+		[]swarm.Task{failed, stoppedTask(swarm.TaskStateComplete, 0)},
+	)
+
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+	job.Delete = "true"
+	job.RestartOnFailure = 2
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: logger, Job: job})
+	c.Assert(err, IsNil)
+
+	services, err := s.client.ListServices(docker.ListServicesOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(services, HasLen, 0)
+}
+
+func (s *SuiteRunServiceJob) TestRunRestartOnFailureExhausted(c *C) {
+	failed := stoppedTask(swarm.TaskStateFailed, 3)
+	s.serveTasks(
+		[]swarm.Task{failed},
+		[]swarm.Task{failed, failed},
+	)
+
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+	job.Delete = "true"
+	job.RestartOnFailure = 1
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: logger, Job: job})
+	c.Assert(ExitCode(err), Equals, 3)
+
+	// the service is removed all the same
+	services, err := s.client.ListServices(docker.ListServicesOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(services, HasLen, 0)
+}
+
 func (s *SuiteRunServiceJob) buildImage(c *C) {
 	inputbuf := bytes.NewBuffer(nil)
 	tr := tar.NewWriter(inputbuf)
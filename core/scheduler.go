@@ -3,49 +3,171 @@ package core
 import (
 	"errors"
 	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	docker "github.com/fsouza/go-dockerclient"
 	"github.com/robfig/cron/v3"
 )
 
 var (
-	ErrEmptyScheduler = errors.New("unable to start a empty scheduler.")
-	ErrEmptySchedule  = errors.New("unable to add a job with a empty schedule.")
+	ErrEmptyScheduler       = errors.New("unable to start a empty scheduler.")
+	ErrEmptySchedule        = errors.New("unable to add a job with a empty schedule.")
+	ErrScheduleConflict     = errors.New("schedule and cron are set to different values")
+	ErrOnFailureLoop        = errors.New("a job can't be its own on-failure job")
+	ErrUnknownOverlapPolicy = errors.New("unknown overlap policy")
+	ErrJobNotFound          = errors.New("job not found")
+	ErrAmbiguousJob         = errors.New("several jobs have the name")
+	ErrShutdownTimeout      = errors.New("jobs force-stopped after the shutdown timeout")
+	ErrSchedulerNotRunning  = errors.New("scheduler not running")
+	ErrSchedulerStalled     = errors.New("scheduler stalled")
 )
 
+// Overlap policies, they define what happens when a job is triggered while a
+// previous execution of the same job is still running.
+const (
+	// OverlapPolicyAllow runs the executions concurrently, the default.
+	OverlapPolicyAllow = "allow"
+	// OverlapPolicySkip skips the new execution.
+	OverlapPolicySkip = "skip"
+	// OverlapPolicyQueue holds the new execution until the previous one has
+	// finished, at most `queue-depth` executions are kept waiting.
+	OverlapPolicyQueue = "queue"
+	// OverlapPolicyCancelPrevious cancels the running execution before
+	// starting the new one.
+	OverlapPolicyCancelPrevious = "cancel-previous"
+)
+
+// ScheduleReboot runs a job once when the scheduler starts and never again,
+// as the @reboot of cron
+const ScheduleReboot = "@reboot"
+
 type Scheduler struct {
 	Jobs   []Job
 	Logger Logger
+	// DefaultJitter is used for the jobs without their own jitter
+	DefaultJitter time.Duration
+	// DefaultMaxOutput is used for the jobs without their own max-output
+	DefaultMaxOutput int64
+	// RegistryAuths are the credentials used to pull images, keyed by
+	// registry host
+	RegistryAuths map[string]docker.AuthConfiguration
+	// RunPastAt runs the jobs scheduled @at a past time as soon as the
+	// scheduler is running, instead of rejecting them
+	RunPastAt bool
+	// MaintenanceWindows are the periods during which the scheduled
+	// executions of the jobs without ignore-maintenance don't run, skipped
+	// or deferred after the window according to MaintenancePolicy
+	MaintenanceWindows []MaintenanceWindow
+	MaintenancePolicy  string
 
 	middlewareContainer
 	cron      *cron.Cron
 	wg        sync.WaitGroup
 	isRunning bool
+	// stopMu guards stopping and the executions counted in wg, none is
+	// added once stopping is closed
+	stopMu   sync.Mutex
+	stopping chan struct{}
+	paused   atomic.Bool
+	// now is the clock used to tell whether an @at time is past
+	now func() time.Time
+	// heartbeat is how often the cron loop is checked while running, the
+	// unix nano time of the last answer is kept in lastBeat
+	heartbeat time.Duration
+	lastBeat  atomic.Int64
+	// freeMemory and freeDisk read the free resources of the host, for the
+	// jobs requiring them
+	freeMemory func() (int64, error)
+	freeDisk   func() (int64, error)
+	// running and queued count the executions of all the jobs running and
+	// waiting for their overlap policy or max-concurrent
+	running atomic.Int64
+	queued  atomic.Int64
+
+	// startup are the @reboot jobs, they aren't registered in cron
+	startup []*jobWrapper
+}
+
+var cronParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// NextRun returns the first activation of a schedule after the given time,
+// without the jitter of the job
+func NextRun(schedule string, from time.Time) (time.Time, error) {
+	sched, err := parseSchedule(schedule)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return sched.Next(from), nil
 }
 
 func NewScheduler(l Logger) *Scheduler {
 	cronUtils := NewCronUtils(l)
 	cron := cron.New(
-		cron.WithParser(cron.NewParser(cron.SecondOptional|cron.Minute|cron.Hour|cron.Dom|cron.Month|cron.Dow|cron.Descriptor)),
+		cron.WithParser(cronParser),
 		cron.WithLogger(cronUtils),
 		cron.WithChain(cron.Recover(cronUtils)),
 	)
 
 	return &Scheduler{
-		Logger: l,
-		cron:   cron,
+		Logger:     l,
+		cron:       cron,
+		stopping:   make(chan struct{}),
+		now:        time.Now,
+		heartbeat:  10 * time.Second,
+		freeMemory: readFreeMemory,
+		freeDisk:   readFreeDisk,
 	}
 }
 
 func (s *Scheduler) AddJob(j Job) error {
-	if j.GetSchedule() == "" {
-		return ErrEmptySchedule
+	if err := ValidateJob(j); err != nil {
+		return err
+	}
+
+	o := j.GetSchedulingOptions()
+	jitter, err := parseJitter(o.Jitter, s.DefaultJitter)
+	if err != nil {
+		return err
+	}
+
+	maxOutput, err := ParseMaxOutput(o.MaxOutput, s.DefaultMaxOutput)
+	if err != nil {
+		return err
+	}
+
+	w := newJobWrapper(s, j)
+	w.jitter = jitter
+	w.maxOutput = maxOutput
+
+	if j.GetSchedule() == ScheduleReboot {
+		s.startup = append(s.startup, w)
+		j.Use(s.Middlewares()...)
+		s.Logger.Noticef("New job registered %q - %q - %q, it runs at startup", j.GetName(), j.GetCommand(), j.GetSchedule())
+		return nil
 	}
 
-	id, err := s.cron.AddJob(j.GetSchedule(), &jobWrapper{s, j})
+	sched, err := parseSchedule(j.GetSchedule())
 	if err != nil {
 		return err
 	}
+
+	if at, ok := sched.(*atSchedule); ok {
+		if !s.RunPastAt && !s.now().Before(at.at) {
+			return fmt.Errorf("%w: %q", ErrPastSchedule, j.GetSchedule())
+		}
+
+		at.past = s.RunPastAt
+	}
+
+	id := s.cron.Schedule(sched, w)
 	j.SetCronJobID(int(id)) // Cast to int in order to avoid pushing cron external to common
 	j.Use(s.Middlewares()...)
 	s.Logger.Noticef("New job registered %q - %q - %q - ID: %v", j.GetName(), j.GetCommand(), j.GetSchedule(), id)
@@ -54,44 +176,709 @@ func (s *Scheduler) AddJob(j Job) error {
 
 func (s *Scheduler) RemoveJob(j Job) error {
 	s.Logger.Noticef("Job deregistered (will not fire again) %q - %q - %q - ID: %v", j.GetName(), j.GetCommand(), j.GetSchedule(), j.GetCronJobID())
+	for i, w := range s.startup {
+		if w.j == j {
+			s.startup = append(s.startup[:i], s.startup[i+1:]...)
+			return nil
+		}
+	}
+
 	s.cron.Remove(cron.EntryID(j.GetCronJobID()))
 	return nil
 }
 
+// Entries returns the jobs registered in the scheduler
+func (s *Scheduler) Entries() []Job {
+	var jobs []Job
+	for _, w := range s.wrappers() {
+		jobs = append(jobs, w.j)
+	}
+
+	return jobs
+}
+
+func (s *Scheduler) wrappers() []*jobWrapper {
+	wrappers := append([]*jobWrapper{}, s.startup...)
+	for _, e := range s.cron.Entries() {
+		if w, ok := e.Job.(*jobWrapper); ok {
+			wrappers = append(wrappers, w)
+		}
+	}
+
+	return wrappers
+}
+
+// RunJob runs the registered job with the given name right away, without its
+// jitter, and returns its execution once finished. The overlap policy of the
+// job applies. It fails with ErrSchedulerNotRunning once stopped, and with
+// ErrAmbiguousJob if jobs of several types have the name, see RunEntry.
+func (s *Scheduler) RunJob(name string) (*Execution, error) {
+	w, err := s.wrapperNamed(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return w.runNow()
+}
+
+// RunEntry runs j, one of the Entries, like RunJob
+func (s *Scheduler) RunEntry(j Job) (*Execution, error) {
+	for _, w := range s.wrappers() {
+		if w.j == j {
+			return w.runNow()
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrJobNotFound, j.GetName())
+}
+
+// JobNamed returns the registered job with the given name, the names being
+// unique per job type only. It fails with ErrJobNotFound or ErrAmbiguousJob.
+func (s *Scheduler) JobNamed(name string) (Job, error) {
+	w, err := s.wrapperNamed(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return w.j, nil
+}
+
+func (s *Scheduler) wrapperNamed(name string) (*jobWrapper, error) {
+	var found *jobWrapper
+	for _, w := range s.wrappers() {
+		if w.j.GetName() != name {
+			continue
+		}
+
+		if found != nil {
+			return nil, fmt.Errorf("%w: %q", ErrAmbiguousJob, name)
+		}
+
+		found = w
+	}
+
+	if found == nil {
+		return nil, fmt.Errorf("%w: %q", ErrJobNotFound, name)
+	}
+
+	return found, nil
+}
+
 func (s *Scheduler) Start() error {
 	s.Logger.Debugf("Starting scheduler")
 	s.isRunning = true
+	s.stopMu.Lock()
+	s.stopping = make(chan struct{})
+	s.stopMu.Unlock()
 	s.cron.Start()
+	go s.beat(s.stopped())
+
+	for _, w := range s.startup {
+		// counted right away so Stop waits for them
+		if !s.begin() {
+			break
+		}
+
+		go func(w *jobWrapper) {
+			defer s.wg.Done()
+			w.Run()
+		}(w)
+	}
+
 	return nil
 }
 
+// Stop stops the scheduler and waits for the running executions to finish
 func (s *Scheduler) Stop() error {
-	s.wg.Wait()
+	return s.StopWithTimeout(0)
+}
+
+// StopWithTimeout stops the scheduler and waits up to timeout, without limit
+// if zero, for the running executions to finish. The ones still running then
+// are cancelled, the run jobs stopping their container with their
+// stop-signal, and waited for. It returns ErrShutdownTimeout with the names
+// of the jobs force-stopped.
+func (s *Scheduler) StopWithTimeout(timeout time.Duration) error {
+	// abort the executions still waiting for their jitter delay, and refuse
+	// the new ones
+	s.stopMu.Lock()
+	select {
+	case <-s.stopping:
+	default:
+		close(s.stopping)
+	}
+	s.stopMu.Unlock()
+
+	// nothing new is scheduled while waiting
 	s.cron.Stop()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	var err error
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+
+		select {
+		case <-done:
+		case <-t.C:
+			if names := s.cancelRunning(); len(names) > 0 {
+				s.Logger.Warningf("Force-stopping the jobs still running after %s: %s", timeout, strings.Join(names, ", "))
+				err = fmt.Errorf("%w: %s", ErrShutdownTimeout, strings.Join(names, ", "))
+			}
+		}
+	}
+
+	<-done
 	s.isRunning = false
 
-	return nil
+	return err
+}
+
+// begin counts a new execution in wg, so the stop waits for it. It returns
+// false once the scheduler is stopping, the execution must not start.
+func (s *Scheduler) begin() bool {
+	s.stopMu.Lock()
+	defer s.stopMu.Unlock()
+
+	select {
+	case <-s.stopping:
+		return false
+	default:
+	}
+
+	s.wg.Add(1)
+	return true
+}
+
+// stopped returns the channel closed once the scheduler is stopping
+func (s *Scheduler) stopped() <-chan struct{} {
+	s.stopMu.Lock()
+	defer s.stopMu.Unlock()
+
+	return s.stopping
+}
+
+// cancelRunning cancels the running executions and returns the names of
+// their jobs
+func (s *Scheduler) cancelRunning() []string {
+	var names []string
+	for _, w := range s.wrappers() {
+		w.mu.Lock()
+		for ctx := range w.active {
+			ctx.Cancel()
+		}
+
+		if len(w.active) > 0 {
+			names = append(names, w.j.GetName())
+		}
+		w.mu.Unlock()
+	}
+
+	sort.Strings(names)
+	return names
 }
 
 func (s *Scheduler) IsRunning() bool {
 	return s.isRunning
 }
 
+// beat records when the cron loop answers until stop is closed. The entries
+// are read through the loop while it runs, a stuck loop stops the beats.
+func (s *Scheduler) beat(stop <-chan struct{}) {
+	t := time.NewTicker(s.heartbeat)
+	defer t.Stop()
+
+	for {
+		s.cron.Entries()
+		s.lastBeat.Store(time.Now().UnixNano())
+
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Health returns nil if the scheduler is running and its cron loop answered
+// within the last three heartbeats, the liveness of the daemon
+func (s *Scheduler) Health() error {
+	last := s.lastBeat.Load()
+	if last == 0 {
+		return ErrSchedulerNotRunning
+	}
+
+	select {
+	case <-s.stopped():
+		return ErrSchedulerNotRunning
+	default:
+	}
+
+	if age := time.Since(time.Unix(0, last)); age > 3*s.heartbeat {
+		return fmt.Errorf("%w: last heartbeat %s ago", ErrSchedulerStalled, age.Round(time.Second))
+	}
+
+	return nil
+}
+
+// PauseAll skips the scheduled executions until ResumeAll is called, the
+// jobs stay registered and can still be run with RunJob
+func (s *Scheduler) PauseAll() {
+	s.paused.Store(true)
+}
+
+// ResumeAll lets the scheduled executions run again after PauseAll
+func (s *Scheduler) ResumeAll() {
+	s.paused.Store(false)
+}
+
+// IsPaused reports whether the scheduled executions are paused
+func (s *Scheduler) IsPaused() bool {
+	return s.paused.Load()
+}
+
+// Running returns the number of executions running, of all the jobs
+func (s *Scheduler) Running() int {
+	return int(s.running.Load())
+}
+
+// Queued returns the number of executions waiting for their overlap policy or
+// max-concurrent, of all the jobs
+func (s *Scheduler) Queued() int {
+	return int(s.queued.Load())
+}
+
+// ValidateJob checks the parameters of a job without adding it to any
+// scheduler: the schedule, set with schedule or cron, the overlap policy,
+// the jitter, the retries and, if the job has a ValidateParams method, the
+// parameters specific to its type
+func ValidateJob(j Job) error {
+	o := j.GetSchedulingOptions()
+	if j.GetSchedule() == "" {
+		return ErrEmptySchedule
+	}
+
+	if c := j.GetCron(); c != "" && c != j.GetSchedule() {
+		return fmt.Errorf("%w: %q and %q", ErrScheduleConflict, j.GetSchedule(), c)
+	}
+
+	// @reboot is handled by the scheduler, not cron
+	if j.GetSchedule() != ScheduleReboot {
+		if _, err := parseSchedule(j.GetSchedule()); err != nil {
+			return fmt.Errorf("invalid schedule %q: %w", j.GetSchedule(), err)
+		}
+	}
+
+	if err := validateOverlapPolicy(o.OverlapPolicy); err != nil {
+		return err
+	}
+
+	if n := o.MaxConcurrent; n < 0 {
+		return fmt.Errorf("invalid max-concurrent %d", n)
+	}
+
+	if n := o.MaxRuns; n < 0 {
+		return fmt.Errorf("invalid max-runs %d", n)
+	}
+
+	if _, err := parseJitter(o.Jitter, 0); err != nil {
+		return err
+	}
+
+	if _, _, err := parseRetryBackoff(j); err != nil {
+		return err
+	}
+
+	if _, err := ParseMaxOutput(o.MaxOutput, 0); err != nil {
+		return err
+	}
+
+	if err := validateOutputKeep(o.OutputKeep); err != nil {
+		return err
+	}
+
+	if err := validateOutputEncoding(o.OutputEncoding); err != nil {
+		return err
+	}
+
+	if v := o.RequireFreeMemory; v != "" {
+		if _, err := parseRequiredFree("require-free-memory", v); err != nil {
+			return err
+		}
+	}
+
+	if v := o.RequireFreeDisk; v != "" {
+		if _, err := parseRequiredFree("require-free-disk", v); err != nil {
+			return err
+		}
+	}
+
+	if v := o.NotifyEmpty; v != "" {
+		if _, err := strconv.ParseBool(v); err != nil {
+			return fmt.Errorf("invalid notify-empty %q, expected true or false", v)
+		}
+	}
+
+	if f := o.OnFailure; f != "" && f == j.GetName() {
+		return fmt.Errorf("%w: %q", ErrOnFailureLoop, f)
+	}
+
+	if o.CommandTemplate {
+		if _, err := parseCommandTemplate(j.GetCommand()); err != nil {
+			return err
+		}
+	}
+
+	if v, ok := j.(interface{ ValidateParams() error }); ok {
+		return v.ValidateParams()
+	}
+
+	return nil
+}
+
+func parseJitter(value string, fallback time.Duration) (time.Duration, error) {
+	if value == "" {
+		return fallback, nil
+	}
+
+	jitter, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid jitter %q: %w", value, err)
+	}
+
+	if jitter < 0 {
+		return 0, fmt.Errorf("invalid jitter %q, can't be negative", value)
+	}
+
+	return jitter, nil
+}
+
+func validateOverlapPolicy(policy string) error {
+	switch policy {
+	case "", OverlapPolicyAllow, OverlapPolicySkip, OverlapPolicyQueue, OverlapPolicyCancelPrevious:
+		return nil
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownOverlapPolicy, policy)
+	}
+}
+
 type jobWrapper struct {
 	s *Scheduler
 	j Job
+
+	// slot is held by the running execution when the overlap policy is
+	// other than "allow"
+	slot    chan struct{}
+	mu      sync.Mutex
+	waiting int
+	active  map[*Context]struct{}
+
+	// limit holds a slot per running execution when the job has a
+	// max-concurrent, nil otherwise
+	limit chan struct{}
+	// runs is the number of scheduled executions, counted against max-runs
+	runs int
+	// deferred is set while a scheduled execution waits for the end of a
+	// maintenance window
+	deferred bool
+
+	// jitter is the upper bound of the random delay applied to each execution
+	jitter time.Duration
+	// maxOutput is the size of the buffers of the streams, the default one
+	// if zero
+	maxOutput int64
+	rand      *rand.Rand
+}
+
+func newJobWrapper(s *Scheduler, j Job) *jobWrapper {
+	w := &jobWrapper{
+		s:      s,
+		j:      j,
+		slot:   make(chan struct{}, 1),
+		active: make(map[*Context]struct{}),
+		rand:   rand.New(rand.NewSource(jitterSeed(j.GetName()))),
+	}
+
+	if n := j.GetSchedulingOptions().MaxConcurrent; n > 0 {
+		w.limit = make(chan struct{}, n)
+	}
+
+	return w
 }
 
 func (w *jobWrapper) Run() {
-	w.s.wg.Add(1)
+	if w.s.IsPaused() {
+		w.s.Logger.Debugf("Job %q not executed, the scheduler is paused", w.j.GetName())
+		return
+	}
+
+	if !w.maintenance() {
+		return
+	}
+
+	if !w.countRun() {
+		return
+	}
+
+	w.run(true, nil)
+}
+
+// countRun counts a scheduled execution against the max-runs of the job,
+// removing the job from the scheduler on the last one. It returns false once
+// the runs are exhausted, for the activations already queued by cron.
+func (w *jobWrapper) countRun() bool {
+	max := w.j.GetSchedulingOptions().MaxRuns
+	if max <= 0 {
+		return true
+	}
+
+	w.mu.Lock()
+	if w.runs >= max {
+		w.mu.Unlock()
+		return false
+	}
+
+	w.runs++
+	last := w.runs == max
+	w.mu.Unlock()
+
+	if last {
+		w.s.Logger.Noticef("Job %q reached its max-runs %d, removing it", w.j.GetName(), max)
+		w.s.RemoveJob(w.j)
+	}
+
+	return true
+}
+
+// run executes the job, after the jitter delay if jitter is set, and returns
+// the execution, nil if the scheduler is stopping or was stopped during the
+// delay. chain are the jobs whose failures led to this execution through
+// on-failure.
+// runNow runs the job right away for RunJob and RunEntry
+func (w *jobWrapper) runNow() (*Execution, error) {
+	if e := w.run(false, nil); e != nil {
+		return e, nil
+	}
+
+	return nil, ErrSchedulerNotRunning
+}
+
+func (w *jobWrapper) run(jitter bool, chain []string) *Execution {
+	if !w.s.begin() {
+		w.s.Logger.Debugf("Job %q not executed, the scheduler is stopping", w.j.GetName())
+		return nil
+	}
 	defer w.s.wg.Done()
 
-	e := NewExecution()
+	return w.execute(jitter, chain)
+}
+
+// execute is run for an execution already counted in the wait group of the
+// scheduler
+func (w *jobWrapper) execute(jitter bool, chain []string) *Execution {
+	if jitter && !w.delay() {
+		w.s.Logger.Debugf("Job %q not executed, the scheduler is stopping", w.j.GetName())
+		return nil
+	}
+
+	o := w.j.GetSchedulingOptions()
+	e := newExecution(w.maxOutput, o.OutputKeep)
+	e.OutputEncoding = o.OutputEncoding
 	ctx := NewContext(w.s, w.j, e)
+	defer ctx.Cancel()
+
+	queued := time.Now()
+	var release func()
+	reason := w.checkResources()
+	if reason == "" {
+		release, reason = w.wait()
+	}
+
+	if release != nil {
+		e.QueueWait = time.Since(queued)
+	}
 
 	w.start(ctx)
+	if release == nil {
+		ctx.Stop(ErrSkippedExecution)
+		ctx.Log("Skipped - " + reason)
+	} else {
+		w.s.running.Add(1)
+		w.track(ctx)
+		defer release()
+		defer w.s.running.Add(-1)
+		defer w.untrack(ctx)
+	}
+
 	err := ctx.Next()
 	w.stop(ctx, err)
+	if e.Failed {
+		w.onFailure(chain)
+	}
+
+	return e
+}
+
+// onFailure runs the on-failure job of the job in the background, unless it
+// already failed in the chain of failures, which would loop forever
+func (w *jobWrapper) onFailure(chain []string) {
+	name := w.j.GetSchedulingOptions().OnFailure
+	if name == "" {
+		return
+	}
+
+	chain = append(chain[:len(chain):len(chain)], w.j.GetName())
+	for _, failed := range chain {
+		if failed == name {
+			w.s.Logger.Warningf(
+				"Job %q not run on the failure of %q, it already failed before: %s",
+				name, w.j.GetName(), strings.Join(chain, " -> "),
+			)
+			return
+		}
+	}
+
+	hook, err := w.s.wrapperNamed(name)
+	if err != nil {
+		w.s.Logger.Errorf("Can't run the on-failure job of %q: %s", w.j.GetName(), err)
+		return
+	}
+
+	if !w.s.begin() {
+		return
+	}
+
+	go func() {
+		defer w.s.wg.Done()
+		w.s.Logger.Noticef("Running job %q on the failure of %q", name, w.j.GetName())
+		hook.execute(false, chain)
+	}()
+}
+
+// wait acquires the slots of the overlap policy and the max-concurrent of
+// the job, the execution being counted as queued meanwhile. It returns the
+// function releasing them or, if the execution must be skipped, nil and the
+// reason.
+func (w *jobWrapper) wait() (func(), string) {
+	w.s.queued.Add(1)
+	defer w.s.queued.Add(-1)
+
+	release, reason := w.acquire()
+	if release == nil || w.limit == nil {
+		return release, reason
+	}
+
+	// the executions allowed by the overlap policy wait for a free slot
+	w.limit <- struct{}{}
+	return func() {
+		<-w.limit
+		release()
+	}, ""
+}
+
+// acquire applies the overlap policy of the job, it returns the function to
+// be called once the execution has finished or, if the execution must be
+// skipped, nil and the reason.
+func (w *jobWrapper) acquire() (func(), string) {
+	noop := func() {}
+	release := func() { <-w.slot }
+
+	switch w.j.GetSchedulingOptions().OverlapPolicy {
+	case OverlapPolicySkip:
+		select {
+		case w.slot <- struct{}{}:
+			return release, ""
+		default:
+			return nil, "previous execution still running"
+		}
+	case OverlapPolicyQueue:
+		select {
+		case w.slot <- struct{}{}:
+			return release, ""
+		default:
+		}
+
+		w.mu.Lock()
+		if w.waiting >= w.queueDepth() {
+			w.mu.Unlock()
+			return nil, "execution queue is full"
+		}
+		w.waiting++
+		w.mu.Unlock()
+
+		w.slot <- struct{}{}
+
+		w.mu.Lock()
+		w.waiting--
+		w.mu.Unlock()
+		return release, ""
+	case OverlapPolicyCancelPrevious:
+		w.mu.Lock()
+		for ctx := range w.active {
+			ctx.Cancel()
+		}
+		w.mu.Unlock()
+
+		w.slot <- struct{}{}
+		return release, ""
+	default:
+		return noop, ""
+	}
+}
+
+// delay waits a random duration in [0, jitter), it returns false if the
+// scheduler was stopped meanwhile.
+func (w *jobWrapper) delay() bool {
+	if w.jitter <= 0 {
+		return true
+	}
+
+	w.mu.Lock()
+	d := time.Duration(w.rand.Int63n(int64(w.jitter)))
+	w.mu.Unlock()
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-w.s.stopped():
+		return false
+	}
+}
+
+// jitterSeed derives the seed of the jitter random source from the job name,
+// so each job gets its own sequence of delays.
+func jitterSeed(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+func (w *jobWrapper) queueDepth() int {
+	if d := w.j.GetSchedulingOptions().QueueDepth; d > 0 {
+		return d
+	}
+
+	return 1
+}
+
+func (w *jobWrapper) track(ctx *Context) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.active[ctx] = struct{}{}
+}
+
+func (w *jobWrapper) untrack(ctx *Context) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.active, ctx)
 }
 
 func (w *jobWrapper) start(ctx *Context) {
@@ -1,6 +1,12 @@
 package core
 
 import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	. "gopkg.in/check.v1"
@@ -23,6 +29,181 @@ func (s *SuiteScheduler) TestAddJob(c *C) {
 	c.Assert(e[0].Job.(*jobWrapper).j, DeepEquals, job)
 }
 
+func (s *SuiteScheduler) TestEntries(c *C) {
+	job := &TestJob{}
+	job.Schedule = "@hourly"
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.Entries(), HasLen, 0)
+	c.Assert(sc.AddJob(job), IsNil)
+	c.Assert(sc.Entries(), DeepEquals, []Job{job})
+
+	c.Assert(sc.RemoveJob(job), IsNil)
+	c.Assert(sc.Entries(), HasLen, 0)
+}
+
+func (s *SuiteScheduler) TestRunJob(c *C) {
+	job := &TestJob{}
+	job.Name = "foo"
+	job.Schedule = "@hourly"
+	// the jitter is ignored when running a job on demand
+	job.Jitter = "1h"
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(job), IsNil)
+
+	e, err := sc.RunJob("foo")
+	c.Assert(err, IsNil)
+	c.Assert(job.Called, Equals, 1)
+	c.Assert(e.Failed, Equals, false)
+	c.Assert(e.Duration > 0, Equals, true)
+
+	_, err = sc.RunJob("bar")
+	c.Assert(err, ErrorMatches, `job not found: "bar"`)
+	c.Assert(job.Called, Equals, 1)
+}
+
+func (s *SuiteScheduler) TestRunJobSameName(c *C) {
+	// the names are unique per job type only
+	a, b := &TestJob{}, &TestJob{}
+	a.Name, b.Name = "backup", "backup"
+	a.Schedule, b.Schedule = "@hourly", "@daily"
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(a), IsNil)
+	c.Assert(sc.AddJob(b), IsNil)
+
+	_, err := sc.RunJob("backup")
+	c.Assert(errors.Is(err, ErrAmbiguousJob), Equals, true)
+	_, err = sc.JobNamed("backup")
+	c.Assert(err, ErrorMatches, `several jobs have the name: "backup"`)
+
+	for _, j := range []*TestJob{a, b, b} {
+		_, err := sc.RunEntry(j)
+		c.Assert(err, IsNil)
+	}
+
+	c.Assert(a.Called, Equals, 1)
+	c.Assert(b.Called, Equals, 2)
+
+	_, err = sc.RunEntry(&TestJob{})
+	c.Assert(errors.Is(err, ErrJobNotFound), Equals, true)
+}
+
+func (s *SuiteScheduler) TestReboot(c *C) {
+	job := &TestJob{}
+	job.Name = "startup"
+	job.Schedule = ScheduleReboot
+	c.Assert(ValidateJob(job), IsNil)
+
+	ticking := &TestJob{}
+	ticking.Name = "ticking"
+	ticking.Schedule = "@every 1s"
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(job), IsNil)
+	c.Assert(sc.AddJob(ticking), IsNil)
+
+	// not a cron entry, but still a job of the scheduler
+	c.Assert(sc.cron.Entries(), HasLen, 1)
+	c.Assert(sc.Entries(), DeepEquals, []Job{job, ticking})
+	c.Assert(job.Called, Equals, 0)
+
+	sc.Start()
+	time.Sleep(time.Millisecond * 2500)
+	sc.Stop()
+
+	c.Assert(job.Called, Equals, 1)
+	c.Assert(ticking.Called >= 2, Equals, true)
+
+	c.Assert(sc.RemoveJob(job), IsNil)
+	c.Assert(sc.Entries(), DeepEquals, []Job{ticking})
+}
+
+func (s *SuiteScheduler) TestPauseAll(c *C) {
+	job := &TestJob{}
+	job.Name = "paused"
+	job.Schedule = "@every 1s"
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(job), IsNil)
+	w := sc.wrappers()[0]
+
+	sc.PauseAll()
+	c.Assert(sc.IsPaused(), Equals, true)
+	w.Run()
+	c.Assert(job.Called, Equals, 0)
+	c.Assert(sc.Entries(), HasLen, 1)
+
+	// the manual runs are not affected
+	_, err := sc.RunJob("paused")
+	c.Assert(err, IsNil)
+	c.Assert(job.Called, Equals, 1)
+
+	sc.ResumeAll()
+	c.Assert(sc.IsPaused(), Equals, false)
+	w.Run()
+	c.Assert(job.Called, Equals, 2)
+}
+
+// recordingLogger keeps the messages logged
+type recordingLogger struct {
+	TestLogger
+	mu       sync.Mutex
+	messages []string
+}
+
+func (l *recordingLogger) Noticef(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages = append(l.messages, fmt.Sprintf(format, args...))
+}
+
+func (s *SuiteScheduler) TestExecutionIDLogged(c *C) {
+	job := &TestJob{}
+	job.Name = "logged"
+	job.Schedule = "@daily"
+
+	logger := &recordingLogger{}
+	sc := NewScheduler(logger)
+	c.Assert(sc.AddJob(job), IsNil)
+
+	first, err := sc.RunJob("logged")
+	c.Assert(err, IsNil)
+	second, err := sc.RunJob("logged")
+	c.Assert(err, IsNil)
+	c.Assert(first.ID, Not(Equals), second.ID)
+
+	prefix := fmt.Sprintf("[Job %q (%s)] ", "logged", first.ID)
+	var started, finished bool
+	for _, m := range logger.messages {
+		started = started || strings.HasPrefix(m, prefix+"Started")
+		finished = finished || strings.HasPrefix(m, prefix+"Finished")
+	}
+
+	c.Assert(started, Equals, true)
+	c.Assert(finished, Equals, true)
+}
+
+func (s *SuiteScheduler) TestNextRun(c *C) {
+	from := time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC)
+
+	next, err := NextRun("@hourly", from)
+	c.Assert(err, IsNil)
+	c.Assert(next, Equals, time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC))
+
+	next, err = NextRun("0 0 2 * * *", from)
+	c.Assert(err, IsNil)
+	c.Assert(next, Equals, time.Date(2024, 1, 2, 2, 0, 0, 0, time.UTC))
+
+	next, err = NextRun("@every 10s", from)
+	c.Assert(err, IsNil)
+	c.Assert(next, Equals, from.Add(10*time.Second))
+
+	_, err = NextRun("foo", from)
+	c.Assert(err, NotNil)
+}
+
 func (s *SuiteScheduler) TestStartStop(c *C) {
 	job := &TestJob{}
 	job.Schedule = "@every 1s"
@@ -40,6 +221,22 @@ func (s *SuiteScheduler) TestStartStop(c *C) {
 	c.Assert(sc.IsRunning(), Equals, false)
 }
 
+func (s *SuiteScheduler) TestRunJobAfterStop(c *C) {
+	job := &TestJob{}
+	job.Name = "backup"
+	job.Schedule = "@hourly"
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(job), IsNil)
+	c.Assert(sc.Start(), IsNil)
+	c.Assert(sc.Stop(), IsNil)
+
+	e, err := sc.RunJob("backup")
+	c.Assert(err, Equals, ErrSchedulerNotRunning)
+	c.Assert(e, IsNil)
+	c.Assert(job.Called, Equals, 0)
+}
+
 func (s *SuiteScheduler) TestMergeMiddlewaresSame(c *C) {
 	mA, mB, mC := &TestMiddleware{}, &TestMiddleware{}, &TestMiddleware{}
 
@@ -55,3 +252,532 @@ func (s *SuiteScheduler) TestMergeMiddlewaresSame(c *C) {
 	c.Assert(m, HasLen, 1)
 	c.Assert(m[0], Equals, mB)
 }
+
+func (s *SuiteScheduler) TestAddJobUnknownOverlapPolicy(c *C) {
+	job := &TestJob{}
+	job.Schedule = "@hourly"
+	job.OverlapPolicy = "foo"
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(job), ErrorMatches, "unknown overlap policy.*")
+	c.Assert(sc.cron.Entries(), HasLen, 0)
+}
+
+func (s *SuiteScheduler) TestValidateJob(c *C) {
+	job := &TestJob{}
+	c.Assert(ValidateJob(job), Equals, ErrEmptySchedule)
+
+	job.Schedule = "@every 1m"
+	c.Assert(ValidateJob(job), IsNil)
+
+	job.Schedule = "0 */5 * * * *"
+	c.Assert(ValidateJob(job), IsNil)
+
+	job.Schedule = "foo"
+	c.Assert(ValidateJob(job), ErrorMatches, "invalid schedule.*")
+
+	job.Schedule = "@hourly"
+	job.OverlapPolicy = "foo"
+	c.Assert(ValidateJob(job), ErrorMatches, "unknown overlap policy.*")
+	job.OverlapPolicy = ""
+
+	job.Schedule = ""
+	job.Cron = "0 */5 * * * *"
+	c.Assert(ValidateJob(job), IsNil)
+	c.Assert(job.GetSchedule(), Equals, "0 */5 * * * *")
+
+	job.Schedule = "0 */5 * * * *"
+	c.Assert(ValidateJob(job), IsNil)
+
+	job.Schedule = "*/5 * * * *"
+	c.Assert(errors.Is(ValidateJob(job), ErrScheduleConflict), Equals, true)
+	job.Cron = ""
+
+	job.OverlapPolicy = OverlapPolicySkip
+	job.Jitter = "foo"
+	c.Assert(ValidateJob(job), ErrorMatches, "invalid jitter.*")
+
+	job.Jitter = "-5s"
+	c.Assert(ValidateJob(job), ErrorMatches, `invalid jitter "-5s", can't be negative`)
+}
+
+func (s *SuiteScheduler) TestScheduleFields(c *C) {
+	// the seconds are optional, whatever the key and wherever it's parsed
+	for _, schedule := range []string{"*/30 * * * * *", "*/5 * * * *", "@every 90s"} {
+		for _, cron := range []bool{false, true} {
+			job := &TestJob{}
+			job.Name = "job"
+			if cron {
+				job.Cron = schedule
+			} else {
+				job.Schedule = schedule
+			}
+
+			comment := Commentf("schedule %q, cron %v", schedule, cron)
+			c.Assert(ValidateJob(job), IsNil, comment)
+
+			_, err := NextRun(job.GetSchedule(), time.Now())
+			c.Assert(err, IsNil, comment)
+
+			sc := NewScheduler(&TestLogger{})
+			c.Assert(sc.AddJob(job), IsNil, comment)
+			c.Assert(sc.Entries(), HasLen, 1, comment)
+		}
+	}
+}
+
+func (s *SuiteScheduler) TestOverlapPolicyAllow(c *C) {
+	job := newBlockingTestJob(OverlapPolicyAllow)
+	w := newJobWrapper(NewScheduler(&TestLogger{}), job)
+
+	wg := runWrapperAsync(w, 2)
+	<-job.started
+	<-job.started
+	close(job.release)
+	wg.Wait()
+
+	c.Assert(atomic.LoadInt32(&job.called), Equals, int32(2))
+}
+
+func (s *SuiteScheduler) TestOverlapPolicySkip(c *C) {
+	job := newBlockingTestJob(OverlapPolicySkip)
+	w := newJobWrapper(NewScheduler(&TestLogger{}), job)
+
+	wg := runWrapperAsync(w, 1)
+	<-job.started
+
+	w.Run()
+	c.Assert(atomic.LoadInt32(&job.called), Equals, int32(1))
+
+	close(job.release)
+	wg.Wait()
+	c.Assert(atomic.LoadInt32(&job.called), Equals, int32(1))
+}
+
+func (s *SuiteScheduler) TestOverlapPolicyQueue(c *C) {
+	job := newBlockingTestJob(OverlapPolicyQueue)
+	w := newJobWrapper(NewScheduler(&TestLogger{}), job)
+
+	wg := runWrapperAsync(w, 1)
+	<-job.started
+
+	queued := runWrapperAsync(w, 1)
+	for {
+		w.mu.Lock()
+		waiting := w.waiting
+		w.mu.Unlock()
+		if waiting == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// the queue depth defaults to 1, so this one is skipped
+	w.Run()
+	c.Assert(atomic.LoadInt32(&job.called), Equals, int32(1))
+
+	job.release <- struct{}{}
+	wg.Wait()
+
+	<-job.started
+	job.release <- struct{}{}
+	queued.Wait()
+
+	c.Assert(atomic.LoadInt32(&job.called), Equals, int32(2))
+}
+
+func (s *SuiteScheduler) TestOverlapPolicyCancelPrevious(c *C) {
+	job := newBlockingTestJob(OverlapPolicyCancelPrevious)
+	w := newJobWrapper(NewScheduler(&TestLogger{}), job)
+
+	wg := runWrapperAsync(w, 1)
+	<-job.started
+
+	second := runWrapperAsync(w, 1)
+	wg.Wait()
+	c.Assert(atomic.LoadInt32(&job.cancelled), Equals, int32(1))
+
+	<-job.started
+	close(job.release)
+	second.Wait()
+
+	c.Assert(atomic.LoadInt32(&job.called), Equals, int32(2))
+	c.Assert(atomic.LoadInt32(&job.cancelled), Equals, int32(1))
+}
+
+func (s *SuiteScheduler) TestMaxConcurrent(c *C) {
+	for _, limit := range []int{1, 2} {
+		job := &SlowTestJob{}
+		job.Name = "slow"
+		job.MaxConcurrent = limit
+		w := newJobWrapper(NewScheduler(&TestLogger{}), job)
+
+		// the overlap policy allows them all, the limit serializes them
+		runWrapperAsync(w, 4).Wait()
+		c.Assert(atomic.LoadInt32(&job.called), Equals, int32(4))
+		c.Assert(atomic.LoadInt32(&job.max), Equals, int32(limit))
+	}
+
+	job := &SlowTestJob{}
+	job.Name = "slow"
+	runWrapperAsync(newJobWrapper(NewScheduler(&TestLogger{}), job), 4).Wait()
+	c.Assert(atomic.LoadInt32(&job.max), Equals, int32(4))
+
+	job.Schedule = "@hourly"
+	job.MaxConcurrent = -1
+	c.Assert(ValidateJob(job), ErrorMatches, "invalid max-concurrent -1")
+}
+
+func (s *SuiteScheduler) TestValidateNotifyEmpty(c *C) {
+	job := &TestJob{}
+	job.Schedule = "@hourly"
+	c.Assert(ValidateJob(job), IsNil)
+
+	job.NotifyEmpty = "false"
+	c.Assert(ValidateJob(job), IsNil)
+
+	job.NotifyEmpty = "never"
+	c.Assert(ValidateJob(job), ErrorMatches, `invalid notify-empty "never".*`)
+}
+
+func (s *SuiteScheduler) TestRunningQueued(c *C) {
+	job := newBlockingTestJob(OverlapPolicyAllow)
+	job.MaxConcurrent = 1
+	sc := NewScheduler(&TestLogger{})
+	w := newJobWrapper(sc, job)
+
+	wg := runWrapperAsync(w, 2)
+	<-job.started
+	for sc.Queued() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	c.Assert(sc.Running(), Equals, 1)
+
+	job.release <- struct{}{}
+	<-job.started
+	c.Assert(sc.Running(), Equals, 1)
+	c.Assert(sc.Queued(), Equals, 0)
+
+	job.release <- struct{}{}
+	wg.Wait()
+	c.Assert(sc.Running(), Equals, 0)
+	c.Assert(sc.Queued(), Equals, 0)
+}
+
+func (s *SuiteScheduler) TestMaxRuns(c *C) {
+	job := &TestJob{}
+	job.Name = "foo"
+	job.Schedule = "@every 1s"
+	job.MaxRuns = 3
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(job), IsNil)
+	w := sc.wrappers()[0]
+
+	// the activations queued once the job is removed are skipped
+	for i := 0; i < 5; i++ {
+		w.Run()
+	}
+
+	c.Assert(job.Called, Equals, 3)
+	c.Assert(sc.Entries(), HasLen, 0)
+
+	// the executions on demand aren't counted
+	c.Assert(sc.AddJob(job), IsNil)
+	_, err := sc.RunJob("foo")
+	c.Assert(err, IsNil)
+	c.Assert(job.Called, Equals, 4)
+	c.Assert(sc.Entries(), HasLen, 1)
+
+	job.MaxRuns = -1
+	c.Assert(ValidateJob(job), ErrorMatches, "invalid max-runs -1")
+}
+
+func (s *SuiteScheduler) TestHealth(c *C) {
+	sc := NewScheduler(&TestLogger{})
+	sc.heartbeat = time.Hour
+	c.Assert(sc.Health(), Equals, ErrSchedulerNotRunning)
+
+	c.Assert(sc.Start(), IsNil)
+	for i := 0; i < 100 && sc.lastBeat.Load() == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	c.Assert(sc.Health(), IsNil)
+
+	// no beat for longer than three heartbeats
+	sc.lastBeat.Store(time.Now().Add(-4 * time.Hour).UnixNano())
+	c.Assert(sc.Health(), ErrorMatches, "scheduler stalled: last heartbeat 4h0m0s ago")
+
+	c.Assert(sc.Stop(), IsNil)
+	c.Assert(sc.Health(), Equals, ErrSchedulerNotRunning)
+}
+
+func (s *SuiteScheduler) TestAddJobJitter(c *C) {
+	sc := NewScheduler(&TestLogger{})
+	sc.DefaultJitter = time.Minute
+
+	job := &TestJob{}
+	job.Schedule = "@hourly"
+	c.Assert(sc.AddJob(job), IsNil)
+
+	other := &TestJob{}
+	other.Schedule = "@hourly"
+	other.Jitter = "10s"
+	c.Assert(sc.AddJob(other), IsNil)
+
+	e := sc.cron.Entries()
+	c.Assert(e[0].Job.(*jobWrapper).jitter, Equals, time.Minute)
+	c.Assert(e[1].Job.(*jobWrapper).jitter, Equals, 10*time.Second)
+
+	invalid := &TestJob{}
+	invalid.Schedule = "@hourly"
+	invalid.Jitter = "foo"
+	c.Assert(sc.AddJob(invalid), ErrorMatches, "invalid jitter.*")
+}
+
+func (s *SuiteScheduler) TestJitterDelay(c *C) {
+	job := &TestJob{}
+	w := newJobWrapper(NewScheduler(&TestLogger{}), job)
+	w.jitter = 200 * time.Millisecond
+	w.rand = rand.New(&fixedSource{v: int64(w.jitter) / 2})
+
+	start := time.Now()
+	c.Assert(w.delay(), Equals, true)
+	elapsed := time.Since(start)
+	c.Assert(elapsed >= 100*time.Millisecond, Equals, true)
+	c.Assert(elapsed < w.jitter, Equals, true)
+}
+
+func (s *SuiteScheduler) TestJitterDelayStopped(c *C) {
+	job := &TestJob{}
+	sc := NewScheduler(&TestLogger{})
+	w := newJobWrapper(sc, job)
+	w.jitter = time.Hour
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		sc.Stop()
+	}()
+
+	start := time.Now()
+	w.Run()
+	c.Assert(time.Since(start) < time.Second, Equals, true)
+	c.Assert(job.Called, Equals, 0)
+}
+
+// fixedSource is a rand.Source always returning the same value
+type fixedSource struct{ v int64 }
+
+func (s *fixedSource) Int63() int64 { return s.v }
+func (s *fixedSource) Seed(int64)   {}
+
+func runWrapperAsync(w *jobWrapper, n int) *sync.WaitGroup {
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.Run()
+		}()
+	}
+
+	return &wg
+}
+
+// BlockingTestJob runs until it is released or its execution is cancelled
+type BlockingTestJob struct {
+	BareJob
+	called    int32
+	cancelled int32
+	started   chan struct{}
+	release   chan struct{}
+}
+
+func newBlockingTestJob(policy string) *BlockingTestJob {
+	job := &BlockingTestJob{
+		started: make(chan struct{}, 10),
+		release: make(chan struct{}),
+	}
+	job.Name = "blocking"
+	job.OverlapPolicy = policy
+
+	return job
+}
+
+func (j *BlockingTestJob) Run(ctx *Context) error {
+	atomic.AddInt32(&j.called, 1)
+	j.started <- struct{}{}
+
+	select {
+	case <-j.release:
+		return nil
+	case <-ctx.Ctx().Done():
+		atomic.AddInt32(&j.cancelled, 1)
+		return ctx.Ctx().Err()
+	}
+}
+
+// SlowTestJob records the highest number of its executions running at the
+// same time
+type SlowTestJob struct {
+	BareJob
+	called  int32
+	current int32
+	max     int32
+}
+
+func (j *SlowTestJob) Run(ctx *Context) error {
+	atomic.AddInt32(&j.called, 1)
+	n := atomic.AddInt32(&j.current, 1)
+	defer atomic.AddInt32(&j.current, -1)
+
+	for {
+		max := atomic.LoadInt32(&j.max)
+		if n <= max || atomic.CompareAndSwapInt32(&j.max, max, n) {
+			break
+		}
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	return nil
+}
+
+// failingJob returns a job failing on every execution, with the given
+// on-failure job
+func failingJob(name, onFailure string) *FailingTestJob {
+	job := &FailingTestJob{Failures: 100}
+	job.Name = name
+	job.Schedule = "@hourly"
+	job.OnFailure = onFailure
+	return job
+}
+
+func (s *SuiteScheduler) TestOnFailure(c *C) {
+	job := failingJob("backup", "cleanup")
+	cleanup := &TestJob{}
+	cleanup.Name = "cleanup"
+	cleanup.Schedule = "@daily"
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(job), IsNil)
+	c.Assert(sc.AddJob(cleanup), IsNil)
+
+	e, err := sc.RunJob("backup")
+	c.Assert(err, IsNil)
+	c.Assert(e.Failed, Equals, true)
+
+	// waits for the on-failure job, run in the background
+	sc.Stop()
+	c.Assert(cleanup.Called, Equals, 1)
+}
+
+func (s *SuiteScheduler) TestOnFailureNotOnSuccess(c *C) {
+	job := &TestJob{}
+	job.Name = "backup"
+	job.Schedule = "@hourly"
+	job.OnFailure = "cleanup"
+	cleanup := failingJob("cleanup", "")
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(job), IsNil)
+	c.Assert(sc.AddJob(cleanup), IsNil)
+
+	e, err := sc.RunJob("backup")
+	c.Assert(err, IsNil)
+	c.Assert(e.Failed, Equals, false)
+
+	sc.Stop()
+	c.Assert(cleanup.Called, Equals, 0)
+}
+
+func (s *SuiteScheduler) TestOnFailureLoop(c *C) {
+	a, b := failingJob("a", "b"), failingJob("b", "a")
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(a), IsNil)
+	c.Assert(sc.AddJob(b), IsNil)
+
+	_, err := sc.RunJob("a")
+	c.Assert(err, IsNil)
+
+	// a -> b, then b doesn't run a again
+	sc.Stop()
+	c.Assert(a.Called, Equals, 1)
+	c.Assert(b.Called, Equals, 1)
+
+	self := failingJob("self", "self")
+	c.Assert(errors.Is(ValidateJob(self), ErrOnFailureLoop), Equals, true)
+}
+
+// runBlocking registers a blocking job in a started scheduler and runs it in
+// the background
+func runBlocking(c *C) (*Scheduler, *BlockingTestJob) {
+	job := newBlockingTestJob("")
+	job.Schedule = "@hourly"
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(job), IsNil)
+	c.Assert(sc.Start(), IsNil)
+
+	go sc.RunJob(job.Name)
+	<-job.started
+
+	return sc, job
+}
+
+func (s *SuiteScheduler) TestStopWithTimeout(c *C) {
+	sc, job := runBlocking(c)
+	time.AfterFunc(100*time.Millisecond, func() { close(job.release) })
+
+	start := time.Now()
+	c.Assert(sc.StopWithTimeout(time.Minute), IsNil)
+	c.Assert(time.Since(start) < time.Minute, Equals, true)
+	c.Assert(atomic.LoadInt32(&job.cancelled), Equals, int32(0))
+	c.Assert(sc.IsRunning(), Equals, false)
+}
+
+func (s *SuiteScheduler) TestStopWithTimeoutForceStop(c *C) {
+	sc, job := runBlocking(c)
+
+	start := time.Now()
+	err := sc.StopWithTimeout(200 * time.Millisecond)
+	c.Assert(errors.Is(err, ErrShutdownTimeout), Equals, true)
+	c.Assert(err, ErrorMatches, ".*: blocking")
+	c.Assert(time.Since(start) < 5*time.Second, Equals, true)
+	c.Assert(atomic.LoadInt32(&job.cancelled), Equals, int32(1))
+	c.Assert(sc.IsRunning(), Equals, false)
+}
+
+func (s *SuiteScheduler) TestQueueWait(c *C) {
+	job := newBlockingTestJob("")
+	job.Schedule = "@hourly"
+	job.MaxConcurrent = 1
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(job), IsNil)
+
+	executions := make(chan *Execution, 2)
+	run := func() {
+		e, _ := sc.RunJob(job.Name)
+		executions <- e
+	}
+
+	go run()
+	<-job.started
+
+	// the second execution waits for the free slot of the first one
+	go run()
+	time.Sleep(200 * time.Millisecond)
+	close(job.release)
+
+	first, second := <-executions, <-executions
+	if first.QueueWait > second.QueueWait {
+		first, second = second, first
+	}
+
+	// the second one started waiting shortly after the first one
+	c.Assert(first.QueueWait < 100*time.Millisecond, Equals, true)
+	c.Assert(second.QueueWait >= 100*time.Millisecond, Equals, true)
+}
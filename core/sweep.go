@@ -0,0 +1,56 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// RunJobLabel is set on the containers created by the run jobs, with the
+// name of the job, so the ones left behind can be found
+const RunJobLabel = reservedLabelPrefix + "run-job"
+
+// sweptStates are the states of the containers no execution is using
+var sweptStates = map[string]bool{"created": true, "exited": true, "dead": true}
+
+// SweepContainers removes the stopped containers created by the run jobs
+// more than maxAge before now, such as the ones left behind when Ofelia
+// stopped during an execution. The running containers and the ones kept by
+// reuse-container are never removed. It returns the IDs of the removed
+// containers. The listing is retried according to o.
+func SweepContainers(client *docker.Client, o *DockerOptions, maxAge time.Duration, now time.Time) ([]string, error) {
+	var containers []docker.APIContainers
+	err := o.Retry(func() (err error) {
+		containers, err = client.ListContainers(docker.ListContainersOptions{
+			All:     true,
+			Filters: map[string][]string{"label": {RunJobLabel}},
+		})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing the containers of the run jobs: %w", err)
+	}
+
+	var removed []string
+	var errs []error
+	for _, c := range containers {
+		if !sweptStates[c.State] || now.Sub(time.Unix(c.Created, 0)) < maxAge {
+			continue
+		}
+
+		if _, reused := c.Labels[ReuseHashLabel]; reused {
+			continue
+		}
+
+		if err := client.RemoveContainer(docker.RemoveContainerOptions{ID: c.ID}); err != nil {
+			errs = append(errs, fmt.Errorf("error removing container %s: %w", c.ID, err))
+			continue
+		}
+
+		removed = append(removed, c.ID)
+	}
+
+	return removed, errors.Join(errs...)
+}
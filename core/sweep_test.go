@@ -0,0 +1,92 @@
+package core
+
+import (
+	"sort"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/fsouza/go-dockerclient/testing"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteSweep struct {
+	server *testing.DockerServer
+	client *docker.Client
+}
+
+var _ = Suite(&SuiteSweep{})
+
+func (s *SuiteSweep) SetUpTest(c *C) {
+	var err error
+	s.server, err = testing.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, IsNil)
+
+	s.client, err = docker.NewClient(s.server.URL())
+	c.Assert(err, IsNil)
+
+	c.Assert(s.client.PullImage(docker.PullImageOptions{Repository: ImageFixture}, docker.AuthConfiguration{}), IsNil)
+}
+
+// createContainer creates a container of the run job with the given name,
+// started and stopped as asked
+func (s *SuiteSweep) createContainer(c *C, name string, start, stop bool) string {
+	job := &RunJob{Client: s.client}
+	job.Name = name
+	job.Image = ImageFixture
+
+	container, err := job.buildContainer(job.Command)
+	c.Assert(err, IsNil)
+
+	if start {
+		c.Assert(s.client.StartContainer(container.ID, nil), IsNil)
+	}
+
+	if stop {
+		c.Assert(s.client.StopContainer(container.ID, 0), IsNil)
+	}
+
+	return container.ID
+}
+
+func (s *SuiteSweep) containers(c *C) []string {
+	containers, err := s.client.ListContainers(docker.ListContainersOptions{All: true})
+	c.Assert(err, IsNil)
+
+	var ids []string
+	for _, container := range containers {
+		ids = append(ids, container.ID)
+	}
+
+	sort.Strings(ids)
+	return ids
+}
+
+func (s *SuiteSweep) TestSweepContainers(c *C) {
+	created := s.createContainer(c, "created", false, false)
+	exited := s.createContainer(c, "exited", true, true)
+	running := s.createContainer(c, "running", true, false)
+
+	other, err := s.client.CreateContainer(docker.CreateContainerOptions{
+		Config: &docker.Config{Image: ImageFixture},
+	})
+	c.Assert(err, IsNil)
+
+	// too recent
+	removed, err := SweepContainers(s.client, nil, time.Hour, time.Now())
+	c.Assert(err, IsNil)
+	c.Assert(removed, HasLen, 0)
+
+	removed, err = SweepContainers(s.client, nil, time.Hour, time.Now().Add(2*time.Hour))
+	c.Assert(err, IsNil)
+	sort.Strings(removed)
+
+	expected := []string{created, exited}
+	sort.Strings(expected)
+	c.Assert(removed, DeepEquals, expected)
+
+	// the running container and the ones of other tools are kept
+	kept := []string{running, other.ID}
+	sort.Strings(kept)
+	c.Assert(s.containers(c), DeepEquals, kept)
+}
@@ -0,0 +1,96 @@
+package middlewares
+
+import (
+	"sync"
+	"time"
+
+	"github.com/netresearch/ofelia/core"
+)
+
+// Batchable is implemented by the notifiers able to group the failures
+// happening within a time window into a single message
+type Batchable interface {
+	EnableBatching(window time.Duration) *NotificationBatcher
+}
+
+// BatchedFailure is a failed execution waiting in a batch
+type BatchedFailure struct {
+	JobName     string
+	ExecutionID string
+	Schedule    string
+	Command     string
+	ExitCode    int
+	Error       string
+	StdoutTail  string
+	StderrTail  string
+	Duration    time.Duration
+}
+
+func newBatchedFailure(ctx *core.Context) *BatchedFailure {
+	f := &BatchedFailure{
+		JobName:     ctx.Job.GetName(),
+		ExecutionID: ctx.Execution.ID,
+		Schedule:    ctx.Job.GetSchedule(),
+		Command:     ctx.Job.GetCommand(),
+		ExitCode:    core.ExitCode(ctx.Execution.Error),
+		StdoutTail:  streamTail(ctx.Execution, ctx.Execution.OutputStream, webhookStreamTail),
+		StderrTail:  streamTail(ctx.Execution, ctx.Execution.ErrorStream, webhookStreamTail),
+		Duration:    ctx.Execution.Duration,
+	}
+
+	if ctx.Execution.Error != nil {
+		f.Error = ctx.Execution.Error.Error()
+	}
+
+	return f
+}
+
+// NotificationBatcher collects the failures of a notifier: the first one
+// opens a window, and when it closes all the failures collected meanwhile
+// are sent together. A failure after that opens a new window.
+type NotificationBatcher struct {
+	window time.Duration
+	send   func(logger core.Logger, failures []*BatchedFailure)
+
+	mu      sync.Mutex
+	pending []*BatchedFailure
+	logger  core.Logger
+	timer   *time.Timer
+}
+
+// NewNotificationBatcher returns a batcher calling send with the failures of
+// each window
+func NewNotificationBatcher(
+	window time.Duration, send func(logger core.Logger, failures []*BatchedFailure),
+) *NotificationBatcher {
+	return &NotificationBatcher{window: window, send: send}
+}
+
+// Add adds the failed execution of the context to the current batch
+func (b *NotificationBatcher) Add(ctx *core.Context) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.pending = append(b.pending, newBatchedFailure(ctx))
+	b.logger = ctx.Logger
+	if b.timer == nil {
+		b.timer = time.AfterFunc(b.window, b.Flush)
+	}
+}
+
+// Flush sends the pending failures right away, it's called when the window
+// closes and should be called on shutdown so no failure is lost
+func (b *NotificationBatcher) Flush() {
+	b.mu.Lock()
+	failures, logger := b.pending, b.logger
+	b.pending = nil
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.mu.Unlock()
+
+	if len(failures) > 0 {
+		b.send(logger, failures)
+	}
+}
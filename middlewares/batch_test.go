@@ -0,0 +1,129 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/netresearch/ofelia/core"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteBatch struct {
+	BaseSuite
+}
+
+var _ = Suite(&SuiteBatch{})
+
+// failedContext returns the context of a failed execution of the named job
+func (s *SuiteBatch) failedContext(name string) *core.Context {
+	j := &TestJob{}
+	j.Name = name
+	ctx := core.NewContext(core.NewScheduler(&TestLogger{}), j, core.NewExecution())
+	ctx.Start()
+	ctx.Stop(errors.New(name + " failed"))
+
+	return ctx
+}
+
+func (s *SuiteBatch) TestBatcherWindow(c *C) {
+	batches := make(chan []*BatchedFailure, 2)
+	b := NewNotificationBatcher(50*time.Millisecond, func(_ core.Logger, f []*BatchedFailure) {
+		batches <- f
+	})
+
+	foo := s.failedContext("foo")
+	b.Add(foo)
+	b.Add(s.failedContext("bar"))
+
+	batch := <-batches
+	c.Assert(batch, HasLen, 2)
+	c.Assert(batch[0].JobName, Equals, "foo")
+	c.Assert(batch[0].ExecutionID, Equals, foo.Execution.ID)
+	c.Assert(batch[0].Error, Equals, "foo failed")
+	c.Assert(batch[1].JobName, Equals, "bar")
+
+	// a later failure starts a new batch
+	b.Add(s.failedContext("qux"))
+	batch = <-batches
+	c.Assert(batch, HasLen, 1)
+	c.Assert(batch[0].JobName, Equals, "qux")
+}
+
+func (s *SuiteBatch) TestBatcherFlush(c *C) {
+	var batches [][]*BatchedFailure
+	b := NewNotificationBatcher(time.Hour, func(_ core.Logger, f []*BatchedFailure) {
+		batches = append(batches, f)
+	})
+
+	b.Flush()
+	c.Assert(batches, HasLen, 0)
+
+	b.Add(s.failedContext("foo"))
+	b.Flush()
+	c.Assert(batches, HasLen, 1)
+	c.Assert(batches[0][0].JobName, Equals, "foo")
+}
+
+func (s *SuiteBatch) TestSlackBatch(c *C) {
+	var mu sync.Mutex
+	var messages []slackMessage
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m slackMessage
+		json.Unmarshal([]byte(r.FormValue(slackPayloadVar)), &m)
+
+		mu.Lock()
+		messages = append(messages, m)
+		mu.Unlock()
+	}))
+
+	defer ts.Close()
+
+	m := NewSlack(&SlackConfig{SlackWebhook: ts.URL})
+	b := m.(Batchable).EnableBatching(time.Hour)
+
+	c.Assert(m.Run(s.failedContext("foo")), IsNil)
+	c.Assert(m.Run(s.failedContext("bar")), IsNil)
+	c.Assert(messages, HasLen, 0)
+
+	// the successes aren't batched
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+	c.Assert(m.Run(s.ctx), IsNil)
+	c.Assert(messages, HasLen, 1)
+
+	b.Flush()
+	c.Assert(messages, HasLen, 2)
+	c.Assert(messages[1].Text, Equals, "*2* executions failed")
+	c.Assert(messages[1].Attachments, HasLen, 2)
+	c.Assert(messages[1].Attachments[0].Title, Equals, `Job "foo" failed`)
+	c.Assert(messages[1].Attachments[1].Text, Equals, "bar failed")
+}
+
+func (s *SuiteBatch) TestWebhookBatch(c *C) {
+	var payload struct {
+		Failures []webhookData `json:"failures"`
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&payload)
+	}))
+
+	defer ts.Close()
+
+	m := NewWebhook(&WebhookConfig{WebhookURL: ts.URL, WebhookPayloadTemplate: "{{.JobName}}"})
+	b := m.(Batchable).EnableBatching(time.Hour)
+
+	c.Assert(m.Run(s.failedContext("foo")), IsNil)
+	c.Assert(m.Run(s.failedContext("bar")), IsNil)
+	b.Flush()
+
+	c.Assert(payload.Failures, HasLen, 2)
+	c.Assert(payload.Failures[0].JobName, Equals, "foo")
+	c.Assert(payload.Failures[0].Failed, Equals, true)
+	c.Assert(payload.Failures[1].Error, Equals, "bar failed")
+}
@@ -1,6 +1,12 @@
 package middlewares
 
-import "reflect"
+import (
+	"reflect"
+	"strconv"
+	"sync"
+
+	"github.com/netresearch/ofelia/core"
+)
 
 func IsEmpty(i interface{}) bool {
 	t := reflect.TypeOf(i).Elem()
@@ -8,3 +14,43 @@ func IsEmpty(i interface{}) bool {
 
 	return reflect.DeepEqual(i, e)
 }
+
+// StatusTracker remembers whether the last execution of each job failed, to
+// detect when a failing job recovers
+type StatusTracker struct {
+	mu     sync.Mutex
+	failed map[string]bool
+}
+
+// NewStatusTracker returns an empty StatusTracker
+func NewStatusTracker() *StatusTracker {
+	return &StatusTracker{failed: make(map[string]bool)}
+}
+
+// Recovered records the outcome of the execution and reports whether it is a
+// success following a failure of the same job. Skipped executions don't
+// change the status of the job.
+func (t *StatusTracker) Recovered(job string, e *core.Execution) bool {
+	if t == nil || e.Skipped {
+		return false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	wasFailed := t.failed[job]
+	t.failed[job] = e.Failed
+
+	return wasFailed && !e.Failed
+}
+
+// silentSuccess reports whether the execution succeeded without any output
+// in a job with notify-empty set to false, its notification being left out
+func silentSuccess(ctx *core.Context) bool {
+	if notify, err := strconv.ParseBool(ctx.Job.GetSchedulingOptions().NotifyEmpty); err != nil || notify {
+		return false
+	}
+
+	e := ctx.Execution
+	return !e.Failed && !e.Skipped && e.OutputStream.TotalWritten() == 0 && e.ErrorStream.TotalWritten() == 0
+}
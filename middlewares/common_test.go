@@ -1,6 +1,7 @@
 package middlewares
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/netresearch/ofelia/core"
@@ -27,6 +28,42 @@ func (s *SuiteCommon) TestIsEmpty(c *C) {
 	c.Assert(IsEmpty(config), Equals, false)
 }
 
+func (s *SuiteCommon) TestStatusTracker(c *C) {
+	success := &core.Execution{}
+	failure := &core.Execution{Failed: true}
+	skipped := &core.Execution{Skipped: true}
+
+	t := NewStatusTracker()
+	c.Assert(t.Recovered("foo", success), Equals, false, Commentf("first success"))
+	c.Assert(t.Recovered("foo", success), Equals, false, Commentf("success -> success"))
+	c.Assert(t.Recovered("foo", failure), Equals, false, Commentf("success -> fail"))
+	c.Assert(t.Recovered("foo", failure), Equals, false, Commentf("fail -> fail"))
+	c.Assert(t.Recovered("bar", success), Equals, false, Commentf("other job"))
+	c.Assert(t.Recovered("foo", skipped), Equals, false, Commentf("fail -> skip"))
+	c.Assert(t.Recovered("foo", success), Equals, true, Commentf("fail -> success"))
+	c.Assert(t.Recovered("foo", success), Equals, false, Commentf("recovered -> success"))
+
+	var empty *StatusTracker
+	c.Assert(empty.Recovered("foo", success), Equals, false)
+}
+
+func (s *SuiteCommon) TestSilentSuccess(c *C) {
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+	c.Assert(silentSuccess(s.ctx), Equals, false, Commentf("notify-empty by default"))
+
+	s.job.NotifyEmpty = "false"
+	c.Assert(silentSuccess(s.ctx), Equals, true)
+
+	s.ctx.Execution.ErrorStream.Write([]byte("warning"))
+	c.Assert(silentSuccess(s.ctx), Equals, false, Commentf("with output"))
+
+	failed := core.NewContext(s.ctx.Scheduler, s.job, core.NewExecution())
+	failed.Start()
+	failed.Stop(errors.New("foo"))
+	c.Assert(silentSuccess(failed), Equals, false, Commentf("failed"))
+}
+
 type BaseSuite struct {
 	ctx *core.Context
 	job *TestJob
@@ -0,0 +1,204 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/netresearch/ofelia/core"
+)
+
+var (
+	discordUsername  = "Ofelia"
+	discordAvatarURL = "https://raw.githubusercontent.com/netresearch/ofelia/master/static/avatar.png"
+	// discordMaxRetries is the number of attempts made while Discord answers
+	// with 429 Too Many Requests
+	discordMaxRetries = 3
+	// discordMaxBackoff caps the wait requested by Discord between attempts
+	discordMaxBackoff = 5 * time.Second
+	// discordOutputTail is the maximum size of the output sent, Discord
+	// limits the value of an embed field to 1024 characters
+	discordOutputTail = 1000
+)
+
+// DiscordConfig configuration for the Discord middleware
+type DiscordConfig struct {
+	DiscordWebhook     string `gcfg:"discord-webhook" mapstructure:"discord-webhook"`
+	DiscordOnlyOnError bool   `gcfg:"discord-only-on-error" mapstructure:"discord-only-on-error"`
+	// DiscordNotifyOnRecovery sends a message when a job succeeds after a
+	// failure, even with DiscordOnlyOnError
+	DiscordNotifyOnRecovery bool `gcfg:"discord-notify-on-recovery" mapstructure:"discord-notify-on-recovery"`
+}
+
+// NewDiscord returns a Discord middleware if the given configuration is not
+// empty
+func NewDiscord(c *DiscordConfig) core.Middleware {
+	var m core.Middleware
+	if !IsEmpty(c) {
+		m = &Discord{DiscordConfig: *c, status: NewStatusTracker()}
+	}
+
+	return m
+}
+
+// Discord middleware calls to a Discord webhook after every execution of a job
+type Discord struct {
+	DiscordConfig
+	status *StatusTracker
+}
+
+// ContinueOnStop always returns true, the final status of the stopped
+// executions is sent too
+func (m *Discord) ContinueOnStop() bool {
+	return true
+}
+
+// Run sends a message to the Discord channel, the execution is stopped first
+// so the message has its final status and duration
+func (m *Discord) Run(ctx *core.Context) error {
+	err := ctx.Next()
+	ctx.Stop(err)
+
+	recovered := m.DiscordNotifyOnRecovery && m.status.Recovered(ctx.Job.GetName(), ctx.Execution)
+	if ctx.Execution.Failed || (!m.DiscordOnlyOnError && !silentSuccess(ctx)) || recovered {
+		m.pushMessage(ctx, recovered)
+	}
+
+	return err
+}
+
+func (m *Discord) pushMessage(ctx *core.Context, recovered bool) {
+	content, _ := json.Marshal(m.buildMessage(ctx, recovered))
+
+	for i := 0; i < discordMaxRetries; i++ {
+		r, err := http.Post(m.DiscordWebhook, "application/json", bytes.NewReader(content))
+		if err != nil {
+			ctx.Logger.Errorf("Discord error calling %q error: %q", m.DiscordWebhook, err)
+			return
+		}
+		r.Body.Close()
+
+		switch {
+		case r.StatusCode == http.StatusTooManyRequests:
+			time.Sleep(discordRetryAfter(r))
+		case r.StatusCode >= 300:
+			ctx.Logger.Errorf("Discord error non-2xx status code calling %q", m.DiscordWebhook)
+			return
+		default:
+			return
+		}
+	}
+
+	ctx.Logger.Errorf("Discord error rate limited calling %q", m.DiscordWebhook)
+}
+
+// discordRetryAfter returns the wait requested by Discord, in seconds with
+// an optional fraction, capped by discordMaxBackoff
+func discordRetryAfter(r *http.Response) time.Duration {
+	wait := time.Second
+	if s, err := strconv.ParseFloat(r.Header.Get("Retry-After"), 64); err == nil {
+		wait = time.Duration(s * float64(time.Second))
+	}
+
+	if wait > discordMaxBackoff {
+		wait = discordMaxBackoff
+	}
+
+	return wait
+}
+
+func (m *Discord) buildMessage(ctx *core.Context, recovered bool) *discordMessage {
+	e := discordEmbed{
+		Fields: []discordField{
+			{Name: "Job", Value: ctx.Job.GetName(), Inline: true},
+			{Name: "Duration", Value: ctx.Execution.Duration.String(), Inline: true},
+			{Name: "Command", Value: fmt.Sprintf("`%s`", ctx.Job.GetCommand())},
+		},
+		Footer: &discordFooter{Text: "Execution " + ctx.Execution.ID},
+	}
+
+	if ctx.Execution.Failed {
+		e.Title = "Execution failed"
+		e.Description = ctx.Execution.Error.Error()
+		e.Color = 0xF35A00
+	} else if ctx.Execution.Skipped {
+		e.Title = "Execution skipped"
+		e.Color = 0xFFA500
+	} else if recovered {
+		e.Title = "Execution recovered"
+		e.Color = 0x7CD197
+	} else {
+		e.Title = "Execution successful"
+		e.Color = 0x7CD197
+	}
+
+	if out := streamTail(ctx.Execution, ctx.Execution.OutputStream, discordOutputTail); out != "" {
+		e.Fields = append(e.Fields, discordField{
+			Name:  "Output",
+			Value: fmt.Sprintf("```\n%s\n```", out),
+		})
+	}
+
+	return &discordMessage{
+		Username:  discordUsername,
+		AvatarURL: discordAvatarURL,
+		Embeds:    []discordEmbed{e},
+	}
+}
+
+// streamTail renders the last n characters at most of a stream of the
+// execution, the base64 of whole bytes with the base64 output encoding
+func streamTail(e *core.Execution, b core.OutputBuffer, n int) string {
+	if e.OutputEncoding != core.OutputEncodingBase64 {
+		return tail(e.Render(b), n)
+	}
+
+	raw := b.Bytes()
+	if max := n / 4 * 3; len(raw) > max {
+		raw = raw[len(raw)-max:]
+	}
+
+	return core.RenderOutput(raw, e.OutputEncoding)
+}
+
+// tail returns the last n bytes of s, without splitting a rune
+func tail(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+
+	i := len(s) - n
+	for i < len(s) && !utf8.RuneStart(s[i]) {
+		i++
+	}
+
+	return s[i:]
+}
+
+type discordMessage struct {
+	Username  string         `json:"username"`
+	AvatarURL string         `json:"avatar_url"`
+	Embeds    []discordEmbed `json:"embeds"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description,omitempty"`
+	Color       int            `json:"color"`
+	Fields      []discordField `json:"fields"`
+	Footer      *discordFooter `json:"footer,omitempty"`
+}
+
+type discordFooter struct {
+	Text string `json:"text"`
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
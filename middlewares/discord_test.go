@@ -0,0 +1,122 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+
+	"github.com/netresearch/ofelia/core"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteDiscord struct {
+	BaseSuite
+}
+
+var _ = Suite(&SuiteDiscord{})
+
+func (s *SuiteDiscord) TestNewDiscordEmpty(c *C) {
+	c.Assert(NewDiscord(&DiscordConfig{}), IsNil)
+}
+
+func (s *SuiteDiscord) TestRunSuccess(c *C) {
+	var m discordMessage
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.Header.Get("Content-Type"), Equals, "application/json")
+		json.NewDecoder(r.Body).Decode(&m)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	defer ts.Close()
+
+	s.job.Name = "foo"
+	s.job.Command = "echo bar"
+	s.ctx.Start()
+	s.ctx.Execution.OutputStream.Write([]byte("bar"))
+	s.ctx.Stop(nil)
+
+	d := NewDiscord(&DiscordConfig{DiscordWebhook: ts.URL})
+	c.Assert(d.Run(s.ctx), IsNil)
+
+	c.Assert(m.Username, Equals, discordUsername)
+	c.Assert(m.Embeds, HasLen, 1)
+	c.Assert(m.Embeds[0].Title, Equals, "Execution successful")
+	c.Assert(m.Embeds[0].Color, Equals, 0x7CD197)
+	c.Assert(m.Embeds[0].Fields[0], DeepEquals, discordField{Name: "Job", Value: "foo", Inline: true})
+	c.Assert(m.Embeds[0].Fields[1].Name, Equals, "Duration")
+	c.Assert(m.Embeds[0].Fields[2].Value, Equals, "`echo bar`")
+	c.Assert(m.Embeds[0].Fields[3], DeepEquals, discordField{Name: "Output", Value: "```\nbar\n```"})
+	c.Assert(m.Embeds[0].Footer, DeepEquals, &discordFooter{Text: "Execution " + s.ctx.Execution.ID})
+}
+
+func (s *SuiteDiscord) TestRunSuccessFailed(c *C) {
+	var m discordMessage
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&m)
+	}))
+
+	defer ts.Close()
+
+	s.ctx.Start()
+	s.ctx.Stop(errors.New("foo"))
+
+	d := NewDiscord(&DiscordConfig{DiscordWebhook: ts.URL})
+	c.Assert(d.Run(s.ctx), IsNil)
+	c.Assert(m.Embeds[0].Title, Equals, "Execution failed")
+	c.Assert(m.Embeds[0].Description, Equals, "foo")
+}
+
+func (s *SuiteDiscord) TestRunSuccessOnError(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(true, Equals, false)
+	}))
+
+	defer ts.Close()
+
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+
+	d := NewDiscord(&DiscordConfig{DiscordWebhook: ts.URL, DiscordOnlyOnError: true})
+	c.Assert(d.Run(s.ctx), IsNil)
+}
+
+func (s *SuiteDiscord) TestRunRateLimited(c *C) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "0.01")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+
+	defer ts.Close()
+
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+
+	d := NewDiscord(&DiscordConfig{DiscordWebhook: ts.URL})
+	c.Assert(d.Run(s.ctx), IsNil)
+	c.Assert(atomic.LoadInt32(&calls), Equals, int32(2))
+}
+
+func (s *SuiteDiscord) TestTail(c *C) {
+	c.Assert(tail("foo", 5), Equals, "foo")
+	c.Assert(tail("foobar", 3), Equals, "bar")
+	c.Assert(tail("fooé", 1), Equals, "")
+}
+
+func (s *SuiteDiscord) TestStreamTail(c *C) {
+	e := core.NewExecution()
+	e.OutputStream.Write([]byte("foo\xffbar"))
+	c.Assert(streamTail(e, e.OutputStream, 6), Equals, "\uFFFDbar")
+
+	// the base64 of the last whole bytes
+	e.OutputEncoding = core.OutputEncodingBase64
+	c.Assert(streamTail(e, e.OutputStream, 5), Equals, "YmFy")
+
+	e.OutputEncoding = core.OutputEncodingDrop
+	c.Assert(streamTail(e, e.OutputStream, 5), Equals, "")
+}
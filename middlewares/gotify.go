@@ -0,0 +1,155 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/netresearch/ofelia/core"
+)
+
+var (
+	// gotifyOutputTail is the maximum size of the output sent
+	gotifyOutputTail = 1000
+
+	ErrGotifyMissingToken = errors.New("gotify-token is required with gotify-url")
+	ErrGotifyMissingURL   = errors.New("gotify-url is required with gotify-token")
+)
+
+// GotifyConfig configuration for the Gotify middleware
+type GotifyConfig struct {
+	GotifyURL         string `gcfg:"gotify-url" mapstructure:"gotify-url"`
+	GotifyToken       string `gcfg:"gotify-token" mapstructure:"gotify-token"`
+	GotifyPriority    int    `gcfg:"gotify-priority" mapstructure:"gotify-priority"`
+	GotifyOnlyOnError bool   `gcfg:"gotify-only-on-error" mapstructure:"gotify-only-on-error"`
+	// GotifyNotifyOnRecovery sends a message when a job succeeds after a
+	// failure, even with GotifyOnlyOnError
+	GotifyNotifyOnRecovery bool `gcfg:"gotify-notify-on-recovery" mapstructure:"gotify-notify-on-recovery"`
+}
+
+// Validate checks that the server URL and the application token are set
+// together and that the URL is an absolute http(s) URL
+func (c *GotifyConfig) Validate() error {
+	if IsEmpty(c) {
+		return nil
+	}
+
+	switch {
+	case c.GotifyURL == "":
+		return ErrGotifyMissingURL
+	case c.GotifyToken == "":
+		return ErrGotifyMissingToken
+	}
+
+	u, err := url.Parse(c.GotifyURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid gotify-url %q, expected an http or https URL", c.GotifyURL)
+	}
+
+	return nil
+}
+
+// NewGotify returns a Gotify middleware if the given configuration is not
+// empty
+func NewGotify(c *GotifyConfig) core.Middleware {
+	var m core.Middleware
+	if !IsEmpty(c) {
+		m = &Gotify{GotifyConfig: *c, status: NewStatusTracker()}
+	}
+
+	return m
+}
+
+// Gotify middleware pushes a message to a Gotify server after every execution
+// of a job
+type Gotify struct {
+	GotifyConfig
+	status *StatusTracker
+}
+
+// ContinueOnStop always returns true, the final status of the stopped
+// executions is sent too
+func (m *Gotify) ContinueOnStop() bool {
+	return true
+}
+
+// Run sends a message to the Gotify server, the execution is stopped first so
+// the message has its final status and duration
+func (m *Gotify) Run(ctx *core.Context) error {
+	err := ctx.Next()
+	ctx.Stop(err)
+
+	recovered := m.GotifyNotifyOnRecovery && m.status.Recovered(ctx.Job.GetName(), ctx.Execution)
+	if ctx.Execution.Failed || (!m.GotifyOnlyOnError && !silentSuccess(ctx)) || recovered {
+		m.pushMessage(ctx, recovered)
+	}
+
+	return err
+}
+
+func (m *Gotify) pushMessage(ctx *core.Context, recovered bool) {
+	content, _ := json.Marshal(m.buildMessage(ctx, recovered))
+
+	endpoint := strings.TrimSuffix(m.GotifyURL, "/") + "/message"
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(content))
+	if err != nil {
+		ctx.Logger.Errorf("Gotify error calling %q error: %q", m.GotifyURL, err)
+		return
+	}
+
+	// the token goes in a header so it doesn't show up in the logged URL
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", m.GotifyToken)
+
+	r, err := http.DefaultClient.Do(req)
+	if err != nil {
+		ctx.Logger.Errorf("Gotify error calling %q error: %q", m.GotifyURL, err)
+		return
+	}
+	r.Body.Close()
+
+	if r.StatusCode >= 300 {
+		ctx.Logger.Errorf("Gotify error non-2xx status code calling %q", m.GotifyURL)
+	}
+}
+
+func (m *Gotify) buildMessage(ctx *core.Context, recovered bool) *gotifyMessage {
+	msg := &gotifyMessage{Priority: m.GotifyPriority}
+
+	status := "successful"
+	if ctx.Execution.Failed {
+		status = "failed"
+	} else if ctx.Execution.Skipped {
+		status = "skipped"
+	} else if recovered {
+		status = "recovered"
+	}
+
+	msg.Title = fmt.Sprintf("Job %q %s", ctx.Job.GetName(), status)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Command: %s\n", ctx.Job.GetCommand())
+	fmt.Fprintf(&b, "Duration: %s\n", ctx.Execution.Duration)
+	fmt.Fprintf(&b, "Execution: %s\n", ctx.Execution.ID)
+	fmt.Fprintf(&b, "Exit code: %d", core.ExitCode(ctx.Execution.Error))
+	if ctx.Execution.Failed {
+		fmt.Fprintf(&b, "\nError: %s", ctx.Execution.Error)
+	}
+
+	if out := streamTail(ctx.Execution, ctx.Execution.OutputStream, gotifyOutputTail); out != "" {
+		fmt.Fprintf(&b, "\n\n%s", out)
+	}
+
+	msg.Message = b.String()
+	return msg
+}
+
+type gotifyMessage struct {
+	Title    string `json:"title"`
+	Message  string `json:"message"`
+	Priority int    `json:"priority"`
+}
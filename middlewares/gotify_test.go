@@ -0,0 +1,139 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/netresearch/ofelia/core"
+	. "gopkg.in/check.v1"
+)
+
+type SuiteGotify struct {
+	BaseSuite
+}
+
+var _ = Suite(&SuiteGotify{})
+
+func (s *SuiteGotify) TestNewGotifyEmpty(c *C) {
+	c.Assert(NewGotify(&GotifyConfig{}), IsNil)
+}
+
+func (s *SuiteGotify) TestValidate(c *C) {
+	c.Assert((&GotifyConfig{}).Validate(), IsNil)
+	c.Assert((&GotifyConfig{GotifyURL: "https://gotify.example.com", GotifyToken: "t"}).Validate(), IsNil)
+	c.Assert((&GotifyConfig{GotifyURL: "https://gotify.example.com"}).Validate(), Equals, ErrGotifyMissingToken)
+	c.Assert((&GotifyConfig{GotifyToken: "t"}).Validate(), Equals, ErrGotifyMissingURL)
+	c.Assert((&GotifyConfig{GotifyURL: "gotify.example.com", GotifyToken: "t"}).Validate(), ErrorMatches, `invalid gotify-url .*`)
+}
+
+func (s *SuiteGotify) TestRunSuccess(c *C) {
+	var m gotifyMessage
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.URL.Path, Equals, "/message")
+		c.Assert(r.Header.Get("X-Gotify-Key"), Equals, "token")
+		c.Assert(r.Header.Get("Content-Type"), Equals, "application/json")
+		json.NewDecoder(r.Body).Decode(&m)
+	}))
+
+	defer ts.Close()
+
+	s.job.Name = "foo"
+	s.job.Command = "echo bar"
+	s.ctx.Start()
+	s.ctx.Execution.OutputStream.Write([]byte("bar"))
+	s.ctx.Stop(nil)
+
+	g := NewGotify(&GotifyConfig{GotifyURL: ts.URL + "/", GotifyToken: "token", GotifyPriority: 8})
+	c.Assert(g.Run(s.ctx), IsNil)
+
+	c.Assert(m.Title, Equals, `Job "foo" successful`)
+	c.Assert(m.Priority, Equals, 8)
+	c.Assert(strings.HasPrefix(m.Message, "Command: echo bar\n"), Equals, true)
+	c.Assert(strings.Contains(m.Message, "Exit code: 0"), Equals, true)
+	c.Assert(strings.Contains(m.Message, "Execution: "+s.ctx.Execution.ID+"\n"), Equals, true)
+	c.Assert(strings.HasSuffix(m.Message, "\n\nbar"), Equals, true)
+}
+
+func (s *SuiteGotify) TestRunFailed(c *C) {
+	var m gotifyMessage
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&m)
+	}))
+
+	defer ts.Close()
+
+	s.job.Name = "foo"
+	s.ctx.Start()
+	s.ctx.Stop(&core.NonZeroExitError{ExitCode: 3})
+
+	g := NewGotify(&GotifyConfig{GotifyURL: ts.URL, GotifyToken: "token"})
+	c.Assert(g.Run(s.ctx), IsNil)
+	c.Assert(m.Title, Equals, `Job "foo" failed`)
+	c.Assert(strings.Contains(m.Message, "Exit code: 3\nError: error non-zero exit code: 3"), Equals, true)
+}
+
+func (s *SuiteGotify) TestRunTruncatesOutput(c *C) {
+	var m gotifyMessage
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&m)
+	}))
+
+	defer ts.Close()
+
+	s.ctx.Start()
+	s.ctx.Execution.OutputStream.Write([]byte(strings.Repeat("a", gotifyOutputTail) + "end"))
+	s.ctx.Stop(errors.New("foo"))
+
+	g := NewGotify(&GotifyConfig{GotifyURL: ts.URL, GotifyToken: "token"})
+	c.Assert(g.Run(s.ctx), IsNil)
+
+	_, out, _ := strings.Cut(m.Message, "\n\n")
+	c.Assert(out, HasLen, gotifyOutputTail)
+	c.Assert(strings.HasSuffix(out, "end"), Equals, true)
+}
+
+func (s *SuiteGotify) TestRunSuccessOnError(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(true, Equals, false)
+	}))
+
+	defer ts.Close()
+
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+
+	g := NewGotify(&GotifyConfig{GotifyURL: ts.URL, GotifyToken: "token", GotifyOnlyOnError: true})
+	c.Assert(g.Run(s.ctx), IsNil)
+}
+
+func (s *SuiteGotify) TestRunNotifyEmpty(c *C) {
+	var sent int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent++
+	}))
+
+	defer ts.Close()
+
+	s.job.Name = "foo"
+	s.job.NotifyEmpty = "false"
+	g := NewGotify(&GotifyConfig{GotifyURL: ts.URL, GotifyToken: "token"})
+	run := func(output string, err error) {
+		ctx := core.NewContext(s.ctx.Scheduler, s.job, core.NewExecution())
+		ctx.Start()
+		ctx.Execution.OutputStream.Write([]byte(output))
+		ctx.Stop(err)
+		g.Run(ctx)
+	}
+
+	run("", nil)
+	c.Assert(sent, Equals, 0)
+
+	run("bar", nil)
+	c.Assert(sent, Equals, 1)
+
+	run("", &core.NonZeroExitError{ExitCode: 1})
+	c.Assert(sent, Equals, 2)
+}
@@ -8,6 +8,7 @@ import (
 	"io"
 	"os"
 	"strings"
+	"time"
 
 	"crypto/tls"
 	"gopkg.in/gomail.v2"
@@ -25,6 +26,45 @@ type MailConfig struct {
 	EmailTo           string `gcfg:"email-to" mapstructure:"email-to"`
 	EmailFrom         string `gcfg:"email-from" mapstructure:"email-from"`
 	MailOnlyOnError   bool   `gcfg:"mail-only-on-error" mapstructure:"mail-only-on-error"`
+	// SMTPTLSMode forces the encryption of the connection, none, starttls or
+	// tls. By default TLS is used on port 465 and STARTTLS whenever the
+	// server supports it.
+	SMTPTLSMode string `gcfg:"smtp-tls-mode" mapstructure:"smtp-tls-mode"`
+	// SMTPInsecureSkipVerify is the same as SMTPTLSSkipVerify
+	SMTPInsecureSkipVerify bool `gcfg:"smtp-insecure-skip-verify" mapstructure:"smtp-insecure-skip-verify"`
+	// MailNotifyOnRecovery sends a mail when a job succeeds after a failure,
+	// even with MailOnlyOnError
+	MailNotifyOnRecovery bool `gcfg:"mail-notify-on-recovery" mapstructure:"mail-notify-on-recovery"`
+}
+
+// Validate checks the TLS mode
+func (c *MailConfig) Validate() error {
+	switch c.SMTPTLSMode {
+	case "", SMTPTLSModeNone, SMTPTLSModeStartTLS, SMTPTLSModeTLS:
+		return nil
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownSMTPTLSMode, c.SMTPTLSMode)
+	}
+}
+
+// TLSWarning returns a description of a likely mistake in the TLS settings,
+// such as a TLS mode not matching the usual one of the port, or an empty
+// string
+func (c *MailConfig) TLSWarning() string {
+	switch {
+	case c.SMTPPort == 465 && (c.SMTPTLSMode == SMTPTLSModeNone || c.SMTPTLSMode == SMTPTLSModeStartTLS):
+		return fmt.Sprintf("smtp-port 465 usually expects smtp-tls-mode tls, not %s", c.SMTPTLSMode)
+	case c.SMTPPort == 587 && c.SMTPTLSMode == SMTPTLSModeTLS:
+		return "smtp-port 587 usually expects smtp-tls-mode starttls, not tls"
+	case c.SMTPTLSMode == SMTPTLSModeNone && c.SMTPUser != "":
+		return "smtp-tls-mode none with smtp-user, the credentials are only sent to localhost without TLS"
+	default:
+		return ""
+	}
+}
+
+func (c *MailConfig) skipVerify() bool {
+	return c.SMTPTLSSkipVerify || c.SMTPInsecureSkipVerify
 }
 
 // NewMail returns a Mail middleware if the given configuration is not empty
@@ -32,7 +72,7 @@ func NewMail(c *MailConfig) core.Middleware {
 	var m core.Middleware
 
 	if !IsEmpty(c) {
-		m = &Mail{*c}
+		m = &Mail{MailConfig: *c, status: NewStatusTracker()}
 	}
 
 	return m
@@ -41,6 +81,15 @@ func NewMail(c *MailConfig) core.Middleware {
 // Mail middleware delivers a email just after an execution finishes
 type Mail struct {
 	MailConfig
+	status  *StatusTracker
+	batcher *NotificationBatcher
+}
+
+// EnableBatching groups the failures happening within the window into a
+// single mail
+func (m *Mail) EnableBatching(window time.Duration) *NotificationBatcher {
+	m.batcher = NewNotificationBatcher(window, m.sendBatch)
+	return m.batcher
 }
 
 // ContinueOnStop return allways true, we want always report the final status
@@ -53,8 +102,11 @@ func (m *Mail) Run(ctx *core.Context) error {
 	err := ctx.Next()
 	ctx.Stop(err)
 
-	if ctx.Execution.Failed || !m.MailOnlyOnError {
-		err := m.sendMail(ctx)
+	recovered := m.MailNotifyOnRecovery && m.status.Recovered(ctx.Job.GetName(), ctx.Execution)
+	if ctx.Execution.Failed && m.batcher != nil {
+		m.batcher.Add(ctx)
+	} else if ctx.Execution.Failed || (!m.MailOnlyOnError && !silentSuccess(ctx)) || recovered {
+		err := m.sendMail(ctx, recovered)
 		if err != nil {
 			ctx.Logger.Errorf("Mail error: %q", err)
 		}
@@ -63,23 +115,26 @@ func (m *Mail) Run(ctx *core.Context) error {
 	return err
 }
 
-func (m *Mail) sendMail(ctx *core.Context) error {
+func (m *Mail) sendMail(ctx *core.Context, recovered bool) error {
 	msg := gomail.NewMessage()
 	msg.SetHeader("From", m.from())
 	msg.SetHeader("To", strings.Split(m.EmailTo, ",")...)
-	msg.SetHeader("Subject", m.subject(ctx))
-	msg.SetBody("text/html", m.body(ctx))
+	data := &mailData{Context: ctx, Recovered: recovered}
+	msg.SetHeader("Subject", m.subject(data))
+	msg.SetBody("text/html", m.body(data))
 
 	base := fmt.Sprintf("%s_%s", ctx.Job.GetName(), ctx.Execution.ID)
-	msg.Attach(base+".stdout.log", gomail.SetCopyFunc(func(w io.Writer) error {
-		_, err := w.Write(ctx.Execution.OutputStream.Bytes())
-		return err
-	}))
-
-	msg.Attach(base+".stderr.log", gomail.SetCopyFunc(func(w io.Writer) error {
-		_, err := w.Write(ctx.Execution.ErrorStream.Bytes())
-		return err
-	}))
+	if ext := streamExt(ctx.Execution.OutputEncoding); ext != "" {
+		msg.Attach(base+".stdout."+ext, gomail.SetCopyFunc(func(w io.Writer) error {
+			_, err := io.WriteString(w, ctx.Execution.Render(ctx.Execution.OutputStream))
+			return err
+		}))
+
+		msg.Attach(base+".stderr."+ext, gomail.SetCopyFunc(func(w io.Writer) error {
+			_, err := io.WriteString(w, ctx.Execution.Render(ctx.Execution.ErrorStream))
+			return err
+		}))
+	}
 
 	msg.Attach(base+".stderr.json", gomail.SetCopyFunc(func(w io.Writer) error {
 		js, _ := json.MarshalIndent(map[string]interface{}{
@@ -91,9 +146,43 @@ func (m *Mail) sendMail(ctx *core.Context) error {
 		return err
 	}))
 
+	return m.dialAndSend(msg)
+}
+
+// sendBatch sends a single mail listing the failures of a batch, without
+// the attachments of the executions
+func (m *Mail) sendBatch(logger core.Logger, failures []*BatchedFailure) {
+	msg := gomail.NewMessage()
+	msg.SetHeader("From", m.from())
+	msg.SetHeader("To", strings.Split(m.EmailTo, ",")...)
+	msg.SetHeader("Subject", fmt.Sprintf("[Execution failed] %d executions failed", len(failures)))
+
+	buf := bytes.NewBuffer(nil)
+	mailBatchTemplate.Execute(buf, failures)
+	msg.SetBody("text/html", buf.String())
+
+	if err := m.dialAndSend(msg); err != nil {
+		logger.Errorf("Mail error: %q", err)
+	}
+}
+
+func (m *Mail) dialAndSend(msg *gomail.Message) error {
+	if m.SMTPTLSMode != "" {
+		d := &smtpDialer{
+			host:       m.SMTPHost,
+			port:       m.SMTPPort,
+			username:   m.SMTPUser,
+			password:   m.SMTPPassword,
+			mode:       m.SMTPTLSMode,
+			skipVerify: m.skipVerify(),
+		}
+
+		return d.DialAndSend(msg)
+	}
+
 	d := gomail.NewPlainDialer(m.SMTPHost, m.SMTPPort, m.SMTPUser, m.SMTPPassword)
 	// When TLSConfig.InsecureSkipVerify is true, mail server certificate authority is not validated
-	if m.SMTPTLSSkipVerify {
+	if m.skipVerify() {
 		d.TLSConfig = &tls.Config{InsecureSkipVerify: true}
 	}
 	if err := d.DialAndSend(msg); err != nil {
@@ -112,21 +201,27 @@ func (m *Mail) from() string {
 	return fmt.Sprintf(m.EmailFrom, hostname)
 }
 
-func (m *Mail) subject(ctx *core.Context) string {
+func (m *Mail) subject(data *mailData) string {
 	buf := bytes.NewBuffer(nil)
-	mailSubjectTemplate.Execute(buf, ctx)
+	mailSubjectTemplate.Execute(buf, data)
 
 	return buf.String()
 }
 
-func (m *Mail) body(ctx *core.Context) string {
+func (m *Mail) body(data *mailData) string {
 	buf := bytes.NewBuffer(nil)
-	mailBodyTemplate.Execute(buf, ctx)
+	mailBodyTemplate.Execute(buf, data)
 
 	return buf.String()
 }
 
-var mailBodyTemplate, mailSubjectTemplate *template.Template
+// mailData is given to the mail templates
+type mailData struct {
+	*core.Context
+	Recovered bool
+}
+
+var mailBodyTemplate, mailSubjectTemplate, mailBatchTemplate *template.Template
 
 func init() {
 	f := map[string]interface{}{
@@ -141,22 +236,35 @@ func init() {
 	template.Must(mailBodyTemplate.Parse(`
 		<p>
 			Job ​<b>{{.Job.GetName}}</b>,
-			Execution <b>{{status .Execution}}</b> in ​<b>{{.Execution.Duration}}</b>​,
+			Execution <b>{{.Execution.ID}}</b> <b>{{status .}}</b> in ​<b>{{.Execution.Duration}}</b>​,
 			command: ​<pre>{{.Job.GetCommand}}</pre>​
 		</p>
+		{{- if .Execution.Truncated}}
+		<p>The output exceeded max-output and was truncated.</p>
+		{{- end}}
+  `))
+
+	mailBatchTemplate = template.Must(template.New("mail-batch").Parse(`
+		<ul>
+		{{- range .}}
+			<li>Job <b>{{.JobName}}</b> failed in <b>{{.Duration}}</b>: {{.Error}}</li>
+		{{- end}}
+		</ul>
   `))
 
 	template.Must(mailSubjectTemplate.Parse(
-		"[Execution {{status .Execution}}] Job {{.Job.GetName}} finished in {{.Execution.Duration}}",
+		"[Execution {{status .}}] Job {{.Job.GetName}} finished in {{.Execution.Duration}}",
 	))
 }
 
-func executionLabel(e *core.Execution) string {
+func executionLabel(d *mailData) string {
 	status := "successful"
-	if e.Skipped {
+	if d.Execution.Skipped {
 		status = "skipped"
-	} else if e.Failed {
+	} else if d.Execution.Failed {
 		status = "failed"
+	} else if d.Recovered {
+		status = "recovered"
 	}
 
 	return status
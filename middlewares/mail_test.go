@@ -1,10 +1,13 @@
 package middlewares
 
 import (
+	"errors"
 	"net"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/bradfitz/go-smtpd/smtpd"
 
@@ -77,3 +80,31 @@ func (s *MailSuite) TestRunSuccess(c *C) {
 
 	wg.Wait()
 }
+
+func (s *MailSuite) TestRunBatch(c *C) {
+	m := NewMail(&MailConfig{
+		SMTPHost:  s.smtpdHost,
+		SMTPPort:  s.smtpdPort,
+		EmailTo:   "foo@foo.com",
+		EmailFrom: "qux@qux.com",
+	})
+
+	b := m.(Batchable).EnableBatching(time.Hour)
+
+	var mails int32
+	s.smtpd.OnNewMail = func(_ smtpd.Connection, from smtpd.MailAddress) (smtpd.Envelope, error) {
+		atomic.AddInt32(&mails, 1)
+		return nil, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		s.ctx.Start()
+		s.ctx.Stop(errors.New("foo"))
+		c.Assert(m.Run(s.ctx), IsNil)
+	}
+
+	c.Assert(atomic.LoadInt32(&mails), Equals, int32(0))
+
+	b.Flush()
+	c.Assert(atomic.LoadInt32(&mails), Equals, int32(1))
+}
@@ -0,0 +1,184 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/netresearch/ofelia/core"
+)
+
+var (
+	// pagerDutyURL is the Events API v2 endpoint of the US service region
+	pagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+	// pagerDutyOutputTail is the maximum size of the output sent
+	pagerDutyOutputTail = 1000
+
+	ErrPagerDutyMissingKey = errors.New("pagerduty-routing-key is required with the other pagerduty options")
+)
+
+// Severities of the PagerDuty alerts
+const (
+	PagerDutySeverityCritical = "critical"
+	PagerDutySeverityError    = "error"
+	PagerDutySeverityWarning  = "warning"
+	PagerDutySeverityInfo     = "info"
+)
+
+// PagerDutyConfig configuration for the PagerDuty middleware
+type PagerDutyConfig struct {
+	PagerDutyRoutingKey string `gcfg:"pagerduty-routing-key" mapstructure:"pagerduty-routing-key"`
+	// PagerDutySeverity is the severity of the alerts, error by default
+	PagerDutySeverity string `gcfg:"pagerduty-severity" mapstructure:"pagerduty-severity"`
+	// PagerDutyURL is the Events API v2 endpoint, the one of the US service
+	// region by default
+	PagerDutyURL string `gcfg:"pagerduty-url" mapstructure:"pagerduty-url"`
+}
+
+// Validate checks that the routing key is set, the severity is known and the
+// URL is an absolute http(s) URL
+func (c *PagerDutyConfig) Validate() error {
+	if IsEmpty(c) {
+		return nil
+	}
+
+	if c.PagerDutyRoutingKey == "" {
+		return ErrPagerDutyMissingKey
+	}
+
+	switch c.PagerDutySeverity {
+	case "", PagerDutySeverityCritical, PagerDutySeverityError, PagerDutySeverityWarning, PagerDutySeverityInfo:
+	default:
+		return fmt.Errorf("invalid pagerduty-severity %q, expected critical, error, warning or info", c.PagerDutySeverity)
+	}
+
+	if c.PagerDutyURL != "" {
+		u, err := url.Parse(c.PagerDutyURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid pagerduty-url %q, expected an http or https URL", c.PagerDutyURL)
+		}
+	}
+
+	return nil
+}
+
+// NewPagerDuty returns a PagerDuty middleware if the given configuration is
+// not empty
+func NewPagerDuty(c *PagerDutyConfig) core.Middleware {
+	var m core.Middleware
+	if !IsEmpty(c) {
+		m = &PagerDuty{PagerDutyConfig: *c, status: NewStatusTracker()}
+	}
+
+	return m
+}
+
+// PagerDuty middleware triggers a PagerDuty alert when an execution fails and
+// resolves it when the job next succeeds. The alerts of a job share the same
+// deduplication key, so its repeated failures update a single incident.
+type PagerDuty struct {
+	PagerDutyConfig
+	status *StatusTracker
+}
+
+// ContinueOnStop always returns true, the stopped executions trigger or
+// resolve the alert too
+func (m *PagerDuty) ContinueOnStop() bool {
+	return true
+}
+
+// Run triggers or resolves the alert of the job once the execution has
+// finished
+func (m *PagerDuty) Run(ctx *core.Context) error {
+	err := ctx.Next()
+	ctx.Stop(err)
+
+	if m.status.Recovered(ctx.Job.GetName(), ctx.Execution) {
+		m.sendEvent(ctx, m.buildEvent(ctx, "resolve"))
+	} else if ctx.Execution.Failed {
+		m.sendEvent(ctx, m.buildEvent(ctx, "trigger"))
+	}
+
+	return err
+}
+
+func (m *PagerDuty) sendEvent(ctx *core.Context, e *pagerDutyEvent) {
+	endpoint := m.PagerDutyURL
+	if endpoint == "" {
+		endpoint = pagerDutyURL
+	}
+
+	content, _ := json.Marshal(e)
+	r, err := http.Post(endpoint, "application/json", bytes.NewReader(content))
+	if err != nil {
+		ctx.Logger.Errorf("PagerDuty error calling %q error: %q", endpoint, err)
+		return
+	}
+	r.Body.Close()
+
+	if r.StatusCode >= 300 {
+		ctx.Logger.Errorf("PagerDuty error non-2xx status code calling %q", endpoint)
+	}
+}
+
+// pagerDutyDedupKey is the deduplication key of the alerts of a job
+func pagerDutyDedupKey(job string) string {
+	return "ofelia/" + job
+}
+
+func (m *PagerDuty) buildEvent(ctx *core.Context, action string) *pagerDutyEvent {
+	e := &pagerDutyEvent{
+		RoutingKey:  m.PagerDutyRoutingKey,
+		EventAction: action,
+		DedupKey:    pagerDutyDedupKey(ctx.Job.GetName()),
+	}
+
+	if action != "trigger" {
+		return e
+	}
+
+	severity := m.PagerDutySeverity
+	if severity == "" {
+		severity = PagerDutySeverityError
+	}
+
+	source, err := os.Hostname()
+	if err != nil || source == "" {
+		source = "ofelia"
+	}
+
+	e.Payload = &pagerDutyPayload{
+		Summary:   fmt.Sprintf("Job %q failed: %s", ctx.Job.GetName(), ctx.Execution.Error),
+		Source:    source,
+		Severity:  severity,
+		Component: ctx.Job.GetName(),
+		CustomDetails: map[string]interface{}{
+			"command":      ctx.Job.GetCommand(),
+			"execution_id": ctx.Execution.ID,
+			"exit_code":    core.ExitCode(ctx.Execution.Error),
+			"duration":     ctx.Execution.Duration.String(),
+			"stderr_tail":  streamTail(ctx.Execution, ctx.Execution.ErrorStream, pagerDutyOutputTail),
+		},
+	}
+
+	return e
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string                 `json:"summary"`
+	Source        string                 `json:"source"`
+	Severity      string                 `json:"severity"`
+	Component     string                 `json:"component"`
+	CustomDetails map[string]interface{} `json:"custom_details"`
+}
@@ -0,0 +1,107 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/netresearch/ofelia/core"
+	. "gopkg.in/check.v1"
+)
+
+type SuitePagerDuty struct {
+	BaseSuite
+}
+
+var _ = Suite(&SuitePagerDuty{})
+
+func (s *SuitePagerDuty) TestNewPagerDutyEmpty(c *C) {
+	c.Assert(NewPagerDuty(&PagerDutyConfig{}), IsNil)
+}
+
+func (s *SuitePagerDuty) TestValidate(c *C) {
+	c.Assert((&PagerDutyConfig{}).Validate(), IsNil)
+	c.Assert((&PagerDutyConfig{PagerDutyRoutingKey: "k", PagerDutySeverity: "critical"}).Validate(), IsNil)
+	c.Assert((&PagerDutyConfig{PagerDutySeverity: "critical"}).Validate(), Equals, ErrPagerDutyMissingKey)
+	c.Assert((&PagerDutyConfig{PagerDutyRoutingKey: "k", PagerDutySeverity: "fatal"}).Validate(), ErrorMatches, `invalid pagerduty-severity "fatal".*`)
+	c.Assert((&PagerDutyConfig{PagerDutyRoutingKey: "k", PagerDutyURL: "events.pagerduty.com"}).Validate(), ErrorMatches, `invalid pagerduty-url .*`)
+}
+
+// run runs the middleware for an execution of the job ending with err
+func (s *SuitePagerDuty) run(c *C, m core.Middleware, err error) {
+	e := core.NewExecution()
+	ctx := core.NewContext(s.ctx.Scheduler, s.job, e)
+	ctx.Start()
+	e.ErrorStream.Write([]byte("disk full"))
+	ctx.Stop(err)
+
+	c.Assert(m.Run(ctx), IsNil)
+}
+
+func (s *SuitePagerDuty) TestRun(c *C) {
+	var events []map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.Header.Get("Content-Type"), Equals, "application/json")
+
+		var e map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&e)
+		events = append(events, e)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	defer ts.Close()
+
+	s.job.Name = "backup"
+	s.job.Command = "backup.sh"
+	m := NewPagerDuty(&PagerDutyConfig{PagerDutyRoutingKey: "key", PagerDutySeverity: "critical", PagerDutyURL: ts.URL})
+
+	s.run(c, m, nil)
+	c.Assert(events, HasLen, 0)
+
+	s.run(c, m, &core.NonZeroExitError{ExitCode: 3})
+	s.run(c, m, &core.NonZeroExitError{ExitCode: 4})
+	c.Assert(events, HasLen, 2)
+
+	trigger := events[0]
+	c.Assert(trigger["routing_key"], Equals, "key")
+	c.Assert(trigger["event_action"], Equals, "trigger")
+	c.Assert(trigger["dedup_key"], Equals, "ofelia/backup")
+
+	payload := trigger["payload"].(map[string]interface{})
+	c.Assert(payload["summary"], Equals, `Job "backup" failed: error non-zero exit code: 3`)
+	c.Assert(payload["severity"], Equals, "critical")
+	c.Assert(payload["component"], Equals, "backup")
+	c.Assert(payload["source"], Not(Equals), "")
+
+	details := payload["custom_details"].(map[string]interface{})
+	c.Assert(details["command"], Equals, "backup.sh")
+	c.Assert(details["exit_code"], Equals, float64(3))
+	c.Assert(details["stderr_tail"], Equals, "disk full")
+
+	// the repeated failure updates the same alert
+	c.Assert(events[1]["event_action"], Equals, "trigger")
+	c.Assert(events[1]["dedup_key"], Equals, trigger["dedup_key"])
+
+	s.run(c, m, nil)
+	s.run(c, m, nil)
+	c.Assert(events, HasLen, 3)
+	c.Assert(events[2], DeepEquals, map[string]interface{}{
+		"routing_key":  "key",
+		"event_action": "resolve",
+		"dedup_key":    "ofelia/backup",
+	})
+}
+
+func (s *SuitePagerDuty) TestDedupKey(c *C) {
+	c.Assert(pagerDutyDedupKey("backup"), Equals, pagerDutyDedupKey("backup"))
+	c.Assert(pagerDutyDedupKey("backup"), Not(Equals), pagerDutyDedupKey("cleanup"))
+}
+
+func (s *SuitePagerDuty) TestDefaultSeverity(c *C) {
+	s.job.Name = "backup"
+	s.ctx.Start()
+	s.ctx.Stop(&core.NonZeroExitError{ExitCode: 1})
+
+	m := NewPagerDuty(&PagerDutyConfig{PagerDutyRoutingKey: "key"}).(*PagerDuty)
+	c.Assert(m.buildEvent(s.ctx, "trigger").Payload.Severity, Equals, PagerDutySeverityError)
+}
@@ -0,0 +1,161 @@
+package middlewares
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/netresearch/ofelia/core"
+)
+
+// redactedText replaces the redacted parts of the output
+const redactedText = "***"
+
+// RedactConfig configuration for the Redact middleware
+type RedactConfig struct {
+	// RedactPatterns are regular expressions of the parts of the output to
+	// hide from the saved files and the notifications
+	RedactPatterns []string `gcfg:"redact-patterns" mapstructure:"redact-patterns"`
+}
+
+// Validate checks that the patterns are valid regular expressions
+func (c *RedactConfig) Validate() error {
+	_, err := c.compile(nil)
+	return err
+}
+
+// compile builds a single expression matching the patterns and the secrets,
+// nil if there are none
+func (c *RedactConfig) compile(secrets []string) (*regexp.Regexp, error) {
+	var parts []string
+	for _, p := range c.RedactPatterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return nil, fmt.Errorf("invalid redact-patterns %q: %w", p, err)
+		}
+
+		parts = append(parts, "(?:"+p+")")
+	}
+
+	for _, s := range secrets {
+		if s != "" {
+			parts = append(parts, regexp.QuoteMeta(s))
+		}
+	}
+
+	if len(parts) == 0 {
+		return nil, nil
+	}
+
+	return regexp.Compile(strings.Join(parts, "|"))
+}
+
+// NewRedact returns a Redact middleware hiding the matches of the patterns
+// and the given secret values, nil if there is nothing to redact or the
+// patterns are invalid, see Validate
+func NewRedact(c *RedactConfig, secrets ...string) core.Middleware {
+	var m core.Middleware
+	if re, err := c.compile(secrets); err == nil && re != nil {
+		m = &Redact{c: c, secrets: func() []string { return secrets }}
+	}
+
+	return m
+}
+
+// NewRedactFunc returns a Redact middleware hiding the matches of the
+// patterns and the secret values returned by secrets at each execution, for
+// the secrets of jobs added after it, nil if the patterns are invalid
+func NewRedactFunc(c *RedactConfig, secrets func() []string) core.Middleware {
+	var m core.Middleware
+	if c.Validate() == nil {
+		m = &Redact{c: c, secrets: secrets}
+	}
+
+	return m
+}
+
+// Redact middleware replaces the secrets in the output of the execution with
+// `***` once the job has finished. It must be the last middleware so the
+// other ones, saving or sending the output, get the redacted version. The
+// buffers written by the job are left untouched, the execution gets
+// redacted copies of them.
+type Redact struct {
+	c       *RedactConfig
+	secrets func() []string
+
+	// re is compiled from the patterns and the secrets joined in key, again
+	// once the secrets change
+	mu  sync.Mutex
+	key string
+	re  *regexp.Regexp
+}
+
+// ContinueOnStop always returns true, the output of every execution is
+// redacted
+func (m *Redact) ContinueOnStop() bool {
+	return true
+}
+
+// Run redacts the output after running the job
+func (m *Redact) Run(ctx *core.Context) error {
+	err := ctx.Next()
+	ctx.Stop(err)
+
+	re := m.expression()
+	if re == nil {
+		return err
+	}
+
+	e := ctx.Execution
+	e.OutputStream = redact(re, e.OutputStream)
+	e.ErrorStream = redact(re, e.ErrorStream)
+
+	return err
+}
+
+// expression returns the expression matching the patterns and the current
+// secrets, nil if there are none
+func (m *Redact) expression() *regexp.Regexp {
+	secrets := append([]string{}, m.secrets()...)
+	sort.Strings(secrets)
+	key := strings.Join(secrets, "\x00")
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.re == nil || key != m.key {
+		// the patterns were validated by the constructor
+		m.re, _ = m.c.compile(secrets)
+		m.key = key
+	}
+
+	return m.re
+}
+
+func redact(re *regexp.Regexp, b core.OutputBuffer) core.OutputBuffer {
+	if b == nil || b.TotalWritten() == 0 {
+		return b
+	}
+
+	r := &redactedBuffer{size: b.Size(), written: b.TotalWritten()}
+	r.Buffer.Write(re.ReplaceAll(b.Bytes(), []byte(redactedText)))
+	return r
+}
+
+// redactedBuffer holds the redacted copy of an output, with the size and the
+// written bytes of the original so its truncation is still reported
+type redactedBuffer struct {
+	bytes.Buffer
+	size    int64
+	written int64
+}
+
+func (b *redactedBuffer) Size() int64 {
+	return b.size
+}
+
+func (b *redactedBuffer) TotalWritten() int64 {
+	return b.written
+}
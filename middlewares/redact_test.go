@@ -0,0 +1,95 @@
+package middlewares
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/netresearch/ofelia/core"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteRedact struct{}
+
+var _ = Suite(&SuiteRedact{})
+
+// leakyJob prints its output to stdout and stderr
+type leakyJob struct {
+	core.BareJob
+	stdout, stderr string
+}
+
+func (j *leakyJob) Run(ctx *core.Context) error {
+	fmt.Fprint(ctx.Execution.OutputStream, j.stdout)
+	fmt.Fprint(ctx.Execution.ErrorStream, j.stderr)
+	return nil
+}
+
+func (s *SuiteRedact) TestNewRedactEmpty(c *C) {
+	c.Assert(NewRedact(&RedactConfig{}), IsNil)
+	c.Assert(NewRedact(&RedactConfig{}, "", ""), IsNil)
+	c.Assert(NewRedact(&RedactConfig{}, "s3cr3t"), NotNil)
+	c.Assert(NewRedact(&RedactConfig{RedactPatterns: []string{"("}}), IsNil)
+
+	c.Assert(NewRedactFunc(&RedactConfig{}, func() []string { return nil }), NotNil)
+	c.Assert(NewRedactFunc(&RedactConfig{RedactPatterns: []string{"("}}, func() []string { return nil }), IsNil)
+}
+
+func (s *SuiteRedact) TestRedactLiveSecrets(c *C) {
+	var secrets []string
+	job := &leakyJob{stdout: "first hunter2 then s3cr3t\n"}
+	job.Name = "leaky"
+	job.Use(NewRedactFunc(&RedactConfig{}, func() []string { return secrets }))
+
+	run := func() string {
+		ctx := core.NewContext(core.NewScheduler(&TestLogger{}), job, core.NewExecution())
+		ctx.Start()
+		c.Assert(ctx.Next(), IsNil)
+		return string(ctx.Execution.OutputStream.Bytes())
+	}
+
+	c.Assert(run(), Equals, "first hunter2 then s3cr3t\n")
+
+	// a job with a secret was added
+	secrets = []string{"hunter2"}
+	c.Assert(run(), Equals, "first *** then s3cr3t\n")
+
+	secrets = append(secrets, "s3cr3t")
+	c.Assert(run(), Equals, "first *** then ***\n")
+}
+
+func (s *SuiteRedact) TestValidate(c *C) {
+	c.Assert((&RedactConfig{RedactPatterns: []string{`token=\w+`}}).Validate(), IsNil)
+	c.Assert((&RedactConfig{RedactPatterns: []string{`token=\w+`, "("}}).Validate(), ErrorMatches, `invalid redact-patterns "\(".*`)
+}
+
+func (s *SuiteRedact) TestRedactSaved(c *C) {
+	dir := c.MkDir()
+
+	job := &leakyJob{
+		stdout: "login as admin with hunter2.*\nAuthorization: Bearer abc.def\n",
+		stderr: "retrying with token=xyz42\n",
+	}
+	job.Name = "leaky"
+	job.Use(
+		NewSave(&SaveConfig{SaveFolder: dir}),
+		NewRedact(&RedactConfig{RedactPatterns: []string{`Bearer \S+`, `token=\w+`}}, "hunter2.*"),
+	)
+
+	ctx := core.NewContext(core.NewScheduler(&TestLogger{}), job, core.NewExecution())
+	ctx.Start()
+	c.Assert(ctx.Next(), IsNil)
+
+	root := filepath.Join(dir, ctx.Execution.Date.Format("20060102_150405")+"_leaky")
+	stdout, err := os.ReadFile(root + ".stdout.log")
+	c.Assert(err, IsNil)
+	c.Assert(string(stdout), Equals, "login as admin with ***\nAuthorization: ***\n")
+
+	stderr, err := os.ReadFile(root + ".stderr.log")
+	c.Assert(err, IsNil)
+	c.Assert(string(stderr), Equals, "retrying with ***\n")
+
+	c.Assert(ctx.Execution.OutputStream.TotalWritten(), Equals, int64(len(job.stdout)))
+	c.Assert(ctx.Execution.Truncated, Equals, false)
+}
@@ -58,17 +58,19 @@ func (m *Save) saveToDisk(ctx *core.Context) error {
 	))
 
 	e := ctx.Execution
-	err := m.writeFile(e.ErrorStream.Bytes(), fmt.Sprintf("%s.stderr.log", root))
-	if err != nil {
-		return err
-	}
+	if ext := streamExt(e.OutputEncoding); ext != "" {
+		err := m.writeFile([]byte(e.Render(e.ErrorStream)), fmt.Sprintf("%s.stderr.%s", root, ext))
+		if err != nil {
+			return err
+		}
 
-	err = m.writeFile(e.OutputStream.Bytes(), fmt.Sprintf("%s.stdout.log", root))
-	if err != nil {
-		return err
+		err = m.writeFile([]byte(e.Render(e.OutputStream)), fmt.Sprintf("%s.stdout.%s", root, ext))
+		if err != nil {
+			return err
+		}
 	}
 
-	err = m.saveContextToDisk(ctx, fmt.Sprintf("%s.json", root))
+	err := m.saveContextToDisk(ctx, fmt.Sprintf("%s.json", root))
 	if err != nil {
 		return err
 	}
@@ -76,6 +78,19 @@ func (m *Save) saveToDisk(ctx *core.Context) error {
 	return nil
 }
 
+// streamExt returns the extension of the files of the streams rendered with
+// the given output encoding, empty if they are dropped
+func streamExt(encoding string) string {
+	switch encoding {
+	case core.OutputEncodingBase64:
+		return "b64"
+	case core.OutputEncodingDrop:
+		return ""
+	default:
+		return "log"
+	}
+}
+
 func (m *Save) saveContextToDisk(ctx *core.Context, filename string) error {
 	js, _ := json.MarshalIndent(map[string]interface{}{
 		"Job":       ctx.Job,
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/netresearch/ofelia/core"
 	. "gopkg.in/check.v1"
 )
 
@@ -42,6 +43,47 @@ func (s *SuiteSave) TestRunSuccess(c *C) {
 	c.Assert(err, IsNil)
 }
 
+func (s *SuiteSave) TestRunOutputEncoding(c *C) {
+	s.job.Name = "foo"
+	binary := []byte("ok \xff\xfe\n")
+
+	for _, t := range []struct {
+		encoding string
+		ext      string
+		stdout   string
+	}{
+		{"", "log", "ok \uFFFD\n"},
+		{core.OutputEncodingBase64, "b64", "b2sg//4K"},
+	} {
+		dir := c.MkDir()
+		s.ctx.Execution = core.NewExecution()
+		s.ctx.Execution.OutputEncoding = t.encoding
+		s.ctx.Execution.OutputStream.Write(binary)
+		s.ctx.Start()
+		s.ctx.Stop(nil)
+		s.ctx.Execution.Date = time.Time{}
+
+		c.Assert(NewSave(&SaveConfig{SaveFolder: dir}).Run(s.ctx), IsNil)
+
+		stdout, err := os.ReadFile(filepath.Join(dir, "00010101_000000_foo.stdout."+t.ext))
+		c.Assert(err, IsNil)
+		c.Assert(string(stdout), Equals, t.stdout)
+
+		_, err = os.Stat(filepath.Join(dir, "00010101_000000_foo.stderr."+t.ext))
+		c.Assert(err, IsNil)
+	}
+
+	// only the report is saved
+	dir := c.MkDir()
+	s.ctx.Execution.OutputEncoding = core.OutputEncodingDrop
+	c.Assert(NewSave(&SaveConfig{SaveFolder: dir}).Run(s.ctx), IsNil)
+
+	files, err := os.ReadDir(dir)
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 1)
+	c.Assert(files[0].Name(), Equals, "00010101_000000_foo.json")
+}
+
 func (s *SuiteSave) TestRunSuccessOnError(c *C) {
 	dir, err := ioutil.TempDir("/tmp", "save")
 	c.Assert(err, IsNil)
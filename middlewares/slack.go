@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/netresearch/ofelia/core"
 )
@@ -19,13 +20,16 @@ var (
 type SlackConfig struct {
 	SlackWebhook     string `gcfg:"slack-webhook" mapstructure:"slack-webhook"`
 	SlackOnlyOnError bool   `gcfg:"slack-only-on-error" mapstructure:"slack-only-on-error"`
+	// SlackNotifyOnRecovery sends a message when a job succeeds after a
+	// failure, even with SlackOnlyOnError
+	SlackNotifyOnRecovery bool `gcfg:"slack-notify-on-recovery" mapstructure:"slack-notify-on-recovery"`
 }
 
 // NewSlack returns a Slack middleware if the given configuration is not empty
 func NewSlack(c *SlackConfig) core.Middleware {
 	var m core.Middleware
 	if !IsEmpty(c) {
-		m = &Slack{*c}
+		m = &Slack{SlackConfig: *c, status: NewStatusTracker()}
 	}
 
 	return m
@@ -34,6 +38,15 @@ func NewSlack(c *SlackConfig) core.Middleware {
 // Slack middleware calls to a Slack input-hook after every execution of a job
 type Slack struct {
 	SlackConfig
+	status  *StatusTracker
+	batcher *NotificationBatcher
+}
+
+// EnableBatching groups the failures happening within the window into a
+// single message
+func (m *Slack) EnableBatching(window time.Duration) *NotificationBatcher {
+	m.batcher = NewNotificationBatcher(window, m.pushBatch)
+	return m.batcher
 }
 
 // ContinueOnStop return allways true, we want alloways report the final status
@@ -47,37 +60,52 @@ func (m *Slack) Run(ctx *core.Context) error {
 	err := ctx.Next()
 	ctx.Stop(err)
 
-	if ctx.Execution.Failed || !m.SlackOnlyOnError {
-		m.pushMessage(ctx)
+	recovered := m.SlackNotifyOnRecovery && m.status.Recovered(ctx.Job.GetName(), ctx.Execution)
+	if ctx.Execution.Failed && m.batcher != nil {
+		m.batcher.Add(ctx)
+	} else if ctx.Execution.Failed || (!m.SlackOnlyOnError && !silentSuccess(ctx)) || recovered {
+		m.pushMessage(ctx, recovered)
 	}
 
 	return err
 }
 
-func (m *Slack) pushMessage(ctx *core.Context) {
+func (m *Slack) pushMessage(ctx *core.Context, recovered bool) {
+	m.post(ctx.Logger, m.buildMessage(ctx, recovered))
+}
+
+func (m *Slack) pushBatch(logger core.Logger, failures []*BatchedFailure) {
+	m.post(logger, m.buildBatchMessage(failures))
+}
+
+func (m *Slack) post(logger core.Logger, msg *slackMessage) {
 	values := make(url.Values, 0)
-	content, _ := json.Marshal(m.buildMessage(ctx))
+	content, _ := json.Marshal(msg)
 	values.Add(slackPayloadVar, string(content))
 
 	r, err := http.PostForm(m.SlackWebhook, values)
 	if err != nil {
-		ctx.Logger.Errorf("Slack error calling %q error: %q", m.SlackWebhook, err)
+		logger.Errorf("Slack error calling %q error: %q", m.SlackWebhook, err)
 	} else if r.StatusCode != 200 {
-		ctx.Logger.Errorf("Slack error non-200 status code calling %q", m.SlackWebhook)
+		logger.Errorf("Slack error non-200 status code calling %q", m.SlackWebhook)
 	}
 }
 
-func (m *Slack) buildMessage(ctx *core.Context) *slackMessage {
+func (m *Slack) buildMessage(ctx *core.Context, recovered bool) *slackMessage {
 	msg := &slackMessage{
 		Username: slackUsername,
 		IconURL:  slackAvatarURL,
 	}
 
 	msg.Text = fmt.Sprintf(
-		"Job *%q* finished in *%s*, command `%s`",
-		ctx.Job.GetName(), ctx.Execution.Duration, ctx.Job.GetCommand(),
+		"Job *%q* finished in *%s*, command `%s`, execution `%s`",
+		ctx.Job.GetName(), ctx.Execution.Duration, ctx.Job.GetCommand(), ctx.Execution.ID,
 	)
 
+	if ctx.Execution.Truncated {
+		msg.Text += ", output truncated"
+	}
+
 	if ctx.Execution.Failed {
 		msg.Attachments = append(msg.Attachments, slackAttachment{
 			Title: "Execution failed",
@@ -89,6 +117,11 @@ func (m *Slack) buildMessage(ctx *core.Context) *slackMessage {
 			Title: "Execution skipped",
 			Color: "#FFA500",
 		})
+	} else if recovered {
+		msg.Attachments = append(msg.Attachments, slackAttachment{
+			Title: "Execution recovered",
+			Color: "#7CD197",
+		})
 	} else {
 		msg.Attachments = append(msg.Attachments, slackAttachment{
 			Title: "Execution successful",
@@ -99,6 +132,24 @@ func (m *Slack) buildMessage(ctx *core.Context) *slackMessage {
 	return msg
 }
 
+func (m *Slack) buildBatchMessage(failures []*BatchedFailure) *slackMessage {
+	msg := &slackMessage{
+		Username: slackUsername,
+		IconURL:  slackAvatarURL,
+		Text:     fmt.Sprintf("*%d* executions failed", len(failures)),
+	}
+
+	for _, f := range failures {
+		msg.Attachments = append(msg.Attachments, slackAttachment{
+			Title: fmt.Sprintf("Job %q failed", f.JobName),
+			Text:  f.Error,
+			Color: "#F35A00",
+		})
+	}
+
+	return msg
+}
+
 type slackMessage struct {
 	Text        string            `json:"text"`
 	Username    string            `json:"username"`
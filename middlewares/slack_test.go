@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 
+	"github.com/netresearch/ofelia/core"
+
 	. "gopkg.in/check.v1"
 )
 
@@ -64,3 +66,24 @@ func (s *SuiteSlack) TestRunSuccessOnError(c *C) {
 	m := NewSlack(&SlackConfig{SlackWebhook: ts.URL, SlackOnlyOnError: true})
 	c.Assert(m.Run(s.ctx), IsNil)
 }
+
+func (s *SuiteSlack) TestRunRecovered(c *C) {
+	var titles []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m slackMessage
+		json.Unmarshal([]byte(r.FormValue(slackPayloadVar)), &m)
+		titles = append(titles, m.Attachments[0].Title)
+	}))
+
+	defer ts.Close()
+
+	m := NewSlack(&SlackConfig{SlackWebhook: ts.URL, SlackOnlyOnError: true, SlackNotifyOnRecovery: true})
+	for _, err := range []error{nil, errors.New("foo"), nil, nil} {
+		s.ctx.Execution = core.NewExecution()
+		s.ctx.Start()
+		s.ctx.Stop(err)
+		m.Run(s.ctx)
+	}
+
+	c.Assert(titles, DeepEquals, []string{"Execution failed", "Execution recovered"})
+}
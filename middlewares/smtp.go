@@ -0,0 +1,191 @@
+package middlewares
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/gomail.v2"
+)
+
+// TLS modes of the connection to the SMTP server
+const (
+	SMTPTLSModeNone     = "none"
+	SMTPTLSModeStartTLS = "starttls"
+	SMTPTLSModeTLS      = "tls"
+)
+
+var (
+	// smtpDialTimeout is the maximum time to connect to the SMTP server
+	smtpDialTimeout = 10 * time.Second
+
+	ErrUnknownSMTPTLSMode   = errors.New("unknown smtp-tls-mode, expected none, starttls or tls")
+	ErrSTARTTLSNotSupported = errors.New("the SMTP server doesn't support STARTTLS")
+)
+
+// smtpDialer connects to an SMTP server with an explicit TLS mode: `none`
+// never encrypts the connection, `starttls` requires the STARTTLS extension
+// and `tls` encrypts the connection from the start
+type smtpDialer struct {
+	host       string
+	port       int
+	username   string
+	password   string
+	mode       string
+	skipVerify bool
+}
+
+// DialAndSend connects to the server, sends the message and disconnects
+func (d *smtpDialer) DialAndSend(msg *gomail.Message) error {
+	c, err := d.dial()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	s := gomail.SendFunc(func(from string, to []string, msg io.WriterTo) error {
+		return sendSMTP(c, from, to, msg)
+	})
+
+	if err := gomail.Send(s, msg); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+func (d *smtpDialer) dial() (*smtp.Client, error) {
+	addr := net.JoinHostPort(d.host, strconv.Itoa(d.port))
+	cfg := &tls.Config{ServerName: d.host, InsecureSkipVerify: d.skipVerify}
+
+	var conn net.Conn
+	var err error
+	switch d.mode {
+	case SMTPTLSModeTLS:
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: smtpDialTimeout}, "tcp", addr, cfg)
+	case SMTPTLSModeNone, SMTPTLSModeStartTLS:
+		conn, err = net.DialTimeout("tcp", addr, smtpDialTimeout)
+	default:
+		return nil, ErrUnknownSMTPTLSMode
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := smtp.NewClient(conn, d.host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if d.mode == SMTPTLSModeStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			c.Close()
+			return nil, ErrSTARTTLSNotSupported
+		}
+
+		if err := c.StartTLS(cfg); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+
+	if err := d.auth(c); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// auth authenticates with the first mechanism supported by the server among
+// CRAM-MD5, PLAIN and LOGIN. The credentials are never sent over an
+// unencrypted connection, except to localhost.
+func (d *smtpDialer) auth(c *smtp.Client) error {
+	if d.username == "" {
+		return nil
+	}
+
+	ok, mechanisms := c.Extension("AUTH")
+	if !ok {
+		return errors.New("the SMTP server doesn't support authentication")
+	}
+
+	var a smtp.Auth
+	switch {
+	case strings.Contains(mechanisms, "CRAM-MD5"):
+		a = smtp.CRAMMD5Auth(d.username, d.password)
+	case strings.Contains(mechanisms, "PLAIN"):
+		a = smtp.PlainAuth("", d.username, d.password, d.host)
+	case strings.Contains(mechanisms, "LOGIN"):
+		a = &smtpLoginAuth{username: d.username, password: d.password}
+	default:
+		return fmt.Errorf("no supported authentication mechanism among %q", mechanisms)
+	}
+
+	return c.Auth(a)
+}
+
+func sendSMTP(c *smtp.Client, from string, to []string, msg io.WriterTo) error {
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+
+	for _, addr := range to {
+		if err := c.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err := msg.WriteTo(w); err != nil {
+		w.Close()
+		return err
+	}
+
+	return w.Close()
+}
+
+// smtpLoginAuth implements the LOGIN mechanism, not provided by net/smtp
+type smtpLoginAuth struct {
+	username string
+	password string
+}
+
+func (a *smtpLoginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+
+	return "LOGIN", nil, nil
+}
+
+func (a *smtpLoginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected server challenge %q", fromServer)
+	}
+}
+
+func isLocalhost(host string) bool {
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
@@ -0,0 +1,199 @@
+package middlewares
+
+import (
+	"bufio"
+	"crypto/tls"
+	"net"
+	"net/http/httptest"
+	"net/smtp"
+	"strconv"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteSMTP struct {
+	BaseSuite
+	cert tls.Certificate
+}
+
+var _ = Suite(&SuiteSMTP{})
+
+func (s *SuiteSMTP) SetUpSuite(c *C) {
+	// borrow the self-signed certificate of httptest
+	ts := httptest.NewUnstartedServer(nil)
+	ts.StartTLS()
+	s.cert = ts.TLS.Certificates[0]
+	ts.Close()
+}
+
+// fakeSMTP is a minimal SMTP server recording how the client secured the
+// connection: "tls" from the start, "starttls" or "plain"
+type fakeSMTP struct {
+	l         net.Listener
+	starttls  bool
+	handshake chan string
+	auth      chan string
+}
+
+func (s *SuiteSMTP) newFakeSMTP(c *C, implicitTLS, starttls bool) *fakeSMTP {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+
+	cfg := &tls.Config{Certificates: []tls.Certificate{s.cert}}
+	if implicitTLS {
+		l = tls.NewListener(l, cfg)
+	}
+
+	f := &fakeSMTP{l: l, starttls: starttls, handshake: make(chan string, 1), auth: make(chan string, 1)}
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		mode := "plain"
+		if implicitTLS {
+			mode = "tls"
+		}
+
+		f.serve(conn, cfg, mode)
+	}()
+
+	return f
+}
+
+func (f *fakeSMTP) serve(conn net.Conn, cfg *tls.Config, mode string) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	write := func(s string) { conn.Write([]byte(s + "\r\n")) }
+	write("220 localhost ESMTP")
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		cmd := strings.ToUpper(strings.Fields(line + " x")[0])
+		switch cmd {
+		case "EHLO":
+			if f.starttls && mode == "plain" {
+				write("250-localhost")
+				write("250-STARTTLS")
+			} else {
+				write("250-localhost")
+			}
+			write("250 AUTH PLAIN")
+		case "STARTTLS":
+			write("220 ready")
+			tc := tls.Server(conn, cfg)
+			if tc.Handshake() != nil {
+				return
+			}
+
+			conn, r, mode = tc, bufio.NewReader(tc), "starttls"
+		case "AUTH":
+			f.auth <- strings.TrimSpace(line)
+			write("235 ok")
+		case "MAIL":
+			f.handshake <- mode
+			write("250 ok")
+		case "RCPT":
+			write("250 ok")
+		case "DATA":
+			write("354 go ahead")
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil || l == ".\r\n" {
+					break
+				}
+			}
+			write("250 ok")
+		case "QUIT":
+			write("221 bye")
+			return
+		default:
+			write("502 not implemented")
+		}
+	}
+}
+
+func (f *fakeSMTP) config(mode string) *MailConfig {
+	host, port, _ := net.SplitHostPort(f.l.Addr().String())
+	p, _ := strconv.Atoi(port)
+
+	return &MailConfig{
+		SMTPHost:               host,
+		SMTPPort:               p,
+		SMTPTLSMode:            mode,
+		SMTPInsecureSkipVerify: true,
+		EmailTo:                "foo@foo.com",
+		EmailFrom:              "qux@qux.com",
+	}
+}
+
+func (s *SuiteSMTP) send(mc *MailConfig) error {
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+
+	return NewMail(mc).(*Mail).sendMail(s.ctx, false)
+}
+
+func (s *SuiteSMTP) TestModeTLS(c *C) {
+	f := s.newFakeSMTP(c, true, false)
+	defer f.l.Close()
+
+	c.Assert(s.send(f.config(SMTPTLSModeTLS)), IsNil)
+	c.Assert(<-f.handshake, Equals, "tls")
+}
+
+func (s *SuiteSMTP) TestModeStartTLS(c *C) {
+	f := s.newFakeSMTP(c, false, true)
+	defer f.l.Close()
+
+	mc := f.config(SMTPTLSModeStartTLS)
+	mc.SMTPUser = "user"
+	mc.SMTPPassword = "secret"
+	c.Assert(s.send(mc), IsNil)
+	c.Assert(<-f.handshake, Equals, "starttls")
+	c.Assert(<-f.auth, Matches, "AUTH PLAIN .+")
+}
+
+func (s *SuiteSMTP) TestModeStartTLSNotSupported(c *C) {
+	f := s.newFakeSMTP(c, false, false)
+	defer f.l.Close()
+
+	c.Assert(s.send(f.config(SMTPTLSModeStartTLS)), Equals, ErrSTARTTLSNotSupported)
+}
+
+func (s *SuiteSMTP) TestModeNone(c *C) {
+	f := s.newFakeSMTP(c, false, true)
+	defer f.l.Close()
+
+	c.Assert(s.send(f.config(SMTPTLSModeNone)), IsNil)
+	c.Assert(<-f.handshake, Equals, "plain")
+}
+
+func (s *SuiteSMTP) TestLoginAuthRefusesUnencrypted(c *C) {
+	_, _, err := (&smtpLoginAuth{}).Start(&smtp.ServerInfo{Name: "mail.example.com"})
+	c.Assert(err, NotNil)
+
+	_, _, err = (&smtpLoginAuth{}).Start(&smtp.ServerInfo{Name: "mail.example.com", TLS: true})
+	c.Assert(err, IsNil)
+}
+
+func (s *SuiteSMTP) TestValidate(c *C) {
+	c.Assert((&MailConfig{}).Validate(), IsNil)
+	c.Assert((&MailConfig{SMTPTLSMode: SMTPTLSModeStartTLS}).Validate(), IsNil)
+	c.Assert((&MailConfig{SMTPTLSMode: "ssl"}).Validate(), ErrorMatches, `unknown smtp-tls-mode.*"ssl"`)
+}
+
+func (s *SuiteSMTP) TestTLSWarning(c *C) {
+	c.Assert((&MailConfig{SMTPPort: 465}).TLSWarning(), Equals, "")
+	c.Assert((&MailConfig{SMTPPort: 465, SMTPTLSMode: SMTPTLSModeTLS}).TLSWarning(), Equals, "")
+	c.Assert((&MailConfig{SMTPPort: 465, SMTPTLSMode: SMTPTLSModeStartTLS}).TLSWarning(), Matches, "smtp-port 465 .*")
+	c.Assert((&MailConfig{SMTPPort: 587, SMTPTLSMode: SMTPTLSModeTLS}).TLSWarning(), Matches, "smtp-port 587 .*")
+	c.Assert((&MailConfig{SMTPPort: 25, SMTPTLSMode: SMTPTLSModeNone, SMTPUser: "u"}).TLSWarning(), Matches, ".*credentials.*")
+}
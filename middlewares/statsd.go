@@ -0,0 +1,186 @@
+package middlewares
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/netresearch/ofelia/core"
+)
+
+var (
+	statsdDefaultPrefix = "ofelia"
+	// statsdMaxPacket is the maximum size of the UDP packets, small enough
+	// to not be fragmented on common networks
+	statsdMaxPacket = 1432
+	// statsdQueueSize is the number of metrics waiting to be sent, once the
+	// queue is full the new metrics are dropped
+	statsdQueueSize = 1000
+	// statsdGaugeInterval is how often the running and queued executions
+	// are sampled
+	statsdGaugeInterval = 10 * time.Second
+	statsdInvalid       = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+)
+
+// StatsDConfig configuration for the StatsD middleware
+type StatsDConfig struct {
+	// StatsDAddress is the `host:port` of the StatsD server
+	StatsDAddress string `gcfg:"statsd-address" mapstructure:"statsd-address"`
+	// StatsDPrefix is prepended to the metric names, `ofelia` by default
+	StatsDPrefix string `gcfg:"statsd-prefix" mapstructure:"statsd-prefix"`
+}
+
+// NewStatsD returns a StatsD middleware if the given configuration has an
+// address
+func NewStatsD(c *StatsDConfig) core.Middleware {
+	var m core.Middleware
+	if c.StatsDAddress != "" {
+		prefix := c.StatsDPrefix
+		if prefix == "" {
+			prefix = statsdDefaultPrefix
+		}
+
+		m = &StatsD{
+			StatsDConfig: *c,
+			prefix:       prefix,
+			client:       newStatsDClient(c.StatsDAddress),
+		}
+	}
+
+	return m
+}
+
+// StatsD middleware emits a counter when a job starts, and a timer plus a
+// counter of the outcome when it finishes. The time an execution waited for
+// its overlap policy and max-concurrent, if any, is timed too, and the time
+// of the last success is kept in a gauge. The executions running and queued
+// in the scheduler are sampled in gauges from the first execution on. The
+// metrics are sent over UDP from a background goroutine, the executions never
+// wait for the network.
+type StatsD struct {
+	StatsDConfig
+	prefix string
+	client *statsdClient
+	gauges sync.Once
+}
+
+// ContinueOnStop always returns true, the metrics of the stopped executions
+// are emitted too
+func (m *StatsD) ContinueOnStop() bool {
+	return true
+}
+
+// Run emits the metrics of the execution
+func (m *StatsD) Run(ctx *core.Context) error {
+	m.gauges.Do(func() { go m.sampleScheduler(ctx.Scheduler, statsdGaugeInterval) })
+
+	name := m.metricName(ctx.Job.GetName())
+	if !ctx.Execution.Skipped {
+		m.client.send(name + ".started:1|c")
+	}
+
+	err := ctx.Next()
+	ctx.Stop(err)
+
+	if ctx.Execution.QueueWait >= time.Millisecond {
+		m.client.send(fmt.Sprintf("%s.queue_wait:%d|ms", name, ctx.Execution.QueueWait.Milliseconds()))
+	}
+
+	switch {
+	case ctx.Execution.Skipped:
+		m.client.send(name + ".skipped:1|c")
+	case ctx.Execution.Failed:
+		m.client.send(fmt.Sprintf("%s.duration:%d|ms", name, ctx.Execution.Duration.Milliseconds()))
+		m.client.send(name + ".failed:1|c")
+	default:
+		m.client.send(fmt.Sprintf("%s.duration:%d|ms", name, ctx.Execution.Duration.Milliseconds()))
+		m.client.send(name + ".succeeded:1|c")
+		m.client.send(fmt.Sprintf("%s.last_success:%d|g", name, ctx.Execution.Date.Add(ctx.Execution.Duration).Unix()))
+	}
+
+	return err
+}
+
+// sampleScheduler sends the gauges of the executions running and queued in
+// the scheduler at every interval
+func (m *StatsD) sampleScheduler(s *core.Scheduler, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for range t.C {
+		m.client.send(fmt.Sprintf("%s.running:%d|g", m.prefix, s.Running()))
+		m.client.send(fmt.Sprintf("%s.queued:%d|g", m.prefix, s.Queued()))
+	}
+}
+
+// metricName returns the base name of the metrics of a job, the characters
+// with a meaning for StatsD are replaced
+func (m *StatsD) metricName(job string) string {
+	return m.prefix + ".job." + statsdInvalid.ReplaceAllString(job, "_")
+}
+
+// statsdClient sends the metrics queued by send, batching as many as fit
+// in a packet
+type statsdClient struct {
+	addr    string
+	metrics chan string
+	conn    net.Conn
+}
+
+func newStatsDClient(addr string) *statsdClient {
+	c := &statsdClient{
+		addr:    addr,
+		metrics: make(chan string, statsdQueueSize),
+	}
+
+	go c.loop()
+	return c
+}
+
+// send queues a metric, it's dropped if the queue is full
+func (c *statsdClient) send(metric string) {
+	select {
+	case c.metrics <- metric:
+	default:
+	}
+}
+
+func (c *statsdClient) loop() {
+	for metric := range c.metrics {
+		packet := metric
+	drain:
+		for {
+			select {
+			case metric := <-c.metrics:
+				if len(packet)+1+len(metric) > statsdMaxPacket {
+					c.write(packet)
+					packet = metric
+					continue
+				}
+
+				packet += "\n" + metric
+			default:
+				break drain
+			}
+		}
+
+		c.write(packet)
+	}
+}
+
+// write sends a packet, dialing the server on first use. StatsD is a best
+// effort protocol, the errors are ignored.
+func (c *statsdClient) write(packet string) {
+	if c.conn == nil {
+		conn, err := net.DialTimeout("udp", c.addr, time.Second)
+		if err != nil {
+			return
+		}
+
+		c.conn = conn
+	}
+
+	c.conn.Write([]byte(packet))
+}
@@ -0,0 +1,125 @@
+package middlewares
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/netresearch/ofelia/core"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteStatsD struct {
+	BaseSuite
+	conn net.PacketConn
+}
+
+var _ = Suite(&SuiteStatsD{})
+
+func (s *SuiteStatsD) SetUpTest(c *C) {
+	s.BaseSuite.SetUpTest(c)
+
+	var err error
+	s.conn, err = net.ListenPacket("udp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+}
+
+func (s *SuiteStatsD) TearDownTest(c *C) {
+	s.conn.Close()
+}
+
+// receive reads the metric lines sent to the fake server until n of them
+// are received, the lines are sorted since their order isn't relevant
+func (s *SuiteStatsD) receive(c *C, n int) []string {
+	var lines []string
+	buf := make([]byte, statsdMaxPacket)
+	s.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for len(lines) < n {
+		size, _, err := s.conn.ReadFrom(buf)
+		c.Assert(err, IsNil)
+		lines = append(lines, strings.Split(string(buf[:size]), "\n")...)
+	}
+
+	sort.Strings(lines)
+	return lines
+}
+
+func (s *SuiteStatsD) TestNewStatsDEmpty(c *C) {
+	c.Assert(NewStatsD(&StatsDConfig{}), IsNil)
+	c.Assert(NewStatsD(&StatsDConfig{StatsDPrefix: "foo"}), IsNil)
+}
+
+func (s *SuiteStatsD) TestRunSucceeded(c *C) {
+	s.job.Name = "backup:db"
+	s.ctx.Start()
+
+	m := NewStatsD(&StatsDConfig{StatsDAddress: s.conn.LocalAddr().String()})
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	lines := s.receive(c, 4)
+	c.Assert(lines, HasLen, 4)
+	c.Assert(lines[0], Matches, `ofelia\.job\.backup_db\.duration:\d+\|ms`)
+	c.Assert(lines[1], Equals, fmt.Sprintf("ofelia.job.backup_db.last_success:%d|g", s.ctx.Execution.Date.Add(s.ctx.Execution.Duration).Unix()))
+	c.Assert(lines[2:], DeepEquals, []string{
+		"ofelia.job.backup_db.started:1|c",
+		"ofelia.job.backup_db.succeeded:1|c",
+	})
+}
+
+func (s *SuiteStatsD) TestRunFailed(c *C) {
+	s.job.Name = "foo"
+	s.ctx.Start()
+	s.ctx.Stop(errors.New("foo"))
+
+	m := NewStatsD(&StatsDConfig{StatsDAddress: s.conn.LocalAddr().String(), StatsDPrefix: "cron"})
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	lines := s.receive(c, 3)
+	c.Assert(lines, HasLen, 3)
+	c.Assert(lines[0], Matches, `cron\.job\.foo\.duration:\d+\|ms`)
+	c.Assert(lines[1:], DeepEquals, []string{"cron.job.foo.failed:1|c", "cron.job.foo.started:1|c"})
+}
+
+func (s *SuiteStatsD) TestRunQueueWait(c *C) {
+	s.job.Name = "foo"
+	s.ctx.Execution.QueueWait = 1500 * time.Millisecond
+	s.ctx.Start()
+
+	m := NewStatsD(&StatsDConfig{StatsDAddress: s.conn.LocalAddr().String()})
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	lines := s.receive(c, 5)
+	c.Assert(lines, HasLen, 5)
+	c.Assert(lines[2], Equals, "ofelia.job.foo.queue_wait:1500|ms")
+}
+
+func (s *SuiteStatsD) TestRunSkipped(c *C) {
+	s.job.Name = "foo"
+	s.ctx.Start()
+	s.ctx.Stop(core.ErrSkippedExecution)
+
+	m := NewStatsD(&StatsDConfig{StatsDAddress: s.conn.LocalAddr().String()})
+	c.Assert(m.Run(s.ctx), IsNil)
+	c.Assert(s.receive(c, 1), DeepEquals, []string{"ofelia.job.foo.skipped:1|c"})
+}
+
+func (s *SuiteStatsD) TestSampleScheduler(c *C) {
+	m := NewStatsD(&StatsDConfig{StatsDAddress: s.conn.LocalAddr().String()}).(*StatsD)
+	go m.sampleScheduler(s.ctx.Scheduler, 10*time.Millisecond)
+
+	// a packet may hold the samples of several ticks
+	lines := s.receive(c, 2)
+	c.Assert(lines[0], Equals, "ofelia.queued:0|g")
+	c.Assert(lines[len(lines)-1], Equals, "ofelia.running:0|g")
+}
+
+func (s *SuiteStatsD) TestSendNeverBlocks(c *C) {
+	client := &statsdClient{metrics: make(chan string, 1)}
+	client.send("a:1|c")
+	client.send("b:1|c")
+	c.Assert(len(client.metrics), Equals, 1)
+}
@@ -0,0 +1,133 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/netresearch/ofelia/core"
+)
+
+var (
+	teamsCardType    = "MessageCard"
+	teamsCardContext = "https://schema.org/extensions"
+)
+
+// TeamsConfig configuration for the Microsoft Teams middleware
+type TeamsConfig struct {
+	TeamsWebhook     string `gcfg:"teams-webhook" mapstructure:"teams-webhook"`
+	TeamsOnlyOnError bool   `gcfg:"teams-only-on-error" mapstructure:"teams-only-on-error"`
+	// TeamsNotifyOnRecovery sends a card when a job succeeds after a
+	// failure, even with TeamsOnlyOnError
+	TeamsNotifyOnRecovery bool `gcfg:"teams-notify-on-recovery" mapstructure:"teams-notify-on-recovery"`
+}
+
+// NewTeams returns a Teams middleware if the given configuration is not empty
+func NewTeams(c *TeamsConfig) core.Middleware {
+	var m core.Middleware
+	if !IsEmpty(c) {
+		m = &Teams{TeamsConfig: *c, status: NewStatusTracker()}
+	}
+
+	return m
+}
+
+// Teams middleware posts a MessageCard to a Teams incoming webhook after
+// every execution of a job
+type Teams struct {
+	TeamsConfig
+	status *StatusTracker
+}
+
+// ContinueOnStop always returns true, the final status of the stopped
+// executions is sent too
+func (m *Teams) ContinueOnStop() bool {
+	return true
+}
+
+// Run sends a card to the Teams channel, the execution is stopped first so
+// the card has its final status and duration
+func (m *Teams) Run(ctx *core.Context) error {
+	err := ctx.Next()
+	ctx.Stop(err)
+
+	recovered := m.TeamsNotifyOnRecovery && m.status.Recovered(ctx.Job.GetName(), ctx.Execution)
+	if ctx.Execution.Failed || (!m.TeamsOnlyOnError && !silentSuccess(ctx)) || recovered {
+		m.pushMessage(ctx, recovered)
+	}
+
+	return err
+}
+
+func (m *Teams) pushMessage(ctx *core.Context, recovered bool) {
+	content, _ := json.Marshal(m.buildMessage(ctx, recovered))
+
+	r, err := http.Post(m.TeamsWebhook, "application/json", bytes.NewReader(content))
+	if err != nil {
+		ctx.Logger.Errorf("Teams error calling %q error: %q", m.TeamsWebhook, err)
+		return
+	}
+	r.Body.Close()
+
+	if r.StatusCode >= 300 {
+		ctx.Logger.Errorf("Teams error non-2xx status code calling %q", m.TeamsWebhook)
+	}
+}
+
+func (m *Teams) buildMessage(ctx *core.Context, recovered bool) *teamsMessage {
+	msg := &teamsMessage{
+		Type:    teamsCardType,
+		Context: teamsCardContext,
+	}
+
+	s := teamsSection{
+		Facts: []teamsFact{
+			{Name: "Job", Value: ctx.Job.GetName()},
+			{Name: "Command", Value: ctx.Job.GetCommand()},
+			{Name: "Duration", Value: ctx.Execution.Duration.String()},
+			{Name: "Execution", Value: ctx.Execution.ID},
+		},
+	}
+
+	if ctx.Execution.Failed {
+		msg.ThemeColor = "F35A00"
+		s.ActivityTitle = "Execution failed"
+		s.Text = ctx.Execution.Error.Error()
+	} else if ctx.Execution.Skipped {
+		msg.ThemeColor = "FFA500"
+		s.ActivityTitle = "Execution skipped"
+	} else if recovered {
+		msg.ThemeColor = "7CD197"
+		s.ActivityTitle = "Execution recovered"
+	} else {
+		msg.ThemeColor = "7CD197"
+		s.ActivityTitle = "Execution successful"
+	}
+
+	msg.Summary = fmt.Sprintf("Job %q: %s", ctx.Job.GetName(), s.ActivityTitle)
+	msg.Title = fmt.Sprintf("Job %q finished in %s", ctx.Job.GetName(), ctx.Execution.Duration)
+	msg.Sections = []teamsSection{s}
+
+	return msg
+}
+
+type teamsMessage struct {
+	Type       string         `json:"@type"`
+	Context    string         `json:"@context"`
+	Summary    string         `json:"summary"`
+	ThemeColor string         `json:"themeColor"`
+	Title      string         `json:"title"`
+	Sections   []teamsSection `json:"sections"`
+}
+
+type teamsSection struct {
+	ActivityTitle string      `json:"activityTitle"`
+	Text          string      `json:"text,omitempty"`
+	Facts         []teamsFact `json:"facts"`
+}
+
+type teamsFact struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
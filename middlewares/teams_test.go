@@ -0,0 +1,95 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteTeams struct {
+	BaseSuite
+}
+
+var _ = Suite(&SuiteTeams{})
+
+func (s *SuiteTeams) TestNewTeamsEmpty(c *C) {
+	c.Assert(NewTeams(&TeamsConfig{}), IsNil)
+}
+
+func (s *SuiteTeams) TestRunSuccess(c *C) {
+	var card map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.Header.Get("Content-Type"), Equals, "application/json")
+		json.NewDecoder(r.Body).Decode(&card)
+	}))
+
+	defer ts.Close()
+
+	s.job.Name = "foo"
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+
+	m := NewTeams(&TeamsConfig{TeamsWebhook: ts.URL})
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	for _, key := range []string{"@type", "@context", "summary", "themeColor", "title", "sections"} {
+		c.Assert(card[key], NotNil, Commentf("missing %q", key))
+	}
+
+	c.Assert(card["@type"], Equals, "MessageCard")
+	c.Assert(card["themeColor"], Equals, "7CD197")
+
+	section := card["sections"].([]interface{})[0].(map[string]interface{})
+	c.Assert(section["activityTitle"], Equals, "Execution successful")
+	c.Assert(section["facts"].([]interface{})[0], DeepEquals, map[string]interface{}{
+		"name": "Job", "value": "foo",
+	})
+}
+
+func (s *SuiteTeams) TestRunSuccessFailed(c *C) {
+	var m teamsMessage
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&m)
+	}))
+
+	defer ts.Close()
+
+	s.ctx.Start()
+	s.ctx.Stop(errors.New("foo"))
+
+	t := NewTeams(&TeamsConfig{TeamsWebhook: ts.URL})
+	c.Assert(t.Run(s.ctx), IsNil)
+	c.Assert(m.ThemeColor, Equals, "F35A00")
+	c.Assert(m.Sections[0].ActivityTitle, Equals, "Execution failed")
+	c.Assert(m.Sections[0].Text, Equals, "foo")
+	c.Assert(m.Sections[0].Facts[3], DeepEquals, teamsFact{Name: "Execution", Value: s.ctx.Execution.ID})
+}
+
+func (s *SuiteTeams) TestRunSuccessOnError(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(true, Equals, false)
+	}))
+
+	defer ts.Close()
+
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+
+	m := NewTeams(&TeamsConfig{TeamsWebhook: ts.URL, TeamsOnlyOnError: true})
+	c.Assert(m.Run(s.ctx), IsNil)
+}
+
+func (s *SuiteTeams) TestRunNetworkFailure(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Close()
+
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+
+	m := NewTeams(&TeamsConfig{TeamsWebhook: ts.URL})
+	c.Assert(m.Run(s.ctx), IsNil)
+	c.Assert(s.ctx.Execution.Failed, Equals, false)
+}
@@ -0,0 +1,221 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"text/template"
+	"time"
+
+	"github.com/netresearch/ofelia/core"
+)
+
+var (
+	webhookContentType = "application/json"
+	// webhookStreamTail is the maximum size of the output exposed to the
+	// payload template
+	webhookStreamTail = 4096
+)
+
+// WebhookConfig configuration for the Webhook middleware
+type WebhookConfig struct {
+	WebhookURL             string `gcfg:"webhook-url" mapstructure:"webhook-url"`
+	WebhookOnlyOnError     bool   `gcfg:"webhook-only-on-error" mapstructure:"webhook-only-on-error"`
+	WebhookPayloadTemplate string `gcfg:"webhook-payload-template" mapstructure:"webhook-payload-template"`
+	WebhookContentType     string `gcfg:"webhook-content-type" mapstructure:"webhook-content-type"`
+	// WebhookNotifyOnRecovery posts when a job succeeds after a failure,
+	// even with WebhookOnlyOnError
+	WebhookNotifyOnRecovery bool `gcfg:"webhook-notify-on-recovery" mapstructure:"webhook-notify-on-recovery"`
+}
+
+// Validate checks the payload template, rendering it with empty values so
+// references to unknown fields are reported too
+func (c *WebhookConfig) Validate() error {
+	if c.WebhookPayloadTemplate == "" {
+		return nil
+	}
+
+	t, err := c.parseTemplate()
+	if err == nil {
+		err = t.Execute(io.Discard, &webhookData{})
+	}
+
+	if err != nil {
+		return fmt.Errorf("invalid webhook-payload-template: %w", err)
+	}
+
+	return nil
+}
+
+func (c *WebhookConfig) parseTemplate() (*template.Template, error) {
+	return template.New("webhook").Parse(c.WebhookPayloadTemplate)
+}
+
+// NewWebhook returns a Webhook middleware if the given configuration is not
+// empty, the payload template is parsed once, checked by Validate before
+func NewWebhook(c *WebhookConfig) core.Middleware {
+	var m core.Middleware
+	if !IsEmpty(c) {
+		w := &Webhook{WebhookConfig: *c, status: NewStatusTracker()}
+		if c.WebhookPayloadTemplate != "" {
+			w.template, w.templateErr = c.parseTemplate()
+		}
+
+		m = w
+	}
+
+	return m
+}
+
+// Webhook middleware posts the result of every execution of a job to an URL,
+// as JSON or rendered with the payload template
+type Webhook struct {
+	WebhookConfig
+	status  *StatusTracker
+	batcher *NotificationBatcher
+	// template is the parsed payload template, nil without one, templateErr
+	// is reported instead of posting if it couldn't be parsed
+	template    *template.Template
+	templateErr error
+}
+
+// EnableBatching groups the failures happening within the window into a
+// single post
+func (m *Webhook) EnableBatching(window time.Duration) *NotificationBatcher {
+	m.batcher = NewNotificationBatcher(window, m.pushBatch)
+	return m.batcher
+}
+
+// ContinueOnStop always returns true, the final status of the stopped
+// executions is posted too
+func (m *Webhook) ContinueOnStop() bool {
+	return true
+}
+
+// Run posts the payload to the webhook, the execution is stopped first so the
+// payload has its final status and duration
+func (m *Webhook) Run(ctx *core.Context) error {
+	err := ctx.Next()
+	ctx.Stop(err)
+
+	recovered := m.WebhookNotifyOnRecovery && m.status.Recovered(ctx.Job.GetName(), ctx.Execution)
+	if ctx.Execution.Failed && m.batcher != nil {
+		m.batcher.Add(ctx)
+	} else if ctx.Execution.Failed || (!m.WebhookOnlyOnError && !silentSuccess(ctx)) || recovered {
+		m.pushMessage(ctx, recovered)
+	}
+
+	return err
+}
+
+func (m *Webhook) pushMessage(ctx *core.Context, recovered bool) {
+	body, err := m.buildPayload(ctx, recovered)
+	if err != nil {
+		ctx.Logger.Errorf("Webhook error rendering the payload: %q", err)
+		return
+	}
+
+	contentType := m.WebhookContentType
+	if contentType == "" {
+		contentType = webhookContentType
+	}
+
+	m.post(ctx.Logger, contentType, body)
+}
+
+// pushBatch posts the failures of a batch as `{"failures": [...]}`, each
+// entry being the default payload, the payload template isn't used
+func (m *Webhook) pushBatch(logger core.Logger, failures []*BatchedFailure) {
+	batch := struct {
+		Failures []*webhookData `json:"failures"`
+	}{}
+
+	for _, f := range failures {
+		batch.Failures = append(batch.Failures, &webhookData{
+			JobName:    f.JobName,
+			Schedule:   f.Schedule,
+			Command:    f.Command,
+			ExitCode:   f.ExitCode,
+			Failed:     true,
+			StdoutTail: f.StdoutTail,
+			StderrTail: f.StderrTail,
+			Duration:   f.Duration,
+			Error:      f.Error,
+		})
+	}
+
+	body, _ := json.Marshal(batch)
+	m.post(logger, webhookContentType, body)
+}
+
+func (m *Webhook) post(logger core.Logger, contentType string, body []byte) {
+	r, err := http.Post(m.WebhookURL, contentType, bytes.NewReader(body))
+	if err != nil {
+		logger.Errorf("Webhook error calling %q error: %q", m.WebhookURL, err)
+		return
+	}
+	r.Body.Close()
+
+	if r.StatusCode >= 300 {
+		logger.Errorf("Webhook error non-2xx status code calling %q", m.WebhookURL)
+	}
+}
+
+func (m *Webhook) buildPayload(ctx *core.Context, recovered bool) ([]byte, error) {
+	data := newWebhookData(ctx)
+	data.Recovered = recovered
+	if m.templateErr != nil {
+		return nil, m.templateErr
+	}
+
+	if m.template == nil {
+		return json.Marshal(data)
+	}
+
+	var b bytes.Buffer
+	if err := m.template.Execute(&b, data); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// webhookData is the payload sent by default, and the data given to the
+// payload template
+type webhookData struct {
+	JobName     string        `json:"job_name"`
+	ExecutionID string        `json:"execution_id"`
+	Schedule    string        `json:"schedule"`
+	Command     string        `json:"command"`
+	ExitCode    int           `json:"exit_code"`
+	Failed      bool          `json:"failed"`
+	Skipped     bool          `json:"skipped"`
+	Recovered   bool          `json:"recovered"`
+	StdoutTail  string        `json:"stdout_tail"`
+	StderrTail  string        `json:"stderr_tail"`
+	Duration    time.Duration `json:"duration"`
+	Error       string        `json:"error,omitempty"`
+}
+
+func newWebhookData(ctx *core.Context) *webhookData {
+	d := &webhookData{
+		JobName:     ctx.Job.GetName(),
+		ExecutionID: ctx.Execution.ID,
+		Schedule:    ctx.Job.GetSchedule(),
+		Command:     ctx.Job.GetCommand(),
+		ExitCode:    core.ExitCode(ctx.Execution.Error),
+		Failed:      ctx.Execution.Failed,
+		Skipped:     ctx.Execution.Skipped,
+		StdoutTail:  streamTail(ctx.Execution, ctx.Execution.OutputStream, webhookStreamTail),
+		StderrTail:  streamTail(ctx.Execution, ctx.Execution.ErrorStream, webhookStreamTail),
+		Duration:    ctx.Execution.Duration,
+	}
+
+	if ctx.Execution.Error != nil {
+		d.Error = ctx.Execution.Error.Error()
+	}
+
+	return d
+}
@@ -0,0 +1,117 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/netresearch/ofelia/core"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteWebhook struct {
+	BaseSuite
+}
+
+var _ = Suite(&SuiteWebhook{})
+
+func (s *SuiteWebhook) TestNewWebhookEmpty(c *C) {
+	c.Assert(NewWebhook(&WebhookConfig{}), IsNil)
+}
+
+func (s *SuiteWebhook) TestRunDefaultPayload(c *C) {
+	var d webhookData
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.Header.Get("Content-Type"), Equals, "application/json")
+		json.NewDecoder(r.Body).Decode(&d)
+	}))
+
+	defer ts.Close()
+
+	s.job.Name = "foo"
+	s.ctx.Start()
+	s.ctx.Stop(&core.NonZeroExitError{ExitCode: 2})
+
+	m := NewWebhook(&WebhookConfig{WebhookURL: ts.URL})
+	c.Assert(m.Run(s.ctx), IsNil)
+	c.Assert(d.JobName, Equals, "foo")
+	c.Assert(d.ExecutionID, Equals, s.ctx.Execution.ID)
+	c.Assert(d.ExitCode, Equals, 2)
+	c.Assert(d.Failed, Equals, true)
+	c.Assert(d.Error, Equals, "error non-zero exit code: 2")
+}
+
+func (s *SuiteWebhook) TestRunTemplate(c *C) {
+	var body string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.Header.Get("Content-Type"), Equals, "text/plain")
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+	}))
+
+	defer ts.Close()
+
+	s.job.Name = "foo"
+	s.job.Schedule = "@hourly"
+	s.ctx.Start()
+	s.ctx.Execution.OutputStream.Write([]byte("out"))
+	s.ctx.Execution.ErrorStream.Write([]byte("err"))
+	s.ctx.Stop(errors.New("bar"))
+
+	m := NewWebhook(&WebhookConfig{
+		WebhookURL:             ts.URL,
+		WebhookContentType:     "text/plain",
+		WebhookPayloadTemplate: "{{.JobName}} {{.Schedule}} {{.ExitCode}} {{.StdoutTail}} {{.StderrTail}} {{.Error}}",
+	})
+	c.Assert(m.Run(s.ctx), IsNil)
+	c.Assert(body, Equals, "foo @hourly -1 out err bar")
+}
+
+func (s *SuiteWebhook) TestNewWebhookParsesTemplate(c *C) {
+	m := NewWebhook(&WebhookConfig{WebhookURL: "http://localhost", WebhookPayloadTemplate: "{{.JobName}}"}).(*Webhook)
+	c.Assert(m.template, NotNil)
+	c.Assert(m.templateErr, IsNil)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(true, Equals, false)
+	}))
+
+	defer ts.Close()
+
+	s.ctx.Start()
+	s.ctx.Stop(errors.New("bar"))
+
+	// a malformed template, not validated, is reported instead of posted
+	m = NewWebhook(&WebhookConfig{WebhookURL: ts.URL, WebhookPayloadTemplate: "{{.JobName"}).(*Webhook)
+	c.Assert(m.template, IsNil)
+	c.Assert(m.templateErr, NotNil)
+	c.Assert(m.Run(s.ctx), IsNil)
+}
+
+func (s *SuiteWebhook) TestRunSuccessOnError(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(true, Equals, false)
+	}))
+
+	defer ts.Close()
+
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+
+	m := NewWebhook(&WebhookConfig{WebhookURL: ts.URL, WebhookOnlyOnError: true})
+	c.Assert(m.Run(s.ctx), IsNil)
+}
+
+func (s *SuiteWebhook) TestValidate(c *C) {
+	c.Assert((&WebhookConfig{}).Validate(), IsNil)
+	c.Assert((&WebhookConfig{WebhookPayloadTemplate: "{{.JobName}} {{.Duration}}"}).Validate(), IsNil)
+
+	malformed := &WebhookConfig{WebhookPayloadTemplate: "{{.JobName"}
+	c.Assert(malformed.Validate(), ErrorMatches, "invalid webhook-payload-template.*")
+
+	missing := &WebhookConfig{WebhookPayloadTemplate: "{{.Foo}}"}
+	c.Assert(missing.Validate(), ErrorMatches, "invalid webhook-payload-template.*can't evaluate field Foo.*")
+}
@@ -28,6 +28,8 @@ func main() {
 	parser := flags.NewNamedParser("ofelia", flags.Default)
 	parser.AddCommand("daemon", "daemon process", "", &cli.DaemonCommand{Logger: logger})
 	parser.AddCommand("validate", "validates the config file", "", &cli.ValidateCommand{Logger: logger})
+	parser.AddCommand("list", "lists the jobs of the config file", "", &cli.ListCommand{Logger: logger})
+	parser.AddCommand("schema", "prints the JSON schema of the config", "", &cli.SchemaCommand{Logger: logger})
 
 	if _, err := parser.Parse(); err != nil {
 		if flagErr, ok := err.(*flags.Error); ok {